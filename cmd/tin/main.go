@@ -45,6 +45,12 @@ func main() {
 		err = commands.Amp(args)
 	case "codex":
 		err = commands.Codex(args)
+	case "claude":
+		err = commands.Claude(args)
+	case "cursor":
+		err = commands.Cursor(args)
+	case "aider":
+		err = commands.Aider(args)
 	case "agents":
 		err = commands.Agents(args)
 	case "hook":
@@ -62,6 +68,8 @@ func main() {
 		err = commands.Serve(args)
 	case "serve-http":
 		err = commands.ServeHTTP(args)
+	case "server":
+		err = commands.Server(args)
 	case "config":
 		err = commands.Config(args)
 	case "version", "--version", "-v":
@@ -98,9 +106,12 @@ Commands:
 
 Agent integrations:
   hooks       Manage hooks for AI agents (Claude Code, Cursor)
-  agents      List and manage agent integrations
+  agents      List, inspect and watch agent integrations
   amp         Manage AMP agent integration (pull threads)
-  codex       Manage Codex CLI integration (notifications)
+  codex       Manage Codex CLI integration and import sessions
+  claude      Import Claude Code history from transcripts
+  cursor      Import Cursor chat history from its local database
+  aider       Import Aider chat history and link it to Aider's commits
 
 Remote commands:
   remote      Manage remote repositories
@@ -108,6 +119,7 @@ Remote commands:
   pull        Pull commits and threads from remote
   serve       Start a tin server (TCP protocol)
   serve-http  Start a tin HTTP server (HTTPS with Basic Auth)
+  server      Administer a tin server (API tokens)
   config      View and modify configuration
 
 Options:
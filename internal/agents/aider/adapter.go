@@ -0,0 +1,125 @@
+// Package aider provides the Aider agent integration for Tin.
+// It implements the PullAdapter interface for importing Aider's chat
+// history.
+//
+// Aider keeps no session store of its own: it appends each session to
+// .aider.chat.history.md in the repository, and each prompt, with the time
+// it was sent, to .aider.input.history. Sessions are rebuilt from the two,
+// and linked to the commits Aider makes after each edit.
+package aider
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sestinj/tin/internal/agents"
+	"github.com/sestinj/tin/internal/model"
+)
+
+const (
+	agentName        = "aider"
+	agentDisplayName = "Aider"
+)
+
+// Adapter implements agents.PullAdapter for Aider. It reads the history of
+// the git repository containing the current directory.
+type Adapter struct{}
+
+// NewAdapter creates a new Aider adapter
+func NewAdapter() *Adapter {
+	return &Adapter{}
+}
+
+// Info returns metadata about the Aider agent
+func (a *Adapter) Info() agents.AgentInfo {
+	return agents.AgentInfo{
+		Name:        agentName,
+		DisplayName: agentDisplayName,
+		Paradigm:    agents.ParadigmPull,
+		Version:     "1.0.0",
+	}
+}
+
+// List returns the session IDs of the chat history, most recent first
+func (a *Adapter) List(limit int) ([]string, error) {
+	threads, err := loadThreads()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for i := len(threads) - 1; i >= 0; i-- {
+		if limit > 0 && len(ids) >= limit {
+			break
+		}
+		ids = append(ids, threads[i].AgentSessionID)
+	}
+	return ids, nil
+}
+
+// Pull returns the session with the given ID
+func (a *Adapter) Pull(threadID string, opts agents.PullOptions) (*model.Thread, error) {
+	threads, err := loadThreads()
+	if err != nil {
+		return nil, err
+	}
+	for _, thread := range threads {
+		if thread.AgentSessionID == threadID {
+			return thread, nil
+		}
+	}
+	return nil, fmt.Errorf("no aider session %s in the chat history", threadID)
+}
+
+// PullRecent returns the N most recent sessions, most recent first
+func (a *Adapter) PullRecent(count int, opts agents.PullOptions) ([]*model.Thread, error) {
+	threads, err := loadThreads()
+	if err != nil {
+		return nil, err
+	}
+
+	var recent []*model.Thread
+	for i := len(threads) - 1; i >= 0; i-- {
+		if count > 0 && len(recent) >= count {
+			break
+		}
+		thread := threads[i]
+		if opts.Since != nil && thread.CompletedAt != nil && thread.CompletedAt.Before(*opts.Since) {
+			continue
+		}
+		recent = append(recent, thread)
+	}
+	return recent, nil
+}
+
+// loadThreads reads the sessions of the repository containing the current
+// directory. A repository Aider has not been used in has none.
+func loadThreads() ([]*model.Thread, error) {
+	root, err := RepoRoot()
+	if err != nil {
+		return nil, err
+	}
+	threads, err := LoadThreads(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return threads, err
+}
+
+// RepoRoot returns the root of the git repository containing the current
+// directory, where Aider keeps its history, or the current directory
+// outside one
+func RepoRoot() (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	if output, err := cmd.Output(); err == nil {
+		return strings.TrimSpace(string(output)), nil
+	}
+	return os.Getwd()
+}
+
+// Register this adapter with the global registry
+func init() {
+	agents.Register(NewAdapter())
+}
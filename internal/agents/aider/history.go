@@ -0,0 +1,499 @@
+package aider
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+const (
+	// ChatHistoryFile is the transcript Aider appends each session to, in
+	// the root of the repository
+	ChatHistoryFile = ".aider.chat.history.md"
+	// InputHistoryFile is Aider's prompt history, which records when each
+	// prompt was sent
+	InputHistoryFile = ".aider.input.history"
+
+	sessionHeader   = "# aider chat started at "
+	promptPrefix    = "#### "
+	outputPrefix    = "> "
+	chatTimeLayout  = "2006-01-02 15:04:05"
+	inputTimeLayout = "2006-01-02 15:04:05.999999"
+
+	// commitSlack is how far outside a turn an auto-commit may be dated and
+	// still be matched to it by its message
+	commitSlack = time.Minute
+)
+
+// promptCommands are the Aider commands whose argument is a prompt to the
+// model. Other commands only change Aider's state and are not recorded.
+var promptCommands = map[string]bool{
+	"/ask":       true,
+	"/code":      true,
+	"/architect": true,
+}
+
+// Session is an Aider chat session, as recorded in the chat history
+type Session struct {
+	ID        string // Derived from the start time, unique within the history
+	StartedAt time.Time
+	Turns     []Turn
+}
+
+// Turn is a prompt and everything Aider did in response to it
+type Turn struct {
+	Prompt   string
+	Response string   // The model's reply
+	Edits    []Edit   // Edits Aider applied
+	Commits  []Commit // Commits Aider reported making
+}
+
+// Edit is an edit Aider applied to a file. Old and New are set for edits in
+// the search/replace format.
+type Edit struct {
+	Path string
+	Old  string
+	New  string
+}
+
+// Commit is a git commit, as reported by Aider or as read from git
+type Commit struct {
+	Hash    string // Abbreviated in the chat history
+	Subject string
+	Time    time.Time // Zero in the chat history
+}
+
+// InputEntry is a prompt from the input history
+type InputEntry struct {
+	Time   time.Time
+	Prompt string
+}
+
+// HistoryOptions selects what BuildThreads links the sessions to
+type HistoryOptions struct {
+	Inputs  []InputEntry // Prompt times
+	Commits []Commit     // Commits to link turns to, from GitCommits
+}
+
+// HistoryPaths returns the chat and input history files of the repository
+// at root. Like Aider, it honors $AIDER_CHAT_HISTORY_FILE and
+// $AIDER_INPUT_HISTORY_FILE.
+func HistoryPaths(root string) (chat, input string) {
+	chat, input = ChatHistoryFile, InputHistoryFile
+	if path := os.Getenv("AIDER_CHAT_HISTORY_FILE"); path != "" {
+		chat = path
+	}
+	if path := os.Getenv("AIDER_INPUT_HISTORY_FILE"); path != "" {
+		input = path
+	}
+	if !filepath.IsAbs(chat) {
+		chat = filepath.Join(root, chat)
+	}
+	if !filepath.IsAbs(input) {
+		input = filepath.Join(root, input)
+	}
+	return chat, input
+}
+
+// LoadThreads reads the Aider history of the repository at root and returns
+// a thread for each session, oldest first. Assistant messages are linked to
+// the commits Aider made for them.
+func LoadThreads(root string) ([]*model.Thread, error) {
+	chatPath, inputPath := HistoryPaths(root)
+	chat, err := os.Open(chatPath)
+	if err != nil {
+		return nil, err
+	}
+	defer chat.Close()
+	sessions, err := ParseChatHistory(chat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", chatPath, err)
+	}
+
+	var opts HistoryOptions
+	// Both are optional: without them, turns fall back to session times and
+	// are not linked to commits
+	if input, err := os.Open(inputPath); err == nil {
+		opts.Inputs, err = ParseInputHistory(input)
+		input.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", inputPath, err)
+		}
+	}
+	opts.Commits, _ = GitCommits(root)
+
+	return BuildThreads(sessions, opts), nil
+}
+
+// ParseChatHistory splits Aider's chat history into sessions. Sessions
+// without prompts are left out.
+func ParseChatHistory(r io.Reader) ([]*Session, error) {
+	var sessions []*Session
+	var session *Session
+	var turn *Turn
+	var response []string
+	seen := make(map[string]int)
+
+	endTurn := func() {
+		if turn != nil {
+			turn.Response = strings.TrimSpace(strings.Join(response, "\n"))
+			turn.Edits = attachBlocks(turn.Edits, response)
+			session.Turns = append(session.Turns, *turn)
+		}
+		turn, response = nil, nil
+	}
+	endSession := func() {
+		endTurn()
+		if session != nil && len(session.Turns) > 0 {
+			sessions = append(sessions, session)
+		}
+		session = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	inPrompt := false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+
+		if rest, ok := strings.CutPrefix(line, sessionHeader); ok {
+			endSession()
+			started, err := time.ParseInLocation(chatTimeLayout, strings.TrimSpace(rest), time.Local)
+			if err != nil {
+				continue // Not a session header after all
+			}
+			id := "aider-" + started.UTC().Format("20060102T150405Z")
+			if seen[id]++; seen[id] > 1 {
+				id += "-" + strconv.Itoa(seen[id])
+			}
+			session = &Session{ID: id, StartedAt: started}
+			inPrompt = false
+			continue
+		}
+		if session == nil {
+			continue
+		}
+
+		// Empty prompt lines lose their trailing space
+		if prompt, ok := strings.CutPrefix(line+" ", promptPrefix); ok {
+			prompt = strings.TrimSuffix(prompt, " ")
+			// Multi-line prompts are recorded a line at a time
+			if inPrompt && turn != nil {
+				turn.Prompt += "\n" + prompt
+				continue
+			}
+			endTurn()
+			turn = &Turn{Prompt: prompt}
+			inPrompt = true
+			continue
+		}
+		inPrompt = false
+		if turn == nil {
+			continue // Aider's startup output
+		}
+
+		// A bare ">" is an empty output line
+		if output, ok := strings.CutPrefix(line+" ", outputPrefix); ok {
+			output = strings.TrimSpace(output)
+			if path, ok := strings.CutPrefix(output, "Applied edit to "); ok {
+				turn.Edits = append(turn.Edits, Edit{Path: path})
+			} else if commit, ok := parseCommitLine(output); ok {
+				turn.Commits = append(turn.Commits, commit)
+			}
+			continue
+		}
+		response = append(response, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	endSession()
+
+	// Commands that are not prompts leave no trace
+	for _, s := range sessions {
+		turns := s.Turns[:0]
+		for _, t := range s.Turns {
+			if prompt, ok := promptText(t.Prompt); ok {
+				t.Prompt = prompt
+				turns = append(turns, t)
+			}
+		}
+		s.Turns = turns
+	}
+	kept := sessions[:0]
+	for _, s := range sessions {
+		if len(s.Turns) > 0 {
+			kept = append(kept, s)
+		}
+	}
+	return kept, nil
+}
+
+// promptText returns the prompt a turn sent to the model, if it sent one
+func promptText(prompt string) (string, bool) {
+	prompt = strings.TrimSpace(prompt)
+	if !strings.HasPrefix(prompt, "/") {
+		return prompt, prompt != ""
+	}
+	command, rest, _ := strings.Cut(prompt, " ")
+	rest = strings.TrimSpace(rest)
+	return rest, promptCommands[command] && rest != ""
+}
+
+// parseCommitLine parses Aider's report of an auto-commit:
+// "Commit <hash> <message>"
+func parseCommitLine(output string) (Commit, bool) {
+	rest, ok := strings.CutPrefix(output, "Commit ")
+	if !ok {
+		return Commit{}, false
+	}
+	hash, subject, _ := strings.Cut(rest, " ")
+	if len(hash) < 7 || strings.Trim(hash, "0123456789abcdef") != "" {
+		return Commit{}, false
+	}
+	return Commit{Hash: hash, Subject: strings.TrimSpace(subject)}, true
+}
+
+// attachBlocks fills in the search and replace text of edits from the
+// search/replace blocks of the response that edited them. Edits made in
+// other formats keep only their path.
+func attachBlocks(edits []Edit, response []string) []Edit {
+	if len(edits) == 0 {
+		return edits
+	}
+	blocks := make(map[string][]Edit)
+	var path string
+	var block *Edit
+	inReplace := false
+	for _, line := range response {
+		switch {
+		case strings.HasPrefix(line, "<<<<<<< SEARCH"):
+			block, inReplace = &Edit{Path: path}, false
+		case block != nil && strings.HasPrefix(line, "======="):
+			inReplace = true
+		case block != nil && strings.HasPrefix(line, ">>>>>>> REPLACE"):
+			blocks[block.Path] = append(blocks[block.Path], *block)
+			block = nil
+		case block != nil && inReplace:
+			block.New += line + "\n"
+		case block != nil:
+			block.Old += line + "\n"
+		case strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "```"):
+			// The file name comes on the line before the block's fence
+			path = strings.Trim(strings.TrimSpace(line), "`*")
+		}
+	}
+
+	var result []Edit
+	for _, edit := range edits {
+		if found := blocks[edit.Path]; len(found) > 0 {
+			result = append(result, found...)
+			delete(blocks, edit.Path)
+			continue
+		}
+		result = append(result, edit)
+	}
+	return result
+}
+
+// ParseInputHistory reads Aider's input history: each prompt is a
+// "# <time>" line followed by its lines, each prefixed with "+"
+func ParseInputHistory(r io.Reader) ([]InputEntry, error) {
+	var entries []InputEntry
+	var entry *InputEntry
+	flush := func() {
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+		entry = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if stamp, ok := strings.CutPrefix(line, "# "); ok {
+			flush()
+			if t, err := time.ParseInLocation(inputTimeLayout, strings.TrimSpace(stamp), time.Local); err == nil {
+				entry = &InputEntry{Time: t}
+			}
+			continue
+		}
+		if text, ok := strings.CutPrefix(line, "+"); ok && entry != nil {
+			if entry.Prompt != "" {
+				entry.Prompt += "\n"
+			}
+			entry.Prompt += text
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return entries, nil
+}
+
+// GitCommits returns the commits of the git repository at root, on any
+// branch
+func GitCommits(root string) ([]Commit, error) {
+	cmd := exec.Command("git", "log", "--all", "--format=%H%x00%ct%x00%s")
+	cmd.Dir = root
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []Commit
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		commits = append(commits, Commit{Hash: fields[0], Subject: fields[2], Time: time.Unix(seconds, 0)})
+	}
+	return commits, nil
+}
+
+// BuildThreads turns sessions into threads. Prompts are dated from the input
+// history, and assistant messages are linked to the commits Aider made for
+// them through GitHashAfter.
+func BuildThreads(sessions []*Session, opts HistoryOptions) []*model.Thread {
+	var threads []*model.Thread
+	inputs := opts.Inputs
+	for i, session := range sessions {
+		// A session ends where the next begins
+		var end time.Time
+		if i+1 < len(sessions) {
+			end = sessions[i+1].StartedAt
+		}
+
+		thread := model.NewThread(agentName, session.ID, "", "")
+		thread.Status = model.ThreadStatusCompleted
+
+		times := make([]time.Time, len(session.Turns))
+		last := session.StartedAt
+		for j, turn := range session.Turns {
+			var sent time.Time
+			sent, inputs = promptTime(inputs, turn.Prompt, last, end)
+			if sent.IsZero() {
+				sent = last
+			}
+			times[j], last = sent, sent
+		}
+
+		for j, turn := range session.Turns {
+			human := &model.Message{Role: model.RoleHuman, Content: turn.Prompt, Timestamp: times[j].UTC()}
+			addMessage(thread, human)
+
+			if turn.Response == "" && len(turn.Edits) == 0 && len(turn.Commits) == 0 {
+				continue
+			}
+			turnEnd := end
+			if j+1 < len(session.Turns) {
+				turnEnd = times[j+1]
+			}
+			assistant := &model.Message{
+				Role:      model.RoleAssistant,
+				Content:   turn.Response,
+				Timestamp: times[j].UTC(),
+				ToolCalls: editCalls(turn.Edits),
+			}
+			for _, reported := range turn.Commits {
+				if commit, ok := matchCommit(opts.Commits, reported, times[j], turnEnd); ok {
+					assistant.GitHashAfter = commit.Hash
+					if commit.Time.After(times[j]) {
+						assistant.Timestamp = commit.Time.UTC()
+					}
+				}
+			}
+			addMessage(thread, assistant)
+		}
+
+		if len(thread.Messages) > 0 {
+			thread.StartedAt = thread.Messages[0].Timestamp
+			completed := thread.Messages[len(thread.Messages)-1].Timestamp
+			thread.CompletedAt = &completed
+		}
+		threads = append(threads, thread)
+	}
+	return threads
+}
+
+// addMessage appends a message to a thread, deriving its ID
+func addMessage(thread *model.Thread, msg *model.Message) {
+	if len(thread.Messages) == 0 {
+		msg.ID = msg.ComputeHash()
+	}
+	thread.AddMessage(msg)
+}
+
+// promptTime finds when a prompt was sent in the input history: the first
+// entry for it from after the previous prompt, and before the session ended
+// (if end is set). It returns the remaining entries, which later prompts
+// are looked up in.
+func promptTime(inputs []InputEntry, prompt string, after, end time.Time) (time.Time, []InputEntry) {
+	for i, entry := range inputs {
+		if !end.IsZero() && entry.Time.After(end) {
+			break
+		}
+		if entry.Time.Before(after) {
+			continue
+		}
+		if entryPrompt, ok := promptText(entry.Prompt); ok && entryPrompt == prompt {
+			return entry.Time, inputs[i+1:]
+		}
+	}
+	return time.Time{}, inputs
+}
+
+// matchCommit finds the commit Aider reported in the repository's history.
+// The abbreviated hash identifies it while the commit still exists; after a
+// rebase or amend, a commit with the same message made during the turn is
+// taken to be its replacement.
+func matchCommit(commits []Commit, reported Commit, start, end time.Time) (Commit, bool) {
+	for _, commit := range commits {
+		if strings.HasPrefix(commit.Hash, reported.Hash) {
+			return commit, true
+		}
+	}
+	for _, commit := range commits {
+		if reported.Subject == "" || commit.Subject != reported.Subject || commit.Time.Before(start.Add(-commitSlack)) {
+			continue
+		}
+		if end.IsZero() || !commit.Time.After(end.Add(commitSlack)) {
+			return commit, true
+		}
+	}
+	return Commit{}, false
+}
+
+// editCalls records the edits Aider applied as edit tool calls
+func editCalls(edits []Edit) []model.ToolCall {
+	var calls []model.ToolCall
+	for i, edit := range edits {
+		args := map[string]string{"path": edit.Path}
+		if edit.Old != "" || edit.New != "" {
+			args["old_string"], args["new_string"] = edit.Old, edit.New
+		}
+		data, _ := json.Marshal(args)
+		calls = append(calls, model.ToolCall{
+			ID:        fmt.Sprintf("edit-%d", i+1),
+			Name:      "edit",
+			Arguments: data,
+		})
+	}
+	return calls
+}
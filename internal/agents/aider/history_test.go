@@ -0,0 +1,265 @@
+package aider
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testChatHistory = `
+# aider chat started at 2025-09-01 10:00:00
+
+> /usr/local/bin/aider --model gpt-4o
+> Aider v0.86.1
+> Git repo: .git with 3 files
+
+#### /add main.py
+> Added main.py to the chat
+
+#### add a hello function
+#### and call it from main
+
+I'll add the function.
+
+main.py
+` + "```" + `python
+<<<<<<< SEARCH
+def main():
+    pass
+=======
+def hello():
+    print("hello")
+
+def main():
+    hello()
+>>>>>>> REPLACE
+` + "```" + `
+
+> Tokens: 2.1k sent, 80 received.
+> Applied edit to main.py
+> Commit 1a2b3c4 feat: Add hello function
+> You can use /undo to undo and discard each aider commit.
+
+#### /ask what does main do?
+
+It calls hello.
+
+# aider chat started at 2025-09-01 11:00:00
+
+> Aider v0.86.1
+
+#### /exit
+
+# aider chat started at 2025-09-01 12:00:00
+
+#### fix the typo
+
+Done.
+
+> Applied edit to README.md
+> Commit 9f8e7d6 docs: Fix typo in README
+`
+
+const testInputHistory = `
+# 2025-09-01 10:00:05.100000
++/add main.py
+
+# 2025-09-01 10:00:20.250000
++add a hello function
++and call it from main
+
+# 2025-09-01 10:01:30.000000
++/ask what does main do?
+
+# 2025-09-01 11:00:04.000000
++/exit
+
+# 2025-09-01 12:00:10.000000
++fix the typo
+`
+
+func localTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation(inputTimeLayout, value, time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestParseChatHistory(t *testing.T) {
+	sessions, err := ParseChatHistory(strings.NewReader(testChatHistory))
+	if err != nil {
+		t.Fatalf("ParseChatHistory failed: %v", err)
+	}
+	// The session that only ran /exit is left out
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	first := sessions[0]
+	if !first.StartedAt.Equal(localTime(t, "2025-09-01 10:00:00")) {
+		t.Errorf("StartedAt = %v", first.StartedAt)
+	}
+	if first.ID != "aider-"+first.StartedAt.UTC().Format("20060102T150405Z") {
+		t.Errorf("ID = %s", first.ID)
+	}
+	if len(first.Turns) != 2 {
+		t.Fatalf("expected /add to be dropped, got turns %+v", first.Turns)
+	}
+
+	turn := first.Turns[0]
+	if turn.Prompt != "add a hello function\nand call it from main" {
+		t.Errorf("Prompt = %q", turn.Prompt)
+	}
+	if !strings.HasPrefix(turn.Response, "I'll add the function.") || strings.Contains(turn.Response, "Tokens:") {
+		t.Errorf("Response = %q", turn.Response)
+	}
+	if len(turn.Edits) != 1 || turn.Edits[0].Path != "main.py" || turn.Edits[0].Old != "def main():\n    pass\n" ||
+		!strings.Contains(turn.Edits[0].New, "def hello():") {
+		t.Errorf("Edits = %+v", turn.Edits)
+	}
+	if len(turn.Commits) != 1 || turn.Commits[0].Hash != "1a2b3c4" || turn.Commits[0].Subject != "feat: Add hello function" {
+		t.Errorf("Commits = %+v", turn.Commits)
+	}
+	if ask := first.Turns[1]; ask.Prompt != "what does main do?" || ask.Response != "It calls hello." {
+		t.Errorf("/ask turn = %+v", ask)
+	}
+
+	// An edit without a search/replace block keeps only its path
+	if edits := sessions[1].Turns[0].Edits; len(edits) != 1 || edits[0].Path != "README.md" || edits[0].Old != "" {
+		t.Errorf("Edits = %+v", edits)
+	}
+}
+
+func TestParseChatHistory_DuplicateStart(t *testing.T) {
+	history := "# aider chat started at 2025-09-01 10:00:00\n#### one\n" +
+		"# aider chat started at 2025-09-01 10:00:00\n#### two\n"
+	sessions, err := ParseChatHistory(strings.NewReader(history))
+	if err != nil {
+		t.Fatalf("ParseChatHistory failed: %v", err)
+	}
+	if len(sessions) != 2 || sessions[1].ID != sessions[0].ID+"-2" {
+		t.Errorf("sessions = %+v", sessions)
+	}
+}
+
+func TestParseInputHistory(t *testing.T) {
+	entries, err := ParseInputHistory(strings.NewReader(testInputHistory))
+	if err != nil {
+		t.Fatalf("ParseInputHistory failed: %v", err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(entries))
+	}
+	if entries[1].Prompt != "add a hello function\nand call it from main" || !entries[1].Time.Equal(localTime(t, "2025-09-01 10:00:20.25")) {
+		t.Errorf("entry = %+v", entries[1])
+	}
+}
+
+func TestBuildThreads(t *testing.T) {
+	sessions, _ := ParseChatHistory(strings.NewReader(testChatHistory))
+	inputs, _ := ParseInputHistory(strings.NewReader(testInputHistory))
+	helloTime := localTime(t, "2025-09-01 10:00:45")
+	commits := []Commit{
+		{Hash: "1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b", Subject: "feat: Add hello function", Time: helloTime},
+		// The README commit was amended: only its message matches
+		{Hash: "5555555555555555555555555555555555555555", Subject: "docs: Fix typo in README", Time: localTime(t, "2025-09-01 12:00:30")},
+		{Hash: "6666666666666666666666666666666666666666", Subject: "docs: Fix typo in README", Time: localTime(t, "2025-08-01 12:00:30")},
+	}
+
+	threads := BuildThreads(sessions, HistoryOptions{Inputs: inputs, Commits: commits})
+	if len(threads) != 2 {
+		t.Fatalf("expected 2 threads, got %d", len(threads))
+	}
+
+	thread := threads[0]
+	if thread.Agent != "aider" || thread.AgentSessionID != sessions[0].ID || thread.Status != "completed" {
+		t.Errorf("thread = %+v", thread)
+	}
+	if len(thread.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(thread.Messages))
+	}
+	if thread.ID != thread.Messages[0].ID || thread.Messages[1].ParentMessageID != thread.Messages[0].ID {
+		t.Error("messages are not chained from the thread ID")
+	}
+
+	prompt, reply, ask := thread.Messages[0], thread.Messages[1], thread.Messages[2]
+	if !prompt.Timestamp.Equal(localTime(t, "2025-09-01 10:00:20.25")) || !thread.StartedAt.Equal(prompt.Timestamp) {
+		t.Errorf("prompt timestamp = %v", prompt.Timestamp)
+	}
+	if reply.GitHashAfter != commits[0].Hash || !reply.Timestamp.Equal(helloTime) {
+		t.Errorf("reply = %+v", reply)
+	}
+	if len(reply.ToolCalls) != 1 || reply.ToolCalls[0].Name != "edit" {
+		t.Fatalf("tool calls = %+v", reply.ToolCalls)
+	}
+	var args map[string]string
+	json.Unmarshal(reply.ToolCalls[0].Arguments, &args)
+	if args["path"] != "main.py" || args["old_string"] != "def main():\n    pass\n" {
+		t.Errorf("arguments = %v", args)
+	}
+	if !ask.Timestamp.Equal(localTime(t, "2025-09-01 10:01:30")) || thread.Messages[3].GitHashAfter != "" {
+		t.Errorf("ask = %+v", ask)
+	}
+
+	if reply := threads[1].Messages[1]; reply.GitHashAfter != commits[1].Hash {
+		t.Errorf("expected the amended commit made during the turn, got %q", reply.GitHashAfter)
+	}
+}
+
+func TestBuildThreads_NoInputHistory(t *testing.T) {
+	sessions, _ := ParseChatHistory(strings.NewReader(testChatHistory))
+	threads := BuildThreads(sessions, HistoryOptions{})
+	for _, msg := range threads[0].Messages {
+		if !msg.Timestamp.Equal(sessions[0].StartedAt) || msg.GitHashAfter != "" {
+			t.Errorf("message = %+v", msg)
+		}
+	}
+}
+
+func TestLoadThreads(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=aider", "GIT_AUTHOR_EMAIL=aider@example.com",
+			"GIT_COMMITTER_NAME=aider", "GIT_COMMITTER_EMAIL=aider@example.com",
+			"GIT_COMMITTER_DATE="+localTime(t, "2025-09-01 12:00:20").Format(time.RFC3339))
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v failed: %v", args, err)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("tin\n"), 0644)
+	git("add", "README.md")
+	git("commit", "-q", "-m", "docs: Fix typo in README")
+	hash := git("rev-parse", "HEAD")
+
+	history := "# aider chat started at 2025-09-01 12:00:00\n#### fix the typo\nDone.\n> Applied edit to README.md\n> Commit " +
+		hash[:7] + " docs: Fix typo in README\n"
+	os.WriteFile(filepath.Join(dir, ChatHistoryFile), []byte(history), 0644)
+	t.Setenv("AIDER_CHAT_HISTORY_FILE", "")
+	t.Setenv("AIDER_INPUT_HISTORY_FILE", "")
+
+	threads, err := LoadThreads(dir)
+	if err != nil {
+		t.Fatalf("LoadThreads failed: %v", err)
+	}
+	if len(threads) != 1 || len(threads[0].Messages) != 2 {
+		t.Fatalf("threads = %+v", threads)
+	}
+	if reply := threads[0].Messages[1]; reply.GitHashAfter != hash {
+		t.Errorf("GitHashAfter = %q, want %s", reply.GitHashAfter, hash)
+	}
+	if threads[0].LastGitHash() != hash {
+		t.Errorf("LastGitHash = %q", threads[0].LastGitHash())
+	}
+}
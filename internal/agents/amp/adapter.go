@@ -1,5 +1,9 @@
 // Package amp provides the AMP (Sourcegraph) agent integration for Tin.
 // It implements the PullAdapter interface for batch thread import.
+//
+// Threads are read from the amp CLI's JSON output where it provides it,
+// which keeps tool calls and message times; the rendered markdown and
+// thread list table are only parsed as a fallback.
 package amp
 
 import (
@@ -38,22 +42,58 @@ func (a *Adapter) Info() agents.AgentInfo {
 	}
 }
 
-// List returns available thread IDs from AMP
+// List returns available thread IDs from AMP, most recent first
 func (a *Adapter) List(limit int) ([]string, error) {
 	if limit <= 0 {
 		limit = 100 // Default limit
 	}
 
-	cmd := exec.Command("amp", "threads", "list")
-	output, err := cmd.Output()
+	if output, err := runAmp("threads", "list", "--json"); err == nil {
+		if threadIDs, err := parseThreadListJSON(output, limit); err == nil {
+			return threadIDs, nil
+		}
+	}
+
+	output, err := runAmp("threads", "list")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list amp threads: %w", err)
 	}
+	return parseThreadList(string(output), limit), nil
+}
+
+// parseThreadListJSON returns the thread IDs of the JSON thread list: an
+// array of threads, or an object holding one
+func parseThreadListJSON(output []byte, limit int) ([]string, error) {
+	var threads []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(output, &threads); err != nil {
+		var wrapped struct {
+			Threads json.RawMessage `json:"threads"`
+		}
+		if json.Unmarshal(output, &wrapped) != nil || wrapped.Threads == nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(wrapped.Threads, &threads); err != nil {
+			return nil, err
+		}
+	}
 
+	var threadIDs []string
+	for _, t := range threads {
+		if t.ID != "" && len(threadIDs) < limit {
+			threadIDs = append(threadIDs, t.ID)
+		}
+	}
+	return threadIDs, nil
+}
+
+// parseThreadList returns the thread IDs of the thread list table
+func parseThreadList(output string, limit int) []string {
 	// Parse the output to extract thread IDs
 	// Format: Title | Last Updated | Visibility | Messages | Thread ID
 	var threadIDs []string
-	lines := strings.Split(string(output), "\n")
+	lines := strings.Split(output, "\n")
 
 	// Skip header lines (first two lines are header and separator)
 	for i, line := range lines {
@@ -71,7 +111,7 @@ func (a *Adapter) List(limit int) ([]string, error) {
 		}
 	}
 
-	return threadIDs, nil
+	return threadIDs
 }
 
 // Pull fetches a specific thread by ID
@@ -81,16 +121,27 @@ func (a *Adapter) Pull(threadID string, opts agents.PullOptions) (*model.Thread,
 		threadID = strings.TrimPrefix(threadID, "https://ampcode.com/threads/")
 	}
 
-	// Fetch the thread markdown from amp CLI
-	markdown, err := fetchThreadMarkdown(threadID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch thread %s: %w", threadID, err)
+	// Prefer the structured export, and fall back to the rendered markdown
+	// for amp versions without it
+	var thread *model.Thread
+	if data, err := runAmp("threads", "export", threadID); err == nil {
+		thread, err = parseThreadJSON(data, threadID, opts.IncludeGit)
+		if err != nil {
+			thread = nil
+		}
 	}
-
-	// Parse the markdown into a tin Thread
-	thread, err := parseMarkdown(markdown, threadID, opts.IncludeGit)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse thread %s: %w", threadID, err)
+	if thread == nil {
+		markdown, err := runAmp("threads", "markdown", threadID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch thread %s: %w", threadID, err)
+		}
+		thread, err = parseMarkdown(string(markdown), threadID, opts.IncludeGit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse thread %s: %w", threadID, err)
+		}
+	}
+	if thread.AgentSessionID == "" {
+		thread.AgentSessionID = threadID
 	}
 
 	return thread, nil
@@ -111,33 +162,34 @@ func (a *Adapter) PullRecent(count int, opts agents.PullOptions) ([]*model.Threa
 			fmt.Fprintf(os.Stderr, "Warning: failed to pull thread %s: %v\n", id, err)
 			continue
 		}
+		// Threads rebuilt from markdown have no message times, and always
+		// count as updated
+		if opts.Since != nil && thread.CompletedAt != nil && thread.CompletedAt.Before(*opts.Since) {
+			continue
+		}
 		threads = append(threads, thread)
 	}
 
 	return threads, nil
 }
 
-func fetchThreadMarkdown(threadID string) (string, error) {
+// runAmp runs the amp CLI and returns its output
+func runAmp(args ...string) ([]byte, error) {
 	// Write to temp file to work around amp CLI truncating output when piped
-	tmpFile, err := os.CreateTemp("", "amp-thread-*.md")
+	tmpFile, err := os.CreateTemp("", "amp-output-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
-	}
-	tmpPath := tmpFile.Name()
-	tmpFile.Close()
-	defer os.Remove(tmpPath)
-
-	// Use shell redirection to write to file
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("amp threads markdown %s > %s", threadID, tmpPath))
-	if err := cmd.Run(); err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
+	defer os.Remove(tmpFile.Name())
 
-	data, err := os.ReadFile(tmpPath)
+	cmd := exec.Command("amp", args...)
+	cmd.Stdout = tmpFile
+	err = cmd.Run()
+	tmpFile.Close()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return string(data), nil
+	return os.ReadFile(tmpFile.Name())
 }
 
 func parseMarkdown(markdown string, ampThreadID string, includeGit bool) (*model.Thread, error) {
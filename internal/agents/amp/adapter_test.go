@@ -1,7 +1,11 @@
 package amp
 
 import (
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/sestinj/tin/internal/agents"
 	"github.com/sestinj/tin/internal/model"
@@ -343,3 +347,180 @@ Response
 		t.Errorf("expected 2 messages with whitespace handling, got %d", len(thread.Messages))
 	}
 }
+
+// A thread as recorded from `amp threads export`
+const testThreadExport = `{
+  "v": 42,
+  "id": "T-0199a1b2-c3d4-7000-8000-123456789abc",
+  "created": 1756720800000,
+  "title": "Fix typo",
+  "messages": [
+    {"role": "user", "messageId": 0, "content": [{"type": "text", "text": "fix the typo in README"}], "meta": {"sentAt": 1756720801000}},
+    {"role": "assistant", "messageId": 1, "content": [
+      {"type": "thinking", "thinking": "grep first", "signature": "abc"},
+      {"type": "text", "text": "Let me find it."},
+      {"type": "tool_use", "id": "toolu_1", "name": "Bash", "input": {"cmd": "grep -rn teh ."}},
+      {"type": "tool_use", "id": "toolu_2", "name": "Read", "input": {"path": "/work/repo/README.md"}}
+    ], "state": {"type": "complete", "stopReason": "tool_use"}},
+    {"role": "user", "messageId": 2, "content": [
+      {"type": "tool_result", "toolUseID": "toolu_1", "run": {"status": "done", "result": {"output": "README.md:1:teh", "exitCode": 0}}},
+      {"type": "tool_result", "toolUseID": "toolu_2", "run": {"status": "done", "result": "1: teh"}}
+    ], "meta": {"sentAt": 1756720803000}},
+    {"role": "assistant", "messageId": 3, "content": [
+      {"type": "tool_use", "id": "toolu_3", "name": "edit_file", "input": {"path": "/work/repo/README.md", "old_str": "teh", "new_str": "the"}}
+    ]},
+    {"role": "user", "messageId": 4, "content": [
+      {"type": "tool_result", "toolUseID": "toolu_3", "run": {"status": "error", "error": {"message": "file changed on disk"}}}
+    ], "meta": {"sentAt": 1756720805000}},
+    {"role": "assistant", "messageId": 5, "content": [{"type": "text", "text": "Fixed the typo."}]}
+  ]
+}`
+
+func TestParseThreadJSON(t *testing.T) {
+	thread, err := parseThreadJSON([]byte(testThreadExport), "T-requested", false)
+	if err != nil {
+		t.Fatalf("parseThreadJSON failed: %v", err)
+	}
+	if thread.Agent != "amp" || thread.AgentSessionID != "T-0199a1b2-c3d4-7000-8000-123456789abc" {
+		t.Errorf("agent = %s, session = %s", thread.Agent, thread.AgentSessionID)
+	}
+	if thread.Status != model.ThreadStatusCompleted {
+		t.Errorf("expected completed status, got %s", thread.Status)
+	}
+	if len(thread.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %d: %+v", len(thread.Messages), thread.Messages)
+	}
+	if thread.ID != thread.Messages[0].ID {
+		t.Error("thread ID is not the first message's ID")
+	}
+
+	prompt := thread.Messages[0]
+	if prompt.Role != model.RoleHuman || prompt.Content != "fix the typo in README" {
+		t.Errorf("prompt = %s %q", prompt.Role, prompt.Content)
+	}
+	if !prompt.Timestamp.Equal(time.Date(2025, 9, 1, 10, 0, 1, 0, time.UTC)) || !thread.StartedAt.Equal(prompt.Timestamp) {
+		t.Errorf("prompt sent at %v, thread started at %v", prompt.Timestamp, thread.StartedAt)
+	}
+
+	calls := thread.Messages[1].ToolCalls
+	if thread.Messages[1].Content != "Let me find it." || len(calls) != 2 {
+		t.Fatalf("assistant message = %+v", thread.Messages[1])
+	}
+	if calls[0].ID != "toolu_1" || calls[0].Name != "Bash" || string(calls[0].Arguments) != `{"cmd": "grep -rn teh ."}` {
+		t.Errorf("first tool call = %s %s %s", calls[0].ID, calls[0].Name, calls[0].Arguments)
+	}
+	if calls[0].Result != "README.md:1:teh" || calls[1].Result != "1: teh" {
+		t.Errorf("tool results = %q, %q", calls[0].Result, calls[1].Result)
+	}
+	if thread.Messages[1].Thinking != "" {
+		t.Error("thinking recorded")
+	}
+
+	edit := thread.Messages[2]
+	if edit.Content != "" || len(edit.ToolCalls) != 1 || edit.ToolCalls[0].Result != "file changed on disk" {
+		t.Errorf("edit message = %+v", edit)
+	}
+	if !edit.Timestamp.Equal(time.Date(2025, 9, 1, 10, 0, 3, 0, time.UTC)) {
+		t.Errorf("edit message at %v", edit.Timestamp)
+	}
+
+	if thread.Messages[3].Content != "Fixed the typo." || thread.CompletedAt == nil {
+		t.Errorf("response = %q", thread.Messages[3].Content)
+	}
+}
+
+func TestParseThreadJSON_Invalid(t *testing.T) {
+	for _, data := range []string{"", "Usage: amp threads [command]", `{"title":"no thread"}`} {
+		if _, err := parseThreadJSON([]byte(data), "T-x", false); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestParseThreadList(t *testing.T) {
+	// As recorded from `amp threads list`
+	table := `Title                 Last Updated  Visibility  Messages  Thread ID
+────────────────────  ────────────  ──────────  ────────  ──────────────────────────────────────
+Fix typo              2m ago        Private     6         T-0199a1b2-c3d4-7000-8000-123456789abc
+Add T-shirt sizes     1h ago        Workspace   12        T-0199a1b2-c3d4-7000-8000-def012345678
+`
+	ids := parseThreadList(table, 10)
+	if len(ids) != 2 || ids[0] != "T-0199a1b2-c3d4-7000-8000-123456789abc" || ids[1] != "T-0199a1b2-c3d4-7000-8000-def012345678" {
+		t.Errorf("table thread IDs = %v", ids)
+	}
+	if ids := parseThreadList(table, 1); len(ids) != 1 {
+		t.Errorf("expected limit of 1, got %v", ids)
+	}
+
+	// As recorded from `amp threads list --json`, bare and wrapped
+	list := `[{"id":"T-a","title":"Fix typo","updated":"2025-09-01T10:00:05Z"},{"id":"T-b","title":"Other"},{"title":"no id"}]`
+	if ids, err := parseThreadListJSON([]byte(list), 10); err != nil || len(ids) != 2 || ids[0] != "T-a" || ids[1] != "T-b" {
+		t.Errorf("JSON thread IDs = %v, %v", ids, err)
+	}
+	if ids, err := parseThreadListJSON([]byte(`{"threads":`+list+`}`), 1); err != nil || len(ids) != 1 || ids[0] != "T-a" {
+		t.Errorf("wrapped JSON thread IDs = %v, %v", ids, err)
+	}
+	if _, err := parseThreadListJSON([]byte(table), 10); err == nil {
+		t.Error("expected an error for the table")
+	}
+}
+
+// installFakeAmp puts an amp script on PATH that prints the JSON export,
+// or fails for it when export is empty, and prints markdown otherwise
+func installFakeAmp(t *testing.T, export, markdown string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "export.json"), []byte(export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "thread.md"), []byte(markdown), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+case "$2" in
+export) [ -s "` + dir + `/export.json" ] || { echo "unknown command: export" >&2; exit 1; }; cat "` + dir + `/export.json" ;;
+markdown) cat "` + dir + `/thread.md" ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "amp"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestAdapter_Pull(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake amp CLI is a shell script")
+	}
+	markdown := `---
+created: 2025-09-01T10:00:00Z
+---
+
+## User
+
+fix the typo in README
+
+## Assistant
+
+Fixed the typo.
+`
+	installFakeAmp(t, testThreadExport, markdown)
+	thread, err := NewAdapter().Pull("https://ampcode.com/threads/T-0199a1b2-c3d4-7000-8000-123456789abc", agents.PullOptions{})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(thread.Messages) != 4 || len(thread.Messages[1].ToolCalls) != 2 {
+		t.Errorf("expected the JSON export, got %+v", thread.Messages)
+	}
+
+	// Amp versions without the export fall back to the markdown
+	installFakeAmp(t, "", markdown)
+	thread, err = NewAdapter().Pull("T-md", agents.PullOptions{})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if len(thread.Messages) != 2 || thread.Messages[1].Content != "Fixed the typo." || thread.AgentSessionID != "T-md" {
+		t.Errorf("expected the markdown, got %+v", thread)
+	}
+}
@@ -0,0 +1,176 @@
+package amp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+// threadExport is a thread as exported by `amp threads export`
+type threadExport struct {
+	ID       string          `json:"id"`
+	Created  int64           `json:"created"` // Unix milliseconds
+	Title    string          `json:"title"`
+	Messages []exportMessage `json:"messages"`
+}
+
+type exportMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"` // A string or content blocks
+	Meta    struct {
+		SentAt int64 `json:"sentAt"` // Unix milliseconds
+	} `json:"meta"`
+}
+
+type exportBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+
+	// tool_use
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+
+	// tool_result
+	ToolUseID string `json:"toolUseID"`
+	Run       struct {
+		Status string          `json:"status"`
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"run"`
+}
+
+// parseThreadJSON rebuilds a thread from its JSON export: every prompt and
+// response with the times they were sent, and tool uses as tool calls with
+// their results
+func parseThreadJSON(data []byte, ampThreadID string, includeGit bool) (*model.Thread, error) {
+	var export threadExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid thread export: %w", err)
+	}
+	if export.ID == "" && len(export.Messages) == 0 {
+		return nil, fmt.Errorf("invalid thread export: no thread")
+	}
+	if export.ID != "" {
+		ampThreadID = export.ID
+	}
+
+	var messages []*model.Message
+	toolCallIndex := make(map[string][2]int) // Tool use ID -> message, tool call
+	timestamp := time.UnixMilli(export.Created).UTC()
+	for _, m := range export.Messages {
+		if m.Meta.SentAt > 0 {
+			timestamp = time.UnixMilli(m.Meta.SentAt).UTC()
+		}
+		blocks := exportBlocks(m.Content)
+
+		var text []string
+		var toolCalls []model.ToolCall
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				if t := strings.TrimSpace(block.Text); t != "" {
+					text = append(text, t)
+				}
+			case "tool_use":
+				args := block.Input
+				if len(args) == 0 || string(args) == "null" {
+					args = json.RawMessage("{}")
+				}
+				toolCalls = append(toolCalls, model.ToolCall{ID: block.ID, Name: block.Name, Arguments: args})
+			case "tool_result":
+				if at, ok := toolCallIndex[block.ToolUseID]; ok {
+					messages[at[0]].ToolCalls[at[1]].Result = toolResult(block)
+				}
+			}
+		}
+
+		var role model.Role
+		switch m.Role {
+		case "user":
+			role = model.RoleHuman
+		case "assistant":
+			role = model.RoleAssistant
+		default:
+			continue
+		}
+		// User messages holding only tool results are not prompts
+		if len(text) == 0 && len(toolCalls) == 0 {
+			continue
+		}
+
+		msg := model.NewMessage(role, strings.Join(text, "\n\n"), "", toolCalls)
+		msg.Timestamp = timestamp
+		messages = append(messages, msg)
+		for i, call := range toolCalls {
+			if call.ID != "" {
+				toolCallIndex[call.ID] = [2]int{len(messages) - 1, i}
+			}
+		}
+	}
+
+	thread := model.NewThread(agentName, ampThreadID, "", "")
+	thread.Status = model.ThreadStatusCompleted
+	for _, msg := range messages {
+		if len(thread.Messages) == 0 {
+			msg.ID = msg.ComputeHash()
+		}
+		thread.AddMessage(msg)
+	}
+	if len(thread.Messages) > 0 {
+		thread.StartedAt = thread.Messages[0].Timestamp
+		completed := thread.Messages[len(thread.Messages)-1].Timestamp
+		thread.CompletedAt = &completed
+	} else {
+		thread.ID = ampThreadID
+	}
+
+	// Record git hash if requested
+	if includeGit {
+		if hash := getCurrentGitHash(); hash != "" {
+			thread.GitCommitHash = hash
+		}
+	}
+	return thread, nil
+}
+
+// exportBlocks returns the content blocks of a message, whose content may
+// also be plain text
+func exportBlocks(content json.RawMessage) []exportBlock {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return []exportBlock{{Type: "text", Text: text}}
+	}
+	var blocks []exportBlock
+	json.Unmarshal(content, &blocks)
+	return blocks
+}
+
+// toolResult returns the text of a tool run's result: the result itself if
+// it is text, its output or content if it has one, or else its JSON
+func toolResult(block exportBlock) string {
+	result := block.Run.Result
+	if len(result) == 0 || string(result) == "null" {
+		result = block.Run.Error
+	}
+	if len(result) == 0 || string(result) == "null" {
+		return ""
+	}
+
+	var text string
+	if json.Unmarshal(result, &text) == nil {
+		return text
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(result, &fields) == nil {
+		for _, key := range []string{"output", "content", "message"} {
+			if json.Unmarshal(fields[key], &text) == nil && text != "" {
+				return text
+			}
+		}
+	}
+	return string(result)
+}
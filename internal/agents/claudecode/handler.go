@@ -84,6 +84,8 @@ func (h *Handler) HandleEvent(event *agents.HookEvent) (string, error) {
 		return h.handleSessionStart(repo, event)
 	case agents.HookEventUserPrompt:
 		return h.handleUserPrompt(repo, event)
+	case agents.HookEventToolUse:
+		return h.handleToolUse(repo, event)
 	case agents.HookEventAssistantStop:
 		return h.handleStop(repo, event)
 	case agents.HookEventSessionEnd:
@@ -126,11 +128,14 @@ func (h *Handler) handleSessionStart(repo *storage.Repository, event *agents.Hoo
 		return "", err
 	}
 
-	// Save session state
+	// Save session state. Only what the transcript gains from here on is
+	// recorded; a resumed session's earlier turns belong to the parent thread.
 	if err := saveSessionState(repo.RootPath, event.SessionID, &SessionState{
-		SessionID: event.SessionID,
-		ThreadID:  thread.ID,
-		StartedAt: time.Now().UTC(),
+		SessionID:        event.SessionID,
+		ThreadID:         thread.ID,
+		StartedAt:        time.Now().UTC(),
+		TranscriptPath:   event.Transcript,
+		TranscriptOffset: TranscriptSize(event.Transcript),
 	}); err != nil {
 		return "", err
 	}
@@ -168,15 +173,16 @@ func (h *Handler) handleUserPrompt(repo *storage.Repository, event *agents.HookE
 	msg := model.NewMessage(model.RoleHuman, event.Prompt, "", nil)
 	thread.AddMessage(msg)
 
+	// Snapshot the working tree, so the turn's tool calls are diffed
+	// against it rather than against changes made between turns
+	state.Snapshot, _ = repo.GitSnapshot()
+
 	// If thread ID changed (first message was added), update session state and clean up
+	state.ThreadID = thread.ID
+	if err := saveSessionState(repo.RootPath, event.SessionID, state); err != nil {
+		return thread.ID, err
+	}
 	if thread.ID != oldThreadID {
-		if err := saveSessionState(repo.RootPath, event.SessionID, &SessionState{
-			SessionID: state.SessionID,
-			ThreadID:  thread.ID,
-			StartedAt: state.StartedAt,
-		}); err != nil {
-			return thread.ID, err
-		}
 		repo.DeleteThread(oldThreadID)
 		repo.UnstageThread(oldThreadID)
 	}
@@ -192,7 +198,49 @@ func (h *Handler) handleUserPrompt(repo *storage.Repository, event *agents.HookE
 	return thread.ID, repo.SaveThread(thread)
 }
 
+// handleToolUse snapshots the working tree after a tool call, and if the
+// tool call changed it, keeps the change until the turn is recorded
+func (h *Handler) handleToolUse(repo *storage.Repository, event *agents.HookEvent) (string, error) {
+	// Claude Code runs the hooks of parallel tool calls concurrently; each
+	// must see the snapshot the previous one saved
+	unlock, err := lockSessionState(repo.RootPath, event.SessionID)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	state, err := loadSessionState(repo.RootPath, event.SessionID)
+	if err != nil || state == nil || len(event.ToolCalls) == 0 || event.ToolCalls[0].ID == "" {
+		return "", nil // No active session
+	}
+
+	after, err := repo.GitSnapshot()
+	if err != nil {
+		return state.ThreadID, nil // Not a git working tree
+	}
+	before := state.Snapshot
+	if before == "" {
+		before, _ = repo.GitTree("HEAD")
+	}
+	if before == "" || after == before {
+		return state.ThreadID, nil // Nothing changed
+	}
+
+	if state.Snapshots == nil {
+		state.Snapshots = make(map[string]model.Snapshot)
+	}
+	state.Snapshots[event.ToolCalls[0].ID] = model.Snapshot{Before: before, After: after}
+	state.Snapshot = after
+	return state.ThreadID, saveSessionState(repo.RootPath, event.SessionID, state)
+}
+
 func (h *Handler) handleStop(repo *storage.Repository, event *agents.HookEvent) (string, error) {
+	unlock, err := lockSessionState(repo.RootPath, event.SessionID)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
 	state, err := loadSessionState(repo.RootPath, event.SessionID)
 	if err != nil || state == nil {
 		return "", nil // No active session
@@ -203,39 +251,71 @@ func (h *Handler) handleStop(repo *storage.Repository, event *agents.HookEvent)
 		return state.ThreadID, err
 	}
 
-	// Get assistant response - either from event or parse transcript
-	assistantContent := event.Response
-	toolCalls := event.ToolCalls
-
-	if assistantContent == "" && len(toolCalls) == 0 && event.Transcript != "" {
-		assistantContent, toolCalls, err = parseLatestAssistantResponse(event.Transcript)
+	// Get the turn's messages - either from the event, everything the
+	// transcript gained since the last hook, or its latest response
+	var messages []*model.Message
+	var subagents []Subagent
+	switch {
+	case event.Response != "" || len(event.ToolCalls) > 0:
+		messages = append(messages, model.NewMessage(model.RoleAssistant, event.Response, "", event.ToolCalls))
+	case event.Transcript != "" && event.Transcript == state.TranscriptPath:
+		opts := TranscriptOptions{}
+		if config, err := repo.ReadConfig(); err == nil {
+			opts.Thinking = config.CaptureThinking
+		}
+		update, err := ReadTranscriptSince(event.Transcript, state.TranscriptOffset, opts)
 		if err != nil {
 			// Log error but continue - don't fail the hook
 			fmt.Fprintf(os.Stderr, "Warning: failed to parse transcript: %v\n", err)
+			break
+		}
+		messages, subagents, state.TranscriptOffset = update.Messages, update.Subagents, update.Offset
+	case event.Transcript != "":
+		// Session tracked without a transcript offset (started by an older
+		// tin): record the latest response, and read incrementally from here
+		content, toolCalls, err := parseLatestAssistantResponse(event.Transcript)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to parse transcript: %v\n", err)
+		}
+		if content != "" || len(toolCalls) > 0 {
+			messages = append(messages, model.NewMessage(model.RoleAssistant, content, "", toolCalls))
 		}
+		state.TranscriptPath = event.Transcript
+		state.TranscriptOffset = TranscriptSize(event.Transcript)
 	}
 
-	if assistantContent == "" && len(toolCalls) == 0 {
-		return state.ThreadID, nil // No response to record
+	if len(messages) == 0 {
+		// No response to record
+		return state.ThreadID, saveSessionState(repo.RootPath, event.SessionID, state)
 	}
 
-	// Get current git hash
-	gitHash, _ := repo.GetCurrentGitHash()
+	// Attach the working tree changes of the turn's tool calls
+	AttachSnapshots(messages, subagents, state.Snapshots)
+	state.Snapshots = nil
 
-	// Create assistant message
-	msg := model.NewMessage(model.RoleAssistant, assistantContent, "", toolCalls)
-	msg.GitHashAfter = gitHash
-	thread.AddMessage(msg)
+	for _, msg := range messages {
+		thread.AddMessage(msg)
+	}
 
-	// Auto-stage if configured
-	if h.config.AutoStage == nil || *h.config.AutoStage {
-		contentHash := thread.ComputeContentHash()
-		if err := repo.StageThread(thread.ID, len(thread.Messages), contentHash); err != nil {
+	// The git state is known as of the end of the turn
+	gitHash, _ := repo.GetCurrentGitHash()
+	thread.Messages[len(thread.Messages)-1].GitHashAfter = gitHash
+
+	// Subagent runs of the turn become child threads
+	threads := append([]*model.Thread{thread}, SubagentThreads(thread, subagents)...)
+	for _, t := range threads {
+		// Auto-stage if configured
+		if h.config.AutoStage == nil || *h.config.AutoStage {
+			contentHash := t.ComputeContentHash()
+			if err := repo.StageThread(t.ID, len(t.Messages), contentHash); err != nil {
+				return thread.ID, err
+			}
+		}
+		if err := repo.SaveThread(t); err != nil {
 			return thread.ID, err
 		}
 	}
-
-	return thread.ID, repo.SaveThread(thread)
+	return thread.ID, saveSessionState(repo.RootPath, event.SessionID, state)
 }
 
 func (h *Handler) handleSessionEnd(repo *storage.Repository, event *agents.HookEvent) (string, error) {
@@ -280,9 +360,15 @@ func (h *Handler) handleSessionEnd(repo *storage.Repository, event *agents.HookE
 
 // SessionState tracks the current session for hooks
 type SessionState struct {
-	SessionID string    `json:"session_id"`
-	ThreadID  string    `json:"thread_id"`
-	StartedAt time.Time `json:"started_at"`
+	SessionID        string    `json:"session_id"`
+	ThreadID         string    `json:"thread_id"`
+	StartedAt        time.Time `json:"started_at"`
+	TranscriptPath   string    `json:"transcript_path,omitempty"`
+	TranscriptOffset int64     `json:"transcript_offset,omitempty"` // Bytes of the transcript already recorded
+	// Snapshot is the working tree as of the last tool call or prompt, and
+	// Snapshots the changes of tool calls not yet recorded, by tool call ID
+	Snapshot  string                    `json:"snapshot,omitempty"`
+	Snapshots map[string]model.Snapshot `json:"snapshots,omitempty"`
 }
 
 func getSessionStatePath(rootPath, sessionID string) string {
@@ -327,6 +413,12 @@ func saveSessionState(rootPath, sessionID string, state *SessionState) error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// lockSessionState serializes hooks that update a session's state, so
+// concurrent ones don't overwrite each other's changes
+func lockSessionState(rootPath, sessionID string) (func(), error) {
+	return storage.LockFile(getSessionStatePath(rootPath, sessionID))
+}
+
 func clearSessionState(rootPath, sessionID string) {
 	// Remove session-specific file
 	path := getSessionStatePath(rootPath, sessionID)
@@ -5,8 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/sestinj/tin/internal/agents"
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
 )
 
 func TestHandler_Info(t *testing.T) {
@@ -250,3 +253,52 @@ func TestHandler_IsInstalled_WithHooks(t *testing.T) {
 		t.Error("expected installed when settings has tin hooks")
 	}
 }
+
+func TestHandleToolUse_ParallelCallsKeepSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := storage.Init(dir)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	baseline, err := repo.GitSnapshot()
+	if err != nil {
+		t.Fatalf("GitSnapshot failed: %v", err)
+	}
+	sessionID := "parallel-session"
+	saveSessionState(dir, sessionID, &SessionState{SessionID: sessionID, ThreadID: "thread-1", Snapshot: baseline})
+
+	// Two tool calls run in parallel. The first one's hook snapshots its
+	// change and is still saving it when the second one's hook starts.
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	treeA, _ := repo.GitSnapshot()
+	unlock, err := lockSessionState(dir, sessionID)
+	if err != nil {
+		t.Fatalf("lockSessionState failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+
+	h := NewHandler(nil)
+	done := make(chan error)
+	go func() {
+		_, err := h.handleToolUse(repo, &agents.HookEvent{SessionID: sessionID, ToolCalls: []model.ToolCall{{ID: "call-b"}}})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	state, _ := loadSessionState(dir, sessionID)
+	state.Snapshots = map[string]model.Snapshot{"call-a": {Before: baseline, After: treeA}}
+	state.Snapshot = treeA
+	saveSessionState(dir, sessionID, state)
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("handleToolUse failed: %v", err)
+	}
+
+	state, _ = loadSessionState(dir, sessionID)
+	if _, ok := state.Snapshots["call-a"]; !ok {
+		t.Error("the first tool call's snapshot was lost")
+	}
+	if got := state.Snapshots["call-b"]; got.Before != treeA || got.After == treeA {
+		t.Errorf("second tool call should be credited only its own change, got %+v", got)
+	}
+}
@@ -36,6 +36,12 @@ func getSettingsPath(projectDir string, global bool) string {
 	return filepath.Join(projectDir, ".claude", "settings.json")
 }
 
+// toolHookMatchers limits tool hooks to the tools that change files; the
+// working tree is snapshotted after each of them
+var toolHookMatchers = map[string]string{
+	"PostToolUse": "Edit|MultiEdit|Write|NotebookEdit|Bash",
+}
+
 // InstallHooks installs tin hooks into Claude Code settings
 func InstallHooks(projectDir string, global bool, timeout int) error {
 	if timeout <= 0 {
@@ -79,6 +85,7 @@ func InstallHooks(projectDir string, global bool, timeout int) error {
 		"UserPromptSubmit": "user-prompt",
 		"Stop":             "stop",
 		"SessionEnd":       "session-end",
+		"PostToolUse":      "post-tool-use",
 	}
 
 	for event, handler := range tinHooks {
@@ -98,6 +105,7 @@ func InstallHooks(projectDir string, global bool, timeout int) error {
 
 		if !alreadyInstalled {
 			settings.Hooks[event] = append(settings.Hooks[event], HookMatcher{
+				Matcher: toolHookMatchers[event],
 				Hooks: []HookConfig{{
 					Type:    "command",
 					Command: hookCmd,
@@ -138,7 +146,7 @@ func UninstallHooks(projectDir string, global bool) error {
 	}
 
 	// Remove tin hooks
-	events := []string{"SessionStart", "UserPromptSubmit", "Stop", "SessionEnd"}
+	events := []string{"SessionStart", "UserPromptSubmit", "Stop", "SessionEnd", "PostToolUse"}
 	for _, event := range events {
 		matchers := settings.Hooks[event]
 		var filtered []HookMatcher
@@ -0,0 +1,567 @@
+package claudecode
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+// Transcript is a Claude Code session transcript found on disk
+type Transcript struct {
+	Path      string
+	SessionID string
+	Cwd       string // Working directory the session ran in
+	ModTime   time.Time
+}
+
+// transcriptEntry is a line of a Claude Code transcript (JSONL)
+type transcriptEntry struct {
+	Type          string                  `json:"type"`
+	UUID          string                  `json:"uuid,omitempty"`
+	ParentUUID    string                  `json:"parentUuid,omitempty"`
+	SessionID     string                  `json:"sessionId,omitempty"`
+	Cwd           string                  `json:"cwd,omitempty"`
+	Timestamp     time.Time               `json:"timestamp"`
+	IsMeta        bool                    `json:"isMeta,omitempty"`
+	IsSidechain   bool                    `json:"isSidechain,omitempty"`
+	Message       *transcriptMessageInner `json:"message,omitempty"`
+	ToolUseResult json.RawMessage         `json:"toolUseResult,omitempty"`
+}
+
+// transcriptBlock is a content block of a transcript message
+type transcriptBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+}
+
+var projectDirPattern = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+// ClaudeConfigDir returns the directory Claude Code keeps its data in:
+// $CLAUDE_CONFIG_DIR, or ~/.claude
+func ClaudeConfigDir() (string, error) {
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".claude"), nil
+}
+
+// ProjectDirName returns the name Claude Code gives the transcript directory
+// of sessions started in dir: the path with every other character than
+// letters and digits replaced by '-'
+func ProjectDirName(dir string) string {
+	return projectDirPattern.ReplaceAllString(dir, "-")
+}
+
+// FindTranscripts returns the transcripts under projectsDir of sessions that
+// ran in rootPath or one of its subdirectories, oldest first
+func FindTranscripts(projectsDir, rootPath string) ([]Transcript, error) {
+	prefix := ProjectDirName(rootPath)
+	dirs, err := os.ReadDir(projectsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var transcripts []Transcript
+	for _, dir := range dirs {
+		// Subdirectories of the repository get directories with the same
+		// prefix; so do unrelated siblings like repo-old, which the
+		// working directory recorded in the transcript rules out
+		if !dir.IsDir() || !strings.HasPrefix(dir.Name(), prefix) {
+			continue
+		}
+		files, _ := filepath.Glob(filepath.Join(projectsDir, dir.Name(), "*.jsonl"))
+		for _, path := range files {
+			transcript, err := readTranscriptHeader(path)
+			if err != nil || transcript.SessionID == "" || !withinDir(transcript.Cwd, rootPath) {
+				continue
+			}
+			transcripts = append(transcripts, transcript)
+		}
+	}
+
+	sort.Slice(transcripts, func(i, j int) bool {
+		return transcripts[i].ModTime.Before(transcripts[j].ModTime)
+	})
+	return transcripts, nil
+}
+
+// readTranscriptHeader reads the session ID and working directory of a
+// transcript from its first entries that record them
+func readTranscriptHeader(path string) (Transcript, error) {
+	transcript := Transcript{Path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return transcript, err
+	}
+	transcript.ModTime = info.ModTime()
+
+	_, err = readTranscriptEntries(path, 0, func(entry *transcriptEntry) bool {
+		if transcript.SessionID == "" {
+			transcript.SessionID = entry.SessionID
+		}
+		if transcript.Cwd == "" {
+			transcript.Cwd = entry.Cwd
+		}
+		return transcript.SessionID == "" || transcript.Cwd == ""
+	})
+	return transcript, err
+}
+
+// withinDir reports whether path is dir or inside it
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readTranscriptEntries calls fn for each entry of a transcript from the
+// byte offset on, until it returns false, and returns the offset after the
+// last line read. Lines that are not valid JSON are skipped; lines may be far
+// larger than a bufio.Scanner allows, since tool results are inlined. A last
+// line without a newline is still being written and is left for next time.
+func readTranscriptEntries(path string, offset int64, fn func(*transcriptEntry) bool) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return offset, err
+		}
+	}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+		var entry transcriptEntry
+		if json.Unmarshal(line, &entry) == nil && !fn(&entry) {
+			return offset, nil
+		}
+	}
+}
+
+// TranscriptOptions controls what is read from a transcript
+type TranscriptOptions struct {
+	Prompts  bool // Include user prompts; hooks record them as they are submitted
+	Thinking bool // Include the assistant's thinking blocks
+}
+
+// Subagent is a subagent run found in a transcript: the work behind one of
+// the session's Task tool calls
+type Subagent struct {
+	ToolCallID string // Task tool call that launched it
+	AgentID    string // Claude Code's ID for the run, if recorded
+	Messages   []*model.Message
+}
+
+// taskToolNames are the tools Claude Code launches subagents with
+var taskToolNames = map[string]bool{"Task": true, "Agent": true}
+
+// taskCall is a subagent launch seen in the transcript
+type taskCall struct {
+	toolUseID string
+	prompt    string
+	agentID   string // From the tool result, once it arrives
+}
+
+// transcriptParser turns transcript entries into messages. Claude Code
+// writes one entry per content block, so blocks of the same API message are
+// merged, and tool results, which arrive in later user entries, are attached
+// to their tool calls.
+//
+// Subagents either write their entries into the session's transcript as
+// sidechains, each run a chain of entries linked by parentUuid, or to a
+// transcript of their own next to it (newer versions). Either way they are
+// parsed separately and matched to the Task calls that launched them.
+type transcriptParser struct {
+	opts           TranscriptOptions
+	sidechain      bool // Parsing a subagent's entries
+	sessionID      string
+	messages       []*model.Message
+	assistantIndex map[string]int    // API message ID -> index in messages
+	toolCallIndex  map[string][2]int // tool use ID -> message, tool call index
+
+	tasks      []*taskCall
+	chainRoots map[string]string // sidechain entry UUID -> UUID of its run's first entry
+	chains     []string          // first entry UUIDs, in order
+	subagents  map[string]*transcriptParser
+}
+
+func newTranscriptParser(opts TranscriptOptions) *transcriptParser {
+	return &transcriptParser{
+		opts:           opts,
+		assistantIndex: make(map[string]int),
+		toolCallIndex:  make(map[string][2]int),
+		chainRoots:     make(map[string]string),
+		subagents:      make(map[string]*transcriptParser),
+	}
+}
+
+// add processes an entry. Meta entries are left out, and sidechain entries
+// are handed to the parser of their subagent run.
+func (p *transcriptParser) add(entry *transcriptEntry) {
+	if p.sessionID == "" {
+		p.sessionID = entry.SessionID
+	}
+	if entry.IsSidechain && !p.sidechain {
+		p.addSidechain(entry)
+		return
+	}
+	if entry.Message == nil || entry.IsMeta {
+		return
+	}
+
+	switch entry.Type {
+	case "user":
+		text, results := parseUserContent(entry.Message.Content)
+		for toolUseID, result := range results {
+			if at, ok := p.toolCallIndex[toolUseID]; ok {
+				p.messages[at[0]].ToolCalls[at[1]].Result = result
+			}
+			if agentID := subagentID(entry.ToolUseResult); agentID != "" {
+				for _, task := range p.tasks {
+					if task.toolUseID == toolUseID {
+						task.agentID = agentID
+					}
+				}
+			}
+		}
+		if p.opts.Prompts && strings.TrimSpace(text) != "" {
+			p.messages = append(p.messages, &model.Message{Role: model.RoleHuman, Content: text, Timestamp: entry.Timestamp})
+		}
+
+	case "assistant":
+		i, ok := p.assistantIndex[entry.Message.ID]
+		if !ok || entry.Message.ID == "" {
+			p.messages = append(p.messages, &model.Message{Role: model.RoleAssistant, Timestamp: entry.Timestamp})
+			i = len(p.messages) - 1
+			p.assistantIndex[entry.Message.ID] = i
+		}
+		msg := p.messages[i]
+		for _, block := range contentBlocks(entry.Message.Content) {
+			switch block.Type {
+			case "text":
+				msg.Content = joinText(msg.Content, block.Text)
+			case "thinking":
+				if p.opts.Thinking {
+					msg.Thinking = joinText(msg.Thinking, block.Thinking)
+				}
+			case "tool_use":
+				if _, seen := p.toolCallIndex[block.ID]; seen && block.ID != "" {
+					continue
+				}
+				p.toolCallIndex[block.ID] = [2]int{i, len(msg.ToolCalls)}
+				msg.ToolCalls = append(msg.ToolCalls, model.ToolCall{ID: block.ID, Name: block.Name, Arguments: block.Input})
+				if taskToolNames[block.Name] && !p.sidechain {
+					var input struct {
+						Prompt string `json:"prompt"`
+					}
+					json.Unmarshal(block.Input, &input)
+					p.tasks = append(p.tasks, &taskCall{toolUseID: block.ID, prompt: input.Prompt})
+				}
+			}
+		}
+	}
+}
+
+// addSidechain hands a sidechain entry to the parser of its run. A run
+// starts with an entry whose parent is not part of a sidechain.
+func (p *transcriptParser) addSidechain(entry *transcriptEntry) {
+	root, ok := p.chainRoots[entry.ParentUUID]
+	if !ok || entry.ParentUUID == "" {
+		root = entry.UUID
+		p.chains = append(p.chains, root)
+	}
+	if entry.UUID != "" {
+		p.chainRoots[entry.UUID] = root
+	}
+	sub := p.subagents[root]
+	if sub == nil {
+		sub = newTranscriptParser(TranscriptOptions{Prompts: true, Thinking: p.opts.Thinking})
+		sub.sidechain = true
+		p.subagents[root] = sub
+	}
+	sub.add(entry)
+}
+
+// subagentRuns returns the subagent runs behind the Task calls read, from
+// the subagent's own transcript next to the session's at path if it has
+// one, or else from the sidechain run that starts with the task's prompt
+func (p *transcriptParser) subagentRuns(path string) []Subagent {
+	used := make(map[string]bool)
+	var runs []Subagent
+	for _, task := range p.tasks {
+		run := Subagent{ToolCallID: task.toolUseID, AgentID: task.agentID}
+		if task.agentID != "" && p.sessionID != "" {
+			agentPath := filepath.Join(filepath.Dir(path), p.sessionID, "subagents", "agent-"+task.agentID+".jsonl")
+			sub := newTranscriptParser(TranscriptOptions{Prompts: true, Thinking: p.opts.Thinking})
+			sub.sidechain = true
+			if _, err := readTranscriptEntries(agentPath, 0, func(entry *transcriptEntry) bool {
+				sub.add(entry)
+				return true
+			}); err == nil {
+				run.Messages = sub.result()
+			}
+		}
+		if len(run.Messages) == 0 {
+			for _, root := range p.chains {
+				messages := p.subagents[root].result()
+				if !used[root] && len(messages) > 0 && messages[0].Content == task.prompt {
+					used[root] = true
+					run.Messages = messages
+					break
+				}
+			}
+		}
+		if len(run.Messages) > 0 {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// subagentID returns the agent ID Claude Code records in the result of a
+// Task tool call, if any
+func subagentID(toolUseResult json.RawMessage) string {
+	var result struct {
+		AgentID string `json:"agentId"`
+	}
+	if len(toolUseResult) == 0 || json.Unmarshal(toolUseResult, &result) != nil {
+		return ""
+	}
+	return result.AgentID
+}
+
+// result returns the messages read, in transcript order, leaving out
+// assistant messages with nothing recorded (e.g. only thinking blocks when
+// thinking is not captured).
+func (p *transcriptParser) result() []*model.Message {
+	var messages []*model.Message
+	for _, msg := range p.messages {
+		if msg.Content == "" && msg.Thinking == "" && len(msg.ToolCalls) == 0 {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// joinText appends a text block to earlier ones, a line apart
+func joinText(text, block string) string {
+	if block == "" {
+		return text
+	}
+	if text == "" {
+		return block
+	}
+	return text + "\n" + block
+}
+
+// ParseTranscript rebuilds the complete thread of a Claude Code session from
+// its transcript: every user prompt, and every assistant message with its
+// text, tool calls and their results, with the original timestamps. It also
+// returns a child thread for each subagent run (see SubagentThreads).
+func ParseTranscript(path string, opts TranscriptOptions) (*model.Thread, []*model.Thread, error) {
+	opts.Prompts = true
+	parser := newTranscriptParser(opts)
+	_, err := readTranscriptEntries(path, 0, func(entry *transcriptEntry) bool {
+		parser.add(entry)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	thread := model.NewThread(agentName, parser.sessionID, "", "")
+	completeThread(thread, parser.result())
+	return thread, SubagentThreads(thread, parser.subagentRuns(path)), nil
+}
+
+// completeThread adds the messages of a finished session to a new thread,
+// dating it by its messages
+func completeThread(thread *model.Thread, messages []*model.Message) {
+	thread.Status = model.ThreadStatusCompleted
+	for _, msg := range messages {
+		if len(thread.Messages) == 0 {
+			msg.ID = msg.ComputeHash()
+		}
+		thread.AddMessage(msg)
+	}
+	if len(thread.Messages) > 0 {
+		thread.StartedAt = thread.Messages[0].Timestamp
+		completed := thread.Messages[len(thread.Messages)-1].Timestamp
+		thread.CompletedAt = &completed
+	}
+}
+
+// SubagentThreads returns a child thread of parent for each subagent run,
+// linked to the message holding the Task call that launched it. Runs whose
+// Task call is not in parent are left out.
+func SubagentThreads(parent *model.Thread, runs []Subagent) []*model.Thread {
+	var children []*model.Thread
+	for _, run := range runs {
+		messageID := ""
+		for i := len(parent.Messages) - 1; i >= 0 && messageID == ""; i-- {
+			for _, tc := range parent.Messages[i].ToolCalls {
+				if tc.ID == run.ToolCallID {
+					messageID = parent.Messages[i].ID
+				}
+			}
+		}
+		if messageID == "" {
+			continue
+		}
+		child := model.NewThread(agentName, run.AgentID, parent.ID, messageID)
+		child.ParentToolCallID = run.ToolCallID
+		completeThread(child, run.Messages)
+		children = append(children, child)
+	}
+	return children
+}
+
+// TranscriptUpdate is what a transcript gained after an offset
+type TranscriptUpdate struct {
+	Messages  []*model.Message
+	Subagents []Subagent // Runs launched by Task calls among Messages
+	Offset    int64      // Offset to continue from
+}
+
+// ReadTranscriptSince returns the messages a transcript gained after the
+// byte offset, in order, and the offset to continue from. Hooks use it to
+// append each turn in full: every assistant message with its text, tool
+// calls and their results, rather than only the final response.
+func ReadTranscriptSince(path string, offset int64, opts TranscriptOptions) (*TranscriptUpdate, error) {
+	parser := newTranscriptParser(opts)
+	next, err := readTranscriptEntries(path, offset, func(entry *transcriptEntry) bool {
+		parser.add(entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	update := &TranscriptUpdate{Messages: parser.result(), Subagents: parser.subagentRuns(path), Offset: next}
+	for _, msg := range update.Messages {
+		msg.ID = msg.ComputeHash()
+	}
+	return update, nil
+}
+
+// AttachSnapshots records the working tree changes of tool calls, by tool
+// use ID, on the tool calls of messages and subagent runs read from the
+// transcript, and recomputes the IDs of the messages it changes
+func AttachSnapshots(messages []*model.Message, subagents []Subagent, snapshots map[string]model.Snapshot) {
+	if len(snapshots) == 0 {
+		return
+	}
+	attach := func(messages []*model.Message) {
+		for _, msg := range messages {
+			changed := false
+			for i := range msg.ToolCalls {
+				if snapshot, ok := snapshots[msg.ToolCalls[i].ID]; ok {
+					msg.ToolCalls[i].Snapshot = &snapshot
+					changed = true
+				}
+			}
+			if changed && msg.ID != "" {
+				msg.ID = msg.ComputeHash()
+			}
+		}
+	}
+	attach(messages)
+	for _, run := range subagents {
+		attach(run.Messages)
+	}
+}
+
+// TranscriptSize returns the current size of a transcript, the offset from
+// which messages after now will be read; 0 if it does not exist yet
+func TranscriptSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// parseUserContent returns the text of a user message and the results it
+// carries for earlier tool calls, keyed by tool use ID
+func parseUserContent(content any) (string, map[string]string) {
+	if text, ok := content.(string); ok {
+		return text, nil
+	}
+	var texts []string
+	results := make(map[string]string)
+	for _, block := range contentBlocks(content) {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_result":
+			results[block.ToolUseID] = toolResultText(block.Content)
+		}
+	}
+	return strings.Join(texts, "\n"), results
+}
+
+// contentBlocks decodes the content blocks of a message; plain string
+// content has none
+func contentBlocks(content any) []transcriptBlock {
+	if _, ok := content.([]any); !ok {
+		return nil
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil
+	}
+	var blocks []transcriptBlock
+	json.Unmarshal(data, &blocks)
+	return blocks
+}
+
+// toolResultText returns the text of a tool result, which is either a
+// string or a list of content blocks
+func toolResultText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+	var blocks []transcriptBlock
+	if json.Unmarshal(content, &blocks) != nil {
+		return ""
+	}
+	var texts []string
+	for _, block := range blocks {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
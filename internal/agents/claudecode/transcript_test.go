@@ -0,0 +1,309 @@
+package claudecode
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+const testTranscript = `{"type":"summary","summary":"Fix the build","leafUuid":"x"}
+{"type":"user","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:00Z","message":{"role":"user","content":"fix the build"}}
+{"type":"user","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:01Z","isMeta":true,"message":{"role":"user","content":"<command-name>/clear</command-name>"}}
+{"type":"assistant","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:05Z","message":{"id":"msg_1","role":"assistant","content":[{"type":"thinking","thinking":"hmm"}]}}
+{"type":"assistant","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:06Z","message":{"id":"msg_1","role":"assistant","content":[{"type":"text","text":"Let me look."}]}}
+{"type":"assistant","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:07Z","message":{"id":"msg_1","role":"assistant","content":[{"type":"tool_use","id":"tu_1","name":"Bash","input":{"command":"go build ./..."}}]}}
+{"type":"user","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:09Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu_1","content":"main.go:3: undefined: x"}]}}
+{"type":"assistant","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:10Z","isSidechain":true,"message":{"id":"msg_side","role":"assistant","content":[{"type":"text","text":"subagent work"}]}}
+not json
+{"type":"assistant","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:12Z","message":{"id":"msg_2","role":"assistant","content":[{"type":"tool_use","id":"tu_2","name":"Read","input":{"file_path":"main.go"}}]}}
+{"type":"user","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:13Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu_2","content":[{"type":"text","text":"package main"}]}]}}
+{"type":"assistant","sessionId":"sess-1","cwd":"/work/repo","timestamp":"2025-03-01T10:00:20Z","message":{"id":"msg_3","role":"assistant","content":[{"type":"text","text":"Fixed."}]}}
+`
+
+func writeTranscript(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseTranscript(t *testing.T) {
+	path := writeTranscript(t, t.TempDir(), "sess-1.jsonl", testTranscript)
+
+	thread, subagents, err := ParseTranscript(path, TranscriptOptions{})
+	if err != nil {
+		t.Fatalf("ParseTranscript failed: %v", err)
+	}
+
+	if thread.AgentSessionID != "sess-1" || thread.Agent != "claude-code" {
+		t.Errorf("unexpected session %q agent %q", thread.AgentSessionID, thread.Agent)
+	}
+	if thread.Status != model.ThreadStatusCompleted {
+		t.Errorf("expected completed thread, got %s", thread.Status)
+	}
+	if len(subagents) != 0 {
+		t.Errorf("sidechain without a Task call imported as %d subagents", len(subagents))
+	}
+
+	roles := []model.Role{model.RoleHuman, model.RoleAssistant, model.RoleAssistant, model.RoleAssistant}
+	if len(thread.Messages) != len(roles) {
+		t.Fatalf("expected %d messages, got %d", len(roles), len(thread.Messages))
+	}
+	for i, role := range roles {
+		if thread.Messages[i].Role != role {
+			t.Errorf("message %d: expected role %s, got %s", i, role, thread.Messages[i].Role)
+		}
+	}
+
+	first := thread.Messages[1]
+	if first.Content != "Let me look." || len(first.ToolCalls) != 1 {
+		t.Fatalf("split assistant entries not merged: %+v", first)
+	}
+	if first.ToolCalls[0].Result != "main.go:3: undefined: x" {
+		t.Errorf("unexpected tool result %q", first.ToolCalls[0].Result)
+	}
+	if got := thread.Messages[2].ToolCalls[0].Result; got != "package main" {
+		t.Errorf("unexpected block tool result %q", got)
+	}
+	for _, msg := range thread.Messages {
+		if strings.Contains(msg.Content, "subagent") || strings.Contains(msg.Content, "/clear") {
+			t.Errorf("sidechain or meta entry imported: %q", msg.Content)
+		}
+	}
+
+	wantStart := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	if !thread.StartedAt.Equal(wantStart) {
+		t.Errorf("expected start %v, got %v", wantStart, thread.StartedAt)
+	}
+	if thread.CompletedAt == nil || !thread.CompletedAt.Equal(wantStart.Add(20*time.Second)) {
+		t.Errorf("unexpected completion time %v", thread.CompletedAt)
+	}
+
+	// Message IDs chain and include the tool results
+	if thread.ID != thread.Messages[0].ID || thread.ID == "" {
+		t.Errorf("thread ID %q should be the first message ID %q", thread.ID, thread.Messages[0].ID)
+	}
+	if first.ParentMessageID != thread.Messages[0].ID || first.ID != first.ComputeHash() {
+		t.Error("message hashes not chained")
+	}
+
+	again, _, _ := ParseTranscript(path, TranscriptOptions{})
+	if again.ComputeContentHash() != thread.ComputeContentHash() {
+		t.Error("parsing the same transcript twice should give the same thread")
+	}
+}
+
+func TestFindTranscripts(t *testing.T) {
+	projects := t.TempDir()
+	root := "/work/repo"
+	entry := func(session, cwd string) string {
+		return `{"type":"user","sessionId":"` + session + `","cwd":"` + cwd + `","timestamp":"2025-03-01T10:00:00Z","message":{"role":"user","content":"hi"}}` + "\n"
+	}
+
+	older := writeTranscript(t, filepath.Join(projects, ProjectDirName(root)), "a.jsonl", entry("sess-a", root))
+	writeTranscript(t, filepath.Join(projects, ProjectDirName(root+"/web")), "b.jsonl", entry("sess-b", root+"/web"))
+	writeTranscript(t, filepath.Join(projects, ProjectDirName(root+"-old")), "c.jsonl", entry("sess-c", root+"-old"))
+	writeTranscript(t, filepath.Join(projects, ProjectDirName("/elsewhere")), "d.jsonl", entry("sess-d", "/elsewhere"))
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(older, old, old)
+
+	transcripts, err := FindTranscripts(projects, root)
+	if err != nil {
+		t.Fatalf("FindTranscripts failed: %v", err)
+	}
+	if len(transcripts) != 2 {
+		t.Fatalf("expected 2 transcripts, got %+v", transcripts)
+	}
+	if transcripts[0].SessionID != "sess-a" || transcripts[1].SessionID != "sess-b" {
+		t.Errorf("unexpected transcripts %s, %s", transcripts[0].SessionID, transcripts[1].SessionID)
+	}
+
+	missing, err := FindTranscripts(filepath.Join(projects, "missing"), root)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("missing projects dir: %v, %v", missing, err)
+	}
+}
+
+func TestProjectDirName(t *testing.T) {
+	if got := ProjectDirName("/Users/me/src/my_repo.v2"); got != "-Users-me-src-my-repo-v2" {
+		t.Errorf("unexpected project dir name %q", got)
+	}
+}
+
+func TestReadTranscriptSince(t *testing.T) {
+	dir := t.TempDir()
+	lines := strings.SplitAfter(testTranscript, "\n")
+	path := writeTranscript(t, dir, "sess-1.jsonl", strings.Join(lines[:7], ""))
+
+	// First turn: the prompt is recorded by its hook, so only the assistant
+	// message with its tool call and result is read
+	update, err := ReadTranscriptSince(path, 0, TranscriptOptions{})
+	if err != nil {
+		t.Fatalf("ReadTranscriptSince failed: %v", err)
+	}
+	messages, offset := update.Messages, update.Offset
+	if len(messages) != 1 || messages[0].Role != model.RoleAssistant || messages[0].ToolCalls[0].Result == "" {
+		t.Fatalf("unexpected first turn %+v", messages)
+	}
+	if messages[0].Thinking != "" {
+		t.Error("thinking captured without being asked for")
+	}
+
+	// A line still being written is left for the next read
+	partial := strings.Join(lines[7:], "")
+	if err := os.WriteFile(path, []byte(strings.Join(lines[:7], "")+partial[:len(partial)-1]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	update, err = ReadTranscriptSince(path, offset, TranscriptOptions{Thinking: true})
+	if err != nil {
+		t.Fatalf("ReadTranscriptSince failed: %v", err)
+	}
+	messages, next := update.Messages, update.Offset
+	if len(messages) != 1 || len(messages[0].ToolCalls) != 1 || messages[0].ToolCalls[0].Result != "package main" {
+		t.Fatalf("unexpected second read %+v", messages)
+	}
+
+	if err := os.WriteFile(path, []byte(testTranscript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	update, err = ReadTranscriptSince(path, next, TranscriptOptions{})
+	if err != nil {
+		t.Fatalf("ReadTranscriptSince failed: %v", err)
+	}
+	messages, end := update.Messages, update.Offset
+	if len(messages) != 1 || messages[0].Content != "Fixed." || end != int64(len(testTranscript)) {
+		t.Errorf("unexpected last read %+v, offset %d", messages, end)
+	}
+	if messages[0].ID != messages[0].ComputeHash() {
+		t.Error("message ID not computed")
+	}
+
+	// Thinking blocks are kept when asked for
+	update, _ = ReadTranscriptSince(path, 0, TranscriptOptions{Thinking: true})
+	if update.Messages[0].Thinking != "hmm" {
+		t.Errorf("expected thinking, got %q", update.Messages[0].Thinking)
+	}
+	if TranscriptSize(path) != end || TranscriptSize(filepath.Join(dir, "missing.jsonl")) != 0 {
+		t.Error("unexpected transcript size")
+	}
+}
+
+// Two subagents launched together write interleaved sidechain runs
+const subagentTranscript = `{"type":"user","uuid":"u1","sessionId":"sess-2","timestamp":"2025-03-01T10:00:00Z","message":{"role":"user","content":"review the code"}}
+{"type":"assistant","uuid":"a1","parentUuid":"u1","sessionId":"sess-2","timestamp":"2025-03-01T10:00:02Z","message":{"id":"msg_1","role":"assistant","content":[{"type":"tool_use","id":"task_1","name":"Task","input":{"description":"Check API","prompt":"Check the API"}},{"type":"tool_use","id":"task_2","name":"Task","input":{"description":"Check docs","prompt":"Check the docs"}}]}}
+{"type":"user","uuid":"s1","parentUuid":null,"isSidechain":true,"sessionId":"sess-2","timestamp":"2025-03-01T10:00:03Z","message":{"role":"user","content":"Check the docs"}}
+{"type":"user","uuid":"s2","parentUuid":null,"isSidechain":true,"sessionId":"sess-2","timestamp":"2025-03-01T10:00:03Z","message":{"role":"user","content":"Check the API"}}
+{"type":"assistant","uuid":"s3","parentUuid":"s2","isSidechain":true,"sessionId":"sess-2","timestamp":"2025-03-01T10:00:04Z","message":{"id":"msg_s3","role":"assistant","content":[{"type":"text","text":"API looks fine"}]}}
+{"type":"assistant","uuid":"s4","parentUuid":"s1","isSidechain":true,"sessionId":"sess-2","timestamp":"2025-03-01T10:00:05Z","message":{"id":"msg_s4","role":"assistant","content":[{"type":"text","text":"Docs are stale"}]}}
+{"type":"user","uuid":"r1","parentUuid":"a1","sessionId":"sess-2","timestamp":"2025-03-01T10:00:06Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"task_1","content":[{"type":"text","text":"API looks fine"}]},{"type":"tool_result","tool_use_id":"task_2","content":[{"type":"text","text":"Docs are stale"}]}]}}
+{"type":"assistant","uuid":"a2","parentUuid":"r1","sessionId":"sess-2","timestamp":"2025-03-01T10:00:08Z","message":{"id":"msg_2","role":"assistant","content":[{"type":"text","text":"Update the docs."}]}}
+`
+
+func TestParseTranscript_Subagents(t *testing.T) {
+	path := writeTranscript(t, t.TempDir(), "sess-2.jsonl", subagentTranscript)
+
+	thread, subagents, err := ParseTranscript(path, TranscriptOptions{})
+	if err != nil {
+		t.Fatalf("ParseTranscript failed: %v", err)
+	}
+	if len(thread.Messages) != 3 {
+		t.Fatalf("expected 3 messages in the parent thread, got %d", len(thread.Messages))
+	}
+	if len(subagents) != 2 {
+		t.Fatalf("expected 2 subagent threads, got %d", len(subagents))
+	}
+
+	launcher := thread.Messages[1]
+	for i, want := range []struct{ toolCall, prompt, answer string }{
+		{"task_1", "Check the API", "API looks fine"},
+		{"task_2", "Check the docs", "Docs are stale"},
+	} {
+		child := subagents[i]
+		if child.ParentThreadID != thread.ID || child.ParentMessageID != launcher.ID || child.ParentToolCallID != want.toolCall {
+			t.Errorf("subagent %d linked to %s/%s/%s", i, child.ParentThreadID, child.ParentMessageID, child.ParentToolCallID)
+		}
+		if !child.IsSubagent() || len(child.Messages) != 2 {
+			t.Fatalf("subagent %d: %+v", i, child.Messages)
+		}
+		if child.Messages[0].Content != want.prompt || child.Messages[1].Content != want.answer {
+			t.Errorf("subagent %d messages %q, %q", i, child.Messages[0].Content, child.Messages[1].Content)
+		}
+		if child.ID == "" || child.ID != child.Messages[0].ID {
+			t.Errorf("subagent %d has no ID", i)
+		}
+	}
+}
+
+func TestParseTranscript_SubagentFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTranscript(t, dir, "sess-3.jsonl", `{"type":"user","sessionId":"sess-3","timestamp":"2025-03-01T10:00:00Z","message":{"role":"user","content":"find the bug"}}
+{"type":"assistant","sessionId":"sess-3","timestamp":"2025-03-01T10:00:02Z","message":{"id":"msg_1","role":"assistant","content":[{"type":"tool_use","id":"task_1","name":"Task","input":{"prompt":"Search for the bug"}}]}}
+{"type":"user","sessionId":"sess-3","timestamp":"2025-03-01T10:00:09Z","toolUseResult":{"status":"completed","agentId":"ab12"},"message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"task_1","content":"Found it"}]}}
+`)
+	writeTranscript(t, filepath.Join(dir, "sess-3", "subagents"), "agent-ab12.jsonl", `{"type":"user","isSidechain":true,"agentId":"ab12","sessionId":"sess-3","timestamp":"2025-03-01T10:00:03Z","message":{"role":"user","content":"Search for the bug"}}
+{"type":"assistant","isSidechain":true,"agentId":"ab12","sessionId":"sess-3","timestamp":"2025-03-01T10:00:05Z","message":{"id":"msg_a","role":"assistant","content":[{"type":"tool_use","id":"g1","name":"Grep","input":{"pattern":"bug"}}]}}
+{"type":"user","isSidechain":true,"agentId":"ab12","sessionId":"sess-3","timestamp":"2025-03-01T10:00:06Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"g1","content":"main.go:1"}]}}
+{"type":"assistant","isSidechain":true,"agentId":"ab12","sessionId":"sess-3","timestamp":"2025-03-01T10:00:08Z","message":{"id":"msg_b","role":"assistant","content":[{"type":"text","text":"Found it"}]}}
+`)
+
+	update, err := ReadTranscriptSince(path, 0, TranscriptOptions{})
+	if err != nil {
+		t.Fatalf("ReadTranscriptSince failed: %v", err)
+	}
+	if len(update.Subagents) != 1 {
+		t.Fatalf("expected 1 subagent, got %d", len(update.Subagents))
+	}
+	run := update.Subagents[0]
+	if run.ToolCallID != "task_1" || run.AgentID != "ab12" || len(run.Messages) != 3 {
+		t.Fatalf("unexpected subagent run %+v", run)
+	}
+	if run.Messages[1].ToolCalls[0].Result != "main.go:1" {
+		t.Errorf("subagent tool result not attached: %+v", run.Messages[1].ToolCalls)
+	}
+
+	parent := model.NewThread("claude-code", "sess-3", "", "")
+	for _, msg := range update.Messages {
+		parent.AddMessage(msg)
+	}
+	children := SubagentThreads(parent, update.Subagents)
+	if len(children) != 1 || children[0].AgentSessionID != "ab12" || children[0].ParentMessageID != parent.Messages[0].ID {
+		t.Errorf("unexpected subagent threads %+v", children)
+	}
+	if len(SubagentThreads(model.NewThread("claude-code", "", "", ""), update.Subagents)) != 0 {
+		t.Error("subagent linked to a thread without its Task call")
+	}
+}
+
+func TestAttachSnapshots(t *testing.T) {
+	msg := model.NewMessage(model.RoleAssistant, "", "", []model.ToolCall{{ID: "toolu_1", Name: "Edit"}, {ID: "toolu_2", Name: "Read"}})
+	msg.ID = msg.ComputeHash()
+	oldID := msg.ID
+	sub := model.NewMessage(model.RoleAssistant, "", "", []model.ToolCall{{ID: "toolu_3", Name: "Write"}})
+
+	AttachSnapshots([]*model.Message{msg}, []Subagent{{ToolCallID: "toolu_0", Messages: []*model.Message{sub}}}, map[string]model.Snapshot{
+		"toolu_1": {Before: "aaa", After: "bbb"},
+		"toolu_3": {Before: "bbb", After: "ccc"},
+	})
+
+	if s := msg.ToolCalls[0].Snapshot; s == nil || s.Before != "aaa" || s.After != "bbb" {
+		t.Errorf("edit snapshot = %+v", s)
+	}
+	if msg.ToolCalls[1].Snapshot != nil {
+		t.Error("snapshot attached to a tool call that made no change")
+	}
+	if msg.ID == oldID || msg.ID != msg.ComputeHash() {
+		t.Error("message ID not recomputed")
+	}
+	if s := sub.ToolCalls[0].Snapshot; s == nil || s.After != "ccc" {
+		t.Errorf("subagent snapshot = %+v", s)
+	}
+}
@@ -2,7 +2,9 @@
 // It implements the NotifyHandler interface for notification-based tracking.
 //
 // Codex CLI only supports the "agent-turn-complete" notification event,
-// which provides limited real-time tracking compared to hook-based agents.
+// which carries only the prompts and the last response. On each
+// notification the thread is rebuilt from the session's rollout file
+// instead, when it can be found.
 package codex
 
 import (
@@ -89,6 +91,16 @@ func (h *Handler) HandleNotification(event *agents.NotifyEvent) error {
 		return nil
 	}
 
+	// Rebuild the whole conversation from the session's rollout if there
+	// is one, recording the git state as of the end of the turn
+	if thread, err := h.readRollout(repo, payload.ThreadID); err == nil && len(thread.Messages) > 0 {
+		gitHash, _ := repo.GetCurrentGitHash()
+		thread.Messages[len(thread.Messages)-1].GitHashAfter = gitHash
+		_, err := SaveRolloutThread(repo, thread, h.config.AutoStage == nil || *h.config.AutoStage)
+		return err
+	}
+
+	// Otherwise record what the notification carries.
 	// Try to load or create thread for this session
 	thread, err := h.getOrCreateThread(repo, payload.ThreadID)
 	if err != nil {
@@ -144,15 +156,22 @@ func (h *Handler) HandleNotification(event *agents.NotifyEvent) error {
 	return repo.SaveThread(thread)
 }
 
-// SyncThread fetches and updates a specific thread by session ID.
-// For Codex, this is a no-op since we don't have access to session data
-// outside of notifications.
+// SyncThread fetches and updates a specific thread by session ID,
+// rebuilding it from the session's rollout. Without a rollout, the thread
+// recorded from notifications is returned as is.
 func (h *Handler) SyncThread(sessionID string, cwd string) (*model.Thread, error) {
 	repo, err := storage.Open(cwd)
 	if err != nil {
 		return nil, err
 	}
 
+	if thread, err := h.readRollout(repo, sessionID); err == nil && len(thread.Messages) > 0 {
+		if _, err := SaveRolloutThread(repo, thread, h.config.AutoStage == nil || *h.config.AutoStage); err != nil {
+			return nil, err
+		}
+		return thread, nil
+	}
+
 	threads, err := repo.FindThreadsBySessionID(sessionID)
 	if err != nil {
 		return nil, err
@@ -165,6 +184,62 @@ func (h *Handler) SyncThread(sessionID string, cwd string) (*model.Thread, error
 	return threads[0], nil
 }
 
+// readRollout rebuilds the thread of a session from its rollout
+func (h *Handler) readRollout(repo *storage.Repository, sessionID string) (*model.Thread, error) {
+	sessionsDir, err := SessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	path, err := FindRollout(sessionsDir, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	opts := RolloutOptions{}
+	if config, err := repo.ReadConfig(); err == nil {
+		opts.Thinking = config.CaptureThinking
+	}
+	return ParseRollout(path, opts)
+}
+
+// SaveRolloutThread saves a thread rebuilt from a rollout, and stages it if
+// stage is set. It replaces the uncommitted threads recorded for the
+// session from notifications, and keeps the git states recorded on the
+// messages of the previous version. It reports whether the thread changed.
+func SaveRolloutThread(repo *storage.Repository, thread *model.Thread, stage bool) (bool, error) {
+	existing, _ := repo.FindThreadsBySessionID(thread.AgentSessionID)
+	for _, old := range existing {
+		if old.ID != thread.ID {
+			if committed, _ := repo.ThreadIsCommitted(old.ID); !committed {
+				repo.DeleteThread(old.ID)
+				repo.UnstageThread(old.ID)
+			}
+			continue
+		}
+		gitHashes := make(map[string]string)
+		for _, msg := range old.Messages {
+			gitHashes[msg.ID] = msg.GitHashAfter
+		}
+		for i := range thread.Messages {
+			if thread.Messages[i].GitHashAfter == "" {
+				thread.Messages[i].GitHashAfter = gitHashes[thread.Messages[i].ID]
+			}
+		}
+		if old.ComputeContentHash() == thread.ComputeContentHash() {
+			return false, nil
+		}
+	}
+
+	if err := repo.SaveThread(thread); err != nil {
+		return false, err
+	}
+	if stage {
+		if err := repo.StageThread(thread.ID, len(thread.Messages), thread.ComputeContentHash()); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
 func (h *Handler) getOrCreateThread(repo *storage.Repository, threadID string) (*model.Thread, error) {
 	// Check for existing thread
 	threads, _ := repo.FindThreadsBySessionID(threadID)
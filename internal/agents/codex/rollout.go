@@ -0,0 +1,533 @@
+package codex
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+// Rollout is a Codex CLI session rollout file: the JSONL record Codex keeps
+// of each session under ~/.codex/sessions/YYYY/MM/DD/
+type Rollout struct {
+	Path      string
+	SessionID string
+	Cwd       string // Working directory the session ran in
+	StartedAt time.Time
+}
+
+// RolloutOptions selects what ParseRollout records beyond the conversation
+type RolloutOptions struct {
+	Thinking bool // Record reasoning summaries on assistant messages
+}
+
+// rolloutLine is a line of a rollout. Current rollouts wrap each record as
+// {timestamp, type, payload}; older ones hold bare response items, after a
+// first line with the session metadata.
+type rolloutLine struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// rolloutMeta is the session metadata a rollout starts with
+type rolloutMeta struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Cwd       string    `json:"cwd"`
+}
+
+// rolloutItem is a response item: a message, reasoning, or a tool call or
+// its output
+type rolloutItem struct {
+	Type      string           `json:"type"`
+	Role      string           `json:"role,omitempty"`
+	Content   []rolloutContent `json:"content,omitempty"`
+	Summary   []rolloutContent `json:"summary,omitempty"` // Reasoning
+	Name      string           `json:"name,omitempty"`
+	Arguments string           `json:"arguments,omitempty"` // JSON-encoded function call arguments
+	Input     string           `json:"input,omitempty"`     // Custom tool call input
+	CallID    string           `json:"call_id,omitempty"`
+	Output    json.RawMessage  `json:"output,omitempty"`
+	Action    json.RawMessage  `json:"action,omitempty"` // Local shell and web search calls
+}
+
+// rolloutContent is a content part of a message, or of a reasoning summary
+type rolloutContent struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// shellTools are the names Codex versions have given their shell tool
+var shellTools = map[string]bool{
+	"shell":          true,
+	"container.exec": true,
+	"shell_command":  true,
+	"exec_command":   true,
+	"local_shell":    true,
+}
+
+// contextPrefixes start the user messages Codex adds itself, which are not
+// prompts: the environment, and the user's and AGENTS.md instructions
+var contextPrefixes = []string{
+	"<environment_context>",
+	"<user_instructions>",
+	"<INSTRUCTIONS>",
+	"# AGENTS.md instructions",
+}
+
+// CodexHomeDir returns the Codex CLI home directory: $CODEX_HOME, or ~/.codex
+func CodexHomeDir() (string, error) {
+	if dir := os.Getenv("CODEX_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".codex"), nil
+}
+
+// SessionsDir returns the directory Codex CLI keeps session rollouts in
+func SessionsDir() (string, error) {
+	home, err := CodexHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "sessions"), nil
+}
+
+// FindRollouts returns the rollouts under sessionsDir of sessions that ran
+// in rootPath or one of its subdirectories, oldest first
+func FindRollouts(sessionsDir, rootPath string) ([]Rollout, error) {
+	var rollouts []Rollout
+	err := walkRollouts(sessionsDir, func(path string) bool {
+		rollout, err := readRolloutHeader(path)
+		if err == nil && rollout.SessionID != "" && withinDir(rollout.Cwd, rootPath) {
+			rollouts = append(rollouts, rollout)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(rollouts, func(i, j int) bool {
+		return rollouts[i].StartedAt.Before(rollouts[j].StartedAt)
+	})
+	return rollouts, nil
+}
+
+// FindRollout returns the path of the rollout of a session under
+// sessionsDir. Rollout file names end with the session ID.
+func FindRollout(sessionsDir, sessionID string) (string, error) {
+	found := ""
+	if sessionID != "" {
+		err := walkRollouts(sessionsDir, func(path string) bool {
+			if strings.HasSuffix(filepath.Base(path), "-"+sessionID+".jsonl") {
+				found = path
+			}
+			return found == ""
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("no rollout found for session %s", sessionID)
+	}
+	return found, nil
+}
+
+// walkRollouts calls fn with the path of each rollout file under
+// sessionsDir, until it returns false. A missing directory has none.
+func walkRollouts(sessionsDir string, fn func(path string) bool) error {
+	err := filepath.WalkDir(sessionsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == sessionsDir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() || !strings.HasPrefix(name, "rollout-") || !strings.HasSuffix(name, ".jsonl") {
+			return nil
+		}
+		if !fn(path) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return err
+}
+
+// readRolloutHeader reads the session ID, working directory and start time
+// of a rollout from the metadata it starts with
+func readRolloutHeader(path string) (Rollout, error) {
+	rollout := Rollout{Path: path}
+	err := readRolloutLines(path, func(line *rolloutLine, raw []byte) bool {
+		meta, ok := sessionMeta(line, raw)
+		if ok {
+			rollout.SessionID, rollout.Cwd, rollout.StartedAt = meta.ID, meta.Cwd, meta.Timestamp
+		}
+		// Older rollouts record the working directory in the environment
+		// context message rather than the metadata
+		if rollout.Cwd == "" {
+			if item, ok := responseItem(line, raw); ok && item.Type == "message" && item.Role == "user" {
+				rollout.Cwd = environmentCwd(joinContent(item.Content))
+			}
+		}
+		return rollout.SessionID == "" || rollout.Cwd == ""
+	})
+	return rollout, err
+}
+
+// readRolloutLines calls fn for each line of a rollout until it returns
+// false. Lines that are not valid JSON are skipped; lines may be far larger
+// than a bufio.Scanner allows, since command output is inlined.
+func readRolloutLines(path string, fn func(line *rolloutLine, raw []byte) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if len(raw) > 0 {
+			var line rolloutLine
+			if json.Unmarshal(raw, &line) == nil && !fn(&line, raw) {
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sessionMeta returns the session metadata a line records, if it does
+func sessionMeta(line *rolloutLine, raw []byte) (rolloutMeta, bool) {
+	var meta rolloutMeta
+	switch {
+	case line.Type == "session_meta" && line.Payload != nil:
+		if json.Unmarshal(line.Payload, &meta) != nil {
+			return meta, false
+		}
+	case line.Type == "" && line.Payload == nil:
+		// Older rollouts: a first line of bare metadata
+		if json.Unmarshal(raw, &meta) != nil {
+			return meta, false
+		}
+	default:
+		return meta, false
+	}
+	return meta, meta.ID != ""
+}
+
+// responseItem returns the response item a line records, if it does
+func responseItem(line *rolloutLine, raw []byte) (rolloutItem, bool) {
+	var item rolloutItem
+	switch {
+	case line.Type == "response_item" && line.Payload != nil:
+		if json.Unmarshal(line.Payload, &item) != nil {
+			return item, false
+		}
+	case line.Payload == nil && line.Type != "":
+		// Older rollouts: bare response items
+		if json.Unmarshal(raw, &item) != nil {
+			return item, false
+		}
+	default:
+		return item, false
+	}
+	return item, item.Type != ""
+}
+
+// ParseRollout rebuilds the thread of a Codex session from its rollout:
+// every prompt, response and tool call, with the tool calls' output and
+// the times they were recorded
+func ParseRollout(path string, opts RolloutOptions) (*model.Thread, error) {
+	p := &rolloutParser{opts: opts, toolCallIndex: make(map[string][2]int)}
+	err := readRolloutLines(path, func(line *rolloutLine, raw []byte) bool {
+		if meta, ok := sessionMeta(line, raw); ok {
+			p.sessionID = meta.ID
+			p.timestamp = meta.Timestamp
+			return true
+		}
+		if item, ok := responseItem(line, raw); ok {
+			if !line.Timestamp.IsZero() {
+				p.timestamp = line.Timestamp
+			}
+			p.add(&item)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	thread := model.NewThread(agentName, p.sessionID, "", "")
+	thread.Status = model.ThreadStatusCompleted
+	for _, msg := range p.messages {
+		if len(thread.Messages) == 0 {
+			msg.ID = msg.ComputeHash()
+		}
+		thread.AddMessage(msg)
+	}
+	if len(thread.Messages) > 0 {
+		thread.StartedAt = thread.Messages[0].Timestamp
+		completed := thread.Messages[len(thread.Messages)-1].Timestamp
+		thread.CompletedAt = &completed
+	}
+	return thread, nil
+}
+
+// rolloutParser turns the response items of a rollout into messages.
+// Reasoning and tool calls belong to the assistant message they follow,
+// and each tool call output to its call.
+type rolloutParser struct {
+	opts          RolloutOptions
+	sessionID     string
+	timestamp     time.Time // Of the line being read
+	messages      []*model.Message
+	toolCallIndex map[string][2]int // Call ID -> message, tool call
+}
+
+func (p *rolloutParser) add(item *rolloutItem) {
+	switch item.Type {
+	case "message":
+		text := joinContent(item.Content)
+		switch item.Role {
+		case "user":
+			if text == "" || isContextMessage(text) {
+				return
+			}
+			p.append(model.RoleHuman, text)
+		case "assistant":
+			if text == "" {
+				return
+			}
+			// Fill in a message started by reasoning, or start one
+			if last := p.last(); last != nil && last.Content == "" && len(last.ToolCalls) == 0 {
+				last.Content = text
+				return
+			}
+			p.append(model.RoleAssistant, text)
+		}
+	case "reasoning":
+		if !p.opts.Thinking {
+			return
+		}
+		if text := joinContent(item.Summary); text != "" {
+			p.append(model.RoleAssistant, "").Thinking = text
+		}
+	case "function_call", "custom_tool_call", "local_shell_call", "web_search_call":
+		call := rolloutToolCall(item)
+		msg := p.last()
+		if msg == nil {
+			msg = p.append(model.RoleAssistant, "")
+		}
+		msg.ToolCalls = append(msg.ToolCalls, call)
+		if call.ID != "" {
+			p.toolCallIndex[call.ID] = [2]int{len(p.messages) - 1, len(msg.ToolCalls) - 1}
+		}
+	case "function_call_output", "custom_tool_call_output":
+		if at, ok := p.toolCallIndex[item.CallID]; ok {
+			p.messages[at[0]].ToolCalls[at[1]].Result = toolOutput(item.Output)
+		}
+	}
+}
+
+// last returns the last message if it is the assistant's
+func (p *rolloutParser) last() *model.Message {
+	if len(p.messages) == 0 || p.messages[len(p.messages)-1].Role != model.RoleAssistant {
+		return nil
+	}
+	return p.messages[len(p.messages)-1]
+}
+
+func (p *rolloutParser) append(role model.Role, content string) *model.Message {
+	msg := model.NewMessage(role, content, "", nil)
+	msg.Timestamp = p.timestamp
+	p.messages = append(p.messages, msg)
+	return msg
+}
+
+// rolloutToolCall converts a tool call item. Shell commands are recorded
+// as a command line, and patches - whether applied with the apply_patch
+// tool or through the shell - as the patch text.
+func rolloutToolCall(item *rolloutItem) model.ToolCall {
+	call := model.ToolCall{ID: item.CallID, Name: item.Name}
+
+	var args map[string]json.RawMessage
+	switch item.Type {
+	case "function_call":
+		json.Unmarshal([]byte(item.Arguments), &args)
+	case "local_shell_call":
+		call.Name = "local_shell"
+		json.Unmarshal(item.Action, &args)
+	case "web_search_call":
+		call.Name = "web_search"
+		call.Arguments = item.Action
+		return call
+	case "custom_tool_call":
+		args = map[string]json.RawMessage{}
+		args["input"], _ = json.Marshal(item.Input)
+	}
+
+	switch {
+	case shellTools[call.Name]:
+		command := commandLine(args["command"], args["cmd"])
+		if patch, ok := applyPatchCommand(args["command"]); ok {
+			call.Name = "apply_patch"
+			call.Arguments, _ = json.Marshal(map[string]string{"patch": patch})
+			return call
+		}
+		arguments := map[string]string{"command": command}
+		if workdir := stringValue(args["workdir"], args["working_directory"]); workdir != "" {
+			arguments["workdir"] = workdir
+		}
+		call.Name = "shell"
+		call.Arguments, _ = json.Marshal(arguments)
+	case call.Name == "apply_patch":
+		call.Arguments, _ = json.Marshal(map[string]string{"patch": stringValue(args["input"], args["patch"])})
+	case item.Type == "function_call" && json.Valid([]byte(item.Arguments)):
+		call.Arguments = json.RawMessage(item.Arguments)
+	default:
+		call.Arguments, _ = json.Marshal(args)
+	}
+	return call
+}
+
+// commandLine returns a shell command, given as a string or as an argument
+// list, as a command line. Commands run through a shell are given as the
+// script.
+func commandLine(values ...json.RawMessage) string {
+	for _, value := range values {
+		var argv []string
+		if json.Unmarshal(value, &argv) == nil && len(argv) > 0 {
+			if len(argv) == 3 && (argv[1] == "-lc" || argv[1] == "-c") {
+				return argv[2]
+			}
+			quoted := make([]string, len(argv))
+			for i, arg := range argv {
+				quoted[i] = shellQuote(arg)
+			}
+			return strings.Join(quoted, " ")
+		}
+		if s := stringValue(value); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// applyPatchCommand returns the patch of a shell command that runs
+// apply_patch, as Codex does for patches in some versions
+func applyPatchCommand(value json.RawMessage) (string, bool) {
+	var argv []string
+	if json.Unmarshal(value, &argv) != nil || len(argv) != 2 {
+		return "", false
+	}
+	if argv[0] != "apply_patch" && argv[0] != "applypatch" {
+		return "", false
+	}
+	return argv[1], true
+}
+
+// shellQuote quotes an argument for display if the shell would split it
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]{}~!#") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// toolOutput returns the text of a tool call output. Outputs are strings,
+// which for shell commands hold JSON with the output and exit code; older
+// rollouts record an object with the content.
+func toolOutput(raw json.RawMessage) string {
+	var output string
+	if json.Unmarshal(raw, &output) != nil {
+		var object struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(raw, &object)
+		output = object.Content
+	}
+	var shell struct {
+		Output *string `json:"output"`
+	}
+	if strings.HasPrefix(output, "{") && json.Unmarshal([]byte(output), &shell) == nil && shell.Output != nil {
+		return *shell.Output
+	}
+	return output
+}
+
+// stringValue returns the first of values that is a non-empty JSON string
+func stringValue(values ...json.RawMessage) string {
+	for _, value := range values {
+		var s string
+		if json.Unmarshal(value, &s) == nil && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// joinContent joins the text parts of a message or reasoning summary
+func joinContent(content []rolloutContent) string {
+	var parts []string
+	for _, part := range content {
+		if part.Text != "" {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// isContextMessage reports whether a user message is context Codex added
+// rather than a prompt
+func isContextMessage(text string) bool {
+	text = strings.TrimSpace(text)
+	for _, prefix := range contextPrefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// environmentCwd returns the working directory an environment context
+// message records
+func environmentCwd(text string) string {
+	_, rest, ok := strings.Cut(text, "<cwd>")
+	if !ok {
+		return ""
+	}
+	cwd, _, _ := strings.Cut(rest, "</cwd>")
+	return strings.TrimSpace(cwd)
+}
+
+// withinDir reports whether path is dir or inside it
+func withinDir(path, dir string) bool {
+	if path == "" {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,198 @@
+package codex
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sestinj/tin/internal/storage"
+)
+
+const testRollout = `{"timestamp":"2025-09-01T10:00:00.000Z","type":"session_meta","payload":{"id":"0199-abcd","timestamp":"2025-09-01T10:00:00.000Z","cwd":"/work/repo","originator":"codex_cli_rs","cli_version":"0.30.0"}}
+{"timestamp":"2025-09-01T10:00:00.100Z","type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"<environment_context>\n  <cwd>/work/repo</cwd>\n</environment_context>"}]}}
+{"timestamp":"2025-09-01T10:00:01.000Z","type":"response_item","payload":{"type":"message","role":"user","content":[{"type":"input_text","text":"fix the typo"}]}}
+{"timestamp":"2025-09-01T10:00:01.000Z","type":"event_msg","payload":{"type":"user_message","message":"fix the typo"}}
+{"timestamp":"2025-09-01T10:00:02.000Z","type":"turn_context","payload":{"cwd":"/work/repo","model":"gpt-5"}}
+{"timestamp":"2025-09-01T10:00:03.000Z","type":"response_item","payload":{"type":"reasoning","summary":[{"type":"summary_text","text":"Find the typo first"}],"encrypted_content":"xyz"}}
+{"timestamp":"2025-09-01T10:00:04.000Z","type":"response_item","payload":{"type":"function_call","name":"shell","arguments":"{\"command\":[\"bash\",\"-lc\",\"grep -rn teh .\"],\"workdir\":\"/work/repo\"}","call_id":"call_1"}}
+{"timestamp":"2025-09-01T10:00:05.000Z","type":"response_item","payload":{"type":"function_call_output","call_id":"call_1","output":"{\"output\":\"README.md:1:teh\\n\",\"metadata\":{\"exit_code\":0}}"}}
+not json
+{"timestamp":"2025-09-01T10:00:06.000Z","type":"response_item","payload":{"type":"custom_tool_call","name":"apply_patch","input":"*** Begin Patch\n*** Update File: README.md\n-teh\n+the\n*** End Patch","call_id":"call_2"}}
+{"timestamp":"2025-09-01T10:00:07.000Z","type":"response_item","payload":{"type":"custom_tool_call_output","call_id":"call_2","output":"Success. Updated the following files:\nM README.md\n"}}
+{"timestamp":"2025-09-01T10:00:08.000Z","type":"response_item","payload":{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Fixed the typo."}]}}
+`
+
+// Rollouts of Codex versions before session_meta wrapped records
+const testLegacyRollout = `{"id":"0196-old","timestamp":"2025-05-07T17:24:21.123Z","instructions":null}
+{"record_type":"state"}
+{"type":"message","role":"user","content":[{"type":"input_text","text":"<environment_context>\n  <cwd>/work/repo/sub</cwd>\n</environment_context>"}]}
+{"type":"message","role":"user","content":[{"type":"input_text","text":"list files"}]}
+{"type":"function_call","name":"shell","arguments":"{\"command\":[\"ls\",\"-la\"]}","call_id":"call_a"}
+{"type":"function_call_output","call_id":"call_a","output":{"content":"README.md","success":true}}
+{"type":"function_call","name":"shell","arguments":"{\"command\":[\"apply_patch\",\"*** Begin Patch\\n*** Add File: b.txt\\n+b\\n*** End Patch\"]}","call_id":"call_b"}
+{"type":"message","role":"assistant","content":[{"type":"output_text","text":"Done."}]}
+`
+
+func writeRollout(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseRollout(t *testing.T) {
+	path := writeRollout(t, t.TempDir(), "rollout-2025-09-01T10-00-00-0199-abcd.jsonl", testRollout)
+
+	thread, err := ParseRollout(path, RolloutOptions{})
+	if err != nil {
+		t.Fatalf("ParseRollout failed: %v", err)
+	}
+	if thread.AgentSessionID != "0199-abcd" || thread.Agent != "codex" {
+		t.Errorf("session = %s, agent = %s", thread.AgentSessionID, thread.Agent)
+	}
+	if len(thread.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d: %+v", len(thread.Messages), thread.Messages)
+	}
+	if thread.ID != thread.Messages[0].ID {
+		t.Error("thread ID is not the first message's ID")
+	}
+
+	prompt := thread.Messages[0]
+	if prompt.Content != "fix the typo" || !prompt.Timestamp.Equal(time.Date(2025, 9, 1, 10, 0, 1, 0, time.UTC)) {
+		t.Errorf("prompt = %q at %v", prompt.Content, prompt.Timestamp)
+	}
+
+	calls := thread.Messages[1].ToolCalls
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", calls)
+	}
+	var shell map[string]string
+	json.Unmarshal(calls[0].Arguments, &shell)
+	if calls[0].Name != "shell" || shell["command"] != "grep -rn teh ." || shell["workdir"] != "/work/repo" {
+		t.Errorf("shell call = %s %s", calls[0].Name, calls[0].Arguments)
+	}
+	if calls[0].Result != "README.md:1:teh\n" {
+		t.Errorf("shell result = %q", calls[0].Result)
+	}
+	var patch map[string]string
+	json.Unmarshal(calls[1].Arguments, &patch)
+	if calls[1].Name != "apply_patch" || patch["patch"] == "" || calls[1].Result == "" {
+		t.Errorf("patch call = %+v", calls[1])
+	}
+
+	if thread.Messages[2].Content != "Fixed the typo." || thread.CompletedAt == nil {
+		t.Errorf("response = %q", thread.Messages[2].Content)
+	}
+	if thread.Messages[1].Thinking != "" {
+		t.Error("reasoning recorded without the Thinking option")
+	}
+
+	// Reasoning starts the message of the tool calls that follow it
+	withThinking, _ := ParseRollout(path, RolloutOptions{Thinking: true})
+	if len(withThinking.Messages) != 3 || withThinking.Messages[1].Thinking != "Find the typo first" || len(withThinking.Messages[1].ToolCalls) != 2 {
+		t.Errorf("messages with thinking = %+v", withThinking.Messages)
+	}
+}
+
+func TestParseRollout_Legacy(t *testing.T) {
+	path := writeRollout(t, t.TempDir(), "rollout-2025-05-07T17-24-21-0196-old.jsonl", testLegacyRollout)
+
+	thread, err := ParseRollout(path, RolloutOptions{})
+	if err != nil {
+		t.Fatalf("ParseRollout failed: %v", err)
+	}
+	if thread.AgentSessionID != "0196-old" || len(thread.Messages) != 3 {
+		t.Fatalf("session %s with %d messages: %+v", thread.AgentSessionID, len(thread.Messages), thread.Messages)
+	}
+	calls := thread.Messages[1].ToolCalls
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", calls)
+	}
+	if string(calls[0].Arguments) != `{"command":"ls -la"}` || calls[0].Result != "README.md" {
+		t.Errorf("shell call = %s, result %q", calls[0].Arguments, calls[0].Result)
+	}
+	if calls[1].Name != "apply_patch" {
+		t.Errorf("patch run through the shell recorded as %s", calls[1].Name)
+	}
+	if thread.Messages[2].Content != "Done." {
+		t.Errorf("response = %q", thread.Messages[2].Content)
+	}
+}
+
+func TestFindRollouts(t *testing.T) {
+	sessionsDir := t.TempDir()
+	writeRollout(t, filepath.Join(sessionsDir, "2025", "09", "01"), "rollout-2025-09-01T10-00-00-0199-abcd.jsonl", testRollout)
+	writeRollout(t, filepath.Join(sessionsDir, "2025", "05", "07"), "rollout-2025-05-07T17-24-21-0196-old.jsonl", testLegacyRollout)
+	other := `{"timestamp":"2025-09-02T10:00:00Z","type":"session_meta","payload":{"id":"0199-other","timestamp":"2025-09-02T10:00:00Z","cwd":"/work/repo-old"}}` + "\n"
+	writeRollout(t, filepath.Join(sessionsDir, "2025", "09", "02"), "rollout-2025-09-02T10-00-00-0199-other.jsonl", other)
+
+	rollouts, err := FindRollouts(sessionsDir, "/work/repo")
+	if err != nil {
+		t.Fatalf("FindRollouts failed: %v", err)
+	}
+	if len(rollouts) != 2 || rollouts[0].SessionID != "0196-old" || rollouts[1].SessionID != "0199-abcd" {
+		t.Fatalf("rollouts = %+v", rollouts)
+	}
+	if rollouts[0].Cwd != "/work/repo/sub" {
+		t.Errorf("legacy rollout cwd = %q", rollouts[0].Cwd)
+	}
+
+	path, err := FindRollout(sessionsDir, "0199-abcd")
+	if err != nil || filepath.Base(path) != "rollout-2025-09-01T10-00-00-0199-abcd.jsonl" {
+		t.Errorf("FindRollout = %q, %v", path, err)
+	}
+	if _, err := FindRollout(sessionsDir, "missing"); err == nil {
+		t.Error("expected an error for a session without a rollout")
+	}
+	if rollouts, err := FindRollouts(filepath.Join(sessionsDir, "none"), "/work/repo"); err != nil || len(rollouts) != 0 {
+		t.Errorf("missing sessions dir: %v, %v", rollouts, err)
+	}
+}
+
+func TestSaveRolloutThread(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo, err := storage.Init(tmpDir)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// A thread recorded from a notification for the session, before its
+	// rollout could be found
+	t.Setenv("CODEX_HOME", t.TempDir())
+	payload := `{"type":"agent-turn-complete","thread-id":"0199-abcd","cwd":"` + tmpDir + `","input-messages":["fix the typo"],"last-assistant-message":"Fixed the typo."}`
+	event, err := ParseNotifyArgs([]string{payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewHandler(nil).HandleNotification(event); err != nil {
+		t.Fatalf("HandleNotification failed: %v", err)
+	}
+	before, _ := repo.FindThreadsBySessionID("0199-abcd")
+	if len(before) != 1 {
+		t.Fatalf("expected a notification thread, got %d", len(before))
+	}
+
+	path := writeRollout(t, t.TempDir(), "rollout-2025-09-01T10-00-00-0199-abcd.jsonl", testRollout)
+	thread, _ := ParseRollout(path, RolloutOptions{})
+	changed, err := SaveRolloutThread(repo, thread, true)
+	if err != nil || !changed {
+		t.Fatalf("SaveRolloutThread = %v, %v", changed, err)
+	}
+	after, _ := repo.FindThreadsBySessionID("0199-abcd")
+	if len(after) != 1 || after[0].ID != thread.ID || len(after[0].Messages) != 3 {
+		t.Fatalf("threads after sync = %+v", after)
+	}
+
+	// Saving the same rollout again changes nothing
+	again, _ := ParseRollout(path, RolloutOptions{})
+	if changed, err := SaveRolloutThread(repo, again, true); err != nil || changed {
+		t.Errorf("second SaveRolloutThread = %v, %v", changed, err)
+	}
+}
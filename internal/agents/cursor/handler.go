@@ -127,30 +127,30 @@ func (h *Handler) handleUserPrompt(repo *storage.Repository, event *agents.HookE
 		// Create new thread
 		thread = model.NewThread(agentName, event.SessionID, "", "")
 		thread.ID = fmt.Sprintf("cursor-%s", event.SessionID[:min(12, len(event.SessionID))])
-
-		// Save session state
-		if err := saveSessionState(repo.RootPath, event.SessionID, &SessionState{
-			SessionID: event.SessionID,
-			ThreadID:  thread.ID,
-			StartedAt: time.Now().UTC(),
-		}); err != nil {
-			return "", err
-		}
 	}
 
 	// Create human message
 	msg := model.NewMessage(model.RoleHuman, event.Prompt, "", nil)
 	thread.AddMessage(msg)
 
+	// Save session state, with a snapshot of the working tree that the
+	// turn's file edits are diffed against
+	startedAt := time.Now().UTC()
+	if state != nil {
+		startedAt = state.StartedAt
+	}
+	snapshot, _ := repo.GitSnapshot()
+	if err := saveSessionState(repo.RootPath, event.SessionID, &SessionState{
+		SessionID: event.SessionID,
+		ThreadID:  thread.ID,
+		StartedAt: startedAt,
+		Snapshot:  snapshot,
+	}); err != nil {
+		return thread.ID, err
+	}
+
 	// Handle thread ID change
 	if oldThreadID != "" && thread.ID != oldThreadID {
-		if err := saveSessionState(repo.RootPath, event.SessionID, &SessionState{
-			SessionID: event.SessionID,
-			ThreadID:  thread.ID,
-			StartedAt: state.StartedAt,
-		}); err != nil {
-			return thread.ID, err
-		}
 		repo.DeleteThread(oldThreadID)
 		repo.UnstageThread(oldThreadID)
 	}
@@ -191,8 +191,12 @@ func (h *Handler) handleStop(repo *storage.Repository, event *agents.HookEvent)
 		return "", nil // No thread found for this session
 	}
 
-	// Get assistant response from event
-	if event.Response == "" && len(event.ToolCalls) == 0 {
+	// Get assistant response from event, with the turn's file edits
+	toolCalls := event.ToolCalls
+	if state != nil {
+		toolCalls = append(append([]model.ToolCall(nil), toolCalls...), state.Edits...)
+	}
+	if event.Response == "" && len(toolCalls) == 0 {
 		return thread.ID, nil // No response to record
 	}
 
@@ -200,7 +204,7 @@ func (h *Handler) handleStop(repo *storage.Repository, event *agents.HookEvent)
 	gitHash, _ := repo.GetCurrentGitHash()
 
 	// Create assistant message
-	msg := model.NewMessage(model.RoleAssistant, event.Response, "", event.ToolCalls)
+	msg := model.NewMessage(model.RoleAssistant, event.Response, "", toolCalls)
 	msg.GitHashAfter = gitHash
 	thread.AddMessage(msg)
 
@@ -239,14 +243,31 @@ func (h *Handler) handleStop(repo *storage.Repository, event *agents.HookEvent)
 }
 
 func (h *Handler) handleFileEdit(repo *storage.Repository, event *agents.HookEvent) (string, error) {
-	// File edits are informational - we just note the git hash changed
 	state, _ := loadSessionState(repo.RootPath, event.SessionID)
-	if state == nil {
+	if state == nil || len(event.ToolCalls) == 0 {
 		return "", nil
 	}
 
-	// The file edit is captured via git hash on the next message
-	return state.ThreadID, nil
+	// Snapshot the working tree, so the edit's change can be shown on the
+	// tool call recorded for it at the end of the turn
+	after, err := repo.GitSnapshot()
+	if err != nil {
+		return state.ThreadID, nil // Not a git working tree
+	}
+	before := state.Snapshot
+	if before == "" {
+		before, _ = repo.GitTree("HEAD")
+	}
+	if before == "" || after == before {
+		return state.ThreadID, nil // Nothing changed
+	}
+
+	edit := event.ToolCalls[0]
+	edit.ID = fmt.Sprintf("%s-edit-%d", edit.ID, len(state.Edits)+1)
+	edit.Snapshot = &model.Snapshot{Before: before, After: after}
+	state.Edits = append(state.Edits, edit)
+	state.Snapshot = after
+	return state.ThreadID, saveSessionState(repo.RootPath, event.SessionID, state)
 }
 
 // SessionState tracks the current session for hooks
@@ -254,6 +275,10 @@ type SessionState struct {
 	SessionID string    `json:"session_id"`
 	ThreadID  string    `json:"thread_id"`
 	StartedAt time.Time `json:"started_at"`
+	// Snapshot is the working tree as of the last file edit or prompt, and
+	// Edits the turn's file edits, recorded as tool calls at its end
+	Snapshot string           `json:"snapshot,omitempty"`
+	Edits    []model.ToolCall `json:"edits,omitempty"`
 }
 
 func getSessionStatePath(rootPath, sessionID string) string {
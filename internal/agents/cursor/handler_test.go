@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/sestinj/tin/internal/agents"
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
 )
 
 func TestHandler_Info(t *testing.T) {
@@ -216,3 +219,43 @@ func TestGetSessionStatePath(t *testing.T) {
 		}
 	}
 }
+
+func TestHandler_FileEditSnapshots(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo, err := storage.Init(tmpDir)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	autoCommit := false
+	handler := NewHandler(&agents.Config{AutoCommitGit: &autoCommit})
+
+	path := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(path, []byte("one\n"), 0644)
+	if _, err := handler.HandleEvent(&agents.HookEvent{Type: agents.HookEventUserPrompt, SessionID: "conv-1", Cwd: tmpDir, Prompt: "change it"}); err != nil {
+		t.Fatalf("prompt failed: %v", err)
+	}
+
+	os.WriteFile(path, []byte("1\n"), 0644)
+	edit := model.ToolCall{ID: "gen-1", Name: "MultiEdit", Arguments: json.RawMessage(`{"file_path":"a.txt","edits":[{"old_string":"one","new_string":"1"}]}`)}
+	if _, err := handler.HandleEvent(&agents.HookEvent{Type: agents.HookEventFileEdit, SessionID: "conv-1", Cwd: tmpDir, ToolCalls: []model.ToolCall{edit}}); err != nil {
+		t.Fatalf("file edit failed: %v", err)
+	}
+	threadID, err := handler.HandleEvent(&agents.HookEvent{Type: agents.HookEventAssistantStop, SessionID: "conv-1", Cwd: tmpDir, Response: "Done"})
+	if err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+
+	thread, err := repo.LoadThread(threadID)
+	if err != nil {
+		t.Fatalf("LoadThread failed: %v", err)
+	}
+	last := thread.Messages[len(thread.Messages)-1]
+	if len(last.ToolCalls) != 1 || last.ToolCalls[0].Snapshot == nil {
+		t.Fatalf("edit not recorded with a snapshot: %+v", last.ToolCalls)
+	}
+	snapshot := last.ToolCalls[0].Snapshot
+	diff, err := repo.GitDiffSnapshots(snapshot.Before, snapshot.After)
+	if err != nil || !strings.Contains(diff, "-one") || !strings.Contains(diff, "+1") {
+		t.Errorf("snapshot diff = %q, %v", diff, err)
+	}
+}
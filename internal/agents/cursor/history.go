@@ -0,0 +1,479 @@
+package cursor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+// Cursor keeps its chat history in SQLite state databases (state.vscdb):
+// one per workspace under User/workspaceStorage/<hash>/, listing the
+// workspace's composer sessions (and, in older versions, holding its chat
+// tabs), and a global one under User/globalStorage/ holding the composer
+// sessions' messages ("bubbles"). They are read with the sqlite3 tool.
+
+const (
+	stateDBName         = "state.vscdb"
+	composerListKey     = "composer.composerData"
+	legacyChatKey       = "workbench.panel.aichat.view.aichat.chatdata"
+	bubbleTypeUser      = 1
+	bubbleTypeAssistant = 2
+)
+
+// Workspace is a Cursor workspace and its state database
+type Workspace struct {
+	Folder string // Folder the workspace was opened on
+	DBPath string
+}
+
+// Session is a composer session or chat tab recorded in a workspace
+type Session struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	Legacy    bool // A chat tab of older Cursor versions
+}
+
+// HistoryOptions selects what LoadSession records beyond the conversation
+type HistoryOptions struct {
+	Thinking bool // Record thinking on assistant messages
+}
+
+// composerList is the list of a workspace's composer sessions
+type composerList struct {
+	AllComposers []composerHead `json:"allComposers"`
+}
+
+type composerHead struct {
+	ComposerID string `json:"composerId"`
+	Name       string `json:"name"`
+	CreatedAt  int64  `json:"createdAt"` // Unix milliseconds
+}
+
+// composerData is a composer session. Current versions list its bubbles
+// in order and store each under its own key; older ones inline them.
+type composerData struct {
+	ComposerID   string         `json:"composerId"`
+	Name         string         `json:"name"`
+	CreatedAt    int64          `json:"createdAt"`
+	Conversation []bubble       `json:"conversation"`
+	Headers      []bubbleHeader `json:"fullConversationHeadersOnly"`
+}
+
+type bubbleHeader struct {
+	BubbleID string `json:"bubbleId"`
+	Type     int    `json:"type"`
+}
+
+// bubble is a message of a composer session: a prompt, or a piece of the
+// response - text, thinking or a tool call
+type bubble struct {
+	BubbleID       string          `json:"bubbleId"`
+	Type           int             `json:"type"`
+	Text           string          `json:"text"`
+	CreatedAt      json.RawMessage `json:"createdAt"` // RFC 3339 string or Unix milliseconds
+	Thinking       *bubbleThinking `json:"thinking,omitempty"`
+	ToolFormerData *bubbleToolCall `json:"toolFormerData,omitempty"`
+}
+
+type bubbleThinking struct {
+	Text string `json:"text"`
+}
+
+type bubbleToolCall struct {
+	ToolCallID string `json:"toolCallId"`
+	Name       string `json:"name"`
+	RawArgs    string `json:"rawArgs"`
+	Params     string `json:"params"`
+	Result     string `json:"result"`
+}
+
+// legacyChatData holds the chat tabs of older Cursor versions
+type legacyChatData struct {
+	Tabs []struct {
+		TabID        string `json:"tabId"`
+		ChatTitle    string `json:"chatTitle"`
+		LastSendTime int64  `json:"lastSendTime"`
+		Bubbles      []struct {
+			Type    string `json:"type"` // "user" or "ai"
+			Text    string `json:"text"`
+			RawText string `json:"rawText"`
+		} `json:"bubbles"`
+	} `json:"tabs"`
+}
+
+// UserDataDir returns Cursor's user data directory ("User") for this OS
+func UserDataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", "Cursor", "User"), nil
+	case "windows":
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "Cursor", "User"), nil
+		}
+		return filepath.Join(home, "AppData", "Roaming", "Cursor", "User"), nil
+	default:
+		if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+			return filepath.Join(config, "Cursor", "User"), nil
+		}
+		return filepath.Join(home, ".config", "Cursor", "User"), nil
+	}
+}
+
+// GlobalDBPath returns the path of the global state database
+func GlobalDBPath(userDir string) string {
+	return filepath.Join(userDir, "globalStorage", stateDBName)
+}
+
+// FindWorkspaces returns the workspaces under userDir opened on rootPath or
+// one of its subdirectories
+func FindWorkspaces(userDir, rootPath string) ([]Workspace, error) {
+	storageDir := filepath.Join(userDir, "workspaceStorage")
+	dirs, err := os.ReadDir(storageDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var workspaces []Workspace
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(storageDir, dir.Name(), "workspace.json"))
+		if err != nil {
+			continue
+		}
+		var workspace struct {
+			Folder string `json:"folder"`
+		}
+		if json.Unmarshal(data, &workspace) != nil {
+			continue
+		}
+		folder := folderPath(workspace.Folder)
+		dbPath := filepath.Join(storageDir, dir.Name(), stateDBName)
+		if folder == "" || !withinDir(folder, rootPath) {
+			continue
+		}
+		if _, err := os.Stat(dbPath); err == nil {
+			workspaces = append(workspaces, Workspace{Folder: folder, DBPath: dbPath})
+		}
+	}
+	return workspaces, nil
+}
+
+// ListSessions returns the composer sessions and chat tabs of a workspace,
+// oldest first
+func ListSessions(workspace Workspace) ([]Session, error) {
+	values, err := readItems(workspace.DBPath, composerListKey, legacyChatKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	var composers composerList
+	if json.Unmarshal([]byte(values[composerListKey]), &composers) == nil {
+		for _, c := range composers.AllComposers {
+			if c.ComposerID != "" {
+				sessions = append(sessions, Session{ID: c.ComposerID, Name: c.Name, CreatedAt: time.UnixMilli(c.CreatedAt).UTC()})
+			}
+		}
+	}
+	var chats legacyChatData
+	if json.Unmarshal([]byte(values[legacyChatKey]), &chats) == nil {
+		for _, tab := range chats.Tabs {
+			if tab.TabID != "" && len(tab.Bubbles) > 0 {
+				sessions = append(sessions, Session{ID: tab.TabID, Name: tab.ChatTitle, CreatedAt: time.UnixMilli(tab.LastSendTime).UTC(), Legacy: true})
+			}
+		}
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// LoadSession rebuilds a session of a workspace as a thread: every prompt
+// and response, and the tool calls with their results. Composer sessions'
+// messages are read from the global database at globalDB.
+func LoadSession(workspace Workspace, globalDB string, session Session, opts HistoryOptions) (*model.Thread, error) {
+	if session.Legacy {
+		return loadLegacyChat(workspace, session)
+	}
+
+	rows, err := querySQLite(globalDB, fmt.Sprintf(
+		"SELECT key, CAST(value AS TEXT) AS value FROM cursorDiskKV WHERE key = '%s' OR key LIKE '%s'",
+		sqlString("composerData:"+session.ID), sqlString("bubbleId:"+session.ID+":%")))
+	if err != nil {
+		return nil, err
+	}
+
+	var data composerData
+	bubbles := make(map[string]bubble)
+	for _, row := range rows {
+		if row.Key == "composerData:"+session.ID {
+			json.Unmarshal([]byte(row.Value), &data)
+			continue
+		}
+		var b bubble
+		if json.Unmarshal([]byte(row.Value), &b) == nil {
+			bubbles[strings.TrimPrefix(row.Key, "bubbleId:"+session.ID+":")] = b
+		}
+	}
+
+	conversation := data.Conversation
+	for _, header := range data.Headers {
+		if b, ok := bubbles[header.BubbleID]; ok {
+			conversation = append(conversation, b)
+		}
+	}
+
+	p := &historyParser{opts: opts, timestamp: session.CreatedAt}
+	if data.CreatedAt > 0 {
+		p.timestamp = time.UnixMilli(data.CreatedAt).UTC()
+	}
+	for i := range conversation {
+		p.add(&conversation[i])
+	}
+	return p.thread(session.ID), nil
+}
+
+// loadLegacyChat rebuilds a chat tab of older Cursor versions, which
+// records neither tool calls nor the times of its messages
+func loadLegacyChat(workspace Workspace, session Session) (*model.Thread, error) {
+	values, err := readItems(workspace.DBPath, legacyChatKey)
+	if err != nil {
+		return nil, err
+	}
+	var chats legacyChatData
+	json.Unmarshal([]byte(values[legacyChatKey]), &chats)
+
+	p := &historyParser{timestamp: session.CreatedAt}
+	for _, tab := range chats.Tabs {
+		if tab.TabID != session.ID {
+			continue
+		}
+		for _, b := range tab.Bubbles {
+			text := b.Text
+			if text == "" {
+				text = b.RawText
+			}
+			if text == "" {
+				continue
+			}
+			if b.Type == "user" {
+				p.append(model.RoleHuman, text)
+			} else {
+				p.append(model.RoleAssistant, text)
+			}
+		}
+	}
+	return p.thread(session.ID), nil
+}
+
+// historyParser turns the bubbles of a session into messages. Thinking and
+// tool calls belong to the assistant message they follow.
+type historyParser struct {
+	opts      HistoryOptions
+	timestamp time.Time // Of the bubble being read, or the last one that recorded it
+	messages  []*model.Message
+}
+
+func (p *historyParser) add(b *bubble) {
+	if t, ok := bubbleTime(b.CreatedAt); ok {
+		p.timestamp = t
+	}
+
+	if b.Type == bubbleTypeUser {
+		if strings.TrimSpace(b.Text) != "" {
+			p.append(model.RoleHuman, b.Text)
+		}
+		return
+	}
+	if b.Type != bubbleTypeAssistant {
+		return
+	}
+
+	if b.Thinking != nil && b.Thinking.Text != "" && p.opts.Thinking {
+		p.append(model.RoleAssistant, "").Thinking = b.Thinking.Text
+	}
+	if strings.TrimSpace(b.Text) != "" {
+		// Fill in a message started by thinking, or start one
+		if last := p.last(); last != nil && last.Content == "" && len(last.ToolCalls) == 0 {
+			last.Content = b.Text
+		} else {
+			p.append(model.RoleAssistant, b.Text)
+		}
+	}
+	if tool := b.ToolFormerData; tool != nil && tool.Name != "" {
+		msg := p.last()
+		if msg == nil {
+			msg = p.append(model.RoleAssistant, "")
+		}
+		msg.ToolCalls = append(msg.ToolCalls, model.ToolCall{
+			ID:        tool.ToolCallID,
+			Name:      tool.Name,
+			Arguments: toolArguments(tool),
+			Result:    toolResult(tool.Result),
+		})
+	}
+}
+
+// last returns the last message if it is the assistant's
+func (p *historyParser) last() *model.Message {
+	if len(p.messages) == 0 || p.messages[len(p.messages)-1].Role != model.RoleAssistant {
+		return nil
+	}
+	return p.messages[len(p.messages)-1]
+}
+
+func (p *historyParser) append(role model.Role, content string) *model.Message {
+	msg := model.NewMessage(role, content, "", nil)
+	msg.Timestamp = p.timestamp
+	p.messages = append(p.messages, msg)
+	return msg
+}
+
+// thread returns the completed thread of the session's messages
+func (p *historyParser) thread(sessionID string) *model.Thread {
+	thread := model.NewThread(agentName, sessionID, "", "")
+	thread.Status = model.ThreadStatusCompleted
+	for _, msg := range p.messages {
+		if len(thread.Messages) == 0 {
+			msg.ID = msg.ComputeHash()
+		}
+		thread.AddMessage(msg)
+	}
+	if len(thread.Messages) > 0 {
+		thread.StartedAt = thread.Messages[0].Timestamp
+		completed := thread.Messages[len(thread.Messages)-1].Timestamp
+		thread.CompletedAt = &completed
+	}
+	return thread
+}
+
+// toolArguments returns the arguments of a tool call as JSON
+func toolArguments(tool *bubbleToolCall) json.RawMessage {
+	for _, args := range []string{tool.RawArgs, tool.Params} {
+		if args != "" && json.Valid([]byte(args)) {
+			return json.RawMessage(args)
+		}
+	}
+	arguments, _ := json.Marshal(map[string]string{"input": tool.RawArgs})
+	return arguments
+}
+
+// toolResult returns the text of a tool call result. Terminal commands'
+// results are JSON holding the output.
+func toolResult(result string) string {
+	var terminal struct {
+		Output *string `json:"output"`
+	}
+	if strings.HasPrefix(result, "{") && json.Unmarshal([]byte(result), &terminal) == nil && terminal.Output != nil {
+		return *terminal.Output
+	}
+	return result
+}
+
+// bubbleTime parses the time a bubble was created, if it records one
+func bubbleTime(raw json.RawMessage) (time.Time, bool) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t.UTC(), err == nil
+	}
+	var ms int64
+	if json.Unmarshal(raw, &ms) == nil && ms > 0 {
+		return time.UnixMilli(ms).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// folderPath returns the local path of a workspace folder URI
+func folderPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	path := u.Path
+	// file:///c%3A/Users/... on Windows
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.Clean(filepath.FromSlash(path))
+}
+
+// withinDir reports whether path is dir or inside it
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// sqliteRow is a key-value row of a state database
+type sqliteRow struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// readItems returns the values of keys in a workspace database's ItemTable
+func readItems(dbPath string, keys ...string) (map[string]string, error) {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = "'" + sqlString(key) + "'"
+	}
+	rows, err := querySQLite(dbPath, fmt.Sprintf(
+		"SELECT key, CAST(value AS TEXT) AS value FROM ItemTable WHERE key IN (%s)", strings.Join(quoted, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, row := range rows {
+		values[row.Key] = row.Value
+	}
+	return values, nil
+}
+
+// querySQLite runs a query on a database with the sqlite3 tool, read-only
+// since Cursor may have the database open
+func querySQLite(dbPath, query string) ([]sqliteRow, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return nil, fmt.Errorf("reading Cursor history requires the sqlite3 command-line tool, which was not found on PATH (install it with e.g. 'brew install sqlite' or 'apt install sqlite3')")
+	}
+	cmd := exec.Command("sqlite3", "-readonly", "-json", dbPath, query)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("sqlite3 failed on %s: %s", dbPath, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	var rows []sqliteRow
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return rows, nil // No rows
+	}
+	if err := json.Unmarshal(output, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse sqlite3 output: %w", err)
+	}
+	return rows, nil
+}
+
+// sqlString escapes a string for a single-quoted SQL literal
+func sqlString(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
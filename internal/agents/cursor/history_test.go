@@ -0,0 +1,160 @@
+package cursor
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtureDB is a state database holding both a workspace's items (a composer
+// session and a legacy chat tab) and the global composer messages; see
+// testdata/state.sql
+const fixtureDB = "testdata/state.vscdb"
+
+// requireSQLite skips tests that read databases when the sqlite3 tool,
+// which history import depends on, is not installed
+func requireSQLite(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 command-line tool not installed")
+	}
+}
+
+// copyFixture copies the fixture database to path
+func copyFixture(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(fixtureDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeWorkspace creates a workspace storage directory opened on folder,
+// with the fixture as its database
+func writeWorkspace(t *testing.T, userDir, hash, folder string) Workspace {
+	t.Helper()
+	dir := filepath.Join(userDir, "workspaceStorage", hash)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	workspace, _ := json.Marshal(map[string]string{"folder": "file://" + folder})
+	if err := os.WriteFile(filepath.Join(dir, "workspace.json"), workspace, 0644); err != nil {
+		t.Fatal(err)
+	}
+	copyFixture(t, filepath.Join(dir, stateDBName))
+	return Workspace{Folder: folder, DBPath: filepath.Join(dir, stateDBName)}
+}
+
+// findSession returns the session with the given ID
+func findSession(t *testing.T, sessions []Session, id string) Session {
+	t.Helper()
+	for _, session := range sessions {
+		if session.ID == id {
+			return session
+		}
+	}
+	t.Fatalf("session %s not found in %+v", id, sessions)
+	return Session{}
+}
+
+func TestLoadSession_Composer(t *testing.T) {
+	requireSQLite(t)
+	userDir := t.TempDir()
+	workspace := writeWorkspace(t, userDir, "abc123", "/work/repo")
+	copyFixture(t, GlobalDBPath(userDir))
+
+	sessions, err := ListSessions(workspace)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	// Composer sessions and legacy chat tabs, oldest first
+	if len(sessions) != 2 || sessions[0].ID != "tab-1" || sessions[1].ID != "comp-1" || sessions[1].Name != "Fix typo" || sessions[1].Legacy {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+	session := sessions[1]
+
+	thread, err := LoadSession(workspace, GlobalDBPath(userDir), session, HistoryOptions{})
+	if err != nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+	if thread.Agent != "cursor" || thread.AgentSessionID != "comp-1" || thread.ID != thread.Messages[0].ID {
+		t.Errorf("thread = %s %s %s", thread.Agent, thread.AgentSessionID, thread.ID)
+	}
+	if len(thread.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d: %+v", len(thread.Messages), thread.Messages)
+	}
+	if thread.Messages[0].Content != "fix the typo" || !thread.Messages[0].Timestamp.Equal(time.Date(2025, 9, 1, 10, 0, 1, 0, time.UTC)) {
+		t.Errorf("prompt = %q at %v", thread.Messages[0].Content, thread.Messages[0].Timestamp)
+	}
+	calls := thread.Messages[1].ToolCalls
+	if len(calls) != 1 || calls[0].Name != "run_terminal_cmd" || string(calls[0].Arguments) != `{"command":"grep -rn teh ."}` || calls[0].Result != "README.md:1:teh" {
+		t.Errorf("tool calls = %+v", calls)
+	}
+	if thread.Messages[2].Content != "Fixed the typo." {
+		t.Errorf("response = %q", thread.Messages[2].Content)
+	}
+
+	// Thinking starts the message of the tool calls that follow it
+	withThinking, _ := LoadSession(workspace, GlobalDBPath(userDir), session, HistoryOptions{Thinking: true})
+	if len(withThinking.Messages) != 3 || withThinking.Messages[1].Thinking != "grep first" || len(withThinking.Messages[1].ToolCalls) != 1 {
+		t.Errorf("messages with thinking = %+v", withThinking.Messages)
+	}
+}
+
+func TestLoadSession_LegacyChat(t *testing.T) {
+	requireSQLite(t)
+	userDir := t.TempDir()
+	workspace := writeWorkspace(t, userDir, "def456", "/work/repo")
+
+	sessions, err := ListSessions(workspace)
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	session := findSession(t, sessions, "tab-1")
+	if !session.Legacy {
+		t.Fatalf("session = %+v", session)
+	}
+	thread, err := LoadSession(workspace, GlobalDBPath(userDir), session, HistoryOptions{})
+	if err != nil {
+		t.Fatalf("LoadSession failed: %v", err)
+	}
+	if len(thread.Messages) != 2 || thread.Messages[1].Content != "It starts the server." || thread.AgentSessionID != "tab-1" {
+		t.Errorf("thread = %+v", thread)
+	}
+}
+
+func TestFindWorkspaces(t *testing.T) {
+	userDir := t.TempDir()
+	writeWorkspace(t, userDir, "a", "/work/repo")
+	writeWorkspace(t, userDir, "b", "/work/repo/sub")
+	writeWorkspace(t, userDir, "c", "/work/repo-old")
+
+	workspaces, err := FindWorkspaces(userDir, "/work/repo")
+	if err != nil {
+		t.Fatalf("FindWorkspaces failed: %v", err)
+	}
+	if len(workspaces) != 2 {
+		t.Fatalf("workspaces = %+v", workspaces)
+	}
+	if workspaces, err := FindWorkspaces(filepath.Join(userDir, "none"), "/work/repo"); err != nil || len(workspaces) != 0 {
+		t.Errorf("missing user dir: %v, %v", workspaces, err)
+	}
+}
+
+func TestListSessions_RequiresSQLite(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, err := ListSessions(Workspace{DBPath: filepath.Join(t.TempDir(), "state.vscdb")})
+	if err == nil || !strings.Contains(err.Error(), "sqlite3") {
+		t.Errorf("expected an error naming the missing sqlite3 tool, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+-- Source of state.vscdb, a Cursor state database holding both a workspace's
+-- items and the global composer messages. Regenerate it with:
+--   rm state.vscdb && sqlite3 state.vscdb < state.sql
+
+CREATE TABLE ItemTable (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB);
+CREATE TABLE cursorDiskKV (key TEXT UNIQUE ON CONFLICT REPLACE, value BLOB);
+
+INSERT INTO ItemTable VALUES ('composer.composerData', CAST('{"allComposers":[{"composerId":"comp-1","name":"Fix typo","createdAt":1756720800000}]}' AS BLOB));
+INSERT INTO ItemTable VALUES ('workbench.panel.aichat.view.aichat.chatdata', CAST('{"tabs":[{"tabId":"tab-1","chatTitle":"Explain","lastSendTime":1700000000000,"bubbles":[{"type":"user","text":"what does main do?"},{"type":"ai","rawText":"It starts the server."}]},{"tabId":"tab-empty","bubbles":[]}]}' AS BLOB));
+
+INSERT INTO cursorDiskKV VALUES ('composerData:comp-1', CAST('{"composerId":"comp-1","createdAt":1756720800000,"fullConversationHeadersOnly":[{"bubbleId":"b1","type":1},{"bubbleId":"b2","type":2},{"bubbleId":"b3","type":2},{"bubbleId":"b4","type":2},{"bubbleId":"missing","type":2}]}' AS BLOB));
+INSERT INTO cursorDiskKV VALUES ('bubbleId:comp-1:b1', CAST('{"bubbleId":"b1","type":1,"text":"fix the typo","createdAt":"2025-09-01T10:00:01Z"}' AS BLOB));
+INSERT INTO cursorDiskKV VALUES ('bubbleId:comp-1:b2', CAST('{"bubbleId":"b2","type":2,"text":"","thinking":{"text":"grep first"},"createdAt":"2025-09-01T10:00:02Z"}' AS BLOB));
+INSERT INTO cursorDiskKV VALUES ('bubbleId:comp-1:b3', CAST('{"bubbleId":"b3","type":2,"text":"","createdAt":"2025-09-01T10:00:03Z","toolFormerData":{"toolCallId":"tool_1","name":"run_terminal_cmd","rawArgs":"{\"command\":\"grep -rn teh .\"}","result":"{\"output\":\"README.md:1:teh\",\"exitCode\":0}"}}' AS BLOB));
+INSERT INTO cursorDiskKV VALUES ('bubbleId:comp-1:b4', CAST('{"bubbleId":"b4","type":2,"text":"Fixed the typo.","createdAt":"2025-09-01T10:00:04Z"}' AS BLOB));
+INSERT INTO cursorDiskKV VALUES ('bubbleId:comp-2:b1', CAST('{"bubbleId":"b1","type":1,"text":"another session"}' AS BLOB));
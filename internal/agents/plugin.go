@@ -0,0 +1,437 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Agent plugins are executables named tin-agent-<name> on PATH, for agents
+// that are not built into tin. A plugin is run once per operation, as
+//
+//	tin-agent-<name> <operation>
+//
+// with a JSON request on stdin, and answers with a JSON response on stdout
+// (see docs/AGENT_PLUGINS.md). Its "info" operation declares the agent and
+// the paradigm whose operations it implements.
+const (
+	// PluginPrefix is the file name prefix of agent plugin executables
+	PluginPrefix = "tin-agent-"
+
+	// PluginProtocolVersion is the newest plugin protocol tin speaks
+	PluginProtocolVersion = 1
+
+	// pluginInfoTimeout bounds the info operation run during discovery
+	pluginInfoTimeout = 5 * time.Second
+)
+
+// pluginInfo is the response to the info operation
+type pluginInfo struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Paradigm    Paradigm `json:"paradigm"`
+	Version     string   `json:"version"`
+	Protocol    int      `json:"protocol"`
+}
+
+// pluginEvent is a HookEvent or NotifyEvent as sent to plugins
+type pluginEvent struct {
+	Type       string           `json:"type"`
+	SessionID  string           `json:"session_id,omitempty"`
+	Cwd        string           `json:"cwd,omitempty"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Prompt     string           `json:"prompt,omitempty"`
+	Response   string           `json:"response,omitempty"`
+	Message    string           `json:"message,omitempty"`
+	ToolCalls  []model.ToolCall `json:"tool_calls,omitempty"`
+	Transcript string           `json:"transcript,omitempty"`
+	RawPayload json.RawMessage  `json:"raw_payload,omitempty"`
+}
+
+// pluginRequest holds the arguments of every operation; each sets only
+// its own
+type pluginRequest struct {
+	ProjectDir string       `json:"project_dir,omitempty"`
+	Global     bool         `json:"global,omitempty"`
+	Event      *pluginEvent `json:"event,omitempty"`
+	SessionID  string       `json:"session_id,omitempty"`
+	Cwd        string       `json:"cwd,omitempty"`
+	Limit      int          `json:"limit,omitempty"`
+	ThreadID   string       `json:"thread_id,omitempty"`
+	Count      int          `json:"count,omitempty"`
+	Since      *time.Time   `json:"since,omitempty"`
+	IncludeGit bool         `json:"include_git,omitempty"`
+}
+
+// pluginResponse holds the results of every operation
+type pluginResponse struct {
+	Error     string          `json:"error,omitempty"`
+	Output    string          `json:"output,omitempty"` // Shown to the user
+	Installed bool            `json:"installed,omitempty"`
+	ThreadIDs []string        `json:"thread_ids,omitempty"`
+	Thread    *model.Thread   `json:"thread,omitempty"`
+	Threads   []*model.Thread `json:"threads,omitempty"`
+}
+
+// Plugin is an agent implemented by an external executable
+type Plugin struct {
+	Path    string
+	info    AgentInfo
+	timeout time.Duration // Of hook and notification operations
+}
+
+// LoadPlugin runs a plugin executable's info operation
+func LoadPlugin(path string) (*Plugin, error) {
+	p := &Plugin{Path: path, timeout: time.Duration(DefaultConfig().HookTimeout) * time.Second}
+
+	var info pluginInfo
+	if err := p.run("info", nil, pluginInfoTimeout, &info); err != nil {
+		return nil, err
+	}
+	if info.Name == "" {
+		return nil, fmt.Errorf("%s: info has no name", path)
+	}
+	switch info.Paradigm {
+	case ParadigmHook, ParadigmNotify, ParadigmPull:
+	default:
+		return nil, fmt.Errorf("%s: unknown paradigm %q", path, info.Paradigm)
+	}
+	if info.Protocol > PluginProtocolVersion {
+		return nil, fmt.Errorf("%s: needs plugin protocol %d; this tin speaks %d", path, info.Protocol, PluginProtocolVersion)
+	}
+	if info.DisplayName == "" {
+		info.DisplayName = info.Name
+	}
+
+	p.info = AgentInfo{Name: info.Name, DisplayName: info.DisplayName, Paradigm: info.Paradigm, Version: info.Version}
+	return p, nil
+}
+
+// Info returns metadata about the plugin's agent
+func (p *Plugin) Info() AgentInfo {
+	return p.info
+}
+
+// handler returns the plugin as the handler or adapter of its paradigm
+func (p *Plugin) handler() interface{} {
+	switch p.info.Paradigm {
+	case ParadigmHook:
+		return &pluginHookHandler{p}
+	case ParadigmNotify:
+		return &pluginNotifyHandler{p}
+	default:
+		return &pluginPullAdapter{p}
+	}
+}
+
+// call runs an operation of the plugin
+func (p *Plugin) call(op string, req *pluginRequest, timeout time.Duration) (*pluginResponse, error) {
+	var resp pluginResponse
+	if err := p.run(op, req, timeout, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s %s: %s", p.info.Name, op, resp.Error)
+	}
+	return &resp, nil
+}
+
+// run runs the plugin executable for op, and decodes its response into
+// resp. A timeout of zero runs it without one.
+func (p *Plugin) run(op string, req *pluginRequest, timeout time.Duration, resp interface{}) error {
+	name := p.info.Name
+	if name == "" {
+		name = filepath.Base(p.Path)
+	}
+
+	input := []byte("{}")
+	if req != nil {
+		var err error
+		if input, err = json.Marshal(req); err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Path, op)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s %s: timed out after %s", name, op, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s %s: %s", name, op, msg)
+		}
+		return fmt.Errorf("%s %s: %w", name, op, err)
+	}
+
+	if err := json.Unmarshal(stdout.Bytes(), resp); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", name, op, err)
+	}
+	return nil
+}
+
+// thread fills in what a plugin may leave out of a thread it returns: the
+// agent, the status, and the chain of message IDs that tin derives thread
+// IDs from. Plugins cannot choose message or thread IDs.
+func (p *Plugin) thread(thread *model.Thread, status model.ThreadStatus) *model.Thread {
+	if thread.Agent == "" {
+		thread.Agent = p.info.Name
+	}
+	if thread.Status == "" {
+		thread.Status = status
+	}
+
+	messages := thread.Messages
+	thread.ID = ""
+	thread.Messages = nil
+	for i := range messages {
+		msg := messages[i]
+		msg.ParentMessageID = ""
+		if len(thread.Messages) == 0 {
+			msg.ID = msg.ComputeHash()
+		}
+		thread.AddMessage(&msg)
+	}
+	if thread.StartedAt.IsZero() && len(thread.Messages) > 0 {
+		thread.StartedAt = thread.Messages[0].Timestamp
+	}
+	return thread
+}
+
+// save saves a thread returned by a hook or notification operation to the
+// tin repository containing cwd, and returns its ID
+func (p *Plugin) save(cwd string, thread *model.Thread, status model.ThreadStatus) (string, error) {
+	thread = p.thread(thread, status)
+	if len(thread.Messages) == 0 {
+		return "", nil
+	}
+
+	repo, err := storage.Open(cwd)
+	if err != nil {
+		return "", err
+	}
+	autoStage := DefaultConfig().AutoStage
+	if _, _, err := repo.SaveAgentThread(thread, autoStage == nil || *autoStage); err != nil {
+		return "", err
+	}
+	return thread.ID, nil
+}
+
+// pluginHookHandler implements HookHandler with a plugin
+type pluginHookHandler struct {
+	*Plugin
+}
+
+func (h *pluginHookHandler) Install(projectDir string, global bool) error {
+	resp, err := h.call("install", &pluginRequest{ProjectDir: projectDir, Global: global}, h.timeout)
+	if err != nil {
+		return err
+	}
+	printPluginOutput(resp)
+	return nil
+}
+
+func (h *pluginHookHandler) Uninstall(projectDir string, global bool) error {
+	resp, err := h.call("uninstall", &pluginRequest{ProjectDir: projectDir, Global: global}, h.timeout)
+	if err != nil {
+		return err
+	}
+	printPluginOutput(resp)
+	return nil
+}
+
+func (h *pluginHookHandler) IsInstalled(projectDir string, global bool) (bool, error) {
+	resp, err := h.call("is_installed", &pluginRequest{ProjectDir: projectDir, Global: global}, h.timeout)
+	if err != nil {
+		return false, err
+	}
+	return resp.Installed, nil
+}
+
+// HandleEvent sends the event to the plugin, and saves the thread it
+// returns, if any
+func (h *pluginHookHandler) HandleEvent(event *HookEvent) (string, error) {
+	resp, err := h.call("handle_event", &pluginRequest{Event: &pluginEvent{
+		Type:       string(event.Type),
+		SessionID:  event.SessionID,
+		Cwd:        event.Cwd,
+		Timestamp:  event.Timestamp,
+		Prompt:     event.Prompt,
+		Response:   event.Response,
+		ToolCalls:  event.ToolCalls,
+		Transcript: event.Transcript,
+		RawPayload: event.RawPayload,
+	}}, h.timeout)
+	if err != nil {
+		return "", err
+	}
+	if resp.Thread == nil {
+		return "", nil
+	}
+	return h.save(event.Cwd, resp.Thread, model.ThreadStatusActive)
+}
+
+// pluginNotifyHandler implements NotifyHandler with a plugin
+type pluginNotifyHandler struct {
+	*Plugin
+}
+
+func (h *pluginNotifyHandler) Setup(projectDir string) error {
+	resp, err := h.call("setup", &pluginRequest{ProjectDir: projectDir}, h.timeout)
+	if err != nil {
+		return err
+	}
+	printPluginOutput(resp)
+	return nil
+}
+
+// HandleNotification sends the event to the plugin, and saves the thread
+// it returns, if any
+func (h *pluginNotifyHandler) HandleNotification(event *NotifyEvent) error {
+	resp, err := h.call("handle_notification", &pluginRequest{Event: &pluginEvent{
+		Type:       string(event.Type),
+		SessionID:  event.SessionID,
+		Cwd:        event.Cwd,
+		Timestamp:  event.Timestamp,
+		Message:    event.Message,
+		RawPayload: event.RawPayload,
+	}}, h.timeout)
+	if err != nil {
+		return err
+	}
+	if resp.Thread == nil {
+		return nil
+	}
+	_, err = h.save(event.Cwd, resp.Thread, model.ThreadStatusActive)
+	return err
+}
+
+func (h *pluginNotifyHandler) SyncThread(sessionID string, cwd string) (*model.Thread, error) {
+	resp, err := h.call("sync_thread", &pluginRequest{SessionID: sessionID, Cwd: cwd}, h.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Thread == nil {
+		return nil, fmt.Errorf("%s: no thread for session %s", h.info.Name, sessionID)
+	}
+	if _, err := h.save(cwd, resp.Thread, model.ThreadStatusCompleted); err != nil {
+		return nil, err
+	}
+	return resp.Thread, nil
+}
+
+// pluginPullAdapter implements PullAdapter with a plugin. Pulls have no
+// timeout, as they may fetch many threads.
+type pluginPullAdapter struct {
+	*Plugin
+}
+
+func (a *pluginPullAdapter) List(limit int) ([]string, error) {
+	resp, err := a.call("list", &pluginRequest{Limit: limit}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.ThreadIDs, nil
+}
+
+func (a *pluginPullAdapter) Pull(threadID string, opts PullOptions) (*model.Thread, error) {
+	resp, err := a.call("pull", &pluginRequest{ThreadID: threadID, Since: opts.Since, IncludeGit: opts.IncludeGit}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Thread == nil {
+		return nil, fmt.Errorf("%s: thread %s not found", a.info.Name, threadID)
+	}
+	return a.thread(resp.Thread, model.ThreadStatusCompleted), nil
+}
+
+func (a *pluginPullAdapter) PullRecent(count int, opts PullOptions) ([]*model.Thread, error) {
+	resp, err := a.call("pull_recent", &pluginRequest{Count: count, Since: opts.Since, IncludeGit: opts.IncludeGit}, 0)
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]*model.Thread, 0, len(resp.Threads))
+	for _, thread := range resp.Threads {
+		if thread != nil {
+			threads = append(threads, a.thread(thread, model.ThreadStatusCompleted))
+		}
+	}
+	return threads, nil
+}
+
+func printPluginOutput(resp *pluginResponse) {
+	if resp.Output != "" {
+		fmt.Println(strings.TrimRight(resp.Output, "\n"))
+	}
+}
+
+// findPlugins returns the plugin executables in the directories of path, a
+// PATH-style list, by agent name. The first of several with the same name
+// wins, as it would when run from the shell.
+func findPlugins(path string) map[string]string {
+	plugins := make(map[string]string)
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry)
+			if !ok {
+				continue
+			}
+			if _, seen := plugins[name]; !seen {
+				plugins[name] = filepath.Join(dir, entry.Name())
+			}
+		}
+	}
+	return plugins
+}
+
+// pluginName returns the agent name of a plugin executable
+func pluginName(entry os.DirEntry) (string, bool) {
+	file := entry.Name()
+	if !strings.HasPrefix(file, PluginPrefix) || entry.IsDir() {
+		return "", false
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return "", false
+	}
+
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+			return "", false
+		}
+		file = strings.TrimSuffix(file, filepath.Ext(file))
+	} else if info.Mode()&0111 == 0 {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(file, PluginPrefix)
+	return name, name != ""
+}
@@ -0,0 +1,231 @@
+package agents
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/storage"
+)
+
+const testPluginThread = `{"agent_session_id":"sess-1","messages":[` +
+	`{"role":"human","content":"fix the typo","timestamp":"2025-09-01T10:00:00Z"},` +
+	`{"role":"assistant","content":"Fixed.","timestamp":"2025-09-01T10:00:05Z","tool_calls":[{"id":"t1","name":"edit","arguments":{"path":"README.md"},"result":"ok"}]}]}`
+
+// writePlugin writes a plugin shell script to dir that answers each
+// operation with its response, saving the request it was sent next to it
+func writePlugin(t *testing.T, dir, name string, responses map[string]string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugins are shell scripts")
+	}
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\ncat > \"$0.$1.json\"\ncase \"$1\" in\n")
+	for op, response := range responses {
+		script.WriteString(op + ") cat <<'EOF'\n" + response + "\nEOF\n;;\n")
+	}
+	script.WriteString("*) echo \"unknown operation: $1\" >&2; exit 1 ;;\nesac\n")
+
+	path := filepath.Join(dir, PluginPrefix+name)
+	if err := os.WriteFile(path, []byte(script.String()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// pluginRequestFile returns the last request a test plugin was sent for op
+func pluginRequestFile(t *testing.T, path, op string) map[string]interface{} {
+	t.Helper()
+	data, err := os.ReadFile(path + "." + op + ".json")
+	if err != nil {
+		t.Fatalf("no %s request: %v", op, err)
+	}
+	var req map[string]interface{}
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatalf("invalid %s request %s: %v", op, data, err)
+	}
+	return req
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	writePlugin(t, dir, "inhouse", map[string]string{
+		"info": `{"name":"inhouse","display_name":"In-house Agent","paradigm":"hook","version":"0.1.0","protocol":1}`,
+	})
+	writePlugin(t, dir, "batch", map[string]string{
+		"info": `{"name":"batch","paradigm":"pull","protocol":1}`,
+	})
+	writePlugin(t, dir, "builtin", map[string]string{"info": `{"name":"builtin","paradigm":"pull"}`})
+	writePlugin(t, dir, "future", map[string]string{"info": `{"name":"future","paradigm":"pull","protocol":99}`})
+	writePlugin(t, dir, "misnamed", map[string]string{"info": `{"name":"other","paradigm":"pull"}`})
+	writePlugin(t, dir, "broken", map[string]string{})
+	// Shadowed by the plugin of the same name earlier on the path
+	writePlugin(t, other, "batch", map[string]string{"info": `{"name":"batch","paradigm":"hook"}`})
+	// Not executable
+	os.WriteFile(filepath.Join(dir, PluginPrefix+"data"), []byte("{}"), 0644)
+
+	reg := NewRegistry()
+	reg.RegisterPullAdapter("builtin", &mockPullAdapter{name: "builtin"})
+	errs := reg.DiscoverPlugins(dir + string(os.PathListSeparator) + other)
+	if len(errs) != 3 {
+		t.Errorf("expected errors for future, misnamed and broken plugins, got %v", errs)
+	}
+
+	hook, ok := reg.GetHookHandler("inhouse")
+	if !ok {
+		t.Fatal("expected the hook plugin to be registered")
+	}
+	if info := hook.Info(); info.DisplayName != "In-house Agent" || info.Version != "0.1.0" || info.Paradigm != ParadigmHook {
+		t.Errorf("info = %+v", info)
+	}
+	if path, ok := reg.PluginPath("inhouse"); !ok || path != filepath.Join(dir, PluginPrefix+"inhouse") {
+		t.Errorf("PluginPath = %q, %v", path, ok)
+	}
+
+	if pull, ok := reg.GetPullAdapter("batch"); !ok || pull.Info().DisplayName != "batch" {
+		t.Error("expected the pull plugin earliest on the path to be registered")
+	}
+	if _, ok := reg.GetHookHandler("batch"); ok {
+		t.Error("shadowed plugin registered")
+	}
+	if _, ok := reg.PluginPath("builtin"); ok {
+		t.Error("plugin replaced a registered agent")
+	}
+	if len(reg.ListAll()) != 3 {
+		t.Errorf("agents = %+v", reg.ListAll())
+	}
+}
+
+func TestPlugin_HookHandler(t *testing.T) {
+	dir := t.TempDir()
+	path := writePlugin(t, dir, "inhouse", map[string]string{
+		"info":         `{"name":"inhouse","paradigm":"hook","protocol":1}`,
+		"install":      `{"output":"Added tin to inhouse.json"}`,
+		"is_installed": `{"installed":true}`,
+		"uninstall":    `{"error":"read-only config"}`,
+		"handle_event": `{"thread":` + testPluginThread + `}`,
+	})
+	plugin, err := LoadPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadPlugin failed: %v", err)
+	}
+	handler := plugin.handler().(HookHandler)
+
+	if err := handler.Install("/work/repo", true); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if req := pluginRequestFile(t, path, "install"); req["project_dir"] != "/work/repo" || req["global"] != true {
+		t.Errorf("install request = %v", req)
+	}
+	if installed, err := handler.IsInstalled("/work/repo", false); err != nil || !installed {
+		t.Errorf("IsInstalled = %v, %v", installed, err)
+	}
+	if err := handler.Uninstall("/work/repo", false); err == nil || !strings.Contains(err.Error(), "read-only config") {
+		t.Errorf("expected the plugin's error, got %v", err)
+	}
+
+	repoDir := t.TempDir()
+	repo, err := storage.Init(repoDir)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	event := &HookEvent{Type: HookEventAssistantStop, Cwd: repoDir, RawPayload: json.RawMessage(`{"session":"sess-1"}`)}
+	threadID, err := handler.HandleEvent(event)
+	if err != nil {
+		t.Fatalf("HandleEvent failed: %v", err)
+	}
+	req := pluginRequestFile(t, path, "handle_event")
+	sent, _ := req["event"].(map[string]interface{})
+	if sent["type"] != "assistant_stop" || sent["cwd"] != repoDir || sent["raw_payload"].(map[string]interface{})["session"] != "sess-1" {
+		t.Errorf("handle_event request = %v", req)
+	}
+
+	// The thread is saved under the ID tin derives from its messages
+	thread, err := repo.LoadThread(threadID)
+	if err != nil {
+		t.Fatalf("LoadThread failed: %v", err)
+	}
+	if thread.Agent != "inhouse" || thread.AgentSessionID != "sess-1" || len(thread.Messages) != 2 {
+		t.Fatalf("thread = %+v", thread)
+	}
+	if thread.ID != thread.Messages[0].ID || thread.Messages[1].ParentMessageID != thread.ID || thread.Messages[1].ToolCalls[0].Result != "ok" {
+		t.Errorf("messages = %+v", thread.Messages)
+	}
+	if staged, _ := repo.GetStagedThreads(); len(staged) != 1 {
+		t.Errorf("expected the thread to be staged, got %d", len(staged))
+	}
+
+	// The same thread again changes nothing
+	if again, err := handler.HandleEvent(event); err != nil || again != threadID {
+		t.Errorf("second HandleEvent = %s, %v", again, err)
+	}
+	if threads, _ := repo.FindThreadsBySessionID("sess-1"); len(threads) != 1 {
+		t.Errorf("expected 1 thread, got %d", len(threads))
+	}
+}
+
+func TestPlugin_PullAdapter(t *testing.T) {
+	dir := t.TempDir()
+	path := writePlugin(t, dir, "batch", map[string]string{
+		"info":        `{"name":"batch","paradigm":"pull"}`,
+		"list":        `{"thread_ids":["sess-1","sess-2"]}`,
+		"pull":        `{"thread":` + testPluginThread + `}`,
+		"pull_recent": `{"threads":[` + testPluginThread + `,null]}`,
+	})
+	plugin, err := LoadPlugin(path)
+	if err != nil {
+		t.Fatalf("LoadPlugin failed: %v", err)
+	}
+	adapter := plugin.handler().(PullAdapter)
+
+	ids, err := adapter.List(5)
+	if err != nil || len(ids) != 2 {
+		t.Errorf("List = %v, %v", ids, err)
+	}
+	if req := pluginRequestFile(t, path, "list"); req["limit"] != float64(5) {
+		t.Errorf("list request = %v", req)
+	}
+
+	thread, err := adapter.Pull("sess-1", PullOptions{IncludeGit: true})
+	if err != nil {
+		t.Fatalf("Pull failed: %v", err)
+	}
+	if thread.Agent != "batch" || thread.ID != thread.Messages[0].ID || thread.Status != "completed" || thread.StartedAt.IsZero() {
+		t.Errorf("thread = %+v", thread)
+	}
+	if req := pluginRequestFile(t, path, "pull"); req["thread_id"] != "sess-1" || req["include_git"] != true {
+		t.Errorf("pull request = %v", req)
+	}
+
+	threads, err := adapter.PullRecent(3, PullOptions{})
+	if err != nil || len(threads) != 1 || threads[0].ID != thread.ID {
+		t.Errorf("PullRecent = %+v, %v", threads, err)
+	}
+}
+
+func TestGlobalLookup_DiscoversOnlyOnMiss(t *testing.T) {
+	dir := t.TempDir()
+	path := writePlugin(t, dir, "spy", map[string]string{"info": `{"name":"spy","paradigm":"pull"}`})
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// Looking up a registered agent, under any paradigm, runs no plugins
+	Register(&mockHookHandler{name: "lookup-builtin"})
+	if _, ok := GetHook("lookup-builtin"); !ok {
+		t.Fatal("expected the registered agent")
+	}
+	GetNotify("lookup-builtin")
+	PluginPath("lookup-builtin")
+	if _, err := os.Stat(path + ".info.json"); err == nil {
+		t.Fatal("plugins were run to look up a registered agent")
+	}
+
+	if _, ok := GetPull("spy"); !ok {
+		t.Error("expected the plugin to be discovered for an unknown agent")
+	}
+	if _, err := os.Stat(path + ".info.json"); err != nil {
+		t.Error("expected the plugin to be asked for its info")
+	}
+}
@@ -2,6 +2,7 @@ package agents
 
 import (
 	"fmt"
+	"os"
 	"sync"
 )
 
@@ -11,6 +12,7 @@ type Registry struct {
 	hookHandlers  map[string]HookHandler
 	notifyHandlers map[string]NotifyHandler
 	pullAdapters  map[string]PullAdapter
+	plugins       map[string]string // Agent name -> plugin executable
 }
 
 // globalRegistry is the default registry instance
@@ -22,6 +24,7 @@ func NewRegistry() *Registry {
 		hookHandlers:   make(map[string]HookHandler),
 		notifyHandlers: make(map[string]NotifyHandler),
 		pullAdapters:   make(map[string]PullAdapter),
+		plugins:        make(map[string]string),
 	}
 }
 
@@ -121,8 +124,102 @@ func (r *Registry) ListAll() []AgentInfo {
 	return infos
 }
 
+// has reports whether an agent of any paradigm is registered by name
+func (r *Registry) has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, hook := r.hookHandlers[name]
+	_, notify := r.notifyHandlers[name]
+	_, pull := r.pullAdapters[name]
+	return hook || notify || pull
+}
+
+// DiscoverPlugins registers the agent plugins (tin-agent-<name>
+// executables) found in the directories of path, a PATH-style list.
+// Agents already registered, such as those built into tin, take precedence
+// over plugins of the same name. Plugins that cannot be loaded are skipped,
+// and returned as errors.
+func (r *Registry) DiscoverPlugins(path string) []error {
+	var errs []error
+	for name, file := range findPlugins(path) {
+		if r.has(name) {
+			continue
+		}
+		plugin, err := LoadPlugin(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if plugin.Info().Name != name {
+			errs = append(errs, fmt.Errorf("%s: declares agent %q, not %q", file, plugin.Info().Name, name))
+			continue
+		}
+
+		switch h := plugin.handler().(type) {
+		case HookHandler:
+			r.RegisterHookHandler(name, h)
+		case NotifyHandler:
+			r.RegisterNotifyHandler(name, h)
+		case PullAdapter:
+			r.RegisterPullAdapter(name, h)
+		}
+		r.mu.Lock()
+		r.plugins[name] = file
+		r.mu.Unlock()
+	}
+	return errs
+}
+
+// PluginPath returns the executable of an agent registered from a plugin
+func (r *Registry) PluginPath(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	path, ok := r.plugins[name]
+	return path, ok
+}
+
 // Global registry functions for convenience
 
+var (
+	discoverOnce sync.Once
+	pluginErrors []error
+)
+
+// discoverPlugins registers the plugins on PATH with the global registry,
+// the first time it is needed. Built-in agents register in init, before any
+// lookup.
+func discoverPlugins() {
+	discoverOnce.Do(func() {
+		pluginErrors = globalRegistry.DiscoverPlugins(os.Getenv("PATH"))
+	})
+}
+
+// PluginErrors returns the errors of plugins on PATH that failed to load
+func PluginErrors() []error {
+	discoverPlugins()
+	return pluginErrors
+}
+
+// PluginPath returns the executable of an agent registered from a plugin
+func PluginPath(name string) (string, bool) {
+	// Built-in agents take precedence, so are never plugins
+	if !globalRegistry.has(name) {
+		discoverPlugins()
+	}
+	return globalRegistry.PluginPath(name)
+}
+
+// lookup finds an agent in the global registry. Plugins are only discovered
+// for names that are not registered already, so that looking up a built-in
+// agent, as its hooks do on every event, never runs the plugins on PATH.
+func lookup[T any](name string, get func(string) (T, bool)) (T, bool) {
+	if handler, ok := get(name); ok || globalRegistry.has(name) {
+		return handler, ok
+	}
+	discoverPlugins()
+	return get(name)
+}
+
 // Register registers a handler/adapter with the global registry
 func Register(handler interface{}) error {
 	switch h := handler.(type) {
@@ -140,20 +237,21 @@ func Register(handler interface{}) error {
 
 // GetHook returns a hook handler from the global registry
 func GetHook(name string) (HookHandler, bool) {
-	return globalRegistry.GetHookHandler(name)
+	return lookup(name, globalRegistry.GetHookHandler)
 }
 
 // GetNotify returns a notify handler from the global registry
 func GetNotify(name string) (NotifyHandler, bool) {
-	return globalRegistry.GetNotifyHandler(name)
+	return lookup(name, globalRegistry.GetNotifyHandler)
 }
 
 // GetPull returns a pull adapter from the global registry
 func GetPull(name string) (PullAdapter, bool) {
-	return globalRegistry.GetPullAdapter(name)
+	return lookup(name, globalRegistry.GetPullAdapter)
 }
 
 // List returns all registered agent infos from the global registry
 func List() []AgentInfo {
+	discoverPlugins()
 	return globalRegistry.ListAll()
 }
@@ -6,7 +6,9 @@ import (
 	"strings"
 
 	"github.com/sestinj/tin/internal/agents"
+	"github.com/sestinj/tin/internal/storage"
 	// Import agent packages to trigger their init() registration
+	_ "github.com/sestinj/tin/internal/agents/aider"
 	_ "github.com/sestinj/tin/internal/agents/amp"
 	_ "github.com/sestinj/tin/internal/agents/claudecode"
 	_ "github.com/sestinj/tin/internal/agents/codex"
@@ -28,6 +30,8 @@ func Agents(args []string) error {
 		return agentsList()
 	case "status":
 		return agentsStatus(subargs)
+	case "watch":
+		return agentsWatch(subargs)
 	case "-h", "--help":
 		printAgentsHelp()
 		return nil
@@ -82,33 +86,43 @@ func agentsList() error {
 	}
 
 	if len(pullAgents) > 0 {
-		fmt.Println("Pull-based (manual sync):")
+		fmt.Println("Pull-based (manual sync or 'tin agents watch'):")
 		for _, info := range pullAgents {
-			fmt.Printf("  %-15s %s\n", info.Name, info.DisplayName)
+			status := getAgentStatus(info.Name)
+			fmt.Printf("  %-15s %s %s\n", info.Name, info.DisplayName, status)
 		}
 		fmt.Println()
 	}
 
+	for _, err := range agents.PluginErrors() {
+		fmt.Fprintf(os.Stderr, "Warning: agent plugin not loaded: %v\n", err)
+	}
+
 	return nil
 }
 
 func getAgentStatus(name string) string {
 	cwd, _ := os.Getwd()
 
+	plugin := ""
+	if path, ok := agents.PluginPath(name); ok {
+		plugin = fmt.Sprintf(" [plugin: %s]", path)
+	}
+
 	// Check if hooks are installed for hook-based agents
 	if handler, ok := agents.GetHook(name); ok {
 		installed, _ := handler.IsInstalled(cwd, false)
 		globalInstalled, _ := handler.IsInstalled(cwd, true)
 		if installed {
-			return "(hooks installed: project)"
+			return "(hooks installed: project)" + plugin
 		}
 		if globalInstalled {
-			return "(hooks installed: global)"
+			return "(hooks installed: global)" + plugin
 		}
-		return "(not installed)"
+		return "(not installed)" + plugin
 	}
 
-	return ""
+	return strings.TrimSpace(plugin)
 }
 
 func agentsStatus(args []string) error {
@@ -141,11 +155,28 @@ func agentsStatus(args []string) error {
 			}
 
 		case agents.ParadigmNotify:
+			if _, ok := agents.PluginPath(info.Name); ok {
+				fmt.Printf("  Run 'tin hooks install --%s' to set it up\n", info.Name)
+				break
+			}
 			fmt.Println("  Status: requires manual config.toml setup")
 			fmt.Printf("  Run 'tin %s setup' for instructions\n", info.Name)
 
 		case agents.ParadigmPull:
-			fmt.Println("  Status: pull-based (use 'tin amp pull' to sync)")
+			if _, ok := agents.PluginPath(info.Name); ok {
+				fmt.Println("  Status: pull-based (use 'tin agents watch' to sync)")
+			} else if info.Name == "aider" {
+				fmt.Println("  Status: pull-based (use 'tin aider import' to sync)")
+			} else {
+				fmt.Printf("  Status: pull-based (use 'tin %s pull' to sync)\n", info.Name)
+			}
+			if repo, err := storage.Open(cwd); err == nil {
+				if pid, running := watcherRunning(repo); running {
+					fmt.Printf("  Watcher: running (pid %d)\n", pid)
+				} else {
+					fmt.Println("  Watcher: not running")
+				}
+			}
 		}
 		fmt.Println()
 	}
@@ -289,12 +320,16 @@ Usage: tin agents <command>
 Commands:
   list      List all registered agents
   status    Show agent status in current directory
+  watch     Import pull-based agents' threads as they change
 
 Agent Types:
   Hook-based (real-time):     claude-code, cursor
   Notification-based:         codex
-  Pull-based (manual sync):   amp
+  Pull-based (manual sync):   amp, aider
 
 Use "tin hooks install --<agent>" to install hooks for specific agents.
-Use "tin <agent> pull" for pull-based agents.`)
+Use "tin <agent> pull" or "tin agents watch" for pull-based agents.
+
+Agents not built into tin can be added as plugins: executables named
+tin-agent-<agent> on PATH (see docs/AGENT_PLUGINS.md).`)
 }
@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sestinj/tin/internal/agents/aider"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Aider handles the "tin aider" command
+func Aider(args []string) error {
+	if len(args) == 0 {
+		printAiderHelp()
+		return nil
+	}
+
+	subcmd := args[0]
+	subargs := args[1:]
+
+	switch subcmd {
+	case "import":
+		return aiderImport(subargs)
+	case "-h", "--help":
+		printAiderHelp()
+		return nil
+	default:
+		return fmt.Errorf("unknown aider subcommand: %s", subcmd)
+	}
+}
+
+func aiderImport(args []string) error {
+	dryRun := false
+	stage := true
+
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--no-stage":
+			stage = false
+		case "-h", "--help":
+			printAiderImportHelp()
+			return nil
+		default:
+			return fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	repo, err := storage.Open(cwd)
+	if err != nil {
+		return fmt.Errorf("not a tin repository (run 'tin init' first)")
+	}
+
+	chatPath, _ := aider.HistoryPaths(repo.RootPath)
+	threads, err := aider.LoadThreads(repo.RootPath)
+	if os.IsNotExist(err) {
+		fmt.Printf("No Aider chat history found at %s\n", chatPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	imported, updated, skipped := 0, 0, 0
+	for _, thread := range threads {
+		preview := ""
+		if first := thread.FirstHumanMessage(); first != nil {
+			preview = first.Preview(60)
+		}
+		if dryRun {
+			if existing, _ := repo.FindThreadsBySessionID(thread.AgentSessionID); len(existing) > 0 &&
+				existing[0].ComputeContentHash() == thread.ComputeContentHash() {
+				skipped++
+				continue
+			}
+			fmt.Printf("Would import session %s: %d messages, %s  %s\n",
+				thread.AgentSessionID, len(thread.Messages), thread.StartedAt.Local().Format("2006-01-02 15:04"), preview)
+			imported++
+			continue
+		}
+
+		// Sessions are deduplicated by session ID, and the last one is
+		// updated as Aider appends to it
+		existed, changed, err := repo.SaveAgentThread(thread, stage)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !changed:
+			skipped++
+		case existed:
+			fmt.Printf("Updated thread %s (%d messages)  %s\n", thread.ID[:8], len(thread.Messages), preview)
+			updated++
+		default:
+			fmt.Printf("Imported thread %s (%d messages)  %s\n", thread.ID[:8], len(thread.Messages), preview)
+			imported++
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("Would import %d session(s); skipped %d unchanged\n", imported, skipped)
+		return nil
+	}
+	fmt.Printf("Imported %d session(s), updated %d; skipped %d unchanged\n", imported, updated, skipped)
+	if imported+updated > 0 && stage {
+		fmt.Println("Imported threads are staged; run 'tin commit' to record them")
+	}
+	return nil
+}
+
+func printAiderHelp() {
+	fmt.Println(`Work with Aider sessions
+
+Usage: tin aider <command>
+
+Commands:
+  import    Import Aider chat sessions from this repository's history
+
+Aider has no hooks; run 'tin aider import' after using it, or keep
+sessions imported with 'tin agents watch'.`)
+}
+
+func printAiderImportHelp() {
+	fmt.Println(`Import Aider chat sessions from this repository's history
+
+Usage: tin aider import [--dry-run] [--no-stage]
+
+Reads the chat history Aider keeps in the repository root
+(.aider.chat.history.md) and splits it into sessions, each imported as a
+thread. Prompt times are taken from .aider.input.history. Each response is
+linked to the commit Aider made for it, matched by its abbreviated hash,
+or by its message and time if the commit has since been amended or
+rebased. $AIDER_CHAT_HISTORY_FILE and $AIDER_INPUT_HISTORY_FILE are
+honored, as they are by Aider.
+
+Sessions tin already tracks are only updated if Aider has added to them,
+so the command is safe to run repeatedly.
+
+Options:
+  -n, --dry-run    List the sessions that would be imported
+  --no-stage       Save imported threads without staging them`)
+}
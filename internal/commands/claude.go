@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sestinj/tin/internal/agents/claudecode"
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Claude handles the "tin claude" command
+func Claude(args []string) error {
+	if len(args) == 0 {
+		printClaudeHelp()
+		return nil
+	}
+
+	subcmd := args[0]
+	subargs := args[1:]
+
+	switch subcmd {
+	case "import":
+		return claudeImport(subargs)
+	case "-h", "--help":
+		printClaudeHelp()
+		return nil
+	default:
+		return fmt.Errorf("unknown claude subcommand: %s", subcmd)
+	}
+}
+
+func claudeImport(args []string) error {
+	var projectsDir string
+	dryRun := false
+	stage := true
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dir":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--dir requires a path")
+			}
+			projectsDir = args[i+1]
+			i++
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--no-stage":
+			stage = false
+		case "-h", "--help":
+			printClaudeImportHelp()
+			return nil
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	repo, err := storage.Open(cwd)
+	if err != nil {
+		return fmt.Errorf("not a tin repository (run 'tin init' first)")
+	}
+
+	if projectsDir == "" {
+		configDir, err := claudecode.ClaudeConfigDir()
+		if err != nil {
+			return err
+		}
+		projectsDir = filepath.Join(configDir, "projects")
+	}
+	// Claude Code records the resolved working directory
+	rootPath := repo.RootPath
+	if resolved, err := filepath.EvalSymlinks(rootPath); err == nil {
+		rootPath = resolved
+	}
+
+	transcripts, err := claudecode.FindTranscripts(projectsDir, rootPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", projectsDir, err)
+	}
+	if len(transcripts) == 0 {
+		fmt.Printf("No Claude Code sessions found for %s in %s\n", rootPath, projectsDir)
+		return nil
+	}
+
+	opts := claudecode.TranscriptOptions{}
+	if config, err := repo.ReadConfig(); err == nil {
+		opts.Thinking = config.CaptureThinking
+	}
+
+	// Sessions tin already tracks, whether captured by hooks or imported
+	known := make(map[string]bool)
+	threads, _ := repo.ListThreads()
+	for _, t := range threads {
+		if t.AgentSessionID != "" {
+			known[t.AgentSessionID] = true
+		}
+	}
+
+	imported, skipped := 0, 0
+	for _, transcript := range transcripts {
+		if known[transcript.SessionID] {
+			skipped++
+			continue
+		}
+		thread, subagents, err := claudecode.ParseTranscript(transcript.Path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read %s: %v\n", transcript.Path, err)
+			continue
+		}
+		if len(thread.Messages) == 0 {
+			continue
+		}
+		known[transcript.SessionID] = true
+
+		preview := ""
+		if first := thread.FirstHumanMessage(); first != nil {
+			preview = first.Preview(60)
+		}
+		note := ""
+		if len(subagents) > 0 {
+			note = fmt.Sprintf(", %d subagent(s)", len(subagents))
+		}
+		if dryRun {
+			fmt.Printf("Would import session %s: %d messages%s, %s  %s\n",
+				transcript.SessionID, len(thread.Messages), note, thread.StartedAt.Local().Format("2006-01-02 15:04"), preview)
+			imported++
+			continue
+		}
+
+		// Subagent runs are saved as child threads of the session's thread
+		for _, t := range append([]*model.Thread{thread}, subagents...) {
+			if err := repo.SaveThread(t); err != nil {
+				return fmt.Errorf("failed to save thread: %w", err)
+			}
+			if stage {
+				if err := repo.StageThread(t.ID, len(t.Messages), t.ComputeContentHash()); err != nil {
+					return fmt.Errorf("failed to stage thread: %w", err)
+				}
+			}
+		}
+		fmt.Printf("Imported thread %s (%d messages%s)  %s\n", thread.ID[:8], len(thread.Messages), note, preview)
+		imported++
+	}
+
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d session(s); skipped %d already tracked\n", verb, imported, skipped)
+	if imported > 0 && stage && !dryRun {
+		fmt.Println("Imported threads are staged; run 'tin commit' to record them")
+	}
+	return nil
+}
+
+func printClaudeHelp() {
+	fmt.Println(`Work with Claude Code sessions
+
+Usage: tin claude <command>
+
+Commands:
+  import    Import past Claude Code sessions for this repository
+
+Sessions are captured automatically once hooks are installed
+('tin hooks install'). Use 'tin claude import' for sessions from before that.`)
+}
+
+func printClaudeImportHelp() {
+	fmt.Println(`Import past Claude Code sessions for this repository
+
+Usage: tin claude import [--dry-run] [--no-stage] [--dir <projects-dir>]
+
+Reads the session transcripts Claude Code keeps under
+~/.claude/projects/ (or $CLAUDE_CONFIG_DIR/projects/) for this repository
+and its subdirectories, and rebuilds each session as a thread with every
+prompt, response, tool call and tool result, with their original times.
+
+Sessions that tin already tracks (by Claude Code session ID) are skipped,
+so the command is safe to run repeatedly.
+
+Options:
+  -n, --dry-run    List the sessions that would be imported
+  --no-stage       Save imported threads without staging them
+  --dir <path>     Read transcripts from this projects directory`)
+}
@@ -3,9 +3,11 @@ package commands
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/sestinj/tin/internal/agents"
-	_ "github.com/sestinj/tin/internal/agents/codex" // Register agent
+	"github.com/sestinj/tin/internal/agents/codex"
+	"github.com/sestinj/tin/internal/storage"
 )
 
 // Codex handles the "tin codex" command
@@ -16,10 +18,13 @@ func Codex(args []string) error {
 	}
 
 	subcmd := args[0]
+	subargs := args[1:]
 
 	switch subcmd {
 	case "setup":
 		return codexSetup()
+	case "import":
+		return codexImport(subargs)
 	case "-h", "--help":
 		printCodexHelp()
 		return nil
@@ -42,6 +47,133 @@ func codexSetup() error {
 	return handler.Setup(cwd)
 }
 
+func codexImport(args []string) error {
+	var sessionsDir string
+	dryRun := false
+	stage := true
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dir":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--dir requires a path")
+			}
+			sessionsDir = args[i+1]
+			i++
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--no-stage":
+			stage = false
+		case "-h", "--help":
+			printCodexImportHelp()
+			return nil
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	repo, err := storage.Open(cwd)
+	if err != nil {
+		return fmt.Errorf("not a tin repository (run 'tin init' first)")
+	}
+
+	if sessionsDir == "" {
+		sessionsDir, err = codex.SessionsDir()
+		if err != nil {
+			return err
+		}
+	}
+	// Codex records the resolved working directory
+	rootPath := repo.RootPath
+	if resolved, err := filepath.EvalSymlinks(rootPath); err == nil {
+		rootPath = resolved
+	}
+
+	rollouts, err := codex.FindRollouts(sessionsDir, rootPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", sessionsDir, err)
+	}
+	if len(rollouts) == 0 {
+		fmt.Printf("No Codex sessions found for %s in %s\n", rootPath, sessionsDir)
+		return nil
+	}
+
+	opts := codex.RolloutOptions{}
+	if config, err := repo.ReadConfig(); err == nil {
+		opts.Thinking = config.CaptureThinking
+	}
+
+	// Sessions tin already tracks, whose threads are rebuilt in place
+	known := make(map[string]bool)
+	threads, _ := repo.ListThreads()
+	for _, t := range threads {
+		if t.AgentSessionID != "" {
+			known[t.AgentSessionID] = true
+		}
+	}
+
+	imported, updated, unchanged := 0, 0, 0
+	for _, rollout := range rollouts {
+		thread, err := codex.ParseRollout(rollout.Path, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read %s: %v\n", rollout.Path, err)
+			continue
+		}
+		if len(thread.Messages) == 0 {
+			continue
+		}
+
+		preview := ""
+		if first := thread.FirstHumanMessage(); first != nil {
+			preview = first.Preview(60)
+		}
+		if dryRun {
+			verb := "import"
+			if known[rollout.SessionID] {
+				verb = "update"
+			}
+			fmt.Printf("Would %s session %s: %d messages, %s  %s\n",
+				verb, rollout.SessionID, len(thread.Messages), thread.StartedAt.Local().Format("2006-01-02 15:04"), preview)
+			if known[rollout.SessionID] {
+				updated++
+			} else {
+				imported++
+			}
+			continue
+		}
+
+		changed, err := codex.SaveRolloutThread(repo, thread, stage)
+		if err != nil {
+			return fmt.Errorf("failed to save thread: %w", err)
+		}
+		switch {
+		case !changed:
+			unchanged++
+		case known[rollout.SessionID]:
+			fmt.Printf("Updated thread %s (%d messages)  %s\n", thread.ID[:8], len(thread.Messages), preview)
+			updated++
+		default:
+			fmt.Printf("Imported thread %s (%d messages)  %s\n", thread.ID[:8], len(thread.Messages), preview)
+			imported++
+		}
+		known[rollout.SessionID] = true
+	}
+
+	if dryRun {
+		fmt.Printf("Would import %d session(s) and update %d\n", imported, updated)
+		return nil
+	}
+	fmt.Printf("Imported %d session(s), updated %d; %d already up to date\n", imported, updated, unchanged)
+	if imported+updated > 0 && stage {
+		fmt.Println("Imported threads are staged; run 'tin commit' to record them")
+	}
+	return nil
+}
+
 func printCodexHelp() {
 	fmt.Println(`Manage Codex CLI (OpenAI) agent integration
 
@@ -49,11 +181,34 @@ Usage: tin codex <command>
 
 Commands:
   setup    Show configuration instructions for Codex CLI
+  import   Import past Codex sessions for this repository
 
 Codex CLI uses a notification-based integration, which requires manual
 configuration of your config.toml file. Run 'tin codex setup' for
 detailed instructions.
 
-Note: Codex only supports the 'agent-turn-complete' notification event,
-so thread tracking is less comprehensive than hook-based agents.`)
+Codex only supports the 'agent-turn-complete' notification event, so on
+each notification tin rebuilds the thread from the session's rollout file
+in ~/.codex/sessions/. Use 'tin codex import' for sessions from before
+the integration was set up.`)
+}
+
+func printCodexImportHelp() {
+	fmt.Println(`Import past Codex sessions for this repository
+
+Usage: tin codex import [--dry-run] [--no-stage] [--dir <sessions-dir>]
+
+Reads the session rollouts Codex CLI keeps under ~/.codex/sessions/ (or
+$CODEX_HOME/sessions/) of sessions run in this repository and its
+subdirectories, and rebuilds each session as a thread with every prompt,
+response, shell command and patch, with their output and original times.
+
+Sessions that tin already tracks are rebuilt in place, replacing threads
+recorded from notifications that are not yet committed, so the command is
+safe to run repeatedly.
+
+Options:
+  -n, --dry-run    List the sessions that would be imported
+  --no-stage       Save imported threads without staging them
+  --dir <path>     Read rollouts from this sessions directory`)
 }
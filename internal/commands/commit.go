@@ -316,6 +316,11 @@ func shouldPromptForAmpPull(repo *storage.Repository) (bool, string) {
 		return false, ""
 	}
 
+	// A watcher is already pulling Amp threads
+	if _, running := watcherRunning(repo); running {
+		return false, ""
+	}
+
 	// Only prompt if the latest thread is from Amp (or there are no threads yet)
 	threads, err := repo.ListThreads()
 	if err != nil || len(threads) == 0 {
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/sestinj/tin/internal/remote"
@@ -11,9 +12,10 @@ import (
 
 // Known config keys with descriptions
 var configKeys = map[string]string{
-	"thread_host_url": "Base URL for tin web viewer (e.g., http://localhost:8080)",
-	"code_host_url":   "URL for code repository (e.g., https://github.com/user/repo)",
-	"auth_token":      "Authentication token for remote operations (th_xxx)",
+	"thread_host_url":  "Base URL for tin web viewer (e.g., http://localhost:8080)",
+	"code_host_url":    "URL for code repository (e.g., https://github.com/user/repo)",
+	"auth_token":       "Authentication token for remote operations (th_xxx)",
+	"capture_thinking": "Record agent thinking blocks in threads (true/false)",
 }
 
 func Config(args []string) error {
@@ -69,6 +71,10 @@ func configList() error {
 		fmt.Printf("auth_token = %s***\n", config.AuthToken[:min(6, len(config.AuthToken))])
 	}
 
+	if config.CaptureThinking {
+		fmt.Println("capture_thinking = true")
+	}
+
 	if len(config.Remotes) > 0 {
 		fmt.Println("\nRemotes:")
 		for _, r := range config.Remotes {
@@ -114,6 +120,8 @@ func configGet(args []string) error {
 		if config.AuthToken != "" {
 			fmt.Println(config.AuthToken)
 		}
+	case "capture_thinking":
+		fmt.Println(config.CaptureThinking)
 	case "version":
 		fmt.Println(config.Version)
 	default:
@@ -154,6 +162,12 @@ func configSet(args []string) error {
 		config.CodeHostURL = strings.TrimSuffix(value, "/")
 	case "auth_token":
 		config.AuthToken = value
+	case "capture_thinking":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("capture_thinking must be true or false")
+		}
+		config.CaptureThinking = enabled
 	default:
 		return fmt.Errorf("unknown config key: %s\n\nAvailable keys:\n%s", key, formatAvailableKeys())
 	}
@@ -266,13 +280,16 @@ Credentials Commands:
   credentials remove <host>            Remove credentials for a host
 
 Credentials are stored globally in ~/.config/tin/credentials (not in repo).
+They are sent to https:// and tin+tls:// remotes, but not over plaintext
+tin:// connections unless TIN_INSECURE_AUTH=1.
 
 Available config keys:
   thread_host_url  Base URL for tin web viewer (e.g., http://localhost:8080)
   code_host_url    URL for code repository (e.g., https://github.com/user/repo)
 
 Environment Variables:
-  TIN_AUTH   If set (format: user:pass), overrides all stored credentials
+  TIN_AUTH           If set (format: user:pass), overrides all stored credentials
+  TIN_INSECURE_AUTH  If 1, send credentials over plaintext tin:// connections
 
 Examples:
   tin config                                           # List all config
@@ -0,0 +1,195 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sestinj/tin/internal/agents/cursor"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Cursor handles the "tin cursor" command
+func Cursor(args []string) error {
+	if len(args) == 0 {
+		printCursorHelp()
+		return nil
+	}
+
+	subcmd := args[0]
+	subargs := args[1:]
+
+	switch subcmd {
+	case "import":
+		return cursorImport(subargs)
+	case "-h", "--help":
+		printCursorHelp()
+		return nil
+	default:
+		return fmt.Errorf("unknown cursor subcommand: %s", subcmd)
+	}
+}
+
+func cursorImport(args []string) error {
+	var userDir string
+	dryRun := false
+	stage := true
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dir":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--dir requires a path")
+			}
+			userDir = args[i+1]
+			i++
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--no-stage":
+			stage = false
+		case "-h", "--help":
+			printCursorImportHelp()
+			return nil
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	repo, err := storage.Open(cwd)
+	if err != nil {
+		return fmt.Errorf("not a tin repository (run 'tin init' first)")
+	}
+
+	if userDir == "" {
+		userDir, err = cursor.UserDataDir()
+		if err != nil {
+			return err
+		}
+	}
+	// Cursor records the resolved workspace folder
+	rootPath := repo.RootPath
+	if resolved, err := filepath.EvalSymlinks(rootPath); err == nil {
+		rootPath = resolved
+	}
+
+	workspaces, err := cursor.FindWorkspaces(userDir, rootPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", userDir, err)
+	}
+	if len(workspaces) == 0 {
+		fmt.Printf("No Cursor workspaces found for %s in %s\n", rootPath, userDir)
+		return nil
+	}
+
+	opts := cursor.HistoryOptions{}
+	if config, err := repo.ReadConfig(); err == nil {
+		opts.Thinking = config.CaptureThinking
+	}
+
+	// Sessions tin already tracks, whether captured by hooks or imported
+	known := make(map[string]bool)
+	threads, _ := repo.ListThreads()
+	for _, t := range threads {
+		if t.AgentSessionID != "" {
+			known[t.AgentSessionID] = true
+		}
+	}
+
+	globalDB := cursor.GlobalDBPath(userDir)
+	imported, skipped := 0, 0
+	for _, workspace := range workspaces {
+		sessions, err := cursor.ListSessions(workspace)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", workspace.DBPath, err)
+		}
+		for _, session := range sessions {
+			if known[session.ID] {
+				skipped++
+				continue
+			}
+			thread, err := cursor.LoadSession(workspace, globalDB, session, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to read session %s: %v\n", session.ID, err)
+				continue
+			}
+			if len(thread.Messages) == 0 {
+				continue
+			}
+			known[session.ID] = true
+
+			preview := session.Name
+			if first := thread.FirstHumanMessage(); first != nil {
+				preview = first.Preview(60)
+			}
+			if dryRun {
+				fmt.Printf("Would import session %s: %d messages, %s  %s\n",
+					session.ID, len(thread.Messages), thread.StartedAt.Local().Format("2006-01-02 15:04"), preview)
+				imported++
+				continue
+			}
+
+			if err := repo.SaveThread(thread); err != nil {
+				return fmt.Errorf("failed to save thread: %w", err)
+			}
+			if stage {
+				if err := repo.StageThread(thread.ID, len(thread.Messages), thread.ComputeContentHash()); err != nil {
+					return fmt.Errorf("failed to stage thread: %w", err)
+				}
+			}
+			fmt.Printf("Imported thread %s (%d messages)  %s\n", thread.ID[:8], len(thread.Messages), preview)
+			imported++
+		}
+	}
+
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d session(s); skipped %d already tracked\n", verb, imported, skipped)
+	if imported > 0 && stage && !dryRun {
+		fmt.Println("Imported threads are staged; run 'tin commit' to record them")
+	}
+	return nil
+}
+
+func printCursorHelp() {
+	fmt.Println(`Work with Cursor sessions
+
+Usage: tin cursor <command>
+
+Commands:
+  import    Import past Cursor chat sessions for this repository
+
+Sessions are captured automatically once hooks are installed
+('tin hooks install --cursor'). Use 'tin cursor import' for sessions from
+before that, or that the hooks missed.`)
+}
+
+func printCursorImportHelp() {
+	fmt.Println(`Import past Cursor chat sessions for this repository
+
+Usage: tin cursor import [--dry-run] [--no-stage] [--dir <user-dir>]
+
+Reads the chat history Cursor keeps in its local state databases for
+workspaces opened on this repository or its subdirectories, and rebuilds
+each composer session as a thread with every prompt, response and tool
+call, with their original times. Chat tabs of older Cursor versions are
+imported too, without tool calls.
+
+The databases are read with the sqlite3 command-line tool, version 3.33
+or later (for its -json output mode), which must be installed on PATH.
+Sessions that tin already tracks (by Cursor conversation ID) are skipped,
+so the command is safe to run repeatedly.
+
+Options:
+  -n, --dry-run    List the sessions that would be imported
+  --no-stage       Save imported threads without staging them
+  --dir <path>     Read Cursor's user data from this directory (default:
+                   ~/Library/Application Support/Cursor/User on macOS,
+                   ~/.config/Cursor/User on Linux, %APPDATA%\Cursor\User
+                   on Windows)`)
+}
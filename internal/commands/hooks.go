@@ -3,7 +3,10 @@ package commands
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/sestinj/tin/internal/agents"
@@ -11,6 +14,8 @@ import (
 	"github.com/sestinj/tin/internal/agents/codex"
 	_ "github.com/sestinj/tin/internal/agents/cursor" // Register agent
 	"github.com/sestinj/tin/internal/hooks"
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
 )
 
 func Hooks(args []string) error {
@@ -32,6 +37,8 @@ func Hooks(args []string) error {
 		return hookSessionStart()
 	case "user-prompt":
 		return hookUserPrompt()
+	case "post-tool-use":
+		return hookPostToolUse()
 	case "stop":
 		return hookStop()
 	case "session-end":
@@ -46,6 +53,9 @@ func Hooks(args []string) error {
 	// Codex notification
 	case "codex-notify":
 		return hookCodexNotify(subargs)
+	// Agent plugin events
+	case "plugin":
+		return hookPlugin(subargs)
 	case "-h", "--help":
 		printHooksHelp()
 		return nil
@@ -71,6 +81,13 @@ func hooksInstall(args []string) error {
 			agentNames = append(agentNames, "cursor")
 		case "--all":
 			agentNames = append(agentNames, "claude-code", "cursor")
+			agentNames = append(agentNames, pluginHookAgents()...)
+		default:
+			name, err := pluginAgentFlag(arg)
+			if err != nil {
+				return err
+			}
+			agentNames = append(agentNames, name)
 		}
 	}
 
@@ -106,13 +123,32 @@ func hooksInstall(args []string) error {
 			} else {
 				fmt.Fprintf(os.Stderr, "Warning: Cursor agent not registered\n")
 			}
+
+		default:
+			// Notification-based plugins set up their agent instead
+			if notifier, ok := agents.GetNotify(name); ok {
+				if err := notifier.Setup(cwd); err != nil {
+					return err
+				}
+				continue
+			}
+			handler, ok := agents.GetHook(name)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Warning: %s is not a hook-based agent, skipping\n", name)
+				continue
+			}
+			if err := handler.Install(cwd, global); err != nil {
+				return err
+			}
+			fmt.Printf("Installed tin hooks for %s (%s)\n", handler.Info().DisplayName, location)
 		}
 	}
 
 	fmt.Println("\nHooks installed:")
 	fmt.Println("  - SessionStart: Creates/resumes thread tracking")
 	fmt.Println("  - UserPromptSubmit: Records human messages")
-	fmt.Println("  - Stop: Records assistant responses and tool calls")
+	fmt.Println("  - PostToolUse: Snapshots the working tree after each edit")
+	fmt.Println("  - Stop: Records each assistant message, tool call and result")
 	fmt.Println("  - SessionEnd: Marks thread as complete")
 	fmt.Println("\nThreads will be auto-staged as you work.")
 	fmt.Println("Use 'tin commit -m \"message\"' to commit your work.")
@@ -122,22 +158,37 @@ func hooksInstall(args []string) error {
 
 func hooksUninstall(args []string) error {
 	global := false
+	agentNames := []string{}
 	for _, arg := range args {
 		switch arg {
 		case "-h", "--help":
-			fmt.Println("Usage: tin hooks uninstall [--global]")
+			fmt.Println("Usage: tin hooks uninstall [--global] [--<agent>]")
 			return nil
 		case "--global", "-g":
 			global = true
+		case "--claude-code", "--claudecode":
+			agentNames = append(agentNames, "claude-code")
+		case "--cursor":
+			agentNames = append(agentNames, "cursor")
+		case "--all":
+			agentNames = append(agentNames, "claude-code", "cursor")
+			agentNames = append(agentNames, pluginHookAgents()...)
+		default:
+			name, err := pluginAgentFlag(arg)
+			if err != nil {
+				return err
+			}
+			agentNames = append(agentNames, name)
 		}
 	}
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		return err
+	// Default to claude-code if no agents specified
+	if len(agentNames) == 0 {
+		agentNames = []string{"claude-code"}
 	}
 
-	if err := hooks.UninstallClaudeCodeHooks(cwd, global); err != nil {
+	cwd, err := os.Getwd()
+	if err != nil {
 		return err
 	}
 
@@ -145,11 +196,53 @@ func hooksUninstall(args []string) error {
 	if global {
 		location = "global"
 	}
-	fmt.Printf("Uninstalled tin hooks from Claude Code (%s)\n", location)
+
+	for _, name := range agentNames {
+		if name == "claude-code" {
+			if err := hooks.UninstallClaudeCodeHooks(cwd, global); err != nil {
+				return err
+			}
+			fmt.Printf("Uninstalled tin hooks from Claude Code (%s)\n", location)
+			continue
+		}
+
+		handler, ok := agents.GetHook(name)
+		if !ok {
+			continue
+		}
+		if err := handler.Uninstall(cwd, global); err != nil {
+			return err
+		}
+		fmt.Printf("Uninstalled tin hooks from %s (%s)\n", handler.Info().DisplayName, location)
+	}
 
 	return nil
 }
 
+// pluginAgentFlag returns the agent plugin named by a --<agent> flag
+func pluginAgentFlag(arg string) (string, error) {
+	name, ok := strings.CutPrefix(arg, "--")
+	if !ok {
+		return "", fmt.Errorf("unknown argument: %s", arg)
+	}
+	if _, ok := agents.PluginPath(name); !ok {
+		return "", fmt.Errorf("unknown agent: %s (no %s%s plugin on PATH)", name, agents.PluginPrefix, name)
+	}
+	return name, nil
+}
+
+// pluginHookAgents returns the names of hook-based agent plugins
+func pluginHookAgents() []string {
+	var names []string
+	for _, info := range agents.List() {
+		if _, ok := agents.PluginPath(info.Name); ok && info.Paradigm == agents.ParadigmHook {
+			names = append(names, info.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Hook event handlers - these read from stdin and process the event
 
 func hookSessionStart() error {
@@ -174,6 +267,17 @@ func hookUserPrompt() error {
 	return hooks.HandleUserPromptSubmit(input)
 }
 
+func hookPostToolUse() error {
+	input, err := readHookInput()
+	if err != nil {
+		return err
+	}
+	if input == nil {
+		return nil // Not a tin repo, skip silently
+	}
+	return hooks.HandlePostToolUse(input)
+}
+
 func hookStop() error {
 	input, err := readHookInput()
 	if err != nil {
@@ -213,6 +317,61 @@ func readHookInput() (*hooks.HookInput, error) {
 	return &input, nil
 }
 
+// hookPlugin passes an event from the agent of an agent plugin on to the
+// plugin: tin hooks plugin <agent> <event> [payload]. The payload - the
+// agent's own hook input - is read from stdin unless given as an argument.
+func hookPlugin(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: tin hooks plugin <agent> <event> [payload]")
+	}
+	name, eventType := args[0], args[1]
+	if _, ok := agents.PluginPath(name); !ok {
+		return fmt.Errorf("unknown agent plugin: %s", name)
+	}
+
+	var payload []byte
+	if len(args) > 2 {
+		payload = []byte(args[2])
+	} else {
+		payload, _ = io.ReadAll(os.Stdin)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if _, err := storage.Open(cwd); err != nil {
+		return nil // Not a tin repo, skip silently
+	}
+
+	// Pass payloads that are not JSON on as a JSON string
+	var raw json.RawMessage
+	if json.Valid(payload) {
+		raw = payload
+	} else if len(payload) > 0 {
+		raw, _ = json.Marshal(string(payload))
+	}
+
+	if handler, ok := agents.GetHook(name); ok {
+		_, err := handler.HandleEvent(&agents.HookEvent{
+			Type:       agents.HookEventType(eventType),
+			Cwd:        cwd,
+			Timestamp:  time.Now().UTC(),
+			RawPayload: raw,
+		})
+		return err
+	}
+	if handler, ok := agents.GetNotify(name); ok {
+		return handler.HandleNotification(&agents.NotifyEvent{
+			Type:       agents.NotifyEventType(eventType),
+			Cwd:        cwd,
+			Timestamp:  time.Now().UTC(),
+			RawPayload: raw,
+		})
+	}
+	return fmt.Errorf("%s is a pull-based agent; use 'tin agents watch' for it", name)
+}
+
 // Cursor hook handlers
 
 // CursorHookInput represents input from Cursor hooks
@@ -228,6 +387,9 @@ type CursorHookInput struct {
 	// For stop
 	Text     string `json:"text,omitempty"`
 	Duration int    `json:"duration,omitempty"`
+	// For afterFileEdit
+	FilePath string          `json:"file_path,omitempty"`
+	Edits    json.RawMessage `json:"edits,omitempty"`
 }
 
 func hookCursorPrompt() error {
@@ -312,11 +474,21 @@ func hookCursorFileEdit() error {
 		cwd = input.WorkspaceRoots[0]
 	}
 
+	// Recorded like a MultiEdit tool call, so viewers show it as an edit
+	arguments, err := json.Marshal(map[string]any{
+		"file_path": input.FilePath,
+		"edits":     input.Edits,
+	})
+	if err != nil {
+		return err
+	}
+
 	event := &agents.HookEvent{
 		Type:      agents.HookEventFileEdit,
 		SessionID: input.ConversationID,
 		Cwd:       cwd,
 		Timestamp: time.Now().UTC(),
+		ToolCalls: []model.ToolCall{{ID: input.GenerationID, Name: "MultiEdit", Arguments: arguments}},
 	}
 
 	_, err = handler.HandleEvent(event)
@@ -367,6 +539,7 @@ Commands:
 Supported agents:
   --claude-code   Claude Code (default)
   --cursor        Cursor IDE
+  --<agent>       A hook-based agent plugin (tin-agent-<agent> on PATH)
   --all           All hook-based agents
 
 The hooks integration automatically tracks your conversations with
@@ -391,6 +564,7 @@ Options:
 Agents:
   --claude-code   Claude Code (default if no agent specified)
   --cursor        Cursor IDE
+  --<agent>       A hook-based agent plugin (tin-agent-<agent> on PATH)
   --all           All hook-based agents
 
 This command adds hooks that will automatically:
@@ -64,6 +64,7 @@ func Pull(args []string) error {
 			return err
 		}
 		defer client.Close()
+		client.SetProgress(printTransferProgress)
 
 		// Pull
 		refs, err := client.Pull(repo, branch)
@@ -14,7 +14,7 @@ import (
 func Push(args []string) error {
 	force := false
 	remoteName := "origin"
-	branch := ""
+	var branches []string
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -27,8 +27,8 @@ func Push(args []string) error {
 			if !strings.HasPrefix(args[i], "-") {
 				if remoteName == "origin" && i == 0 {
 					remoteName = args[i]
-				} else if branch == "" {
-					branch = args[i]
+				} else {
+					branches = append(branches, args[i])
 				}
 			}
 		}
@@ -55,19 +55,22 @@ func Push(args []string) error {
 	}
 
 	// Default to current branch
-	if branch == "" {
-		branch, err = repo.ReadHead()
+	if len(branches) == 0 {
+		branch, err := repo.ReadHead()
 		if err != nil {
 			return fmt.Errorf("failed to get current branch: %w", err)
 		}
+		branches = []string{branch}
 	}
 
 	// Always do git push first
-	fmt.Printf("Pushing git to %s/%s...\n", remoteName, branch)
-	if err := repo.GitPush(remoteName, branch, force); err != nil {
-		return err
+	for _, branch := range branches {
+		fmt.Printf("Pushing git to %s/%s...\n", remoteName, branch)
+		if err := repo.GitPush(remoteName, branch, force); err != nil {
+			return err
+		}
+		fmt.Printf("Git pushed %s -> %s/%s\n", branch, remoteName, branch)
 	}
-	fmt.Printf("Git pushed %s -> %s/%s\n", branch, remoteName, branch)
 
 	// Also push tin data if a tin remote is configured
 	remoteConfig, err := repo.GetRemote(remoteName)
@@ -80,13 +83,16 @@ func Push(args []string) error {
 			return err
 		}
 		defer client.Close()
+		client.SetProgress(printTransferProgress)
 
 		// Push
-		if err := client.Push(repo, branch, force); err != nil {
+		if err := client.PushBranches(repo, branches, force); err != nil {
 			return err
 		}
 
-		fmt.Printf("Tin pushed %s -> %s/%s\n", branch, remoteName, branch)
+		for _, branch := range branches {
+			fmt.Printf("Tin pushed %s -> %s/%s\n", branch, remoteName, branch)
+		}
 
 		// Sync code host URL
 		if err := syncCodeHostURL(repo, remoteConfig.URL, remoteName); err != nil {
@@ -111,8 +117,9 @@ func dialWithCredentials(remoteURL string, repo *storage.Repository) (*remote.Cl
 	credStore := remote.NewCredentialStore()
 	creds, _ := credStore.Get(host)
 
-	// If no credentials found, prompt the user
-	if creds == nil {
+	// If no credentials found, prompt the user (unless a client
+	// certificate will identify us)
+	if creds == nil && os.Getenv(remote.EnvTLSCert) == "" {
 		creds, err = promptForCredentials(host, credStore)
 		if err != nil {
 			return nil, err
@@ -137,6 +144,36 @@ func dialWithCredentials(remoteURL string, repo *storage.Repository) (*remote.Cl
 	return client, nil
 }
 
+// printTransferProgress renders pack transfer progress on a single terminal line
+func printTransferProgress(p remote.Progress) {
+	verb := "Writing"
+	if p.Phase == "receiving" {
+		verb = "Receiving"
+	}
+	percent := 100
+	if p.Total > 0 {
+		percent = p.Objects * 100 / p.Total
+	}
+	fmt.Printf("\r%s objects: %d%% (%d/%d), %s", verb, percent, p.Objects, p.Total, formatByteSize(p.Bytes))
+	if p.Objects >= p.Total {
+		fmt.Println()
+	}
+}
+
+// formatByteSize formats a byte count using binary units
+func formatByteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 // promptForCredentials interactively prompts the user for credentials and stores them
 func promptForCredentials(host string, credStore *remote.CredentialStore) (*remote.Credentials, error) {
 	reader := bufio.NewReader(os.Stdin)
@@ -239,7 +276,7 @@ func syncCodeHostURL(repo *storage.Repository, remoteURL, remoteName string) err
 }
 
 func printPushHelp() {
-	fmt.Println(`Usage: tin push [options] [remote] [branch]
+	fmt.Println(`Usage: tin push [options] [remote] [branch...]
 
 Push commits and threads to a remote repository.
 
@@ -248,10 +285,12 @@ Options:
 
 Arguments:
   remote         Remote name (default: origin)
-  branch         Branch to push (default: current branch)
+  branch         Branch(es) to push (default: current branch)
+                 Servers that support it update all branches atomically
 
 Examples:
   tin push
   tin push origin main
+  tin push origin main feature-auth
   tin push --force origin main`)
 }
@@ -18,6 +18,10 @@ func Serve(args []string) error {
 	repoPath := ""
 	rootPath := ""
 	webMode := false
+	aclPath := ""
+	tokensPath := ""
+	var authPairs []string
+	var tlsOpts remote.ServerTLSOptions
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -50,6 +54,38 @@ func Serve(args []string) error {
 			}
 		case "--web":
 			webMode = true
+		case "--auth":
+			if i+1 < len(args) {
+				authPairs = append(authPairs, args[i+1])
+				i++
+			}
+		case "--acl":
+			if i+1 < len(args) {
+				aclPath = args[i+1]
+				i++
+			}
+		case "--tokens":
+			if i+1 < len(args) {
+				tokensPath = args[i+1]
+				i++
+			}
+		case "--tls-cert":
+			if i+1 < len(args) {
+				tlsOpts.CertFile = args[i+1]
+				i++
+			}
+		case "--tls-key":
+			if i+1 < len(args) {
+				tlsOpts.KeyFile = args[i+1]
+				i++
+			}
+		case "--tls-client-ca":
+			if i+1 < len(args) {
+				tlsOpts.ClientCAFile = args[i+1]
+				i++
+			}
+		case "--tls-require-client-cert":
+			tlsOpts.RequireClientCert = true
 		default:
 			if !strings.HasPrefix(args[i], "-") && repoPath == "" && rootPath == "" {
 				repoPath = args[i]
@@ -63,24 +99,158 @@ func Serve(args []string) error {
 			return fmt.Errorf("--root is required for web mode")
 		}
 		server := web.NewWebServer(host, port, rootPath)
+		if err := configureWebAuth(server, authPairs, tokensPath, aclPath, tlsOpts); err != nil {
+			return err
+		}
 		return server.Start()
 	}
 
-	// Multi-repo mode (--root)
+	var server *remote.Server
 	if rootPath != "" {
-		server := remote.NewMultiRepoServer(host, port, rootPath, true)
-		return server.Start()
+		// Multi-repo mode (--root)
+		server = remote.NewMultiRepoServer(host, port, rootPath, true)
+	} else if repoPath != "" {
+		// Single-repo mode
+		server = remote.NewServer(host, port, repoPath)
+	} else {
+		return fmt.Errorf("repository path required (use --repo or --root)")
 	}
 
-	// Single-repo mode
-	if repoPath == "" {
-		return fmt.Errorf("repository path required (use --repo or --root)")
+	authValidator, err := serverAuthValidator(authPairs, tokensPath)
+	if err != nil {
+		return err
+	}
+	server.SetAuthValidator(authValidator)
+
+	acl, err := loadServerACL(aclPath)
+	if err != nil {
+		return err
+	}
+	if err := checkACLAuth(acl, authValidator, tlsOpts.ClientCAFile != ""); err != nil {
+		return err
+	}
+	server.SetACL(acl)
+
+	if tlsOpts.Enabled() {
+		tlsConfig, err := tlsOpts.Config()
+		if err != nil {
+			return err
+		}
+		server.SetTLS(tlsConfig, &remote.CommonNameCertValidator{})
 	}
 
-	server := remote.NewServer(host, port, repoPath)
 	return server.Start()
 }
 
+// serverAuthValidator builds a validator from --auth flags, the
+// TIN_SERVER_AUTH env var and the token store (--tokens, or the default
+// store if it exists). It returns nil if no credentials are configured.
+func serverAuthValidator(authPairs []string, tokensPath string) (remote.AuthValidator, error) {
+	credentials := make(map[string]string)
+
+	// Parse TIN_SERVER_AUTH env var (comma-separated user:pass pairs)
+	if envAuth := os.Getenv("TIN_SERVER_AUTH"); envAuth != "" {
+		for _, pair := range strings.Split(envAuth, ",") {
+			pair = strings.TrimSpace(pair)
+			if pair == "" {
+				continue
+			}
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid TIN_SERVER_AUTH format: %q (expected user:pass)", pair)
+			}
+			credentials[parts[0]] = parts[1]
+		}
+	}
+
+	// Parse --auth flags (user:pass format)
+	for _, pair := range authPairs {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid --auth format: %q (expected user:pass)", pair)
+		}
+		credentials[parts[0]] = parts[1]
+	}
+
+	if tokensPath == "" {
+		tokensPath = remote.DefaultTokenStorePath()
+		if _, err := os.Stat(tokensPath); err != nil {
+			tokensPath = ""
+		}
+	}
+
+	if len(credentials) == 0 && tokensPath == "" {
+		log.Printf("WARNING: no authentication configured, accepting all clients anonymously")
+		log.Printf("  use --auth user:pass, TIN_SERVER_AUTH=user:pass or tin server token create to enable auth")
+		return nil, nil
+	}
+
+	validator := remote.NewTokenAuthValidator(credentials)
+	if tokensPath != "" {
+		store, err := remote.OpenTokenStore(tokensPath)
+		if err != nil {
+			return nil, err
+		}
+		validator.SetTokenStore(store)
+		log.Printf("accepting API tokens from %s", tokensPath)
+	}
+	if len(credentials) > 0 {
+		log.Printf("authentication enabled with %d user(s)", len(credentials))
+	}
+	return validator, nil
+}
+
+// configureWebAuth applies --auth, --tokens, --acl and the TLS options to a
+// standalone web viewer. Without credentials the viewer stays open to anyone.
+func configureWebAuth(server *web.WebServer, authPairs []string, tokensPath, aclPath string, tlsOpts remote.ServerTLSOptions) error {
+	authValidator, err := serverAuthValidator(authPairs, tokensPath)
+	if err != nil {
+		return err
+	}
+	server.SetAuthValidator(authValidator)
+
+	acl, err := loadServerACL(aclPath)
+	if err != nil {
+		return err
+	}
+	if err := checkACLAuth(acl, authValidator, tlsOpts.ClientCAFile != ""); err != nil {
+		return err
+	}
+	server.SetACL(acl)
+
+	if tlsOpts.Enabled() {
+		tlsConfig, err := tlsOpts.Config()
+		if err != nil {
+			return err
+		}
+		server.SetTLS(tlsConfig, &remote.CommonNameCertValidator{})
+	}
+	return nil
+}
+
+// loadServerACL loads the --acl file, if one was given
+func loadServerACL(aclPath string) (*remote.ACL, error) {
+	if aclPath == "" {
+		return nil, nil
+	}
+	acl, err := remote.LoadACL(aclPath)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("access control enabled: %d rule(s), %d protected branch rule(s)", len(acl.Rules), len(acl.ProtectedBranches))
+	return acl, nil
+}
+
+// checkACLAuth refuses an ACL on a server that cannot tell its users apart.
+// Without authentication every client is anonymous, and only rules for "*"
+// would ever match.
+func checkACLAuth(acl *remote.ACL, authValidator remote.AuthValidator, clientCerts bool) error {
+	if acl != nil && authValidator == nil && !clientCerts {
+		return fmt.Errorf("--acl requires authentication (use --auth, TIN_SERVER_AUTH, --tokens or --tls-client-ca)")
+	}
+	return nil
+}
+
 func printServeHelp() {
 	fmt.Println(`Usage: tin serve [options] [repo-path]
 
@@ -93,7 +263,24 @@ Options:
   --root <path>     Serve any repository under this root directory
                     (repos are auto-created on push)
   --web             Start HTML web viewer instead of push/pull server
-                    (requires --root)
+                    (requires --root); --auth, --tokens, --acl and the
+                    --tls-* options apply to it as well. To serve both on one port, use
+                    tin serve-http --web
+  --auth <u:pass>   Require clients to authenticate (can be repeated;
+                    also read from TIN_SERVER_AUTH)
+  --tokens <file>   Accept API tokens from this store (default:
+                    ~/.config/tin/server-tokens.json if it exists)
+  --acl <file>      Restrict access per repository (see "Access control"
+                    in tin serve-http --help)
+  --tls-cert <file> Serve over TLS with this certificate (PEM);
+                    clients use tin+tls://host:port/path. Clients only
+                    send credentials over TLS (or with TIN_INSECURE_AUTH=1)
+  --tls-key <file>  Private key for --tls-cert
+  --tls-client-ca <file>
+                    Authenticate clients presenting a certificate signed
+                    by this CA; the certificate's common name is the user
+  --tls-require-client-cert
+                    Refuse clients without a valid client certificate
 
 Single-repo mode:
   tin serve /path/to/repo.tin
@@ -108,6 +295,9 @@ Multi-repo mode (recommended):
 Web viewer mode:
   tin serve --web --root ~/projects
   # Opens http://localhost:2323 with web interface
+  # and a read-only JSON API under /api/v1/ (see COMMANDS.md)
+  # With --auth or API tokens, users sign in (or send Basic Auth to the
+  # API) and only see repositories the --acl lets them read
 
 Examples:
   tin serve --root ~/tin-repos
@@ -119,7 +309,11 @@ Examples:
 func ServeHTTP(args []string) error {
 	addr := ":8443"
 	rootPath := ""
+	webMode := false
+	aclPath := ""
+	tokensPath := ""
 	var authPairs []string
+	var tlsOpts remote.ServerTLSOptions
 
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
@@ -136,11 +330,40 @@ func ServeHTTP(args []string) error {
 				rootPath = args[i+1]
 				i++
 			}
+		case "--web":
+			webMode = true
 		case "--auth":
 			if i+1 < len(args) {
 				authPairs = append(authPairs, args[i+1])
 				i++
 			}
+		case "--acl":
+			if i+1 < len(args) {
+				aclPath = args[i+1]
+				i++
+			}
+		case "--tokens":
+			if i+1 < len(args) {
+				tokensPath = args[i+1]
+				i++
+			}
+		case "--tls-cert":
+			if i+1 < len(args) {
+				tlsOpts.CertFile = args[i+1]
+				i++
+			}
+		case "--tls-key":
+			if i+1 < len(args) {
+				tlsOpts.KeyFile = args[i+1]
+				i++
+			}
+		case "--tls-client-ca":
+			if i+1 < len(args) {
+				tlsOpts.ClientCAFile = args[i+1]
+				i++
+			}
+		case "--tls-require-client-cert":
+			tlsOpts.RequireClientCert = true
 		default:
 			if !strings.HasPrefix(args[i], "-") && rootPath == "" {
 				rootPath = args[i]
@@ -152,55 +375,63 @@ func ServeHTTP(args []string) error {
 		return fmt.Errorf("repository root path required (use --root)")
 	}
 
-	// Build credentials map from --auth flags and TIN_SERVER_AUTH env var
-	credentials := make(map[string]string)
-
-	// Parse TIN_SERVER_AUTH env var (comma-separated user:pass pairs)
-	if envAuth := os.Getenv("TIN_SERVER_AUTH"); envAuth != "" {
-		for _, pair := range strings.Split(envAuth, ",") {
-			pair = strings.TrimSpace(pair)
-			if pair == "" {
-				continue
-			}
-			parts := strings.SplitN(pair, ":", 2)
-			if len(parts) != 2 {
-				return fmt.Errorf("invalid TIN_SERVER_AUTH format: %q (expected user:pass)", pair)
-			}
-			credentials[parts[0]] = parts[1]
-		}
+	authValidator, err := serverAuthValidator(authPairs, tokensPath)
+	if err != nil {
+		return err
 	}
 
-	// Parse --auth flags (user:pass format)
-	for _, pair := range authPairs {
-		parts := strings.SplitN(pair, ":", 2)
-		if len(parts) != 2 {
-			return fmt.Errorf("invalid --auth format: %q (expected user:pass)", pair)
-		}
-		credentials[parts[0]] = parts[1]
+	acl, err := loadServerACL(aclPath)
+	if err != nil {
+		return err
 	}
-
-	// Create auth validator
-	var authValidator remote.AuthValidator
-	if len(credentials) > 0 {
-		authValidator = remote.NewTokenAuthValidator(credentials)
-		log.Printf("authentication enabled with %d user(s)", len(credentials))
-	} else {
-		log.Printf("WARNING: no authentication configured, accepting all credentials")
-		log.Printf("  use --auth user:pass or TIN_SERVER_AUTH=user:pass to enable auth")
+	if err := checkACLAuth(acl, authValidator, tlsOpts.ClientCAFile != ""); err != nil {
+		return err
 	}
 
 	// Create HTTP handler with auto-create enabled
 	handler := remote.NewHTTPHandler(rootPath, true, authValidator)
+	handler.SetACL(acl)
 
-	log.Printf("tin HTTP server listening on %s", addr)
+	server := &http.Server{Addr: addr, Handler: handler}
+	var viewer *web.WebServer
+	if webMode {
+		// Serve the web viewer on the same listener; push/pull requests
+		// are passed through to the protocol handler
+		viewer = web.NewWebServer("", 0, rootPath)
+		viewer.SetAuthValidator(authValidator)
+		viewer.SetACL(acl)
+		viewer.SetProtocolHandler(handler)
+		server.Handler = viewer.Handler()
+	}
+	if tlsOpts.Enabled() {
+		tlsConfig, err := tlsOpts.Config()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+		handler.SetCertValidator(&remote.CommonNameCertValidator{})
+		if viewer != nil {
+			viewer.SetCertValidator(&remote.CommonNameCertValidator{})
+		}
+		log.Printf("tin HTTPS server listening on %s", addr)
+	} else {
+		log.Printf("tin HTTP server listening on %s", addr)
+	}
 	log.Printf("serving repositories under: %s", rootPath)
+	if webMode {
+		log.Printf("web viewer enabled on the same address")
+	}
 	log.Printf("auto-create enabled: new repos will be created on push")
 	log.Printf("\nClient usage:")
 	log.Printf("  tin remote add origin https://localhost%s/user/repo", addr)
 	log.Printf("  tin config credentials add localhost%s th_yourtoken", addr)
 	log.Printf("  tin push origin main")
 
-	return http.ListenAndServe(addr, handler)
+	if tlsOpts.Enabled() {
+		// Certificates are already loaded into TLSConfig
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
 }
 
 func printServeHTTPHelp() {
@@ -212,24 +443,76 @@ Options:
   --addr, -a <addr>   Address to listen on (default: :8443)
   --root <path>       Serve repositories under this root directory
                       (repos are auto-created on push)
+  --web               Also serve the HTML web viewer and JSON API on the
+                      same address, with the same users and ACL
   --auth <user:pass>  Add a valid username/password pair (can be repeated)
+  --tokens <file>     Accept API tokens from this store (default:
+                      ~/.config/tin/server-tokens.json if it exists)
+  --acl <file>        Restrict access per repository with an ACL file
+  --tls-cert <file>   Serve HTTPS with this certificate (PEM)
+  --tls-key <file>    Private key for --tls-cert
+  --tls-client-ca <file>
+                      Authenticate clients presenting a certificate signed
+                      by this CA; the certificate's common name is the user
+  --tls-require-client-cert
+                      Refuse clients without a valid client certificate
 
 Authentication:
   Credentials can be provided via:
   - --auth flags:        --auth alice:secret123 --auth bob:hunter2
   - Environment var:     TIN_SERVER_AUTH=alice:secret123,bob:hunter2
+  - API tokens:          tin server token create --user alice --scope write
 
-  If no credentials are configured, the server accepts any auth (dev mode).
+  Tokens are stored hashed, can expire and be revoked, and are limited to
+  their scope (read, write or admin) even where the ACL grants more. See
+  tin server token --help.
+
+  If no credentials are configured, the server accepts any client as an
+  anonymous user (dev mode); usernames clients send are ignored.
 
 Clients connect using HTTPS URLs and Basic Auth:
   tin remote add origin https://host:port/user/repo
   tin config credentials add host:port alice:secret123
+  tin config credentials add host:port th_yourtoken
   tin push origin main
 
+Access control:
+  Without --acl every authenticated user can read, write and create any
+  repository. --acl requires authentication (credentials, API tokens or
+  --tls-client-ca), so that users are who they claim. An ACL file grants read, write or admin permission on
+  repository path globs ("*" matches one path segment, "**" any number):
+
+    {
+      "groups": {"devs": ["alice", "bob"]},
+      "rules": [
+        {"groups": ["devs"], "repos": ["team/**"], "permission": "write"},
+        {"users": ["alice"], "repos": ["**"], "permission": "admin"},
+        {"users": ["*"], "repos": ["public/*"], "permission": "read"}
+      ],
+      "protected_branches": [
+        {"repos": ["team/**"], "branches": ["main", "release/*"]}
+      ]
+    }
+
+  read: pull and read config; write: push; admin: also create
+  repositories on push and change config. Protected branches refuse
+  force pushes and other non-fast-forward updates from everyone.
+
+Server hooks:
+  Executables in <repo>.tin/hooks/ run on push, as in git: pre-receive
+  (can reject the push), update (per branch; can reject it) and
+  post-receive (after branches are written). They get the ref updates
+  and a summary of the pushed commits and threads as JSON on stdin.
+
+Webhooks:
+  After each push the server can POST a signed JSON event to configured
+  URLs; see tin server webhook --help.
+
 HTTP Endpoints:
   POST /{repo-path}/tin-receive-pack  Push (receive data from client)
   POST /{repo-path}/tin-upload-pack   Pull (send data to client)
   POST /{repo-path}/tin-config        Get/set repository config
+  GET  /, /repo/..., /api/v1/...      Web viewer and JSON API (with --web)
 
 Examples:
   # Dev mode (no auth validation)
@@ -244,5 +527,14 @@ Examples:
   # Via environment variable
   TIN_SERVER_AUTH=alice:pass1,bob:pass2 tin serve-http --root ~/repos
 
-Note: For production, use a reverse proxy (nginx, caddy) for TLS termination.`)
+  # Push/pull and the web viewer on one port
+  tin serve-http --root /var/tin-repos --web --tokens /etc/tin/tokens.json
+
+TLS:
+  With --tls-cert and --tls-key the server speaks HTTPS directly; no
+  reverse proxy is needed. Clients trust private CAs via TIN_TLS_CA and
+  present client certificates via TIN_TLS_CERT and TIN_TLS_KEY:
+
+  tin serve-http --root /var/tin-repos --tls-cert server.pem --tls-key server.key \
+    --tls-client-ca clients-ca.pem`)
 }
@@ -0,0 +1,470 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sestinj/tin/internal/remote"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Server runs server administration subcommands
+func Server(args []string) error {
+	if len(args) == 0 {
+		printServerHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "-h", "--help":
+		printServerHelp()
+		return nil
+	case "token":
+		return serverToken(args[1:])
+	case "webhook":
+		return serverWebhook(args[1:])
+	default:
+		return fmt.Errorf("unknown server subcommand: %s", args[0])
+	}
+}
+
+func serverToken(args []string) error {
+	if len(args) == 0 {
+		printServerHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "-h", "--help":
+		printServerHelp()
+		return nil
+	case "create":
+		return serverTokenCreate(args[1:])
+	case "list":
+		return serverTokenList(args[1:])
+	case "revoke":
+		return serverTokenRevoke(args[1:])
+	default:
+		return fmt.Errorf("unknown token subcommand: %s", args[0])
+	}
+}
+
+func serverTokenCreate(args []string) error {
+	user := ""
+	name := ""
+	scope := remote.PermWrite
+	var ttl time.Duration
+	tokensPath := remote.DefaultTokenStorePath()
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--user", "-u":
+			if i+1 < len(args) {
+				user = args[i+1]
+				i++
+			}
+		case "--name", "-n":
+			if i+1 < len(args) {
+				name = args[i+1]
+				i++
+			}
+		case "--scope":
+			if i+1 < len(args) {
+				p, err := remote.ParsePermission(args[i+1])
+				if err != nil {
+					return err
+				}
+				scope = p
+				i++
+			}
+		case "--expires":
+			if i+1 < len(args) {
+				d, err := parseTokenTTL(args[i+1])
+				if err != nil {
+					return err
+				}
+				ttl = d
+				i++
+			}
+		case "--tokens":
+			if i+1 < len(args) {
+				tokensPath = args[i+1]
+				i++
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	if user == "" {
+		return fmt.Errorf("usage: tin server token create --user <user> [--scope read|write|admin] [--expires 90d]")
+	}
+
+	store, err := remote.OpenTokenStore(tokensPath)
+	if err != nil {
+		return err
+	}
+	token, record, err := store.Create(user, name, scope, ttl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created token %s for %s (scope: %s, expires: %s)\n", record.ID, record.User, record.Scope, formatTokenTime(record.ExpiresAt, "never"))
+	fmt.Println()
+	fmt.Printf("  %s\n", token)
+	fmt.Println()
+	fmt.Println("Store it now; it cannot be shown again. Clients can save it with:")
+	fmt.Println("  tin config credentials add <host> <token>")
+	return nil
+}
+
+func serverTokenList(args []string) error {
+	tokensPath := remote.DefaultTokenStorePath()
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--tokens":
+			if i+1 < len(args) {
+				tokensPath = args[i+1]
+				i++
+			}
+		default:
+			return fmt.Errorf("unknown option: %s", args[i])
+		}
+	}
+
+	store, err := remote.OpenTokenStore(tokensPath)
+	if err != nil {
+		return err
+	}
+	records, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Println("No tokens")
+		return nil
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tNAME\tSCOPE\tSTATUS\tCREATED\tEXPIRES\tLAST USED")
+	for _, r := range records {
+		status := "active"
+		if r.RevokedAt != nil {
+			status = "revoked"
+		} else if !r.Active(now) {
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.User, r.Name, r.Scope, status,
+			formatTokenTime(&r.CreatedAt, "-"),
+			formatTokenTime(r.ExpiresAt, "never"),
+			formatTokenTime(r.LastUsedAt, "never"))
+	}
+	return w.Flush()
+}
+
+func serverTokenRevoke(args []string) error {
+	tokensPath := remote.DefaultTokenStorePath()
+	id := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--tokens":
+			if i+1 < len(args) {
+				tokensPath = args[i+1]
+				i++
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") || id != "" {
+				return fmt.Errorf("unknown option: %s", args[i])
+			}
+			id = args[i]
+		}
+	}
+
+	if id == "" {
+		return fmt.Errorf("usage: tin server token revoke <id>")
+	}
+
+	store, err := remote.OpenTokenStore(tokensPath)
+	if err != nil {
+		return err
+	}
+	if err := store.Revoke(id); err != nil {
+		return err
+	}
+	fmt.Printf("Revoked token %s\n", id)
+	return nil
+}
+
+func serverWebhook(args []string) error {
+	if len(args) == 0 {
+		printServerHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "-h", "--help":
+		printServerHelp()
+		return nil
+	case "add":
+		return serverWebhookAdd(args[1:])
+	case "list":
+		return serverWebhookList(args[1:])
+	case "remove":
+		return serverWebhookRemove(args[1:])
+	case "deliveries":
+		return serverWebhookDeliveries(args[1:])
+	default:
+		return fmt.Errorf("unknown webhook subcommand: %s", args[0])
+	}
+}
+
+func serverWebhookAdd(args []string) error {
+	secret := ""
+	var branches, positional []string
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--secret":
+			if i+1 < len(args) {
+				secret = args[i+1]
+				i++
+			}
+		case "--branch", "-b":
+			if i+1 < len(args) {
+				branches = append(branches, args[i+1])
+				i++
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") {
+				return fmt.Errorf("unknown option: %s", args[i])
+			}
+			positional = append(positional, args[i])
+		}
+	}
+
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: tin server webhook add <repo-path> <url> [--secret <secret>] [--branch <pattern>]")
+	}
+	repoPath, url := positional[0], positional[1]
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return fmt.Errorf("webhook URL must be http:// or https://: %s", url)
+	}
+
+	repo, err := storage.OpenBare(repoPath)
+	if err != nil {
+		return err
+	}
+	config, err := repo.ReadConfig()
+	if err != nil {
+		return err
+	}
+	for _, hook := range config.Webhooks {
+		if hook.URL == url {
+			return fmt.Errorf("webhook already exists: %s", url)
+		}
+	}
+
+	generated := secret == ""
+	if generated {
+		secret, err = remote.GenerateWebhookSecret()
+		if err != nil {
+			return err
+		}
+	}
+
+	config.Webhooks = append(config.Webhooks, storage.WebhookConfig{URL: url, Secret: secret, Branches: branches})
+	if err := repo.WriteConfig(config); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added webhook %s\n", url)
+	if generated {
+		fmt.Printf("Signing secret: %s\n", secret)
+		fmt.Printf("Deliveries carry %s: sha256=<hex HMAC-SHA256 of the body>\n", remote.HeaderWebhookSignature)
+	}
+	return nil
+}
+
+func serverWebhookList(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tin server webhook list <repo-path>")
+	}
+
+	repo, err := storage.OpenBare(args[0])
+	if err != nil {
+		return err
+	}
+	config, err := repo.ReadConfig()
+	if err != nil {
+		return err
+	}
+	if len(config.Webhooks) == 0 {
+		fmt.Println("No webhooks")
+		return nil
+	}
+
+	for _, hook := range config.Webhooks {
+		branches := "all branches"
+		if len(hook.Branches) > 0 {
+			branches = strings.Join(hook.Branches, ", ")
+		}
+		signed := ""
+		if hook.Secret != "" {
+			signed = ", signed"
+		}
+		fmt.Printf("%s (%s%s)\n", hook.URL, branches, signed)
+	}
+	return nil
+}
+
+func serverWebhookRemove(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: tin server webhook remove <repo-path> <url>")
+	}
+
+	repo, err := storage.OpenBare(args[0])
+	if err != nil {
+		return err
+	}
+	config, err := repo.ReadConfig()
+	if err != nil {
+		return err
+	}
+
+	for i, hook := range config.Webhooks {
+		if hook.URL == args[1] {
+			config.Webhooks = append(config.Webhooks[:i], config.Webhooks[i+1:]...)
+			if err := repo.WriteConfig(config); err != nil {
+				return err
+			}
+			fmt.Printf("Removed webhook %s\n", args[1])
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook not found: %s", args[1])
+}
+
+func serverWebhookDeliveries(args []string) error {
+	limit := 20
+	repoPath := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-n":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					return fmt.Errorf("invalid count: %s", args[i+1])
+				}
+				limit = n
+				i++
+			}
+		default:
+			if strings.HasPrefix(args[i], "-") || repoPath != "" {
+				return fmt.Errorf("unknown option: %s", args[i])
+			}
+			repoPath = args[i]
+		}
+	}
+	if repoPath == "" {
+		return fmt.Errorf("usage: tin server webhook deliveries <repo-path> [-n <count>]")
+	}
+
+	repo, err := storage.OpenBare(repoPath)
+	if err != nil {
+		return err
+	}
+	deliveries, err := remote.ReadWebhookDeliveries(repo, limit)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		fmt.Println("No deliveries")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tDELIVERY\tATTEMPT\tRESULT\tURL")
+	for _, d := range deliveries {
+		result := "ok"
+		if !d.Success {
+			result = "failed: " + d.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", formatTokenTime(&d.Time, "-"), d.ID, d.Attempt, result, d.URL)
+	}
+	return w.Flush()
+}
+
+// parseTokenTTL parses a token lifetime such as "90d", "12h" or "never"
+func parseTokenTTL(s string) (time.Duration, error) {
+	if s == "never" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid expiry: %s", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid expiry: %s (e.g. 90d, 12h or never)", s)
+	}
+	return d, nil
+}
+
+func formatTokenTime(t *time.Time, unset string) string {
+	if t == nil {
+		return unset
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func printServerHelp() {
+	fmt.Println(`Usage: tin server <command> [options]
+
+Administer a tin server: API tokens accepted by tin serve and tin serve-http,
+and webhooks of the repositories they serve.
+
+Token commands:
+  token create     Issue a token
+  token list       List tokens with their scope, expiry and last use
+  token revoke     Revoke a token by ID
+
+  Tokens are stored as salted hashes in ~/.config/tin/server-tokens.json
+  (or --tokens <file>); the token itself is shown only once, on creation.
+  Running servers pick up new and revoked tokens without a restart.
+
+Token create options:
+  --user, -u <user>   User the token authenticates as (required)
+  --scope <perm>      read, write or admin (default: write); the token
+                      never exceeds this, whatever the ACL grants
+  --expires <ttl>     Lifetime such as 90d or 12h (default: never)
+  --name, -n <name>   Label shown in tin server token list
+
+  All token commands accept --tokens <file> to use a different store.
+
+Webhook commands:
+  webhook add <repo-path> <url>       POST a JSON event to url after pushes
+      --secret <secret>               Signing secret (generated if omitted)
+      --branch, -b <pattern>          Only for matching branches (repeatable)
+  webhook list <repo-path>            List a repository's webhooks
+  webhook remove <repo-path> <url>    Remove a webhook
+  webhook deliveries <repo-path>      Show recent delivery attempts (-n <count>)
+
+  <repo-path> is the bare repository on the server, e.g. /var/tin-repos/team/proj.tin.
+  Failed deliveries are retried with exponential backoff.
+
+Examples:
+  tin server token create --user alice --scope read --expires 90d
+  tin server token list
+  tin server token revoke 3f9a01c2
+  tin server webhook add /var/tin-repos/proj.tin https://chat.example.com/hook -b main
+  tin serve-http --root /var/tin-repos --tokens /etc/tin/tokens.json`)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -63,13 +64,24 @@ func threadList(args []string) error {
 		return nil
 	}
 
+	// Subagent threads are listed under the thread that launched them
+	listed := make(map[string]bool)
+	for _, t := range threads {
+		listed[t.ID] = true
+	}
+	subagents := make(map[string][]*model.Thread)
+	for _, t := range threads {
+		if t.IsSubagent() && listed[t.ParentThreadID] {
+			subagents[t.ParentThreadID] = append(subagents[t.ParentThreadID], t)
+		}
+	}
+
 	fmt.Printf("%-10s %-12s %-10s %-8s %s\n", "ID", "AGENT", "STATUS", "MSGS", "PREVIEW")
 	fmt.Println(strings.Repeat("-", 80))
 
 	for _, t := range threads {
-		preview := ""
-		if first := t.FirstHumanMessage(); first != nil {
-			preview = truncate(first.Content, 35)
+		if t.IsSubagent() && listed[t.ParentThreadID] {
+			continue
 		}
 
 		// Add continuation indicator if thread has a parent
@@ -77,19 +89,38 @@ func threadList(args []string) error {
 		if t.ParentThreadID != "" {
 			idDisplay = "↳ " + t.ID[:8]
 		}
-
-		fmt.Printf("%-10s %-12s %-10s %-8d %s\n",
-			idDisplay,
-			truncate(t.Agent, 12),
-			t.Status,
-			len(t.Messages),
-			preview,
-		)
+		printThreadListRow(idDisplay, t)
+
+		children := subagents[t.ID]
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].StartedAt.Before(children[j].StartedAt)
+		})
+		for _, child := range children {
+			printThreadListRow("└ "+child.ID[:8], child)
+		}
 	}
 
 	return nil
 }
 
+func printThreadListRow(idDisplay string, t *model.Thread) {
+	preview := ""
+	if first := t.FirstHumanMessage(); first != nil {
+		preview = truncate(first.Content, 35)
+	}
+	if t.IsSubagent() {
+		preview = "[subagent] " + preview
+	}
+
+	fmt.Printf("%-10s %-12s %-10s %-8d %s\n",
+		idDisplay,
+		truncate(t.Agent, 12),
+		t.Status,
+		len(t.Messages),
+		preview,
+	)
+}
+
 func threadShow(args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("thread ID required")
@@ -120,10 +151,21 @@ func threadShow(args []string) error {
 	if thread.CompletedAt != nil {
 		fmt.Printf("Completed: %s\n", thread.CompletedAt.Format(time.RFC3339))
 	}
-	if thread.ParentThreadID != "" {
+	if thread.IsSubagent() {
+		fmt.Printf("Subagent of: %s\n", thread.ParentThreadID[:min(8, len(thread.ParentThreadID))])
+	} else if thread.ParentThreadID != "" {
 		fmt.Printf("Continues: %s\n", thread.ParentThreadID[:min(8, len(thread.ParentThreadID))])
 	}
 	fmt.Printf("Messages: %d\n", len(thread.Messages))
+
+	// Subagents launched by this thread, by the tool call that launched them
+	subagents := make(map[string][]*model.Thread)
+	children, _ := repo.FindChildThreads(thread.ID)
+	for _, child := range children {
+		if child.IsSubagent() {
+			subagents[child.ParentToolCallID] = append(subagents[child.ParentToolCallID], child)
+		}
+	}
 	fmt.Println(strings.Repeat("-", 60))
 
 	for i, msg := range thread.Messages {
@@ -139,6 +181,24 @@ func threadShow(args []string) error {
 			if toolSummary != "" {
 				fmt.Println(toolSummary)
 			}
+			for _, tc := range msg.ToolCalls {
+				for _, child := range subagents[tc.ID] {
+					preview := ""
+					if first := child.FirstHumanMessage(); first != nil {
+						preview = truncate(first.Content, 40)
+					}
+					fmt.Printf("  └ Subagent %s (%d messages): %s\n", child.ID[:8], len(child.Messages), preview)
+				}
+				// The working tree change the tool call made, if snapshotted
+				if tc.Snapshot != nil {
+					if stat, err := repo.GitDiffSnapshots(tc.Snapshot.Before, tc.Snapshot.After, "--stat=72"); err == nil && stat != "" {
+						fmt.Printf("  └ %s changed:\n", tc.Name)
+						for _, line := range strings.Split(strings.TrimRight(stat, "\n"), "\n") {
+							fmt.Printf("    %s\n", line)
+						}
+					}
+				}
+			}
 		}
 
 		if msg.Content != "" {
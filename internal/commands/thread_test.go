@@ -47,6 +47,33 @@ func TestThread_List_WithThreads(t *testing.T) {
 	}
 }
 
+func TestThread_List_WithSubagents(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	repo, _ := storage.Open(tmpDir)
+
+	parent := model.NewThread("claude-code", "session-123", "", "")
+	parent.AddMessage(model.NewMessage(model.RoleHuman, "Review the code", "", nil))
+	parent.AddMessage(model.NewMessage(model.RoleAssistant, "", "", []model.ToolCall{{ID: "task_1", Name: "Task"}}))
+	repo.SaveThread(parent)
+
+	child := model.NewThread("claude-code", "", parent.ID, parent.Messages[1].ID)
+	child.ParentToolCallID = "task_1"
+	child.AddMessage(model.NewMessage(model.RoleHuman, "Check the API", "", nil))
+	repo.SaveThread(child)
+
+	if err := Thread([]string{"list"}); err != nil {
+		t.Fatalf("Thread list failed: %v", err)
+	}
+	if err := Thread([]string{"show", parent.ID[:8]}); err != nil {
+		t.Fatalf("Thread show failed: %v", err)
+	}
+	if err := Thread([]string{"show", child.ID[:8]}); err != nil {
+		t.Fatalf("Thread show failed: %v", err)
+	}
+}
+
 func TestThread_Show(t *testing.T) {
 	tmpDir, cleanup := setupTestRepo(t)
 	defer cleanup()
@@ -0,0 +1,323 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sestinj/tin/internal/agents"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+const (
+	watchPIDFile = "watch.pid"
+	watchLogFile = "watch.log"
+
+	// watchRecentThreads is how many of each agent's most recent threads
+	// a poll checks for changes
+	watchRecentThreads = 10
+)
+
+func agentsWatch(args []string) error {
+	detach := false
+	interval := 0
+	stage := true
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-h", "--help":
+			printAgentsWatchHelp()
+			return nil
+		case "stop":
+			return agentsWatchStop()
+		case "status":
+			return agentsWatchStatus()
+		case "-d", "--detach":
+			detach = true
+		case "--interval":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--interval requires a number of seconds")
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid interval: %s", args[i+1])
+			}
+			interval = n
+			i++
+		case "--no-stage":
+			stage = false
+		default:
+			return fmt.Errorf("unknown argument: %s", args[i])
+		}
+	}
+
+	repo, err := openWatchRepo()
+	if err != nil {
+		return err
+	}
+
+	if pid, running := watcherRunning(repo); running {
+		return fmt.Errorf("already watching (pid %d); run 'tin agents watch stop' first", pid)
+	}
+
+	if detach {
+		return startWatcherDetached(repo, args)
+	}
+
+	config := agents.DefaultConfig()
+	if interval > 0 {
+		config.PollInterval = interval
+	}
+	if !stage {
+		config.AutoStage = &stage
+	}
+	return runWatcher(repo, config)
+}
+
+func openWatchRepo() (*storage.Repository, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	repo, err := storage.Open(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("not a tin repository (run 'tin init' first)")
+	}
+	return repo, nil
+}
+
+// startWatcherDetached runs the watcher in a new background process of
+// this executable. The process writes its own log; only output it fails to
+// log, such as a panic, goes to the log file through stderr.
+func startWatcherDetached(repo *storage.Repository, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find tin executable: %w", err)
+	}
+
+	childArgs := []string{"agents", "watch"}
+	for _, arg := range args {
+		if arg != "-d" && arg != "--detach" {
+			childArgs = append(childArgs, arg)
+		}
+	}
+
+	logPath := filepath.Join(repo.TinPath, watchLogFile)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, childArgs...)
+	cmd.Dir = repo.RootPath
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start watcher: %w", err)
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	fmt.Printf("Watching agents in the background (pid %d)\n", pid)
+	fmt.Printf("Log: %s\n", logPath)
+	fmt.Println("Stop with 'tin agents watch stop'")
+	return nil
+}
+
+// runWatcher polls the pull-based agents every PollInterval seconds until
+// interrupted or terminated. A poll in progress is finished first.
+func runWatcher(repo *storage.Repository, config *agents.Config) error {
+	logFile, err := os.OpenFile(filepath.Join(repo.TinPath, watchLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+	logger := log.New(io.MultiWriter(os.Stdout, logFile), "", log.LstdFlags)
+
+	pidPath := filepath.Join(repo.TinPath, watchPIDFile)
+	if err := os.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write pid file: %w", err)
+	}
+	defer os.Remove(pidPath)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	w := &watcher{repo: repo, config: config, log: logger, since: make(map[string]time.Time)}
+	adapters := pullAdapters()
+	names := make([]string, len(adapters))
+	for i, adapter := range adapters {
+		names[i] = adapter.Info().Name
+	}
+	logger.Printf("Watching %s every %ds (pid %d)", strings.Join(names, ", "), config.PollInterval, os.Getpid())
+
+	ticker := time.NewTicker(time.Duration(config.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		w.poll(adapters)
+		select {
+		case sig := <-stop:
+			logger.Printf("Received %s, stopping", sig)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// pullAdapters returns the registered pull-based agents
+func pullAdapters() []agents.PullAdapter {
+	var adapters []agents.PullAdapter
+	for _, info := range agents.List() {
+		if info.Paradigm != agents.ParadigmPull {
+			continue
+		}
+		if adapter, ok := agents.GetPull(info.Name); ok {
+			adapters = append(adapters, adapter)
+		}
+	}
+	return adapters
+}
+
+// watcher imports the new and updated threads of pull-based agents
+type watcher struct {
+	repo   *storage.Repository
+	config *agents.Config
+	log    *log.Logger
+	since  map[string]time.Time // Agent name -> start of its last successful poll
+}
+
+// poll pulls each agent's recent threads updated since its last poll, and
+// saves those that are new or changed
+func (w *watcher) poll(adapters []agents.PullAdapter) {
+	stage := w.config.AutoStage == nil || *w.config.AutoStage
+
+	for _, adapter := range adapters {
+		name := adapter.Info().Name
+		started := time.Now()
+
+		opts := agents.PullOptions{Count: watchRecentThreads}
+		if since, ok := w.since[name]; ok {
+			opts.Since = &since
+		}
+		threads, err := adapter.PullRecent(watchRecentThreads, opts)
+		if err != nil {
+			w.log.Printf("%s: %v", name, err)
+			continue
+		}
+		w.since[name] = started
+
+		for _, thread := range threads {
+			existed, changed, err := w.repo.SaveAgentThread(thread, stage)
+			if err != nil {
+				w.log.Printf("%s: thread %s: %v", name, thread.AgentSessionID, err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			action := "Imported"
+			if existed {
+				action = "Updated"
+			}
+			w.log.Printf("%s %s thread %s as %s (%d messages)", action, name, thread.AgentSessionID, thread.ID[:8], len(thread.Messages))
+		}
+	}
+}
+
+// watcherRunning returns the pid of the repository's watcher, if one is
+// running. A pid file left behind by a watcher that died is removed.
+func watcherRunning(repo *storage.Repository) (int, bool) {
+	pidPath := filepath.Join(repo.TinPath, watchPIDFile)
+	data, err := os.ReadFile(pidPath)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 || !processAlive(pid) {
+		os.Remove(pidPath)
+		return 0, false
+	}
+	return pid, true
+}
+
+func agentsWatchStop() error {
+	repo, err := openWatchRepo()
+	if err != nil {
+		return err
+	}
+
+	pid, running := watcherRunning(repo)
+	if !running {
+		fmt.Println("No watcher running")
+		return nil
+	}
+	if err := stopProcess(pid); err != nil {
+		return fmt.Errorf("failed to stop watcher (pid %d): %w", pid, err)
+	}
+
+	// Wait for the watcher to finish its poll and remove its pid file
+	for range 100 {
+		if _, running := watcherRunning(repo); !running {
+			fmt.Printf("Stopped watcher (pid %d)\n", pid)
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Printf("Asked watcher (pid %d) to stop; it is finishing a poll\n", pid)
+	return nil
+}
+
+func agentsWatchStatus() error {
+	repo, err := openWatchRepo()
+	if err != nil {
+		return err
+	}
+
+	if pid, running := watcherRunning(repo); running {
+		fmt.Printf("Watching (pid %d)\n", pid)
+	} else {
+		fmt.Println("Not watching")
+	}
+	fmt.Printf("Log: %s\n", filepath.Join(repo.TinPath, watchLogFile))
+	return nil
+}
+
+func printAgentsWatchHelp() {
+	fmt.Println(`Watch pull-based agents and import their threads as they change
+
+Usage: tin agents watch [options]
+       tin agents watch stop
+       tin agents watch status
+
+Polls every pull-based agent (amp) for its most recent threads, and saves
+new threads and threads with new messages, as 'tin amp pull' does. Threads
+are staged unless --no-stage is given.
+
+Only one watcher runs per repository. It records its pid in .tin/watch.pid
+and logs to .tin/watch.log, and stops cleanly on Ctrl-C, SIGTERM or
+'tin agents watch stop', after finishing a poll in progress.
+
+Options:
+  -d, --detach          Run in the background
+  --interval <seconds>  Time between polls (default: 60)
+  --no-stage            Save threads without staging them
+
+Commands:
+  stop                  Stop the repository's watcher
+  status                Show whether a watcher is running
+
+Examples:
+  tin agents watch                  # Watch in the foreground
+  tin agents watch -d --interval 30 # Watch in the background every 30s
+  tin agents watch stop`)
+}
@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sestinj/tin/internal/agents"
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// fakePullAdapter serves fixed threads, built fresh on each pull
+type fakePullAdapter struct {
+	threads map[string][]string // Session ID -> message contents
+	since   []*time.Time        // Since option of each pull
+}
+
+func (a *fakePullAdapter) Info() agents.AgentInfo {
+	return agents.AgentInfo{Name: "fake", Paradigm: agents.ParadigmPull}
+}
+
+func (a *fakePullAdapter) List(limit int) ([]string, error) {
+	var ids []string
+	for id := range a.threads {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (a *fakePullAdapter) Pull(id string, opts agents.PullOptions) (*model.Thread, error) {
+	thread := model.NewThread("fake", id, "", "")
+	for i, content := range a.threads[id] {
+		role := model.RoleHuman
+		if i%2 == 1 {
+			role = model.RoleAssistant
+		}
+		thread.AddMessage(model.NewMessage(role, content, "", nil))
+	}
+	return thread, nil
+}
+
+func (a *fakePullAdapter) PullRecent(count int, opts agents.PullOptions) ([]*model.Thread, error) {
+	a.since = append(a.since, opts.Since)
+	var threads []*model.Thread
+	ids, _ := a.List(count)
+	for _, id := range ids {
+		thread, _ := a.Pull(id, opts)
+		threads = append(threads, thread)
+	}
+	return threads, nil
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	repo, _ := storage.Open(tmpDir)
+
+	var out bytes.Buffer
+	w := &watcher{repo: repo, config: agents.DefaultConfig(), log: log.New(&out, "", 0), since: make(map[string]time.Time)}
+	adapter := &fakePullAdapter{threads: map[string][]string{"s-1": {"Hello", "Hi"}}}
+
+	w.poll([]agents.PullAdapter{adapter})
+	threads, _ := repo.FindThreadsBySessionID("s-1")
+	if len(threads) != 1 {
+		t.Fatalf("expected 1 imported thread, got %d", len(threads))
+	}
+	staged, _ := repo.GetStagedThreads()
+	if len(staged) != 1 || !strings.Contains(out.String(), "Imported fake thread s-1") {
+		t.Errorf("staged %d threads, log:\n%s", len(staged), out.String())
+	}
+	id := threads[0].ID
+
+	// Unchanged threads are left alone; later polls ask for threads updated
+	// since the last one
+	out.Reset()
+	w.poll([]agents.PullAdapter{adapter})
+	if out.Len() != 0 {
+		t.Errorf("unexpected log for unchanged thread:\n%s", out.String())
+	}
+	if len(adapter.since) != 2 || adapter.since[0] != nil || adapter.since[1] == nil {
+		t.Errorf("since options = %v", adapter.since)
+	}
+
+	// A thread with new messages is updated in place
+	adapter.threads["s-1"] = append(adapter.threads["s-1"], "Bye")
+	w.poll([]agents.PullAdapter{adapter})
+	threads, _ = repo.FindThreadsBySessionID("s-1")
+	if len(threads) != 1 || threads[0].ID != id || len(threads[0].Messages) != 3 {
+		t.Fatalf("threads after update = %+v", threads)
+	}
+	if !strings.Contains(out.String(), "Updated fake thread s-1") {
+		t.Errorf("log:\n%s", out.String())
+	}
+}
+
+func TestWatcher_PollNoStage(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	repo, _ := storage.Open(tmpDir)
+
+	config := agents.DefaultConfig()
+	autoStage := false
+	config.AutoStage = &autoStage
+	w := &watcher{repo: repo, config: config, log: log.New(io.Discard, "", 0), since: make(map[string]time.Time)}
+	w.poll([]agents.PullAdapter{&fakePullAdapter{threads: map[string][]string{"s-1": {"Hello"}}}})
+
+	threads, _ := repo.FindThreadsBySessionID("s-1")
+	staged, _ := repo.GetStagedThreads()
+	if len(threads) != 1 || len(staged) != 0 {
+		t.Errorf("saved %d threads, staged %d", len(threads), len(staged))
+	}
+}
+
+func TestWatcherRunning(t *testing.T) {
+	tmpDir, cleanup := setupTestRepo(t)
+	defer cleanup()
+	repo, _ := storage.Open(tmpDir)
+	pidPath := filepath.Join(repo.TinPath, watchPIDFile)
+
+	if _, running := watcherRunning(repo); running {
+		t.Error("expected no watcher without a pid file")
+	}
+
+	os.WriteFile(pidPath, []byte("12345678\n"), 0644)
+	if _, running := watcherRunning(repo); running {
+		t.Error("expected no watcher for a dead pid")
+	}
+	if _, err := os.Stat(pidPath); !os.IsNotExist(err) {
+		t.Error("expected the stale pid file to be removed")
+	}
+
+	os.WriteFile(pidPath, []byte("not a pid"), 0644)
+	if _, running := watcherRunning(repo); running {
+		t.Error("expected no watcher for an invalid pid file")
+	}
+
+	os.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	if pid, running := watcherRunning(repo); !running || pid != os.Getpid() {
+		t.Errorf("watcherRunning = %d, %v", pid, running)
+	}
+}
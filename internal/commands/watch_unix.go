@@ -0,0 +1,32 @@
+//go:build !windows
+
+package commands
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// detachedProcAttr starts the watcher in its own session, so it outlives
+// the terminal it was started from
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Signal(syscall.SIGTERM)
+}
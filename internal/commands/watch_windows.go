@@ -0,0 +1,38 @@
+//go:build windows
+
+package commands
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+)
+
+// detachedProcAttr starts the watcher without a console, so it outlives
+// the one it was started from
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: createNewProcessGroup | detachedProcess}
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// stopProcess kills the watcher, as Windows processes cannot be sent
+// SIGTERM. Its pid file is left for watcherRunning to remove.
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
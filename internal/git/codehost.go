@@ -60,3 +60,11 @@ func (c *CodeHostURL) BaseURL() string {
 	}
 	return ""
 }
+
+// CompareURL generates the URL comparing two commits on the code host
+func (c *CodeHostURL) CompareURL(base, head string) string {
+	if c.Host == "github.com" {
+		return "https://github.com/" + c.Owner + "/" + c.Repo + "/compare/" + base + "..." + head
+	}
+	return ""
+}
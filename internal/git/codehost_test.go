@@ -105,3 +105,14 @@ func TestCodeHostURL_CommitURL(t *testing.T) {
 		})
 	}
 }
+
+func TestCodeHostURL_CompareURL(t *testing.T) {
+	github := &CodeHostURL{Host: "github.com", Owner: "sestinj", Repo: "tin"}
+	if got, want := github.CompareURL("abc", "def"), "https://github.com/sestinj/tin/compare/abc...def"; got != want {
+		t.Errorf("CompareURL = %q, want %q", got, want)
+	}
+	gitlab := &CodeHostURL{Host: "gitlab.com", Owner: "sestinj", Repo: "tin"}
+	if got := gitlab.CompareURL("abc", "def"); got != "" {
+		t.Errorf("CompareURL on non-GitHub host = %q, want empty", got)
+	}
+}
@@ -8,20 +8,22 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/sestinj/tin/internal/agents/claudecode"
 	"github.com/sestinj/tin/internal/model"
 	"github.com/sestinj/tin/internal/storage"
 )
 
 // HookInput represents the common fields from Claude Code hooks
 type HookInput struct {
-	SessionID      string `json:"session_id"`
-	TranscriptPath string `json:"transcript_path"`
-	Cwd            string `json:"cwd"`
-	HookEventName  string `json:"hook_event_name"`
-	Prompt         string `json:"prompt,omitempty"`         // For UserPromptSubmit
-	ToolName       string `json:"tool_name,omitempty"`      // For PostToolUse
-	ToolInput      any    `json:"tool_input,omitempty"`     // For PostToolUse
-	ToolResponse   string `json:"tool_response,omitempty"`  // For PostToolUse
+	SessionID      string          `json:"session_id"`
+	TranscriptPath string          `json:"transcript_path"`
+	Cwd            string          `json:"cwd"`
+	HookEventName  string          `json:"hook_event_name"`
+	Prompt         string          `json:"prompt,omitempty"`        // For UserPromptSubmit
+	ToolName       string          `json:"tool_name,omitempty"`     // For PostToolUse
+	ToolInput      any             `json:"tool_input,omitempty"`    // For PostToolUse
+	ToolResponse   json.RawMessage `json:"tool_response,omitempty"` // For PostToolUse
+	ToolUseID      string          `json:"tool_use_id,omitempty"`   // For PostToolUse
 }
 
 // TranscriptMessage represents a message in the Claude Code transcript
@@ -39,8 +41,14 @@ type TranscriptMessageInner struct {
 
 // SessionState tracks the current session for hooks
 type SessionState struct {
-	SessionID string `json:"session_id"`
-	ThreadID  string `json:"thread_id"`
+	SessionID        string `json:"session_id"`
+	ThreadID         string `json:"thread_id"`
+	TranscriptPath   string `json:"transcript_path,omitempty"`
+	TranscriptOffset int64  `json:"transcript_offset,omitempty"` // Bytes of the transcript already recorded
+	// Snapshot is the working tree as of the last tool call or prompt, and
+	// Snapshots the changes of tool calls not yet recorded, by tool use ID
+	Snapshot  string                    `json:"snapshot,omitempty"`
+	Snapshots map[string]model.Snapshot `json:"snapshots,omitempty"`
 }
 
 const stateFileName = ".tin-session"
@@ -86,10 +94,14 @@ func HandleSessionStart(input *HookInput) error {
 		return err
 	}
 
-	// Save session state using repo root path (not input.Cwd which may be a subdirectory)
+	// Save session state using repo root path (not input.Cwd which may be a subdirectory).
+	// Only what the transcript gains from here on is recorded; a resumed
+	// session's earlier turns belong to the parent thread.
 	if err := saveSessionState(repo.RootPath, &SessionState{
-		SessionID: input.SessionID,
-		ThreadID:  thread.ID,
+		SessionID:        input.SessionID,
+		ThreadID:         thread.ID,
+		TranscriptPath:   input.TranscriptPath,
+		TranscriptOffset: claudecode.TranscriptSize(input.TranscriptPath),
 	}); err != nil {
 		return err
 	}
@@ -132,15 +144,16 @@ func HandleUserPromptSubmit(input *HookInput) error {
 	msg := model.NewMessage(model.RoleHuman, input.Prompt, "", nil)
 	thread.AddMessage(msg)
 
+	// Snapshot the working tree, so the turn's tool calls are diffed
+	// against it rather than against changes made between turns
+	state.Snapshot, _ = repo.GitSnapshot()
+
 	// If thread ID changed (first message was added), update session state and clean up
+	state.ThreadID = thread.ID
+	if err := saveSessionState(repo.RootPath, state); err != nil {
+		return err
+	}
 	if thread.ID != oldThreadID {
-		// Update session state with new thread ID
-		if err := saveSessionState(repo.RootPath, &SessionState{
-			SessionID: state.SessionID,
-			ThreadID:  thread.ID,
-		}); err != nil {
-			return err
-		}
 		// Remove old temporary thread file
 		repo.DeleteThread(oldThreadID)
 		// Unstage old thread ID if it was staged
@@ -163,6 +176,12 @@ func HandleStop(input *HookInput) error {
 		return nil // Not a tin repo
 	}
 
+	unlock, err := lockSessionState(repo.RootPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	state, err := loadSessionState(repo.RootPath)
 	if err != nil || state == nil {
 		return nil // No active session
@@ -173,31 +192,111 @@ func HandleStop(input *HookInput) error {
 		return err
 	}
 
-	// Read transcript to get latest assistant response
-	assistantContent, toolCalls, err := getLatestAssistantResponse(input.TranscriptPath)
-	if err != nil {
-		return err
+	opts := claudecode.TranscriptOptions{}
+	if config, err := repo.ReadConfig(); err == nil {
+		opts.Thinking = config.CaptureThinking
 	}
 
-	if assistantContent == "" && len(toolCalls) == 0 {
-		return nil // No response to record
+	var messages []*model.Message
+	var subagents []claudecode.Subagent
+	if input.TranscriptPath != "" && input.TranscriptPath == state.TranscriptPath {
+		// Read everything the transcript gained since the last hook: each
+		// assistant message with its tool calls and results, in order
+		update, err := claudecode.ReadTranscriptSince(input.TranscriptPath, state.TranscriptOffset, opts)
+		if err != nil {
+			return err
+		}
+		messages, subagents, state.TranscriptOffset = update.Messages, update.Subagents, update.Offset
+	} else {
+		// Session tracked without a transcript offset (started by an older
+		// tin): record the latest response, and read incrementally from here
+		assistantContent, toolCalls, err := getLatestAssistantResponse(input.TranscriptPath)
+		if err != nil {
+			return err
+		}
+		if assistantContent != "" || len(toolCalls) > 0 {
+			messages = append(messages, model.NewMessage(model.RoleAssistant, assistantContent, "", toolCalls))
+		}
+		state.TranscriptPath = input.TranscriptPath
+		state.TranscriptOffset = claudecode.TranscriptSize(input.TranscriptPath)
 	}
 
-	// Get current git hash
+	if len(messages) == 0 {
+		return saveSessionState(repo.RootPath, state) // No response to record
+	}
+
+	// Attach the working tree changes of the turn's tool calls
+	claudecode.AttachSnapshots(messages, subagents, state.Snapshots)
+	state.Snapshots = nil
+
+	for _, msg := range messages {
+		thread.AddMessage(msg)
+	}
+
+	// The git state is known as of the end of the turn
 	gitHash, _ := repo.GetCurrentGitHash()
+	thread.Messages[len(thread.Messages)-1].GitHashAfter = gitHash
+
+	// Subagent runs of the turn become child threads
+	threads := append([]*model.Thread{thread}, claudecode.SubagentThreads(thread, subagents)...)
+	for _, t := range threads {
+		// Auto-stage the thread with content hash
+		contentHash := t.ComputeContentHash()
+		if err := repo.StageThread(t.ID, len(t.Messages), contentHash); err != nil {
+			return err
+		}
+		if err := repo.SaveThread(t); err != nil {
+			return err
+		}
+	}
+	return saveSessionState(repo.RootPath, state)
+}
 
-	// Create assistant message
-	msg := model.NewMessage(model.RoleAssistant, assistantContent, "", toolCalls)
-	msg.GitHashAfter = gitHash
-	thread.AddMessage(msg)
+// HandlePostToolUse handles the PostToolUse hook event (a tool call that may
+// have changed files finished). It snapshots the working tree, and if the
+// tool call changed it, keeps the change until the Stop hook records the
+// tool call.
+func HandlePostToolUse(input *HookInput) error {
+	if input.ToolUseID == "" {
+		return nil
+	}
 
-	// Auto-stage the thread with content hash
-	contentHash := thread.ComputeContentHash()
-	if err := repo.StageThread(thread.ID, len(thread.Messages), contentHash); err != nil {
+	repo, err := storage.Open(input.Cwd)
+	if err != nil {
+		return nil // Not a tin repo
+	}
+
+	// Claude Code runs the hooks of parallel tool calls concurrently; each
+	// must see the snapshot the previous one saved
+	unlock, err := lockSessionState(repo.RootPath)
+	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	return repo.SaveThread(thread)
+	state, err := loadSessionState(repo.RootPath)
+	if err != nil || state == nil || state.SessionID != input.SessionID {
+		return nil // No active session
+	}
+
+	after, err := repo.GitSnapshot()
+	if err != nil {
+		return nil // Not a git working tree
+	}
+	before := state.Snapshot
+	if before == "" {
+		before, _ = repo.GitTree("HEAD")
+	}
+	if before == "" || after == before {
+		return nil // Nothing changed
+	}
+
+	if state.Snapshots == nil {
+		state.Snapshots = make(map[string]model.Snapshot)
+	}
+	state.Snapshots[input.ToolUseID] = model.Snapshot{Before: before, After: after}
+	state.Snapshot = after
+	return saveSessionState(repo.RootPath, state)
 }
 
 // HandleSessionEnd handles the SessionEnd hook event
@@ -403,6 +502,12 @@ func saveSessionState(cwd string, state *SessionState) error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// lockSessionState serializes hooks that update the session state, so
+// concurrent ones don't overwrite each other's changes
+func lockSessionState(cwd string) (func(), error) {
+	return storage.LockFile(filepath.Join(cwd, ".tin", stateFileName))
+}
+
 func clearSessionState(cwd string) {
 	path := filepath.Join(cwd, ".tin", stateFileName)
 	os.Remove(path)
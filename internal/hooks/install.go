@@ -70,6 +70,12 @@ type HookConfig struct {
 	Timeout int    `json:"timeout,omitempty"`
 }
 
+// toolHookMatchers limits tool hooks to the tools that change files; the
+// working tree is snapshotted after each of them
+var toolHookMatchers = map[string]string{
+	"PostToolUse": "Edit|MultiEdit|Write|NotebookEdit|Bash",
+}
+
 // InstallClaudeCodeHooks installs tin hooks into Claude Code settings
 func InstallClaudeCodeHooks(projectDir string, global bool) error {
 	// Find tin binary path
@@ -120,6 +126,7 @@ func InstallClaudeCodeHooks(projectDir string, global bool) error {
 		"UserPromptSubmit": "user-prompt",
 		"Stop":             "stop",
 		"SessionEnd":       "session-end",
+		"PostToolUse":      "post-tool-use",
 	}
 
 	for event, handler := range tinHooks {
@@ -139,6 +146,7 @@ func InstallClaudeCodeHooks(projectDir string, global bool) error {
 
 		if !alreadyInstalled {
 			settings.Hooks[event] = append(settings.Hooks[event], HookMatcher{
+				Matcher: toolHookMatchers[event],
 				Hooks: []HookConfig{{
 					Type:    "command",
 					Command: hookCmd,
@@ -192,7 +200,7 @@ func UninstallClaudeCodeHooks(projectDir string, global bool) error {
 	}
 
 	// Remove tin hooks
-	events := []string{"SessionStart", "UserPromptSubmit", "Stop", "SessionEnd"}
+	events := []string{"SessionStart", "UserPromptSubmit", "Stop", "SessionEnd", "PostToolUse"}
 	for _, event := range events {
 		matchers := settings.Hooks[event]
 		var filtered []HookMatcher
@@ -21,6 +21,14 @@ type ToolCall struct {
 	Name      string          `json:"name"`
 	Arguments json.RawMessage `json:"arguments"`
 	Result    string          `json:"result,omitempty"`
+	Snapshot  *Snapshot       `json:"snapshot,omitempty"` // Working tree change, if the call made one
+}
+
+// Snapshot is the git working tree before and after a tool call, as git
+// tree object hashes
+type Snapshot struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
 }
 
 // Message represents a single message in a conversation thread
@@ -30,6 +38,7 @@ type Message struct {
 	Content         string     `json:"content"`
 	Timestamp       time.Time  `json:"timestamp"`
 	ToolCalls       []ToolCall `json:"tool_calls,omitempty"`
+	Thinking        string     `json:"thinking,omitempty"` // Assistant reasoning, if captured
 	GitHashAfter    string     `json:"git_hash_after,omitempty"`
 	ParentMessageID string     `json:"parent_message_id,omitempty"`
 }
@@ -50,6 +59,11 @@ func (m *Message) ComputeHash() string {
 		h.Write(toolCallsJSON)
 	}
 
+	// Only hashed when present, so messages without it keep their IDs
+	if m.Thinking != "" {
+		h.Write([]byte(m.Thinking))
+	}
+
 	return hex.EncodeToString(h.Sum(nil))
 }
 
@@ -119,6 +119,27 @@ func TestMessage_ComputeHash_WithToolCalls(t *testing.T) {
 	}
 }
 
+func TestMessage_ComputeHash_WithThinking(t *testing.T) {
+	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	msg := &Message{
+		Role:      RoleAssistant,
+		Content:   "same content",
+		Timestamp: timestamp,
+	}
+	hash1 := msg.ComputeHash()
+
+	msg.Thinking = "considering options"
+	if msg.ComputeHash() == hash1 {
+		t.Error("message with thinking should have different hash")
+	}
+
+	msg.Thinking = ""
+	if msg.ComputeHash() != hash1 {
+		t.Error("empty thinking should not change the hash")
+	}
+}
+
 func TestMessage_ComputeHash_WithParent(t *testing.T) {
 	timestamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
 
@@ -22,6 +22,7 @@ type Thread struct {
 	ID                    string       `json:"id"`
 	ParentThreadID        string       `json:"parent_thread_id,omitempty"`
 	ParentMessageID       string       `json:"parent_message_id,omitempty"` // fork point if branched mid-thread
+	ParentToolCallID      string       `json:"parent_tool_call_id,omitempty"` // tool call that launched this thread (subagents)
 	Agent                 string       `json:"agent"`                       // "claude-code", "cursor", "amp", etc.
 	AgentSessionID        string       `json:"agent_session_id,omitempty"`  // for resume capability
 	StartedAt             time.Time    `json:"started_at"`
@@ -61,6 +62,12 @@ func (t *Thread) AddMessage(msg *Message) {
 	}
 }
 
+// IsSubagent reports whether the thread is a subagent run launched by a tool
+// call of its parent thread, rather than a continuation of it
+func (t *Thread) IsSubagent() bool {
+	return t.ParentToolCallID != ""
+}
+
 // Complete marks the thread as completed
 func (t *Thread) Complete() {
 	now := time.Now().UTC()
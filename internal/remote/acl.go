@@ -0,0 +1,261 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Permission is the level of access a user has to a repository
+type Permission int
+
+const (
+	PermNone  Permission = iota
+	PermRead             // pull and read config
+	PermWrite            // push
+	PermAdmin            // create repositories and change config
+)
+
+// String returns the permission name as used in ACL files
+func (p Permission) String() string {
+	switch p {
+	case PermRead:
+		return "read"
+	case PermWrite:
+		return "write"
+	case PermAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// ParsePermission parses a permission name from an ACL file
+func ParsePermission(s string) (Permission, error) {
+	switch s {
+	case "read":
+		return PermRead, nil
+	case "write":
+		return PermWrite, nil
+	case "admin":
+		return PermAdmin, nil
+	default:
+		return PermNone, fmt.Errorf("unknown permission: %q (expected read, write or admin)", s)
+	}
+}
+
+// MarshalJSON encodes the permission by name
+func (p Permission) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON decodes a permission name
+func (p *Permission) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParsePermission(s)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// ACL maps users and groups to permissions on repositories. Repository
+// patterns are matched against the repository path relative to the server
+// root (e.g. "team/project.tin"); "*" matches within one path segment and
+// "**" matches any number of segments.
+//
+// A nil ACL grants everyone admin access, which preserves the behavior of
+// servers started without an ACL file.
+type ACL struct {
+	Groups            map[string][]string   `json:"groups,omitempty"` // group name -> member user IDs
+	Rules             []ACLRule             `json:"rules"`
+	ProtectedBranches []ProtectedBranchRule `json:"protected_branches,omitempty"`
+}
+
+// ACLRule grants a permission on matching repositories to users and groups.
+// The user "*" matches every user.
+type ACLRule struct {
+	Users      []string   `json:"users,omitempty"`
+	Groups     []string   `json:"groups,omitempty"`
+	Repos      []string   `json:"repos"`
+	Permission Permission `json:"permission"`
+}
+
+// ProtectedBranchRule marks branches that refuse force pushes and
+// non-fast-forward updates, even from admins
+type ProtectedBranchRule struct {
+	Repos    []string `json:"repos"`
+	Branches []string `json:"branches"`
+}
+
+// LoadACL reads an ACL from a JSON file
+func LoadACL(filename string) (*ACL, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACL: %w", err)
+	}
+
+	var acl ACL
+	if err := json.Unmarshal(data, &acl); err != nil {
+		return nil, fmt.Errorf("failed to parse ACL %s: %w", filename, err)
+	}
+	if err := acl.validate(); err != nil {
+		return nil, fmt.Errorf("invalid ACL %s: %w", filename, err)
+	}
+	return &acl, nil
+}
+
+// validate checks that every pattern in the ACL is well formed
+func (a *ACL) validate() error {
+	for i, rule := range a.Rules {
+		if len(rule.Repos) == 0 {
+			return fmt.Errorf("rule %d: no repos", i+1)
+		}
+		if rule.Permission == PermNone {
+			return fmt.Errorf("rule %d: no permission", i+1)
+		}
+		for _, group := range rule.Groups {
+			if _, ok := a.Groups[group]; !ok {
+				return fmt.Errorf("rule %d: unknown group %q", i+1, group)
+			}
+		}
+		for _, pattern := range rule.Repos {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: bad repo pattern %q", i+1, pattern)
+			}
+		}
+	}
+	for i, rule := range a.ProtectedBranches {
+		for _, pattern := range append(append([]string{}, rule.Repos...), rule.Branches...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("protected branch rule %d: bad pattern %q", i+1, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Permission returns the highest permission any rule grants the user on the repository
+func (a *ACL) Permission(userID, repo string) Permission {
+	if a == nil {
+		return PermAdmin
+	}
+
+	repo = repoKey(repo)
+	best := PermNone
+	for _, rule := range a.Rules {
+		if rule.Permission <= best || !a.ruleMatchesUser(rule, userID) {
+			continue
+		}
+		for _, pattern := range rule.Repos {
+			if matchGlob(pattern, repo) {
+				best = rule.Permission
+				break
+			}
+		}
+	}
+	return best
+}
+
+func (a *ACL) ruleMatchesUser(rule ACLRule, userID string) bool {
+	for _, u := range rule.Users {
+		if u == "*" || u == userID {
+			return true
+		}
+	}
+	for _, group := range rule.Groups {
+		for _, member := range a.Groups[group] {
+			if member == "*" || member == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProtectedBranchPatterns returns the protected branch patterns that apply to the repository
+func (a *ACL) ProtectedBranchPatterns(repo string) []string {
+	if a == nil {
+		return nil
+	}
+
+	repo = repoKey(repo)
+	var patterns []string
+	for _, rule := range a.ProtectedBranches {
+		for _, pattern := range rule.Repos {
+			if matchGlob(pattern, repo) {
+				patterns = append(patterns, rule.Branches...)
+				break
+			}
+		}
+	}
+	return patterns
+}
+
+// checkPermission checks that the session's user may perform the operation.
+// Pulls and config reads need read permission, pushes need write permission.
+func checkPermission(sess *session, operation string) *ErrorMessage {
+	need := PermRead
+	if operation == "push" {
+		need = PermWrite
+	}
+	if sess.perm < need {
+		return &ErrorMessage{
+			Code:    ErrCodeForbidden,
+			Message: fmt.Sprintf("%s requires %s permission", operation, need),
+		}
+	}
+	return nil
+}
+
+// authenticateHello checks the credentials sent in a TCP hello message and
+// returns the user and the scope of their credentials. Without a validator,
+// every client is allowed as the anonymous user "": a username nothing
+// verified must not be matched against the ACL.
+func authenticateHello(validator AuthValidator, auth *AuthInfo) (string, Permission, bool) {
+	if validator == nil {
+		return "", PermAdmin, true
+	}
+	if auth == nil {
+		return "", PermNone, false
+	}
+	return ValidateCredentials(validator, auth.Username, auth.Token)
+}
+
+// repoKey normalizes a client-supplied repository path for ACL matching
+func repoKey(repoPath string) string {
+	return strings.Trim(path.Clean("/"+repoPath), "/")
+}
+
+// matchGlob matches a slash-separated name against a pattern in which "*"
+// matches within a segment and a "**" segment matches zero or more segments
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,243 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+const testACLJSON = `{
+  "groups": {"devs": ["alice", "bob"]},
+  "rules": [
+    {"groups": ["devs"], "repos": ["team/**"], "permission": "write"},
+    {"users": ["alice"], "repos": ["**"], "permission": "admin"},
+    {"users": ["*"], "repos": ["public/*"], "permission": "read"}
+  ],
+  "protected_branches": [
+    {"repos": ["team/**"], "branches": ["main", "release/*"]}
+  ]
+}`
+
+func writeTestACL(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "acl.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestACL_Permission(t *testing.T) {
+	acl, err := LoadACL(writeTestACL(t, testACLJSON))
+	if err != nil {
+		t.Fatalf("LoadACL failed: %v", err)
+	}
+
+	tests := []struct {
+		user, repo string
+		want       Permission
+	}{
+		{"alice", "anything/at/all.tin", PermAdmin},
+		{"bob", "team/proj.tin", PermWrite},
+		{"bob", "/team/sub/proj.tin", PermWrite},
+		{"bob", "other/proj.tin", PermNone},
+		{"bob", "public/docs.tin", PermRead},
+		{"carol", "public/docs.tin", PermRead},
+		{"carol", "public/nested/docs.tin", PermNone},
+		{"carol", "team/proj.tin", PermNone},
+		{"bob", "team/../other/proj.tin", PermNone},
+	}
+	for _, tt := range tests {
+		if got := acl.Permission(tt.user, tt.repo); got != tt.want {
+			t.Errorf("Permission(%q, %q) = %s, want %s", tt.user, tt.repo, got, tt.want)
+		}
+	}
+
+	var none *ACL
+	if got := none.Permission("anyone", "any.tin"); got != PermAdmin {
+		t.Errorf("nil ACL permission = %s, want admin", got)
+	}
+}
+
+func TestACL_ProtectedBranches(t *testing.T) {
+	acl, err := LoadACL(writeTestACL(t, testACLJSON))
+	if err != nil {
+		t.Fatalf("LoadACL failed: %v", err)
+	}
+
+	sess := &session{protected: acl.ProtectedBranchPatterns("team/proj.tin")}
+	for branch, want := range map[string]bool{"main": true, "release/1.0": true, "feature": false, "release/1.0/hotfix": false} {
+		if got := sess.isProtected(branch); got != want {
+			t.Errorf("isProtected(%q) = %v, want %v", branch, got, want)
+		}
+	}
+	if patterns := acl.ProtectedBranchPatterns("public/docs.tin"); len(patterns) != 0 {
+		t.Errorf("unexpected protected branches for public repo: %v", patterns)
+	}
+}
+
+func TestLoadACL_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown permission": `{"rules": [{"users": ["a"], "repos": ["*"], "permission": "owner"}]}`,
+		"missing permission": `{"rules": [{"users": ["a"], "repos": ["*"]}]}`,
+		"no repos":           `{"rules": [{"users": ["a"], "permission": "read"}]}`,
+		"unknown group":      `{"rules": [{"groups": ["ops"], "repos": ["*"], "permission": "read"}]}`,
+		"bad pattern":        `{"rules": [{"users": ["a"], "repos": ["[x"], "permission": "read"}]}`,
+	}
+	for name, content := range tests {
+		if _, err := LoadACL(writeTestACL(t, content)); err == nil {
+			t.Errorf("%s: expected LoadACL to fail", name)
+		}
+	}
+}
+
+func TestProtocol_ACLEnforced(t *testing.T) {
+	acl, err := LoadACL(writeTestACL(t, testACLJSON))
+	if err != nil {
+		t.Fatalf("LoadACL failed: %v", err)
+	}
+	auth := NewTokenAuthValidator(map[string]string{"alice": "a", "bob": "b", "carol": "c"})
+
+	servers := []struct {
+		name  string
+		start func(t *testing.T) (string, string)
+	}{
+		{"tcp", func(t *testing.T) (string, string) {
+			return startTCPServer(t, func(s *Server) {
+				s.SetAuthValidator(auth)
+				s.SetACL(acl)
+			})
+		}},
+		{"http", func(t *testing.T) (string, string) {
+			return startHTTPServer(t, func(h *HTTPHandler) {
+				h.authValidator = auth
+				h.SetACL(acl)
+			})
+		}},
+	}
+
+	for _, srv := range servers {
+		t.Run(srv.name, func(t *testing.T) {
+			root, base := srv.start(t)
+			as := func(user, password string) *Client {
+				client, err := Dial(base+"/team/proj.tin", &Credentials{Username: user, Password: password})
+				if err != nil {
+					t.Fatalf("Dial failed: %v", err)
+				}
+				t.Cleanup(func() { client.Close() })
+				return client
+			}
+
+			local := newTestRepo(t)
+			first := addTestCommit(t, local, "main", "first")
+
+			// Creating a repository requires admin
+			if err := as("bob", "b").Push(local, "main", false); err == nil || !strings.Contains(err.Error(), "admin") {
+				t.Fatalf("expected writer to be refused repo creation, got %v", err)
+			}
+			if err := as("alice", "a").Push(local, "main", false); err != nil {
+				t.Fatalf("admin Push failed: %v", err)
+			}
+
+			// Writers push; others may not
+			second := addTestCommit(t, local, "main", "second")
+			if err := as("bob", "b").Push(local, "main", false); err != nil {
+				t.Fatalf("writer Push failed: %v", err)
+			}
+			if err := as("carol", "c").Push(local, "main", false); err == nil || !strings.Contains(err.Error(), "write permission") {
+				t.Errorf("expected carol's push to be refused, got %v", err)
+			}
+			if _, err := as("carol", "c").Pull(newTestRepo(t), "main"); err == nil {
+				t.Error("expected carol's pull to be refused")
+			}
+			if err := as("bob", "wrong").Push(local, "main", false); err == nil {
+				t.Error("expected push with bad password to be refused")
+			}
+
+			// Only admins change config
+			if err := as("bob", "b").SetConfig(&SetConfigMessage{CodeHostURL: "https://example.com"}); err == nil {
+				t.Error("expected writer SetConfig to be refused")
+			}
+			if err := as("alice", "a").SetConfig(&SetConfigMessage{CodeHostURL: "https://example.com"}); err != nil {
+				t.Errorf("admin SetConfig failed: %v", err)
+			}
+
+			// Protected branches refuse forced rewrites, even from admins
+			rewrite := model.NewTinCommit("rewrite", nil, "", first.ID)
+			local.SaveCommit(rewrite)
+			local.WriteBranch("main", rewrite.ID)
+			err := as("alice", "a").Push(local, "main", true)
+			if err == nil || !strings.Contains(err.Error(), "protected") {
+				t.Errorf("expected forced push to protected branch to be refused, got %v", err)
+			}
+
+			// Unprotected branches still accept forced rewrites
+			local.WriteBranch("feature", first.ID)
+			if err := as("bob", "b").Push(local, "feature", false); err != nil {
+				t.Fatalf("feature Push failed: %v", err)
+			}
+			local.WriteBranch("feature", rewrite.ID)
+			if err := as("bob", "b").Push(local, "feature", true); err != nil {
+				t.Errorf("forced push to unprotected branch failed: %v", err)
+			}
+
+			// Merging the protected branch back in is a fast-forward, even
+			// when it is the merge's second parent
+			merge := model.NewMergeCommit("merge main", nil, "", rewrite.ID, second.ID)
+			local.SaveCommit(merge)
+			local.WriteBranch("main", merge.ID)
+			if err := as("bob", "b").Push(local, "main", false); err != nil {
+				t.Errorf("merge Push to protected branch failed: %v", err)
+			}
+
+			bare, _ := storage.OpenBare(filepath.Join(root, "team", "proj.tin"))
+			if got, _ := bare.ReadBranch("main"); got != merge.ID {
+				t.Errorf("main = %s, want the merge %s", got, merge.ID)
+			}
+		})
+	}
+}
+
+func TestProtocol_ACLIgnoresUnverifiedUsers(t *testing.T) {
+	acl, err := LoadACL(writeTestACL(t, testACLJSON))
+	if err != nil {
+		t.Fatalf("LoadACL failed: %v", err)
+	}
+
+	// Without a validator, nothing verifies the username a client sends
+	servers := []struct {
+		name  string
+		start func(t *testing.T) (string, string)
+	}{
+		{"tcp", func(t *testing.T) (string, string) {
+			return startTCPServer(t, func(s *Server) { s.SetACL(acl) })
+		}},
+		{"http", func(t *testing.T) (string, string) {
+			return startHTTPServer(t, func(h *HTTPHandler) { h.SetACL(acl) })
+		}},
+	}
+
+	for _, srv := range servers {
+		t.Run(srv.name, func(t *testing.T) {
+			_, base := srv.start(t)
+			client, err := Dial(base+"/team/proj.tin", &Credentials{Username: "alice", Password: "anything"})
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer client.Close()
+
+			local := newTestRepo(t)
+			addTestCommit(t, local, "main", "first")
+			if err := client.Push(local, "main", false); err == nil {
+				t.Error("expected a client claiming to be alice to be refused")
+			}
+			if _, err := client.Pull(newTestRepo(t), "main"); err == nil {
+				t.Error("expected a client claiming to be alice to be refused a pull")
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package remote
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capabilities are optional protocol features negotiated during the handshake.
+// The client lists the capabilities it supports in its hello; the server
+// replies with the intersection in its refs advertisement. Both sides then only
+// use features present in that intersection, so either side can add features
+// without a lockstep upgrade.
+const (
+	// CapMultiRef allows a single push to update several branches atomically.
+	// Without it, the client pushes each branch over its own connection.
+	CapMultiRef = "multi-ref"
+
+	// CapStreamPack replaces the single pack message with a pack-start message,
+	// one object message per commit or thread, and a pack-end message, so
+	// neither side has to hold a whole pack in memory. Over HTTP a streamed
+	// push may be split across several requests.
+	CapStreamPack = "stream-pack"
+
+	// CapCompression allows gzip-compressed object payloads in streamed packs
+	CapCompression = "compression"
+
+	// CapHaveWant replaces the advertisement of every object ID in refs with a
+	// negotiation: the client sends batches of "have" commit IDs, the server
+	// acknowledges the ones it has, and only missing objects are transferred.
+	CapHaveWant = "have-want"
+)
+
+// supportedCapabilities lists the capabilities implemented by this build
+var supportedCapabilities = []string{
+	CapMultiRef,
+	CapStreamPack,
+	CapCompression,
+	CapHaveWant,
+}
+
+// SupportedCapabilities returns the capabilities implemented by this build
+func SupportedCapabilities() []string {
+	caps := make([]string, len(supportedCapabilities))
+	copy(caps, supportedCapabilities)
+	return caps
+}
+
+// CapabilitySet is a set of negotiated capability names
+type CapabilitySet map[string]bool
+
+// NewCapabilitySet creates a set from a list of capability names
+func NewCapabilitySet(caps []string) CapabilitySet {
+	set := make(CapabilitySet, len(caps))
+	for _, c := range caps {
+		if c != "" {
+			set[c] = true
+		}
+	}
+	return set
+}
+
+// Has reports whether the capability is in the set
+func (s CapabilitySet) Has(c string) bool {
+	return s[c]
+}
+
+// Intersect returns the capabilities present in both sets
+func (s CapabilitySet) Intersect(other CapabilitySet) CapabilitySet {
+	result := make(CapabilitySet)
+	for c := range s {
+		if other[c] {
+			result[c] = true
+		}
+	}
+	return result
+}
+
+// List returns the capabilities in the set, sorted by name
+func (s CapabilitySet) List() []string {
+	caps := make([]string, 0, len(s))
+	for c := range s {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// String returns the capabilities as a comma-separated list
+func (s CapabilitySet) String() string {
+	return strings.Join(s.List(), ",")
+}
+
+// ParseCapabilities parses a comma-separated capability list (as used in HTTP headers)
+func ParseCapabilities(value string) []string {
+	var caps []string
+	for _, c := range strings.Split(value, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// session holds the per-connection state agreed on during the handshake
+type session struct {
+	version int
+	caps    CapabilitySet
+
+	repo      string     // repository path relative to the server root
+	user      string     // authenticated user ID ("" if anonymous)
+	perm      Permission // user's permission on the repository
+	protected []string   // protected branch patterns for the repository
+}
+
+// isProtected reports whether the branch matches a protected branch pattern
+func (s *session) isProtected(branch string) bool {
+	for _, pattern := range s.protected {
+		if matchGlob(pattern, branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateSession computes the protocol version and capabilities for a connection.
+// Clients newer than the server are downgraded to the server's version rather than
+// refused; only clients older than MinProtocolVersion are rejected.
+func negotiateSession(clientVersion int, clientCaps []string, serverVersion int, serverCaps []string) (*session, error) {
+	if clientVersion < MinProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version: %d", clientVersion)
+	}
+
+	version := clientVersion
+	if version > serverVersion {
+		version = serverVersion
+	}
+
+	// Version 1 predates capability negotiation
+	caps := make(CapabilitySet)
+	if version >= 2 {
+		caps = NewCapabilitySet(clientCaps).Intersect(NewCapabilitySet(serverCaps))
+	}
+
+	return &session{version: version, caps: caps}, nil
+}
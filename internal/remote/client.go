@@ -2,6 +2,8 @@ package remote
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 
 	"github.com/sestinj/tin/internal/model"
 	"github.com/sestinj/tin/internal/storage"
@@ -11,6 +13,21 @@ import (
 type Client struct {
 	transport Transport
 	url       *ParsedURL
+	creds     *Credentials
+
+	version      int           // protocol version offered in hello (downgraded for v1 servers)
+	capabilities []string      // capabilities offered in hello
+	caps         CapabilitySet // capabilities negotiated with the server
+
+	progress func(Progress)
+}
+
+// Progress describes how far a pack transfer has got
+type Progress struct {
+	Phase   string // "sending" or "receiving"
+	Objects int    // objects transferred so far
+	Total   int    // objects announced in pack-start
+	Bytes   int64  // encoded object bytes transferred so far
 }
 
 // Dial connects to a remote tin server using the appropriate transport
@@ -20,148 +37,279 @@ func Dial(rawURL string, creds *Credentials) (*Client, error) {
 		return nil, err
 	}
 
-	var transport Transport
+	transport, err := dialTransport(url, creds)
+	if err != nil {
+		return nil, err
+	}
 
+	return &Client{
+		transport:    transport,
+		url:          url,
+		creds:        creds,
+		version:      ProtocolVersion,
+		capabilities: SupportedCapabilities(),
+		caps:         make(CapabilitySet),
+	}, nil
+}
+
+// dialTransport creates the transport for the URL's scheme
+func dialTransport(url *ParsedURL, creds *Credentials) (Transport, error) {
 	switch url.TransportType() {
 	case "https":
-		transport, err = NewHTTPSTransport(url, creds)
+		return NewHTTPSTransport(url, creds)
 	default: // "tcp"
-		transport, err = NewTCPTransport(url)
+		return NewTCPTransport(url, creds)
 	}
+}
 
+// reconnect replaces the transport with a fresh connection to the same remote
+func (c *Client) reconnect() error {
+	c.transport.Close()
+	transport, err := dialTransport(c.url, c.creds)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	return &Client{
-		transport: transport,
-		url:       url,
-	}, nil
+	c.transport = transport
+	return nil
 }
 
 // makeHello creates a HelloMessage
 // Note: Authentication is handled at the transport layer, not in the protocol
 func (c *Client) makeHello(operation string) HelloMessage {
-	return HelloMessage{
-		Version:   ProtocolVersion,
+	hello := HelloMessage{
+		Version:   c.version,
 		Operation: operation,
 		RepoPath:  c.url.Path,
 	}
+	if c.version >= 2 {
+		hello.Capabilities = c.capabilities
+	}
+	return hello
 }
 
-// Close closes the connection
-func (c *Client) Close() error {
-	return c.transport.Close()
-}
+// handshake sends the hello for an operation, followed by any request messages,
+// and returns the server's first response. Servers that predate negotiation
+// refuse any version but 1, so on a protocol version error the client reconnects
+// and retries as a v1 client.
+func (c *Client) handshake(operation string, sendRequest func() error) (*Message, error) {
+	for {
+		if err := c.transport.Send(MsgHello, c.makeHello(operation)); err != nil {
+			return nil, fmt.Errorf("failed to send hello: %w", err)
+		}
+		if sendRequest != nil {
+			if err := sendRequest(); err != nil {
+				return nil, err
+			}
+		}
 
-// Push pushes commits and threads to the remote and updates refs
-func (c *Client) Push(repo *storage.Repository, branch string, force bool) error {
-	// Send hello
-	if err := c.transport.Send(MsgHello, c.makeHello("push")); err != nil {
-		return fmt.Errorf("failed to send hello: %w", err)
+		msg, err := c.transport.Receive()
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.Type == MsgError && c.version > MinProtocolVersion {
+			var errMsg ErrorMessage
+			msg.DecodePayload(&errMsg)
+			if errMsg.Code == ErrCodeProtocolVersion {
+				if err := c.reconnect(); err != nil {
+					return nil, err
+				}
+				c.version = MinProtocolVersion
+				continue
+			}
+		}
+
+		return msg, nil
 	}
+}
 
-	// Receive refs
-	msg, err := c.transport.Receive()
+// receiveRefs performs the handshake for a push or pull and returns the
+// server's refs advertisement, recording the negotiated capabilities
+func (c *Client) receiveRefs(operation string) (*RefsMessage, error) {
+	msg, err := c.handshake(operation, nil)
 	if err != nil {
-		return fmt.Errorf("failed to receive refs: %w", err)
+		return nil, fmt.Errorf("failed to receive refs: %w", err)
 	}
 	if msg.Type == MsgError {
 		var errMsg ErrorMessage
 		msg.DecodePayload(&errMsg)
-		return fmt.Errorf("server error: %s", errMsg.Message)
+		return nil, fmt.Errorf("server error: %s", errMsg.Message)
 	}
 	if msg.Type != MsgRefs {
-		return fmt.Errorf("expected refs message, got %s", msg.Type)
+		return nil, fmt.Errorf("expected refs message, got %s", msg.Type)
 	}
 
-	var remoteRefs RefsMessage
-	if err := msg.DecodePayload(&remoteRefs); err != nil {
-		return fmt.Errorf("failed to decode refs: %w", err)
+	var refs RefsMessage
+	if err := msg.DecodePayload(&refs); err != nil {
+		return nil, fmt.Errorf("failed to decode refs: %w", err)
 	}
 
-	// Build set of remote commits for quick lookup
-	remoteCommits := make(map[string]bool)
-	for _, id := range remoteRefs.CommitIDs {
-		remoteCommits[id] = true
+	// A v1 server sends no version and supports no capabilities
+	c.caps = make(CapabilitySet)
+	if refs.Version >= 2 {
+		c.caps = NewCapabilitySet(refs.Capabilities).Intersect(NewCapabilitySet(c.capabilities))
 	}
 
-	// Get local commit for branch
-	localCommitID, err := repo.ReadBranch(branch)
-	if err != nil {
-		return fmt.Errorf("branch %s not found", branch)
+	return &refs, nil
+}
+
+// Version returns the protocol version offered in the most recent hello
+func (c *Client) Version() int {
+	return c.version
+}
+
+// Capabilities returns the capabilities negotiated in the most recent handshake
+func (c *Client) Capabilities() []string {
+	return c.caps.List()
+}
+
+// SetProgress registers a callback that is invoked as pack objects are
+// sent or received. Only streamed packs report progress.
+func (c *Client) SetProgress(fn func(Progress)) {
+	c.progress = fn
+}
+
+func (c *Client) reportProgress(p Progress) {
+	if c.progress != nil {
+		c.progress(p)
 	}
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
 
-	// Collect commits to send (walk back from branch tip)
-	commitsToSend := make([]model.TinCommit, 0)
-	threadsToSend := make(map[string]*model.Thread)
+// Push pushes commits and threads to the remote and updates refs
+func (c *Client) Push(repo *storage.Repository, branch string, force bool) error {
+	return c.PushBranches(repo, []string{branch}, force)
+}
 
-	current := localCommitID
-	for current != "" {
-		if remoteCommits[current] {
-			break // Remote already has this commit and ancestors
+// PushBranches pushes several branches to the remote. If the server supports
+// the multi-ref capability all branches are updated atomically in one push;
+// otherwise each branch is pushed over its own connection.
+func (c *Client) PushBranches(repo *storage.Repository, branches []string, force bool) error {
+	for i := 0; i < len(branches); {
+		if i > 0 {
+			if err := c.reconnect(); err != nil {
+				return err
+			}
 		}
 
-		commit, err := repo.LoadCommit(current)
+		remoteRefs, err := c.receiveRefs("push")
 		if err != nil {
-			return fmt.Errorf("failed to load commit %s: %w", current, err)
+			return err
+		}
+
+		batch := branches[i:]
+		if !c.caps.Has(CapMultiRef) {
+			batch = batch[:1]
+		}
+		if err := c.sendPack(repo, batch, remoteRefs, force); err != nil {
+			return err
 		}
+		i += len(batch)
+	}
+
+	return nil
+}
+
+// sendPack sends the objects the remote is missing for the given branches,
+// followed by the ref updates, and waits for the server's verdict
+func (c *Client) sendPack(repo *storage.Repository, branches []string, remoteRefs *RefsMessage, force bool) error {
+	updates := make(map[string]string)
+	tips := make([]string, 0, len(branches))
+	for _, branch := range branches {
+		localCommitID, err := repo.ReadBranch(branch)
+		if err != nil || localCommitID == "" {
+			return fmt.Errorf("branch %s not found", branch)
+		}
+		updates[branch] = localCommitID
+		tips = append(tips, localCommitID)
+	}
+
+	// Find the commits the remote already has. With have-want the server is
+	// asked; otherwise it advertised every commit ID in refs.
+	remoteCommits := make(map[string]bool)
+	if c.caps.Has(CapHaveWant) {
+		// Remote branch tips we have locally are known to be common
+		known := make(map[string]bool)
+		for _, id := range remoteRefs.Branches {
+			if repo.HasCommit(id) {
+				known[id] = true
+			}
+		}
+		common, err := c.findCommonCommits(repo, tips, known)
+		if err != nil {
+			return err
+		}
+		remoteCommits = common
+	} else {
+		for _, id := range remoteRefs.CommitIDs {
+			remoteCommits[id] = true
+		}
+	}
+
+	// Collect commits to send (walk back from each branch tip, parents first).
+	// Threads are only recorded here and loaded one at a time while sending.
+	missing, err := collectMissingCommits(repo, tips, remoteCommits)
+	if err != nil {
+		return err
+	}
+
+	commitsToSend := make([]model.TinCommit, 0, len(missing))
+	threadsToSend := make([]model.ThreadRef, 0)
+	seenThreads := make(map[string]bool)
+	for _, commit := range missing {
 		commitsToSend = append(commitsToSend, *commit)
 
 		// Collect threads referenced by this commit
-		// Load specific versions if ContentHash is available, otherwise load latest
 		for _, ref := range commit.Threads {
 			// Use ContentHash as key if available to ensure we send the right version
 			key := ref.ThreadID
 			if ref.ContentHash != "" {
 				key = ref.ThreadID + "@" + ref.ContentHash
 			}
-
-			if threadsToSend[key] == nil {
-				var thread *model.Thread
-				var err error
-
-				// Try to load specific version first
-				if ref.ContentHash != "" {
-					thread, err = repo.LoadThreadVersion(ref.ThreadID, ref.ContentHash)
-				}
-				// Fall back to latest version
-				if thread == nil || err != nil {
-					thread, err = repo.LoadThread(ref.ThreadID)
-				}
-				if err != nil {
-					return fmt.Errorf("failed to load thread %s: %w", ref.ThreadID, err)
-				}
-				threadsToSend[key] = thread
+			if !seenThreads[key] {
+				seenThreads[key] = true
+				threadsToSend = append(threadsToSend, ref)
 			}
 		}
-
-		current = commit.ParentCommitID
-	}
-
-	// Convert threads map to slice
-	threads := make([]model.Thread, 0, len(threadsToSend))
-	for _, t := range threadsToSend {
-		threads = append(threads, *t)
 	}
 
-	// Reverse commits to send oldest first
-	for i, j := 0, len(commitsToSend)-1; i < j; i, j = i+1, j-1 {
-		commitsToSend[i], commitsToSend[j] = commitsToSend[j], commitsToSend[i]
+	// Skip thread versions the server already has
+	if c.caps.Has(CapHaveWant) {
+		threadsToSend, err = c.filterThreadVersions(threadsToSend)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Send pack
-	pack := PackMessage{
-		Commits: commitsToSend,
-		Threads: threads,
-	}
-	if err := c.transport.Send(MsgPack, pack); err != nil {
-		return fmt.Errorf("failed to send pack: %w", err)
+	if c.caps.Has(CapStreamPack) {
+		if err := c.sendStreamedPack(repo, commitsToSend, threadsToSend); err != nil {
+			return err
+		}
+	} else {
+		pack := PackMessage{
+			Commits: commitsToSend,
+			Threads: make([]model.Thread, 0, len(threadsToSend)),
+		}
+		for _, ref := range threadsToSend {
+			thread, err := loadPushThread(repo, ref)
+			if err != nil {
+				return err
+			}
+			pack.Threads = append(pack.Threads, *thread)
+		}
+		if err := c.transport.Send(MsgPack, pack); err != nil {
+			return fmt.Errorf("failed to send pack: %w", err)
+		}
 	}
 
 	// Send ref updates
 	updateRefs := UpdateRefsMessage{
-		Updates: map[string]string{branch: localCommitID},
+		Updates: updates,
 		Force:   force,
 	}
 	if err := c.transport.Send(MsgUpdateRefs, updateRefs); err != nil {
@@ -169,7 +317,7 @@ func (c *Client) Push(repo *storage.Repository, branch string, force bool) error
 	}
 
 	// Wait for response
-	msg, err = c.transport.Receive()
+	msg, err := c.transport.Receive()
 	if err != nil {
 		return fmt.Errorf("failed to receive response: %w", err)
 	}
@@ -183,20 +331,194 @@ func (c *Client) Push(repo *storage.Repository, branch string, force bool) error
 	return nil
 }
 
-// GetConfig retrieves the remote repository's config
-func (c *Client) GetConfig() (*ConfigMessage, error) {
-	// Send hello
-	if err := c.transport.Send(MsgHello, c.makeHello("config")); err != nil {
-		return nil, fmt.Errorf("failed to send hello: %w", err)
+// haveBatchSize is the number of commit IDs sent in each have message
+const haveBatchSize = 64
+
+// sendHave asks the server which of the listed objects it already has
+func (c *Client) sendHave(have HaveMessage) (*AckMessage, error) {
+	if err := c.transport.Send(MsgHave, have); err != nil {
+		return nil, fmt.Errorf("failed to send have: %w", err)
+	}
+	msg, err := c.transport.Receive()
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive ack: %w", err)
+	}
+	if msg.Type == MsgError {
+		var errMsg ErrorMessage
+		msg.DecodePayload(&errMsg)
+		return nil, fmt.Errorf("server error: %s", errMsg.Message)
+	}
+	if msg.Type != MsgAck {
+		return nil, fmt.Errorf("expected ack message, got %s", msg.Type)
 	}
 
-	// Send get-config request
-	if err := c.transport.Send(MsgGetConfig, GetConfigMessage{}); err != nil {
-		return nil, fmt.Errorf("failed to send get-config: %w", err)
+	var ack AckMessage
+	if err := msg.DecodePayload(&ack); err != nil {
+		return nil, fmt.Errorf("failed to decode ack: %w", err)
 	}
+	return &ack, nil
+}
 
-	// Receive config
-	msg, err := c.transport.Receive()
+// findCommonCommits discovers which local commits reachable from tips the
+// server already has. It walks back from the tips, asking about one batch of
+// commits at a time. A commit the server acknowledges, or one in known, ends
+// the walk along that path since the server has its ancestors too.
+func (c *Client) findCommonCommits(repo *storage.Repository, tips []string, known map[string]bool) (map[string]bool, error) {
+	common := make(map[string]bool, len(known))
+	for id := range known {
+		common[id] = true
+	}
+
+	queued := make(map[string]bool)
+	var queue []string
+	enqueue := func(id string) {
+		if id != "" && !common[id] && !queued[id] {
+			queued[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for _, tip := range tips {
+		enqueue(tip)
+	}
+
+	for len(queue) > 0 {
+		batch := queue[:min(len(queue), haveBatchSize)]
+		queue = queue[len(batch):]
+
+		ack, err := c.sendHave(HaveMessage{CommitIDs: batch})
+		if err != nil {
+			return nil, err
+		}
+		acked := make(map[string]bool, len(ack.CommitIDs))
+		for _, id := range ack.CommitIDs {
+			acked[id] = true
+		}
+
+		for _, id := range batch {
+			if acked[id] {
+				common[id] = true
+				continue
+			}
+			commit, err := repo.LoadCommit(id)
+			if err != nil {
+				continue // Not walkable locally; the server will send it if needed
+			}
+			enqueue(commit.ParentCommitID)
+			enqueue(commit.SecondParentID)
+		}
+	}
+
+	return common, nil
+}
+
+// filterThreadVersions drops the thread versions the server already has.
+// Refs without a content hash are always kept.
+func (c *Client) filterThreadVersions(refs []model.ThreadRef) ([]model.ThreadRef, error) {
+	var versions []ThreadVersionRef
+	for _, ref := range refs {
+		if ref.ContentHash != "" {
+			versions = append(versions, ThreadVersionRef{ThreadID: ref.ThreadID, ContentHash: ref.ContentHash})
+		}
+	}
+
+	present := make(map[ThreadVersionRef]bool)
+	for len(versions) > 0 {
+		batch := versions[:min(len(versions), maxHavesPerMessage)]
+		versions = versions[len(batch):]
+
+		ack, err := c.sendHave(HaveMessage{ThreadVersions: batch})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range ack.ThreadVersions {
+			present[v] = true
+		}
+	}
+
+	filtered := make([]model.ThreadRef, 0, len(refs))
+	for _, ref := range refs {
+		if ref.ContentHash != "" && present[ThreadVersionRef{ThreadID: ref.ThreadID, ContentHash: ref.ContentHash}] {
+			continue
+		}
+		filtered = append(filtered, ref)
+	}
+	return filtered, nil
+}
+
+// sendStreamedPack sends threads, then commits, one object message at a time
+func (c *Client) sendStreamedPack(repo *storage.Repository, commits []model.TinCommit, threads []model.ThreadRef) error {
+	compress := c.caps.Has(CapCompression)
+	progress := Progress{Phase: "sending", Total: len(commits) + len(threads)}
+
+	start := PackStartMessage{Commits: len(commits), Threads: len(threads)}
+	if err := c.transport.Send(MsgPackStart, start); err != nil {
+		return fmt.Errorf("failed to send pack: %w", err)
+	}
+
+	sendOne := func(kind string, v any) error {
+		obj, err := encodeObject(kind, v, compress)
+		if err != nil {
+			return err
+		}
+		if err := c.transport.Send(MsgObject, obj); err != nil {
+			return fmt.Errorf("failed to send pack: %w", err)
+		}
+		progress.Objects++
+		progress.Bytes += int64(len(obj.Object) + len(obj.Data))
+		c.reportProgress(progress)
+		return nil
+	}
+
+	for _, ref := range threads {
+		thread, err := loadPushThread(repo, ref)
+		if err != nil {
+			return err
+		}
+		if err := sendOne(ObjectThread, thread); err != nil {
+			return err
+		}
+	}
+	for i := range commits {
+		if err := sendOne(ObjectCommit, &commits[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := c.transport.Send(MsgPackEnd, PackEndMessage{Commits: len(commits), Threads: len(threads)}); err != nil {
+		return fmt.Errorf("failed to send pack: %w", err)
+	}
+	return nil
+}
+
+// loadPushThread loads the thread version a commit references,
+// falling back to the latest version if that snapshot is missing
+func loadPushThread(repo *storage.Repository, ref model.ThreadRef) (*model.Thread, error) {
+	var thread *model.Thread
+	var err error
+
+	// Try to load specific version first
+	if ref.ContentHash != "" {
+		thread, err = repo.LoadThreadVersion(ref.ThreadID, ref.ContentHash)
+	}
+	// Fall back to latest version
+	if thread == nil || err != nil {
+		thread, err = repo.LoadThread(ref.ThreadID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load thread %s: %w", ref.ThreadID, err)
+	}
+	return thread, nil
+}
+
+// GetConfig retrieves the remote repository's config
+func (c *Client) GetConfig() (*ConfigMessage, error) {
+	// Send hello and get-config request, then receive config
+	msg, err := c.handshake("config", func() error {
+		if err := c.transport.Send(MsgGetConfig, GetConfigMessage{}); err != nil {
+			return fmt.Errorf("failed to send get-config: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to receive config: %w", err)
 	}
@@ -219,18 +541,13 @@ func (c *Client) GetConfig() (*ConfigMessage, error) {
 
 // SetConfig updates the remote repository's config
 func (c *Client) SetConfig(config *SetConfigMessage) error {
-	// Send hello
-	if err := c.transport.Send(MsgHello, c.makeHello("config")); err != nil {
-		return fmt.Errorf("failed to send hello: %w", err)
-	}
-
-	// Send set-config request
-	if err := c.transport.Send(MsgSetConfig, config); err != nil {
-		return fmt.Errorf("failed to send set-config: %w", err)
-	}
-
-	// Receive response
-	msg, err := c.transport.Receive()
+	// Send hello and set-config request, then receive response
+	msg, err := c.handshake("config", func() error {
+		if err := c.transport.Send(MsgSetConfig, config); err != nil {
+			return fmt.Errorf("failed to send set-config: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to receive response: %w", err)
 	}
@@ -245,30 +562,123 @@ func (c *Client) SetConfig(config *SetConfigMessage) error {
 
 // Pull pulls commits and threads from the remote
 func (c *Client) Pull(repo *storage.Repository, branch string) (*RefsMessage, error) {
-	// Send hello
-	if err := c.transport.Send(MsgHello, c.makeHello("pull")); err != nil {
-		return nil, fmt.Errorf("failed to send hello: %w", err)
+	// Send hello and receive refs
+	remoteRefs, err := c.receiveRefs("pull")
+	if err != nil {
+		return nil, err
+	}
+
+	var want WantMessage
+	if c.caps.Has(CapHaveWant) {
+		want, err = c.negotiateWant(repo, remoteRefs)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		want = wantMissingObjects(repo, remoteRefs)
+	}
+
+	// Send want
+	if err := c.transport.Send(MsgWant, want); err != nil {
+		return nil, fmt.Errorf("failed to send want: %w", err)
 	}
 
-	// Receive refs
+	// Receive pack
 	msg, err := c.transport.Receive()
 	if err != nil {
-		return nil, fmt.Errorf("failed to receive refs: %w", err)
+		return nil, fmt.Errorf("failed to receive pack: %w", err)
 	}
 	if msg.Type == MsgError {
 		var errMsg ErrorMessage
 		msg.DecodePayload(&errMsg)
 		return nil, fmt.Errorf("server error: %s", errMsg.Message)
 	}
-	if msg.Type != MsgRefs {
-		return nil, fmt.Errorf("expected refs message, got %s", msg.Type)
+
+	switch msg.Type {
+	case MsgPack:
+		var pack PackMessage
+		if err := msg.DecodePayload(&pack); err != nil {
+			return nil, fmt.Errorf("failed to decode pack: %w", err)
+		}
+
+		// Save received objects
+		for _, thread := range pack.Threads {
+			t := thread
+			if err := repo.SaveThread(&t); err != nil {
+				return nil, fmt.Errorf("failed to save thread: %w", err)
+			}
+		}
+		for _, commit := range pack.Commits {
+			co := commit
+			if err := repo.SaveCommit(&co); err != nil {
+				return nil, fmt.Errorf("failed to save commit: %w", err)
+			}
+		}
+	case MsgPackStart:
+		if err := c.receiveStreamedPack(repo, msg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("expected pack message, got %s", msg.Type)
 	}
 
-	var remoteRefs RefsMessage
-	if err := msg.DecodePayload(&remoteRefs); err != nil {
-		return nil, fmt.Errorf("failed to decode refs: %w", err)
+	// Send OK
+	c.transport.Send(MsgOK, OKMessage{Message: "received"})
+
+	// Update local branch if specified
+	if branch != "" {
+		if remoteCommitID, ok := remoteRefs.Branches[branch]; ok {
+			if err := repo.WriteBranch(branch, remoteCommitID); err != nil {
+				return nil, fmt.Errorf("failed to update branch: %w", err)
+			}
+		}
+	}
+
+	return remoteRefs, nil
+}
+
+// negotiateWant asks for the remote branch tips we are missing, telling the
+// server which of our commits it already has so only new history is sent
+func (c *Client) negotiateWant(repo *storage.Repository, remoteRefs *RefsMessage) (WantMessage, error) {
+	var want WantMessage
+
+	names := make([]string, 0, len(remoteRefs.Branches))
+	for name := range remoteRefs.Branches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		id := remoteRefs.Branches[name]
+		if !repo.HasCommit(id) && !slices.Contains(want.Wants, id) {
+			want.Wants = append(want.Wants, id)
+		}
+	}
+	if len(want.Wants) == 0 {
+		return want, nil
+	}
+
+	var localTips []string
+	branches, _ := repo.ListBranches()
+	for _, branch := range branches {
+		if id, err := repo.ReadBranch(branch); err == nil && id != "" {
+			localTips = append(localTips, id)
+		}
+	}
+
+	common, err := c.findCommonCommits(repo, localTips, nil)
+	if err != nil {
+		return want, err
 	}
+	for id := range common {
+		want.Haves = append(want.Haves, id)
+	}
+	sort.Strings(want.Haves)
+	return want, nil
+}
 
+// wantMissingObjects compares a full refs advertisement with the local
+// repository and requests every object we don't have
+func wantMissingObjects(repo *storage.Repository, remoteRefs *RefsMessage) WantMessage {
 	// Build set of local objects
 	localCommits := make(map[string]bool)
 	commits, _ := repo.ListCommits()
@@ -310,60 +720,48 @@ func (c *Client) Pull(repo *storage.Repository, branch string) (*RefsMessage, er
 		}
 	}
 
-	// Send want
-	want := WantMessage{
+	return WantMessage{
 		CommitIDs:      wantCommits,
 		ThreadIDs:      wantThreads,
 		ThreadVersions: wantThreadVersions,
 	}
-	if err := c.transport.Send(MsgWant, want); err != nil {
-		return nil, fmt.Errorf("failed to send want: %w", err)
-	}
-
-	// Receive pack
-	msg, err = c.transport.Receive()
-	if err != nil {
-		return nil, fmt.Errorf("failed to receive pack: %w", err)
-	}
-	if msg.Type == MsgError {
-		var errMsg ErrorMessage
-		msg.DecodePayload(&errMsg)
-		return nil, fmt.Errorf("server error: %s", errMsg.Message)
-	}
-	if msg.Type != MsgPack {
-		return nil, fmt.Errorf("expected pack message, got %s", msg.Type)
-	}
+}
 
-	var pack PackMessage
-	if err := msg.DecodePayload(&pack); err != nil {
-		return nil, fmt.Errorf("failed to decode pack: %w", err)
+// receiveStreamedPack saves objects as they arrive until pack-end
+func (c *Client) receiveStreamedPack(repo *storage.Repository, start *Message) error {
+	var header PackStartMessage
+	if err := start.DecodePayload(&header); err != nil {
+		return fmt.Errorf("failed to decode pack: %w", err)
 	}
+	progress := Progress{Phase: "receiving", Total: header.Commits + header.Threads}
 
-	// Save received objects
-	for _, thread := range pack.Threads {
-		t := thread
-		if err := repo.SaveThread(&t); err != nil {
-			return nil, fmt.Errorf("failed to save thread: %w", err)
-		}
-	}
-	for _, commit := range pack.Commits {
-		co := commit
-		if err := repo.SaveCommit(&co); err != nil {
-			return nil, fmt.Errorf("failed to save commit: %w", err)
+	var stats packStats
+	for {
+		msg, err := c.transport.Receive()
+		if err != nil {
+			return fmt.Errorf("failed to receive pack: %w", err)
 		}
-	}
-
-	// Send OK
-	c.transport.Send(MsgOK, OKMessage{Message: "received"})
 
-	// Update local branch if specified
-	if branch != "" {
-		if remoteCommitID, ok := remoteRefs.Branches[branch]; ok {
-			if err := repo.WriteBranch(branch, remoteCommitID); err != nil {
-				return nil, fmt.Errorf("failed to update branch: %w", err)
+		switch msg.Type {
+		case MsgObject:
+			var obj ObjectMessage
+			if err := msg.DecodePayload(&obj); err != nil {
+				return fmt.Errorf("failed to decode pack: %w", err)
 			}
+			if err := saveObject(repo, &obj, &stats, nil); err != nil {
+				return err
+			}
+			progress.Objects++
+			progress.Bytes += int64(len(obj.Object) + len(obj.Data))
+			c.reportProgress(progress)
+		case MsgPackEnd:
+			return nil
+		case MsgError:
+			var errMsg ErrorMessage
+			msg.DecodePayload(&errMsg)
+			return fmt.Errorf("server error: %s", errMsg.Message)
+		default:
+			return fmt.Errorf("unexpected %s message in pack", msg.Type)
 		}
 	}
-
-	return &remoteRefs, nil
 }
@@ -14,7 +14,7 @@ type RemoteConfig struct {
 
 // ParsedURL represents a parsed remote URL
 type ParsedURL struct {
-	Scheme string // "https", "tin", or "" (defaults to tcp)
+	Scheme string // "https", "http", "tin", "tin+tls", or "" (defaults to tcp)
 	Host   string
 	Port   string
 	Path   string
@@ -30,6 +30,11 @@ func (p *ParsedURL) TransportType() string {
 	}
 }
 
+// UseTLS reports whether the TCP transport should connect over TLS
+func (p *ParsedURL) UseTLS() bool {
+	return p.Scheme == "tin+tls"
+}
+
 // ParseURL parses a remote URL in the format host:port/path or host/path
 // Examples:
 //   - localhost:2323/tmp/myproject.tin
@@ -38,6 +43,7 @@ func (p *ParsedURL) TransportType() string {
 //   - https://tinhub.dev/user/repo
 //   - http://localhost:3000/user/repo
 //   - tin://example.com:2323/repos/project.tin
+//   - tin+tls://example.com:2323/repos/project.tin
 func ParseURL(rawURL string) (*ParsedURL, error) {
 	// Handle HTTPS URLs
 	if strings.HasPrefix(rawURL, "https://") {
@@ -75,8 +81,8 @@ func ParseURL(rawURL string) (*ParsedURL, error) {
 		}, nil
 	}
 
-	// Handle tin:// URLs
-	if strings.HasPrefix(rawURL, "tin://") {
+	// Handle tin:// and tin+tls:// URLs
+	if strings.HasPrefix(rawURL, "tin://") || strings.HasPrefix(rawURL, "tin+tls://") {
 		u, err := url.Parse(rawURL)
 		if err != nil {
 			return nil, fmt.Errorf("invalid URL: %w", err)
@@ -86,7 +92,7 @@ func ParseURL(rawURL string) (*ParsedURL, error) {
 			port = "2323"
 		}
 		return &ParsedURL{
-			Scheme: "tin",
+			Scheme: u.Scheme,
 			Host:   u.Hostname(),
 			Port:   port,
 			Path:   u.Path,
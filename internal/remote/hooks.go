@@ -0,0 +1,330 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Server-side hooks are executables in the hooks directory of a bare
+// repository, named like git's:
+//
+//   - pre-receive runs once before any branch is updated and can reject the
+//     whole push by exiting non-zero
+//   - update runs once per branch with "<branch> <old> <new>" as arguments
+//     and can reject that branch
+//   - post-receive runs in the background after the branches are written;
+//     its exit status is ignored
+//
+// Each hook receives a HookInput as JSON on standard input. Until pre-receive
+// accepts a push its objects are kept in a quarantine directory, named by
+// TIN_QUARANTINE_PATH, rather than in the repository.
+const (
+	HooksDir = "hooks"
+
+	HookPreReceive  = "pre-receive"
+	HookUpdate      = "update"
+	HookPostReceive = "post-receive"
+)
+
+// hookTimeout bounds how long a single hook may run
+var hookTimeout = 5 * time.Minute
+
+// maxHookOutput bounds the hook output returned to the client
+const maxHookOutput = 4096
+
+// HookInput is written as JSON to the standard input of server hooks
+type HookInput struct {
+	User    string      `json:"user,omitempty"`
+	Updates []RefUpdate `json:"updates"`
+	Pack    PackSummary `json:"pack"`
+}
+
+// RefUpdate is a proposed (or, for post-receive, applied) branch update.
+// Old is empty for a new branch; Force is set for non-fast-forward updates.
+type RefUpdate struct {
+	Branch string `json:"branch"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new"`
+	Force  bool   `json:"force,omitempty"`
+}
+
+// PackSummary describes the objects a push introduces: the commits each
+// update adds to its branch (old..new; for a new branch, the commits not on
+// the repository's default branch), parents first, and the thread versions
+// they reference
+type PackSummary struct {
+	Commits []model.TinCommit `json:"commits"`
+	Threads []ThreadSummary   `json:"threads"`
+}
+
+// ThreadSummary describes a thread version by its first human prompt
+// instead of its full messages
+type ThreadSummary struct {
+	ID             string `json:"id"`
+	Agent          string `json:"agent"`
+	AgentSessionID string `json:"agent_session_id,omitempty"`
+	ParentThreadID string `json:"parent_thread_id,omitempty"`
+	MessageCount   int    `json:"message_count"`
+	ContentHash    string `json:"content_hash,omitempty"`
+	FirstPrompt    string `json:"first_prompt,omitempty"`
+}
+
+// maxSummaryPrompt bounds the length of ThreadSummary.FirstPrompt in bytes
+const maxSummaryPrompt = 1000
+
+// pushHooks runs the hooks of one repository for one push. The hook input is
+// only computed if a hook (or webhook) needs it.
+type pushHooks struct {
+	repo    *storage.Repository
+	user    string
+	commits map[string][]*model.TinCommit // commits each update adds, by branch
+	input   *HookInput
+}
+
+func newPushHooks(repo *storage.Repository, user string) *pushHooks {
+	return &pushHooks{repo: repo, user: user}
+}
+
+// path returns the executable for the named hook, or "" if there is none
+func (h *pushHooks) path(name string) string {
+	path := filepath.Join(h.repo.RootPath, HooksDir, name)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return ""
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		log.Printf("hook %s is not executable, ignoring", path)
+		return ""
+	}
+	return path
+}
+
+// preReceive runs the pre-receive hook for the proposed updates
+func (h *pushHooks) preReceive(updates []RefUpdate) *ErrorMessage {
+	path := h.path(HookPreReceive)
+	if path == "" {
+		return nil
+	}
+	input, err := h.hookInput(updates)
+	if err != nil {
+		return &ErrorMessage{Code: ErrCodeInternal, Message: "failed to prepare pre-receive hook: " + err.Error()}
+	}
+	return h.run(HookPreReceive, path, input, nil)
+}
+
+// update runs the update hook for one branch
+func (h *pushHooks) update(update RefUpdate, all []RefUpdate) *ErrorMessage {
+	path := h.path(HookUpdate)
+	if path == "" {
+		return nil
+	}
+	input, err := h.hookInput(all)
+	if err != nil {
+		return &ErrorMessage{Code: ErrCodeInternal, Message: "failed to prepare update hook: " + err.Error()}
+	}
+	one := *input
+	one.Updates = []RefUpdate{update}
+	return h.run(HookUpdate, path, &one, []string{update.Branch, update.Old, update.New})
+}
+
+// postReceive starts the post-receive hook for the applied updates in the
+// background, so a slow hook never holds up the push. Failures are logged;
+// the branches have already been written.
+func (h *pushHooks) postReceive(applied []RefUpdate) {
+	path := h.path(HookPostReceive)
+	if path == "" || len(applied) == 0 {
+		return
+	}
+	pack, err := h.summarize(applied)
+	if err != nil {
+		log.Printf("failed to prepare post-receive hook: %v", err)
+		return
+	}
+	input := &HookInput{User: h.user, Updates: applied, Pack: pack}
+	go func() {
+		if errMsg := h.run(HookPostReceive, path, input, nil); errMsg != nil {
+			log.Printf("%s", errMsg.Message)
+		}
+	}()
+}
+
+// prepare records the commits each update adds to its branch: those
+// reachable from the new tip but not the old one. A new branch is compared
+// with the repository's default branch instead. It must be called before any
+// branch is updated if a hook or webhook will run.
+func (h *pushHooks) prepare(updates []RefUpdate) error {
+	if h.commits != nil {
+		return nil
+	}
+
+	defaultTip := ""
+	if head, err := h.repo.ReadHead(); err == nil {
+		defaultTip, _ = h.repo.ReadBranch(head)
+	}
+
+	h.commits = make(map[string][]*model.TinCommit, len(updates))
+	for _, u := range updates {
+		base := u.Old
+		if base == "" {
+			base = defaultTip
+		}
+		stop := make(map[string]bool)
+		for id := range h.repo.ReachableCommits(base) {
+			stop[id] = true
+		}
+		commits, err := collectMissingCommits(h.repo, []string{u.New}, stop)
+		if err != nil {
+			h.commits = nil
+			return err
+		}
+		h.commits[u.Branch] = commits
+	}
+	return nil
+}
+
+// hasHooks reports whether the repository has any push hook installed
+func (h *pushHooks) hasHooks() bool {
+	return h.path(HookPreReceive) != "" || h.path(HookUpdate) != "" || h.path(HookPostReceive) != ""
+}
+
+// hookInput builds the hook input once per push
+func (h *pushHooks) hookInput(updates []RefUpdate) (*HookInput, error) {
+	if h.input != nil {
+		return h.input, nil
+	}
+	pack, err := h.summarize(updates)
+	if err != nil {
+		return nil, err
+	}
+	h.input = &HookInput{User: h.user, Updates: updates, Pack: pack}
+	return h.input, nil
+}
+
+// summarize describes the commits the updates add to their branches and the
+// thread versions they reference
+func (h *pushHooks) summarize(updates []RefUpdate) (PackSummary, error) {
+	if err := h.prepare(updates); err != nil {
+		return PackSummary{}, err
+	}
+
+	var commits []*model.TinCommit
+	added := make(map[string]bool)
+	for _, u := range updates {
+		for _, c := range h.commits[u.Branch] {
+			if !added[c.ID] {
+				added[c.ID] = true
+				commits = append(commits, c)
+			}
+		}
+	}
+
+	pack := PackSummary{Commits: []model.TinCommit{}, Threads: []ThreadSummary{}}
+	seen := make(map[string]bool)
+	for _, c := range commits {
+		pack.Commits = append(pack.Commits, *c)
+		for _, ref := range c.Threads {
+			key := ref.ThreadID + "@" + ref.ContentHash
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			pack.Threads = append(pack.Threads, h.summarizeThread(ref))
+		}
+	}
+	return pack, nil
+}
+
+// summarizeThread describes the thread version a commit references, falling
+// back to the reference itself if the thread can't be loaded
+func (h *pushHooks) summarizeThread(ref model.ThreadRef) ThreadSummary {
+	summary := ThreadSummary{ID: ref.ThreadID, MessageCount: ref.MessageCount, ContentHash: ref.ContentHash}
+
+	var thread *model.Thread
+	var err error
+	if ref.ContentHash != "" {
+		thread, err = h.repo.LoadThreadVersion(ref.ThreadID, ref.ContentHash)
+	} else {
+		thread, err = h.repo.LoadThread(ref.ThreadID)
+	}
+	if err != nil {
+		return summary
+	}
+	summary.Agent = thread.Agent
+	summary.AgentSessionID = thread.AgentSessionID
+	summary.ParentThreadID = thread.ParentThreadID
+	if first := thread.FirstHumanMessage(); first != nil {
+		summary.FirstPrompt = truncateUTF8(first.Content, maxSummaryPrompt)
+	}
+	return summary
+}
+
+// run executes a hook in the repository directory. A non-zero exit rejects
+// the push with the hook's output as the reason.
+func (h *pushHooks) run(name, path string, input *HookInput, args []string) *ErrorMessage {
+	stdin, err := json.Marshal(input)
+	if err != nil {
+		return &ErrorMessage{Code: ErrCodeInternal, Message: "failed to encode hook input: " + err.Error()}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Dir = h.repo.RootPath
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.Env = append(os.Environ(),
+		"TIN_HOOK="+name,
+		"TIN_REPO="+h.repo.RootPath,
+		"TIN_USER="+h.user,
+	)
+	if quarantine := h.repo.QuarantinePath(); quarantine != "" {
+		cmd.Env = append(cmd.Env, "TIN_QUARANTINE_PATH="+quarantine)
+	}
+
+	if err := cmd.Run(); err != nil {
+		reason := strings.TrimSpace(output.String())
+		if len(reason) > maxHookOutput {
+			reason = reason[:maxHookOutput] + "..."
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			reason = "timed out"
+		} else if reason == "" {
+			reason = err.Error()
+		}
+		return &ErrorMessage{
+			Code:    ErrCodeHookRejected,
+			Message: fmt.Sprintf("%s hook rejected the push: %s", name, reason),
+		}
+	}
+
+	if out := strings.TrimSpace(output.String()); out != "" {
+		log.Printf("%s hook: %s", name, out)
+	}
+	return nil
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
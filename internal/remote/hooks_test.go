@@ -0,0 +1,187 @@
+package remote
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// installHook writes an executable shell script into the repository's hooks directory
+func installHook(t *testing.T, repo *storage.Repository, name, script string) {
+	t.Helper()
+	dir := filepath.Join(repo.RootPath, HooksDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func readHookInput(t *testing.T, path string) *HookInput {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("hook input not recorded: %v", err)
+	}
+	var input HookInput
+	if err := json.Unmarshal(data, &input); err != nil {
+		t.Fatalf("invalid hook input: %v", err)
+	}
+	return &input
+}
+
+// waitForHookInput polls for the input a hook recorded for the given update
+func waitForHookInput(t *testing.T, path string, update RefUpdate) *HookInput {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			if input := readHookInput(t, path); len(input.Updates) == 1 && input.Updates[0] == update {
+				return input
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("hook never ran for %+v", update)
+	return nil
+}
+
+func TestProtocol_ServerHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	defer func(timeout time.Duration) { hookTimeout = timeout }(hookTimeout)
+	hookTimeout = 5 * time.Second
+
+	servers := []struct {
+		name  string
+		start func(t *testing.T) (string, string)
+	}{
+		{"tcp", func(t *testing.T) (string, string) {
+			root, addr := startTCPServer(t, func(s *Server) { s.SetAuthValidator(testAuthValidator()) })
+			return root, "tin://" + addr
+		}},
+		{"http", func(t *testing.T) (string, string) {
+			return startHTTPServer(t, func(h *HTTPHandler) { h.authValidator = testAuthValidator() })
+		}},
+	}
+
+	for _, srv := range servers {
+		t.Run(srv.name, func(t *testing.T) {
+			root, base := srv.start(t)
+			bare, err := storage.InitBare(filepath.Join(root, "proj.tin"))
+			if err != nil {
+				t.Fatalf("InitBare failed: %v", err)
+			}
+			installHook(t, bare, HookPreReceive, `cat > "$TIN_REPO/pre-receive.json"
+if grep -q '"message":"wip' "$TIN_REPO/pre-receive.json"; then
+  echo "wip commits are not allowed" >&2
+  exit 1
+fi
+`)
+			installHook(t, bare, HookUpdate, `if [ "$1" = frozen ]; then echo "$1 is frozen"; exit 1; fi
+`)
+			// post-receive waits for the test to release it
+			installHook(t, bare, HookPostReceive, `while [ ! -e "$TIN_REPO/release" ]; do sleep 0.02; done
+cat > "$TIN_REPO/post-receive.tmp" && mv "$TIN_REPO/post-receive.tmp" "$TIN_REPO/post-receive.json"
+`)
+			url := base + "/proj.tin"
+			received := filepath.Join(bare.RootPath, "post-receive.json")
+			release := filepath.Join(bare.RootPath, "release")
+			os.WriteFile(release, nil, 0644)
+
+			local := newTestRepo(t)
+			first := addTestCommit(t, local, "main", "first")
+			if err := dialTest(t, url, nil).Push(local, "main", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			waitForHookInput(t, received, RefUpdate{Branch: "main", New: first.ID})
+
+			// The push doesn't wait for post-receive
+			os.Remove(release)
+			second := addTestCommit(t, local, "main", "second")
+			if err := dialTest(t, url, nil).Push(local, "main", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			if input := readHookInput(t, received); input.Updates[0].New != first.ID {
+				t.Error("post-receive finished before it was released")
+			}
+			os.WriteFile(release, nil, 0644)
+
+			// Hooks see the updates, the pushing user and only the new objects
+			input := waitForHookInput(t, received, RefUpdate{Branch: "main", Old: first.ID, New: second.ID})
+			if input.User != "alice" {
+				t.Errorf("hook user = %q, want alice", input.User)
+			}
+			if len(input.Pack.Commits) != 1 || input.Pack.Commits[0].ID != second.ID {
+				t.Errorf("expected only the new commit in the summary, got %+v", input.Pack.Commits)
+			}
+			if len(input.Pack.Threads) != 1 || input.Pack.Threads[0].Agent != "claude-code" || input.Pack.Threads[0].MessageCount != 2 {
+				t.Errorf("unexpected thread summary: %+v", input.Pack.Threads)
+			}
+
+			// A new branch is summarized against the default branch
+			local.WriteBranch("topic", second.ID)
+			third := addTestCommit(t, local, "topic", "third")
+			if err := dialTest(t, url, nil).Push(local, "topic", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			input = waitForHookInput(t, received, RefUpdate{Branch: "topic", New: third.ID})
+			if len(input.Pack.Commits) != 1 || input.Pack.Commits[0].ID != third.ID {
+				t.Errorf("expected only the topic commit in the summary, got %+v", input.Pack.Commits)
+			}
+
+			// An update is summarized by what it adds to the branch (old..new),
+			// even if another branch already had those commits
+			local.WriteBranch("main", third.ID)
+			if err := dialTest(t, url, nil).Push(local, "main", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			input = waitForHookInput(t, received, RefUpdate{Branch: "main", Old: second.ID, New: third.ID})
+			if len(input.Pack.Commits) != 1 || input.Pack.Commits[0].ID != third.ID {
+				t.Errorf("expected old..new in the summary, got %+v", input.Pack.Commits)
+			}
+
+			// pre-receive rejects the whole push, and its objects are discarded
+			wip := addTestCommit(t, local, "main", "wip: half done")
+			err = dialTest(t, url, nil).Push(local, "main", false)
+			if err == nil || !strings.Contains(err.Error(), "wip commits are not allowed") {
+				t.Errorf("expected pre-receive to reject the push, got %v", err)
+			}
+			if got, _ := bare.ReadBranch("main"); got != third.ID {
+				t.Errorf("main = %s after rejected push, want %s", got, third.ID)
+			}
+			if bare.HasCommit(wip.ID) || bare.HasThreadVersion(wip.Threads[0].ThreadID, wip.Threads[0].ContentHash) {
+				t.Error("objects of the rejected push were stored")
+			}
+
+			// update rejects a single branch
+			local.WriteBranch("frozen", first.ID)
+			err = dialTest(t, url, nil).Push(local, "frozen", false)
+			if err == nil || !strings.Contains(err.Error(), "frozen is frozen") {
+				t.Errorf("expected update hook to reject the branch, got %v", err)
+			}
+			if got, _ := bare.ReadBranch("frozen"); got != "" {
+				t.Errorf("frozen = %s after rejected push, want unset", got)
+			}
+		})
+	}
+}
+
+func TestPushHooks_IgnoresNonExecutable(t *testing.T) {
+	repo := newTestRepo(t)
+	installHook(t, repo, HookPreReceive, "exit 1\n")
+	os.Chmod(filepath.Join(repo.RootPath, HooksDir, HookPreReceive), 0644)
+
+	tip := addTestCommit(t, repo, "main", "first")
+	if errMsg := newPushHooks(repo, "").preReceive([]RefUpdate{{Branch: "main", New: tip.ID}}); errMsg != nil {
+		t.Errorf("non-executable hook ran: %v", errMsg.Message)
+	}
+}
@@ -2,16 +2,20 @@ package remote
 
 import (
 	"bufio"
-	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/sestinj/tin/internal/model"
 	"github.com/sestinj/tin/internal/storage"
 )
 
@@ -21,17 +25,39 @@ type AuthValidator interface {
 	Validate(username, password string) (userID string, valid bool)
 }
 
-// AllowAllAuthValidator allows any credentials (for testing/development)
+// AllowAllAuthValidator allows any credentials (for testing/development).
+// Nothing verifies the username, so every client is the anonymous user "".
 type AllowAllAuthValidator struct{}
 
 func (v *AllowAllAuthValidator) Validate(username, password string) (string, bool) {
-	return username, true
+	return "", true
 }
 
-// TokenAuthValidator validates against a preset list of username/password pairs
+// ScopedAuthValidator is an AuthValidator whose credentials can be limited to
+// a permission scope, such as API tokens issued with `tin server token create`
+type ScopedAuthValidator interface {
+	AuthValidator
+	// ValidateScoped is like Validate but also returns the highest permission
+	// the credentials may exercise, regardless of what the ACL grants
+	ValidateScoped(username, password string) (userID string, scope Permission, valid bool)
+}
+
+// ValidateCredentials checks credentials and returns the user and their scope.
+// Validators that do not support scopes grant full (admin) scope.
+func ValidateCredentials(validator AuthValidator, username, password string) (string, Permission, bool) {
+	if scoped, ok := validator.(ScopedAuthValidator); ok {
+		return scoped.ValidateScoped(username, password)
+	}
+	userID, valid := validator.Validate(username, password)
+	return userID, PermAdmin, valid
+}
+
+// TokenAuthValidator validates against a preset list of username/password
+// pairs and, if configured, API tokens from a TokenStore
 type TokenAuthValidator struct {
 	// credentials maps username to password
 	credentials map[string]string
+	tokens      *TokenStore
 }
 
 // NewTokenAuthValidator creates a validator with the given username/password pairs
@@ -41,18 +67,45 @@ func NewTokenAuthValidator(creds map[string]string) *TokenAuthValidator {
 	}
 }
 
+// SetTokenStore makes the validator accept API tokens from the store.
+// Tokens are passed as the password; the username is ignored.
+func (v *TokenAuthValidator) SetTokenStore(tokens *TokenStore) {
+	v.tokens = tokens
+}
+
+// TokenChecker is implemented by validators that accept API tokens, to
+// check that a token accepted earlier has not since been revoked or expired
+type TokenChecker interface {
+	TokenActive(id string) bool
+}
+
+// TokenActive reports whether the token with the given ID can still be used
+func (v *TokenAuthValidator) TokenActive(id string) bool {
+	return v.tokens != nil && v.tokens.Active(id)
+}
+
 func (v *TokenAuthValidator) Validate(username, password string) (string, bool) {
+	userID, _, valid := v.ValidateScoped(username, password)
+	return userID, valid
+}
+
+func (v *TokenAuthValidator) ValidateScoped(username, password string) (string, Permission, bool) {
+	if v.tokens != nil && strings.HasPrefix(password, TokenPrefix) {
+		if userID, scope, ok := v.tokens.Authenticate(password); ok {
+			return userID, scope, true
+		}
+	}
 	if v.credentials == nil {
-		return "", false
+		return "", PermNone, false
 	}
 	expectedPassword, exists := v.credentials[username]
 	if !exists {
-		return "", false
+		return "", PermNone, false
 	}
-	if expectedPassword != password {
-		return "", false
+	if subtle.ConstantTimeCompare([]byte(expectedPassword), []byte(password)) != 1 {
+		return "", PermNone, false
 	}
-	return username, true
+	return username, PermAdmin, true
 }
 
 // HTTPHandler handles HTTP requests for the TIN protocol
@@ -60,6 +113,10 @@ type HTTPHandler struct {
 	rootPath      string
 	autoCreate    bool
 	authValidator AuthValidator
+	version       int      // highest protocol version offered to clients
+	capabilities  []string // capabilities offered to clients
+	acl           *ACL
+	certs         CertValidator // maps verified client certificates to users
 }
 
 // NewHTTPHandler creates a new HTTP handler
@@ -71,9 +128,36 @@ func NewHTTPHandler(rootPath string, autoCreate bool, authValidator AuthValidato
 		rootPath:      rootPath,
 		autoCreate:    autoCreate,
 		authValidator: authValidator,
+		version:       ProtocolVersion,
+		capabilities:  SupportedCapabilities(),
 	}
 }
 
+// SetCapabilities restricts the capabilities the handler offers to clients
+func (h *HTTPHandler) SetCapabilities(caps []string) {
+	h.capabilities = caps
+}
+
+// SetACL restricts which users may read, write and create repositories
+func (h *HTTPHandler) SetACL(acl *ACL) {
+	h.acl = acl
+}
+
+// SetCertValidator identifies clients presenting a verified TLS client
+// certificate by that certificate instead of Basic Auth
+func (h *HTTPHandler) SetCertValidator(certs CertValidator) {
+	h.certs = certs
+}
+
+// IsProtocolRequest reports whether r is a push, pull or config request for
+// an HTTPHandler, so other handlers can share its listener
+func IsProtocolRequest(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	return strings.HasPrefix(path.Base(r.URL.Path), "tin-")
+}
+
 // ServeHTTP implements http.Handler
 func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -81,18 +165,23 @@ func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract Basic Auth credentials
-	username, password, hasAuth := r.BasicAuth()
-	if !hasAuth {
-		w.Header().Set("WWW-Authenticate", `Basic realm="tin"`)
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
-		return
-	}
-
-	userID, valid := h.authValidator.Validate(username, password)
+	// A verified client certificate identifies the user; otherwise
+	// extract Basic Auth credentials
+	userID, valid := CertUser(h.certs, r.TLS)
+	scope := PermAdmin
 	if !valid {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
+		username, password, hasAuth := r.BasicAuth()
+		if !hasAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="tin"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		userID, scope, valid = ValidateCredentials(h.authValidator, username, password)
+		if !valid {
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
 	}
 
 	// Parse path to get repo path and operation
@@ -120,7 +209,24 @@ func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("[HTTP %s] repo: %s, operation: %s", userID, repoPath, operation)
+	// HTTP has no hello message; version and capabilities travel in headers.
+	// Clients that predate negotiation send neither and are treated as v1.
+	clientVersion := 1
+	if v := r.Header.Get(HeaderProtocolVersion); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid protocol version", http.StatusBadRequest)
+			return
+		}
+		clientVersion = parsed
+	}
+	sess, err := negotiateSession(clientVersion, ParseCapabilities(r.Header.Get(HeaderCapabilities)), h.version, h.capabilities)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[HTTP %s] repo: %s, operation: %s, protocol: v%d", userID, repoPath, operation, sess.version)
 
 	// Resolve repository path
 	fullRepoPath, err := h.resolveRepoPath(repoPath)
@@ -129,10 +235,24 @@ func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check access
+	sess.repo = repoKey(repoPath)
+	sess.user = userID
+	sess.perm = min(h.acl.Permission(userID, repoPath), scope)
+	sess.protected = h.acl.ProtectedBranchPatterns(repoPath)
+	if errMsg := checkPermission(sess, operation); errMsg != nil {
+		http.Error(w, errMsg.Message, http.StatusForbidden)
+		return
+	}
+
 	// Open or create repository
 	repo, err := storage.OpenBare(fullRepoPath)
 	if err != nil {
 		if h.autoCreate && operation == "push" {
+			if sess.perm < PermAdmin {
+				http.Error(w, "creating repositories requires admin permission", http.StatusForbidden)
+				return
+			}
 			log.Printf("[HTTP %s] creating new repository: %s", userID, fullRepoPath)
 			repo, err = storage.InitBare(fullRepoPath)
 			if err != nil {
@@ -148,25 +268,20 @@ func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Set response content type
 	w.Header().Set("Content-Type", ContentTypeTinProtocol)
 
-	// Create a buffer for the response
-	var respBuf bytes.Buffer
-
-	// Create protocol connection adapters using the helper
+	// Stream the request and response bodies so memory use stays bounded
+	// regardless of pack size
 	reqPC := NewProtocolConnFromHTTP(r.Body, io.Discard)
-	respPC := NewProtocolConnFromHTTP(strings.NewReader(""), &respBuf)
+	respPC := NewProtocolConnFromHTTP(strings.NewReader(""), w)
 
 	// Handle the operation
 	switch operation {
 	case "push":
-		h.handlePush(reqPC, respPC, repo, userID)
+		h.handlePush(reqPC, respPC, repo, userID, sess, r.Header.Get(HeaderPushID))
 	case "pull":
-		h.handlePull(reqPC, respPC, repo, userID)
+		h.handlePull(reqPC, respPC, repo, userID, sess)
 	case "config":
-		h.handleConfig(reqPC, respPC, repo, userID)
+		h.handleConfig(reqPC, respPC, repo, userID, sess)
 	}
-
-	// Write response
-	w.Write(respBuf.Bytes())
 }
 
 // resolveRepoPath resolves the repository path (same logic as TCP server)
@@ -197,55 +312,86 @@ func (h *HTTPHandler) resolveRepoPath(clientPath string) (string, error) {
 	return fullPath, nil
 }
 
-func (h *HTTPHandler) handlePush(reqPC, respPC *ProtocolConn, repo *storage.Repository, userID string) {
+func (h *HTTPHandler) handlePush(reqPC, respPC *ProtocolConn, repo *storage.Repository, userID string, sess *session, pushID string) {
 	// HTTP push has two phases:
 	// Phase 1 (refs negotiation): empty request → server sends refs
 	// Phase 2 (actual push): Pack + UpdateRefs → server sends OK
+	// With stream-pack, a large pack may be split across several phase 2
+	// requests; only the last carries pack-end and UpdateRefs
 
 	// Try to receive first message
 	msg, err := reqPC.Receive()
 	if err != nil {
 		// Empty request body = refs negotiation phase
 		// Send refs so client knows what we have
-		refs, err := buildRefsMessage(repo)
-		if err != nil {
-			respPC.SendError(ErrCodeInternal, "failed to build refs: "+err.Error())
-			return
-		}
-		if err := respPC.Send(MsgRefs, refs); err != nil {
-			log.Printf("[HTTP %s] failed to send refs: %v", userID, err)
-		}
-		log.Printf("[HTTP %s] sent refs (negotiation phase)", userID)
+		h.sendRefs(respPC, repo, userID, sess)
 		return
 	}
 
-	if msg.Type != MsgPack {
-		respPC.SendError(ErrCodeInvalidRequest, "expected pack message")
+	if msg.Type == MsgHave {
+		// Have negotiation: each batch is a request of its own
+		if err := answerHave(respPC, repo, msg); err != nil {
+			sendError(respPC, err)
+		}
 		return
 	}
 
-	var pack PackMessage
-	if err := msg.DecodePayload(&pack); err != nil {
-		respPC.SendError(ErrCodeInvalidRequest, "invalid pack payload")
+	// Pushed objects stay in quarantine until the push is accepted. The
+	// requests of a split pack share the quarantine named by their push ID.
+	incoming, err := repo.Quarantine(quarantineName(userID, pushID))
+	if err != nil {
+		respPC.SendError(ErrCodeInternal, "failed to quarantine pack: "+err.Error())
 		return
 	}
-
-	// Save received objects
-	for _, thread := range pack.Threads {
-		t := thread
-		if err := repo.SaveThread(&t); err != nil {
-			log.Printf("[HTTP %s] failed to save thread %s: %v", userID, thread.ID, err)
+	pending := false
+	defer func() {
+		if !pending {
+			incoming.DiscardQuarantine()
 		}
-	}
+	}()
 
-	for _, commit := range pack.Commits {
-		c := commit
-		if err := repo.SaveCommit(&c); err != nil {
-			log.Printf("[HTTP %s] failed to save commit %s: %v", userID, commit.ID, err)
+	logPrefix := "[HTTP " + userID + "]"
+	var stats packStats
+	switch msg.Type {
+	case MsgPack:
+		var pack PackMessage
+		if err := msg.DecodePayload(&pack); err != nil {
+			respPC.SendError(ErrCodeInvalidRequest, "invalid pack payload")
+			return
+		}
+		stats, err = savePack(incoming, &pack, logPrefix)
+		if err != nil {
+			sendError(respPC, err)
+			return
+		}
+	case MsgPackStart, MsgObject:
+		// A streamed pack may be split across several requests; every request
+		// but the last ends without pack-end and is acknowledged on its own
+		var complete bool
+		stats, complete, err = receiveStreamedPack(reqPC, msg, incoming, logPrefix)
+		if err != nil {
+			sendError(respPC, err)
+			return
 		}
+		if !complete {
+			if pushID != "" {
+				pending = true
+			} else if err := incoming.AcceptQuarantine(); err != nil {
+				// Older clients send no push ID, so their chunks can't be
+				// held until the push ends; they are stored once verified
+				respPC.SendError(ErrCodeInternal, "failed to store pack: "+err.Error())
+				return
+			}
+			log.Printf("[HTTP %s] received %d threads, %d commits (partial pack)", userID, stats.Threads, stats.Commits)
+			respPC.SendOK(fmt.Sprintf("received %d objects", stats.Threads+stats.Commits))
+			return
+		}
+	default:
+		respPC.SendError(ErrCodeInvalidRequest, "expected pack message")
+		return
 	}
 
-	log.Printf("[HTTP %s] received %d threads, %d commits", userID, len(pack.Threads), len(pack.Commits))
+	log.Printf("[HTTP %s] received %d threads, %d commits", userID, stats.Threads, stats.Commits)
 
 	// Receive ref updates
 	msg, err = reqPC.Receive()
@@ -267,45 +413,44 @@ func (h *HTTPHandler) handlePush(reqPC, respPC *ProtocolConn, repo *storage.Repo
 	}
 
 	// Apply ref updates
-	for branch, commitID := range updateRefs.Updates {
-		if !updateRefs.Force {
-			currentCommitID, _ := repo.ReadBranch(branch)
-			if currentCommitID != "" {
-				if !isAncestor(repo, currentCommitID, commitID) {
-					respPC.SendError(ErrCodeNotFastForward, fmt.Sprintf("non-fast-forward update rejected for %s", branch))
-					return
-				}
-			}
-		}
-
-		if err := repo.WriteBranch(branch, commitID); err != nil {
-			respPC.SendError(ErrCodeInternal, "failed to update ref: "+err.Error())
-			return
-		}
-		log.Printf("[HTTP %s] updated %s -> %s", userID, branch, commitID[:12])
+	applied, errMsg := applyRefUpdates(incoming, &updateRefs, sess)
+	for _, branch := range applied {
+		log.Printf("[HTTP %s] updated %s -> %s", userID, branch, shortID(updateRefs.Updates[branch]))
+	}
+	if errMsg != nil {
+		respPC.SendError(errMsg.Code, errMsg.Message)
+		return
 	}
 
 	respPC.SendOK("push successful")
 }
 
-func (h *HTTPHandler) handlePull(reqPC, respPC *ProtocolConn, repo *storage.Repository, userID string) {
-	// Send refs advertisement
-	refs, err := buildRefsMessage(repo)
-	if err != nil {
-		respPC.SendError(ErrCodeInternal, "failed to build refs: "+err.Error())
-		return
+// quarantineName returns the quarantine shared by the requests of a split
+// push, or "" for a fresh one. The user is part of the name so one user's
+// push can't reach objects another has not yet finished pushing.
+func quarantineName(userID, pushID string) string {
+	if pushID == "" {
+		return ""
 	}
+	sum := sha256.Sum256([]byte(userID + "\x00" + pushID))
+	return "http-" + hex.EncodeToString(sum[:16])
+}
 
-	if err := respPC.Send(MsgRefs, refs); err != nil {
-		log.Printf("[HTTP %s] failed to send refs: %v", userID, err)
+func (h *HTTPHandler) handlePull(reqPC, respPC *ProtocolConn, repo *storage.Repository, userID string, sess *session) {
+	// HTTP pull has two phases, like push:
+	// Phase 1 (refs negotiation): empty request → server sends refs
+	// Phase 2 (fetch): Want → server sends Pack
+	// With have-want, Have requests → server sends Ack may come in between
+	msg, err := reqPC.Receive()
+	if err != nil {
+		h.sendRefs(respPC, repo, userID, sess)
 		return
 	}
 
-	// Receive want message
-	msg, err := reqPC.Receive()
-	if err != nil {
-		log.Printf("[HTTP %s] failed to receive want: %v", userID, err)
-		respPC.SendError(ErrCodeInvalidRequest, "failed to receive want")
+	if msg.Type == MsgHave {
+		if err := answerHave(respPC, repo, msg); err != nil {
+			sendError(respPC, err)
+		}
 		return
 	}
 
@@ -320,45 +465,34 @@ func (h *HTTPHandler) handlePull(reqPC, respPC *ProtocolConn, repo *storage.Repo
 		return
 	}
 
-	// Build pack with requested objects
-	pack := PackMessage{
-		Commits: make([]model.TinCommit, 0),
-		Threads: make([]model.Thread, 0),
-	}
-
-	for _, threadID := range want.ThreadIDs {
-		thread, err := repo.LoadThread(threadID)
-		if err != nil {
-			continue
-		}
-		pack.Threads = append(pack.Threads, *thread)
-	}
-
-	for _, versionRef := range want.ThreadVersions {
-		thread, err := repo.LoadThreadVersion(versionRef.ThreadID, versionRef.ContentHash)
-		if err != nil {
-			continue
+	// Send requested objects
+	stats, err := sendWantedObjects(respPC, repo, &want, sess, "[HTTP "+userID+"]")
+	if err != nil {
+		var errMsg *ErrorMessage
+		if errors.As(err, &errMsg) {
+			respPC.SendError(errMsg.Code, errMsg.Message)
 		}
-		pack.Threads = append(pack.Threads, *thread)
+		log.Printf("[HTTP %s] failed to send pack: %v", userID, err)
+		return
 	}
 
-	for _, commitID := range want.CommitIDs {
-		commit, err := repo.LoadCommit(commitID)
-		if err != nil {
-			continue
-		}
-		pack.Commits = append(pack.Commits, *commit)
-	}
+	log.Printf("[HTTP %s] sent %d threads, %d commits", userID, stats.Threads, stats.Commits)
+}
 
-	if err := respPC.Send(MsgPack, pack); err != nil {
-		log.Printf("[HTTP %s] failed to send pack: %v", userID, err)
+// sendRefs answers the refs negotiation phase of a push or pull
+func (h *HTTPHandler) sendRefs(respPC *ProtocolConn, repo *storage.Repository, userID string, sess *session) {
+	refs, err := buildRefsMessage(repo, sess)
+	if err != nil {
+		respPC.SendError(ErrCodeInternal, "failed to build refs: "+err.Error())
 		return
 	}
-
-	log.Printf("[HTTP %s] sent %d threads, %d commits", userID, len(pack.Threads), len(pack.Commits))
+	if err := respPC.Send(MsgRefs, refs); err != nil {
+		log.Printf("[HTTP %s] failed to send refs: %v", userID, err)
+	}
+	log.Printf("[HTTP %s] sent refs (negotiation phase)", userID)
 }
 
-func (h *HTTPHandler) handleConfig(reqPC, respPC *ProtocolConn, repo *storage.Repository, userID string) {
+func (h *HTTPHandler) handleConfig(reqPC, respPC *ProtocolConn, repo *storage.Repository, userID string, sess *session) {
 	msg, err := reqPC.Receive()
 	if err != nil {
 		log.Printf("[HTTP %s] failed to receive config message: %v", userID, err)
@@ -380,6 +514,11 @@ func (h *HTTPHandler) handleConfig(reqPC, respPC *ProtocolConn, repo *storage.Re
 		log.Printf("[HTTP %s] sent config", userID)
 
 	case MsgSetConfig:
+		if sess.perm < PermAdmin {
+			respPC.SendError(ErrCodeForbidden, "changing config requires admin permission")
+			return
+		}
+
 		var setConfig SetConfigMessage
 		if err := msg.DecodePayload(&setConfig); err != nil {
 			respPC.SendError(ErrCodeInvalidRequest, "invalid set-config payload")
@@ -8,12 +8,23 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
 const (
 	// ContentTypeTinProtocol is the content type for TIN protocol messages
 	ContentTypeTinProtocol = "application/x-tin-protocol"
+
+	// HeaderProtocolVersion carries the client's protocol version (HTTP has no hello message)
+	HeaderProtocolVersion = "Tin-Protocol-Version"
+
+	// HeaderCapabilities carries the client's comma-separated capabilities
+	HeaderCapabilities = "Tin-Capabilities"
+
+	// HeaderPushID identifies the requests of one push, so the server can
+	// quarantine a streamed pack split across several of them as one
+	HeaderPushID = "Tin-Push-ID"
 )
 
 // HTTPSTransport implements Transport over HTTPS
@@ -21,12 +32,24 @@ type HTTPSTransport struct {
 	client    *http.Client
 	baseURL   string
 	creds     *Credentials
-	operation string // Set from HelloMessage
-	repoPath  string // Set from HelloMessage (not used for HTTP, but stored)
-
-	// Message buffering for request/response batching
-	sendBuf []Message
-	recvBuf []Message
+	operation string   // Set from HelloMessage
+	repoPath  string   // Set from HelloMessage (not used for HTTP, but stored)
+	version   int      // Set from HelloMessage, sent as a header
+	caps      []string // Set from HelloMessage, sent as a header
+	pushID    string   // Set when a streamed pack starts, sent as a header
+
+	// Encoded messages waiting to be sent as the next request body
+	sendBuf bytes.Buffer
+
+	// Response currently being read; messages are decoded one at a time
+	// so large packs are never held in memory
+	resp   *http.Response
+	reader *bufio.Reader
+
+	// MaxRequestBytes bounds the request body built while streaming a pack.
+	// When adding an object would exceed it, the buffered objects are sent
+	// as a request of their own first.
+	MaxRequestBytes int
 }
 
 // NewHTTPSTransport creates a new HTTPS transport
@@ -54,12 +77,23 @@ func NewHTTPSTransport(url *ParsedURL, creds *Credentials) (*HTTPSTransport, err
 		baseURL = fmt.Sprintf("%s://%s%s", scheme, url.Host, url.Path)
 	}
 
+	client := &http.Client{}
+	if scheme == "https" {
+		cfg, err := ClientTLSConfig(url.Host)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = cfg
+		client.Transport = transport
+	}
+
 	return &HTTPSTransport{
-		client:  &http.Client{},
+		client:  client,
 		baseURL: strings.TrimSuffix(baseURL, "/"),
 		creds:   creds,
-		sendBuf: make([]Message, 0),
-		recvBuf: make([]Message, 0),
+
+		MaxRequestBytes: DefaultMaxRequestBytes,
 	}, nil
 }
 
@@ -87,74 +121,114 @@ func (t *HTTPSTransport) Send(msgType MessageType, payload any) error {
 		if err := json.Unmarshal(payloadBytes, &hello); err == nil {
 			t.operation = hello.Operation
 			t.repoPath = hello.RepoPath
+			t.version = hello.Version
+			t.caps = hello.Capabilities
 		}
 		// Don't buffer Hello for HTTP - the endpoint indicates the operation
 		return nil
 	}
 
-	t.sendBuf = append(t.sendBuf, msg)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	if msgType == MsgPackStart {
+		id, err := randomHex(16)
+		if err != nil {
+			return err
+		}
+		t.pushID = id
+	}
+
+	// Split streamed packs into several requests to stay under proxy body limits
+	if msgType == MsgObject && t.sendBuf.Len() > 0 && t.sendBuf.Len()+len(data) > t.MaxRequestBytes {
+		if err := t.flush(); err != nil {
+			return err
+		}
+	}
+
+	t.sendBuf.Write(data)
+	t.sendBuf.WriteByte('\n')
 	return nil
 }
 
-// Receive returns the next message from the response buffer.
-// If the buffer is empty, it flushes pending sends via HTTP and fills the buffer.
+// Receive returns the next message from the current response.
+// Once the response is exhausted, it flushes pending sends as a new HTTP request.
 func (t *HTTPSTransport) Receive() (*Message, error) {
-	// If we have buffered responses, return the next one
-	if len(t.recvBuf) > 0 {
-		msg := t.recvBuf[0]
-		t.recvBuf = t.recvBuf[1:]
-		return &msg, nil
+	// Return the next message of the current response, if any
+	if t.reader != nil {
+		msg, err := t.readMessage()
+		if err == nil {
+			return msg, nil
+		}
+		t.closeResponse()
+		if err != io.EOF {
+			return nil, err
+		}
 	}
 
 	// No buffered responses - flush pending sends and get response
 	// For HTTP, we allow empty sendBuf - this triggers a "get refs" request
-
-	// Make HTTP request
-	responses, err := t.doRequest()
-	if err != nil {
+	if err := t.doRequest(); err != nil {
 		return nil, err
 	}
 
-	// Buffer all responses
-	t.recvBuf = responses
-
-	// Return first response
-	if len(t.recvBuf) == 0 {
+	msg, err := t.readMessage()
+	if err == io.EOF {
+		t.closeResponse()
 		return nil, fmt.Errorf("server returned no messages")
 	}
+	return msg, err
+}
 
-	msg := t.recvBuf[0]
-	t.recvBuf = t.recvBuf[1:]
-	return &msg, nil
+// flush sends the buffered part of a streamed pack as its own request and
+// waits for the server to acknowledge it
+func (t *HTTPSTransport) flush() error {
+	t.closeResponse()
+	if err := t.doRequest(); err != nil {
+		return err
+	}
+	defer t.closeResponse()
+
+	msg, err := t.readMessage()
+	if err != nil {
+		return fmt.Errorf("failed to read acknowledgement: %w", err)
+	}
+	if msg.Type == MsgError {
+		var errMsg ErrorMessage
+		msg.DecodePayload(&errMsg)
+		return fmt.Errorf("server error: %s", errMsg.Message)
+	}
+	return nil
 }
 
-// doRequest sends buffered messages as an HTTP POST and returns response messages
-func (t *HTTPSTransport) doRequest() ([]Message, error) {
+// doRequest sends buffered messages as an HTTP POST and opens the response for reading
+func (t *HTTPSTransport) doRequest() error {
 	// Determine endpoint based on operation
 	endpoint := t.endpointForOperation(t.operation)
 
-	// Encode request messages as newline-delimited JSON
-	var body bytes.Buffer
-	for _, msg := range t.sendBuf {
-		data, err := json.Marshal(msg)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal message: %w", err)
-		}
-		body.Write(data)
-		body.WriteByte('\n')
-	}
-
-	// Clear send buffer
-	t.sendBuf = t.sendBuf[:0]
+	// Take the buffered request body (newline-delimited JSON)
+	body := bytes.NewReader(bytes.Clone(t.sendBuf.Bytes()))
+	t.sendBuf.Reset()
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", endpoint, &body)
+	req, err := http.NewRequest("POST", endpoint, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", ContentTypeTinProtocol)
 	req.Header.Set("Accept", ContentTypeTinProtocol)
+	if t.version > 0 {
+		req.Header.Set(HeaderProtocolVersion, strconv.Itoa(t.version))
+	}
+	if len(t.caps) > 0 {
+		req.Header.Set(HeaderCapabilities, strings.Join(t.caps, ","))
+	}
+	if t.pushID != "" {
+		req.Header.Set(HeaderPushID, t.pushID)
+	}
 
 	// Add Basic Auth if credentials available
 	if t.creds != nil && t.creds.Password != "" {
@@ -171,21 +245,53 @@ func (t *HTTPSTransport) doRequest() ([]Message, error) {
 	// Send request
 	resp, err := t.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
+		return fmt.Errorf("HTTP request failed: %w", err)
 	}
-	defer resp.Body.Close()
 
 	// Check for HTTP-level errors
 	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("authentication required: server returned 401 Unauthorized")
+		resp.Body.Close()
+		return fmt.Errorf("authentication required: server returned 401 Unauthorized")
 	}
 	if resp.StatusCode >= 400 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(respBody))
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		return fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	// Parse response messages (newline-delimited JSON)
-	return t.parseResponse(resp.Body)
+	t.resp = resp
+	t.reader = bufio.NewReader(resp.Body)
+	return nil
+}
+
+// readMessage decodes the next newline-delimited JSON message from the response.
+// It returns io.EOF once the response has no more messages.
+func (t *HTTPSTransport) readMessage() (*Message, error) {
+	for {
+		line, err := t.reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var msg Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				return nil, fmt.Errorf("failed to decode response message: %w", err)
+			}
+			return &msg, nil
+		}
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+	}
+}
+
+// closeResponse releases the current response, if any
+func (t *HTTPSTransport) closeResponse() {
+	if t.resp != nil {
+		t.resp.Body.Close()
+	}
+	t.resp = nil
+	t.reader = nil
 }
 
 // endpointForOperation returns the HTTP endpoint for the given operation
@@ -202,37 +308,9 @@ func (t *HTTPSTransport) endpointForOperation(operation string) string {
 	}
 }
 
-// parseResponse parses newline-delimited JSON messages from the response body
-func (t *HTTPSTransport) parseResponse(r io.Reader) ([]Message, error) {
-	var messages []Message
-	scanner := bufio.NewScanner(r)
-	// Increase buffer size to handle large messages (e.g., packs with many commits/threads)
-	// Default is 64KB, increase to 16MB
-	const maxScannerBuffer = 16 * 1024 * 1024
-	scanner.Buffer(make([]byte, 0, 64*1024), maxScannerBuffer)
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		var msg Message
-		if err := json.Unmarshal(line, &msg); err != nil {
-			return nil, fmt.Errorf("failed to decode response message: %w", err)
-		}
-		messages = append(messages, msg)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	return messages, nil
-}
-
-// Close is a no-op for HTTP (stateless)
+// Close releases any open response (HTTP itself is stateless)
 func (t *HTTPSTransport) Close() error {
+	t.closeResponse()
 	return nil
 }
 
@@ -0,0 +1,415 @@
+package remote
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// DefaultMaxRequestBytes is the largest request body the HTTPS transport builds
+// while streaming a pack before it flushes the objects as a request of their own.
+// It keeps pushes under typical proxy body limits.
+const DefaultMaxRequestBytes = 4 << 20
+
+// maxObjectBytes bounds the decompressed size of a single object
+const maxObjectBytes = 256 << 20
+
+// Error implements the error interface so protocol errors can be returned
+// from helpers and sent back to the peer unchanged
+func (e *ErrorMessage) Error() string {
+	return e.Message
+}
+
+// messageSender is implemented by ProtocolConn and every Transport
+type messageSender interface {
+	Send(msgType MessageType, payload any) error
+}
+
+// encodeObject wraps a commit or thread in an ObjectMessage, gzip-compressing it if requested
+func encodeObject(kind string, v any, compress bool) (*ObjectMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", kind, err)
+	}
+	if !compress {
+		return &ObjectMessage{Kind: kind, Object: data}, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress %s: %w", kind, err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress %s: %w", kind, err)
+	}
+	return &ObjectMessage{Kind: kind, Encoding: "gzip", Data: buf.Bytes()}, nil
+}
+
+// decodeObject decodes the commit or thread carried in an ObjectMessage into v
+func decodeObject(obj *ObjectMessage, v any) error {
+	switch obj.Encoding {
+	case "":
+		return json.Unmarshal(obj.Object, v)
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(obj.Data))
+		if err != nil {
+			return fmt.Errorf("invalid gzip data: %w", err)
+		}
+		defer zr.Close()
+		return json.NewDecoder(io.LimitReader(zr, maxObjectBytes)).Decode(v)
+	default:
+		return fmt.Errorf("unsupported object encoding: %s", obj.Encoding)
+	}
+}
+
+// packStats counts the objects transferred in a pack
+type packStats struct {
+	Threads int
+	Commits int
+}
+
+// saveObject decodes an object from a streamed pack and saves it to the
+// repository. If verify is non-nil the object must pass verification first.
+func saveObject(repo *storage.Repository, obj *ObjectMessage, stats *packStats, verify *packVerifier) error {
+	switch obj.Kind {
+	case ObjectThread:
+		var thread model.Thread
+		if err := decodeObject(obj, &thread); err != nil {
+			return &ErrorMessage{Code: ErrCodeInvalidRequest, Message: "invalid thread object: " + err.Error()}
+		}
+		if verify != nil {
+			if err := verify.verifyThread(&thread); err != nil {
+				return err
+			}
+		}
+		if err := repo.SaveThread(&thread); err != nil {
+			return fmt.Errorf("failed to save thread %s: %w", thread.ID, err)
+		}
+		if verify != nil {
+			verify.acceptThread(&thread)
+		}
+		stats.Threads++
+	case ObjectCommit:
+		var commit model.TinCommit
+		if err := decodeObject(obj, &commit); err != nil {
+			return &ErrorMessage{Code: ErrCodeInvalidRequest, Message: "invalid commit object: " + err.Error()}
+		}
+		if verify != nil {
+			if err := verify.verifyCommit(&commit); err != nil {
+				return err
+			}
+		}
+		if err := repo.SaveCommit(&commit); err != nil {
+			return fmt.Errorf("failed to save commit %s: %w", commit.ID, err)
+		}
+		if verify != nil {
+			verify.acceptCommit(&commit)
+		}
+		stats.Commits++
+	default:
+		return &ErrorMessage{Code: ErrCodeInvalidRequest, Message: "unknown object kind: " + obj.Kind}
+	}
+	return nil
+}
+
+// receiveStreamedPack saves the objects of a streamed pack as they arrive, so
+// memory use is bounded by the largest single object. first is the message that
+// opened the stream: a pack-start, or an object when an HTTP push continues a
+// pack across requests. It returns complete=false if the stream ended before
+// pack-end, which is how each chunk of a split HTTP push ends. Every object is
+// verified before it is saved; commits must follow their parents and the
+// threads they reference.
+func receiveStreamedPack(pc *ProtocolConn, first *Message, repo *storage.Repository, logPrefix string) (stats packStats, complete bool, err error) {
+	verify := newPackVerifier(repo)
+	msg := first
+	for {
+		switch msg.Type {
+		case MsgPackStart:
+			// Counts are advisory (progress only)
+		case MsgObject:
+			var obj ObjectMessage
+			if err := msg.DecodePayload(&obj); err != nil {
+				return stats, false, &ErrorMessage{Code: ErrCodeInvalidRequest, Message: "invalid object payload"}
+			}
+			if err := saveObject(repo, &obj, &stats, verify); err != nil {
+				var errMsg *ErrorMessage
+				if errors.As(err, &errMsg) {
+					return stats, false, err
+				}
+				log.Printf("%s %v", logPrefix, err)
+			}
+		case MsgPackEnd:
+			return stats, true, nil
+		default:
+			return stats, false, &ErrorMessage{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("unexpected %s message in pack", msg.Type)}
+		}
+
+		msg, err = pc.Receive()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return stats, false, nil
+			}
+			return stats, false, err
+		}
+	}
+}
+
+// savePack verifies and saves the objects of a legacy single-message pack.
+// Nothing is saved if any object fails verification.
+func savePack(repo *storage.Repository, pack *PackMessage, logPrefix string) (packStats, error) {
+	if err := newPackVerifier(repo).verifyPack(pack); err != nil {
+		return packStats{}, err
+	}
+
+	var stats packStats
+	for _, thread := range pack.Threads {
+		t := thread // avoid closure issue
+		if err := repo.SaveThread(&t); err != nil {
+			log.Printf("%s failed to save thread %s: %v", logPrefix, thread.ID, err)
+			continue
+		}
+		stats.Threads++
+	}
+
+	for _, commit := range pack.Commits {
+		c := commit // avoid closure issue
+		if err := repo.SaveCommit(&c); err != nil {
+			log.Printf("%s failed to save commit %s: %v", logPrefix, commit.ID, err)
+			continue
+		}
+		stats.Commits++
+	}
+	return stats, nil
+}
+
+// maxHavesPerMessage bounds the number of object IDs a single have message may list
+const maxHavesPerMessage = 1024
+
+// answerHave replies to a have message with the listed objects present in repo
+func answerHave(s messageSender, repo *storage.Repository, msg *Message) error {
+	var have HaveMessage
+	if err := msg.DecodePayload(&have); err != nil {
+		return &ErrorMessage{Code: ErrCodeInvalidRequest, Message: "invalid have payload"}
+	}
+	if len(have.CommitIDs)+len(have.ThreadVersions) > maxHavesPerMessage {
+		return &ErrorMessage{Code: ErrCodeInvalidRequest, Message: fmt.Sprintf("too many haves in one message (max %d)", maxHavesPerMessage)}
+	}
+
+	var ack AckMessage
+	for _, id := range have.CommitIDs {
+		if repo.HasCommit(id) {
+			ack.CommitIDs = append(ack.CommitIDs, id)
+		}
+	}
+	for _, ref := range have.ThreadVersions {
+		if repo.HasThreadVersion(ref.ThreadID, ref.ContentHash) {
+			ack.ThreadVersions = append(ack.ThreadVersions, ref)
+		}
+	}
+	return s.Send(MsgAck, ack)
+}
+
+// expandWants resolves a negotiated want (branch tips and common commits) into
+// the explicit objects to send: every commit reachable from the wants but not
+// from the haves, parents before children, and the thread versions those
+// commits reference.
+func expandWants(repo *storage.Repository, want *WantMessage) (*WantMessage, error) {
+	stop := make(map[string]bool, len(want.Haves))
+	for _, id := range want.Haves {
+		stop[id] = true
+	}
+
+	commits, err := collectMissingCommits(repo, want.Wants, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := &WantMessage{}
+	seenThreads := make(map[string]bool)
+	for _, commit := range commits {
+		for _, ref := range commit.Threads {
+			if ref.ContentHash == "" {
+				if !seenThreads[ref.ThreadID] {
+					seenThreads[ref.ThreadID] = true
+					expanded.ThreadIDs = append(expanded.ThreadIDs, ref.ThreadID)
+				}
+				continue
+			}
+			key := ref.ThreadID + "@" + ref.ContentHash
+			if !seenThreads[key] {
+				seenThreads[key] = true
+				expanded.ThreadVersions = append(expanded.ThreadVersions, ThreadVersionRef{ThreadID: ref.ThreadID, ContentHash: ref.ContentHash})
+			}
+		}
+		expanded.CommitIDs = append(expanded.CommitIDs, commit.ID)
+	}
+	return expanded, nil
+}
+
+// collectMissingCommits walks back from tips through both parents, stopping at
+// commits in stop, and returns the commits visited with parents ordered before
+// their children
+func collectMissingCommits(repo *storage.Repository, tips []string, stop map[string]bool) ([]*model.TinCommit, error) {
+	var commits []*model.TinCommit
+	visited := make(map[string]bool)
+
+	var visit func(id string) error
+	visit = func(id string) error {
+		if id == "" || stop[id] || visited[id] {
+			return nil
+		}
+		visited[id] = true
+
+		commit, err := repo.LoadCommit(id)
+		if err != nil {
+			return fmt.Errorf("failed to load commit %s: %w", shortID(id), err)
+		}
+		if err := visit(commit.ParentCommitID); err != nil {
+			return err
+		}
+		if err := visit(commit.SecondParentID); err != nil {
+			return err
+		}
+		commits = append(commits, commit)
+		return nil
+	}
+
+	for _, tip := range tips {
+		if err := visit(tip); err != nil {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// sendWantedObjects answers a want message. With the stream-pack capability
+// objects are loaded and sent one at a time; otherwise they are collected into
+// a single legacy pack message.
+func sendWantedObjects(s messageSender, repo *storage.Repository, want *WantMessage, sess *session, logPrefix string) (packStats, error) {
+	if len(want.Wants) > 0 {
+		expanded, err := expandWants(repo, want)
+		if err != nil {
+			return packStats{}, &ErrorMessage{Code: ErrCodeNotFound, Message: err.Error()}
+		}
+		want = expanded
+	}
+
+	if !sess.caps.Has(CapStreamPack) {
+		pack := buildPack(repo, want, logPrefix)
+		stats := packStats{Threads: len(pack.Threads), Commits: len(pack.Commits)}
+		return stats, s.Send(MsgPack, pack)
+	}
+
+	compress := sess.caps.Has(CapCompression)
+	start := PackStartMessage{
+		Threads: len(want.ThreadIDs) + len(want.ThreadVersions),
+		Commits: len(want.CommitIDs),
+	}
+	if err := s.Send(MsgPackStart, start); err != nil {
+		return packStats{}, err
+	}
+
+	var stats packStats
+	sendOne := func(kind string, v any) error {
+		obj, err := encodeObject(kind, v, compress)
+		if err != nil {
+			return err
+		}
+		return s.Send(MsgObject, obj)
+	}
+
+	for _, threadID := range want.ThreadIDs {
+		thread, err := repo.LoadThread(threadID)
+		if err != nil {
+			log.Printf("%s thread not found: %s", logPrefix, threadID)
+			continue
+		}
+		if err := sendOne(ObjectThread, thread); err != nil {
+			return stats, err
+		}
+		stats.Threads++
+	}
+
+	for _, versionRef := range want.ThreadVersions {
+		thread, err := repo.LoadThreadVersion(versionRef.ThreadID, versionRef.ContentHash)
+		if err != nil {
+			log.Printf("%s thread version not found: %s@%s", logPrefix, versionRef.ThreadID, shortID(versionRef.ContentHash))
+			continue
+		}
+		if err := sendOne(ObjectThread, thread); err != nil {
+			return stats, err
+		}
+		stats.Threads++
+	}
+
+	for _, commitID := range want.CommitIDs {
+		commit, err := repo.LoadCommit(commitID)
+		if err != nil {
+			log.Printf("%s commit not found: %s", logPrefix, commitID)
+			continue
+		}
+		if err := sendOne(ObjectCommit, commit); err != nil {
+			return stats, err
+		}
+		stats.Commits++
+	}
+
+	return stats, s.Send(MsgPackEnd, PackEndMessage{Threads: stats.Threads, Commits: stats.Commits})
+}
+
+// buildPack collects the requested objects into a single legacy pack message
+func buildPack(repo *storage.Repository, want *WantMessage, logPrefix string) PackMessage {
+	pack := PackMessage{
+		Commits: make([]model.TinCommit, 0),
+		Threads: make([]model.Thread, 0),
+	}
+
+	// Handle legacy thread ID requests (load latest version)
+	for _, threadID := range want.ThreadIDs {
+		thread, err := repo.LoadThread(threadID)
+		if err != nil {
+			log.Printf("%s thread not found: %s", logPrefix, threadID)
+			continue
+		}
+		pack.Threads = append(pack.Threads, *thread)
+	}
+
+	// Handle specific version requests
+	for _, versionRef := range want.ThreadVersions {
+		thread, err := repo.LoadThreadVersion(versionRef.ThreadID, versionRef.ContentHash)
+		if err != nil {
+			log.Printf("%s thread version not found: %s@%s", logPrefix, versionRef.ThreadID, shortID(versionRef.ContentHash))
+			continue
+		}
+		pack.Threads = append(pack.Threads, *thread)
+	}
+
+	for _, commitID := range want.CommitIDs {
+		commit, err := repo.LoadCommit(commitID)
+		if err != nil {
+			log.Printf("%s commit not found: %s", logPrefix, commitID)
+			continue
+		}
+		pack.Commits = append(pack.Commits, *commit)
+	}
+
+	return pack
+}
+
+// sendError reports an error to the peer, using the protocol error code when
+// the error carries one
+func sendError(pc *ProtocolConn, err error) error {
+	var errMsg *ErrorMessage
+	if errors.As(err, &errMsg) {
+		return pc.SendError(errMsg.Code, errMsg.Message)
+	}
+	return pc.SendError(ErrCodeInternal, err.Error())
+}
@@ -9,8 +9,13 @@ import (
 	"github.com/sestinj/tin/internal/model"
 )
 
-// Protocol version
-const ProtocolVersion = 1
+// Protocol versions. ProtocolVersion is the newest version this build speaks;
+// MinProtocolVersion is the oldest version it still accepts from peers.
+// Version 2 added capability negotiation.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
 
 // MessageType identifies the type of protocol message
 type MessageType string
@@ -19,7 +24,12 @@ const (
 	MsgHello      MessageType = "hello"
 	MsgRefs       MessageType = "refs"
 	MsgWant       MessageType = "want"
+	MsgHave       MessageType = "have"
+	MsgAck        MessageType = "ack"
 	MsgPack       MessageType = "pack"
+	MsgPackStart  MessageType = "pack-start"
+	MsgObject     MessageType = "object"
+	MsgPackEnd    MessageType = "pack-end"
 	MsgUpdateRefs MessageType = "update-refs"
 	MsgGetConfig  MessageType = "get-config"
 	MsgConfig     MessageType = "config"
@@ -36,8 +46,9 @@ type Message struct {
 
 // AuthInfo contains authentication credentials
 type AuthInfo struct {
-	Type  string `json:"type"`  // "token"
-	Token string `json:"token"` // the auth token (e.g., "th_xxx")
+	Type     string `json:"type"`               // "token" or "basic"
+	Username string `json:"username,omitempty"` // for "basic"
+	Token    string `json:"token"`              // the auth token (e.g., "th_xxx") or password
 }
 
 // HelloMessage initiates the connection
@@ -46,6 +57,9 @@ type HelloMessage struct {
 	Operation string    `json:"operation"` // "push" or "pull"
 	RepoPath  string    `json:"repo_path"` // path to repository on server
 	Auth      *AuthInfo `json:"auth,omitempty"`
+
+	// Capabilities supported by the client (protocol v2+)
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // RefsMessage advertises refs and object IDs
@@ -55,6 +69,11 @@ type RefsMessage struct {
 	CommitIDs      []string            `json:"commit_ids,omitempty"`      // all known commit IDs
 	ThreadIDs      []string            `json:"thread_ids,omitempty"`      // all known thread IDs
 	ThreadVersions map[string][]string `json:"thread_versions,omitempty"` // threadID -> [contentHashes]
+
+	// Negotiated protocol version and capabilities (protocol v2+).
+	// A v1 server leaves these empty.
+	Version      int      `json:"version,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
 }
 
 // ThreadVersionRef identifies a specific version of a thread
@@ -68,6 +87,26 @@ type WantMessage struct {
 	CommitIDs      []string           `json:"commit_ids,omitempty"`
 	ThreadIDs      []string           `json:"thread_ids,omitempty"`
 	ThreadVersions []ThreadVersionRef `json:"thread_versions,omitempty"` // request specific versions
+
+	// With have-want negotiation the client names branch tips instead of
+	// individual objects. The server sends every commit reachable from Wants
+	// that is not reachable from Haves, plus the thread versions they reference.
+	Wants []string `json:"wants,omitempty"`
+	Haves []string `json:"haves,omitempty"` // common commits found during negotiation
+}
+
+// HaveMessage asks which of the listed objects the server already has
+// (have-want capability). A peer may send any number of these before its pack
+// or want, each answered by an AckMessage.
+type HaveMessage struct {
+	CommitIDs      []string           `json:"commit_ids,omitempty"`
+	ThreadVersions []ThreadVersionRef `json:"thread_versions,omitempty"`
+}
+
+// AckMessage lists the objects from a HaveMessage that the server has
+type AckMessage struct {
+	CommitIDs      []string           `json:"commit_ids,omitempty"`
+	ThreadVersions []ThreadVersionRef `json:"thread_versions,omitempty"`
 }
 
 // PackMessage contains objects to transfer
@@ -76,6 +115,36 @@ type PackMessage struct {
 	Threads []model.Thread    `json:"threads,omitempty"`
 }
 
+// PackStartMessage opens a streamed pack (stream-pack capability).
+// The counts are the number of objects the sender intends to send and are
+// used for progress reporting.
+type PackStartMessage struct {
+	Commits int `json:"commits"`
+	Threads int `json:"threads"`
+}
+
+// Object kinds carried in an ObjectMessage
+const (
+	ObjectCommit = "commit"
+	ObjectThread = "thread"
+)
+
+// ObjectMessage carries a single commit or thread of a streamed pack.
+// Uncompressed objects are embedded as JSON in Object; compressed objects
+// are carried in Data with Encoding naming the compression.
+type ObjectMessage struct {
+	Kind     string          `json:"kind"`
+	Encoding string          `json:"encoding,omitempty"` // "" or "gzip"
+	Object   json.RawMessage `json:"object,omitempty"`
+	Data     []byte          `json:"data,omitempty"`
+}
+
+// PackEndMessage closes a streamed pack with the number of objects actually sent
+type PackEndMessage struct {
+	Commits int `json:"commits"`
+	Threads int `json:"threads"`
+}
+
 // UpdateRefsMessage requests ref updates (for push)
 type UpdateRefsMessage struct {
 	Updates map[string]string `json:"updates"` // branch name -> commit ID
@@ -115,6 +184,12 @@ const (
 	ErrCodeNotFastForward  = "not_fast_forward"
 	ErrCodeInternal        = "internal"
 	ErrCodeProtocolVersion = "protocol_version"
+	ErrCodeInvalidObject   = "invalid_object" // object ID does not match its content, or object is malformed
+	ErrCodeMissingObject   = "missing_object" // a parent commit or referenced thread version is absent
+	ErrCodeUnauthorized    = "unauthorized"
+	ErrCodeForbidden       = "forbidden"
+	ErrCodeProtectedBranch = "protected_branch"
+	ErrCodeHookRejected    = "hook_rejected"
 )
 
 // ProtocolConn wraps a connection for protocol message exchange
@@ -1,45 +1,81 @@
 package remote
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	"github.com/sestinj/tin/internal/model"
 	"github.com/sestinj/tin/internal/storage"
 )
 
 // Server handles remote tin connections
 type Server struct {
-	host       string
-	port       int
-	repoPath   string // single repo mode (legacy)
-	rootPath   string // multi-repo mode: serve any repo under this root
-	autoCreate bool   // auto-create repos on push
-	listener   net.Listener
+	host         string
+	port         int
+	repoPath     string   // single repo mode (legacy)
+	rootPath     string   // multi-repo mode: serve any repo under this root
+	autoCreate   bool     // auto-create repos on push
+	version      int      // highest protocol version offered to clients
+	capabilities []string // capabilities offered to clients
+	auth         AuthValidator
+	acl          *ACL
+	tlsConfig    *tls.Config
+	certs        CertValidator // maps verified client certificates to users
+	listener     net.Listener
 }
 
 // NewServer creates a new tin server for a single repository
 func NewServer(host string, port int, repoPath string) *Server {
 	return &Server{
-		host:     host,
-		port:     port,
-		repoPath: repoPath,
+		host:         host,
+		port:         port,
+		repoPath:     repoPath,
+		version:      ProtocolVersion,
+		capabilities: SupportedCapabilities(),
 	}
 }
 
 // NewMultiRepoServer creates a server that can serve multiple repositories under a root path
 func NewMultiRepoServer(host string, port int, rootPath string, autoCreate bool) *Server {
 	return &Server{
-		host:       host,
-		port:       port,
-		rootPath:   rootPath,
-		autoCreate: autoCreate,
+		host:         host,
+		port:         port,
+		rootPath:     rootPath,
+		autoCreate:   autoCreate,
+		version:      ProtocolVersion,
+		capabilities: SupportedCapabilities(),
 	}
 }
 
+// SetCapabilities restricts the capabilities the server offers to clients
+func (s *Server) SetCapabilities(caps []string) {
+	s.capabilities = caps
+}
+
+// SetAuthValidator requires clients to authenticate. Without a validator,
+// clients may connect anonymously and any credentials they send are trusted.
+func (s *Server) SetAuthValidator(auth AuthValidator) {
+	s.auth = auth
+}
+
+// SetACL restricts which users may read, write and create repositories
+func (s *Server) SetACL(acl *ACL) {
+	s.acl = acl
+}
+
+// SetTLS makes the server accept only TLS connections. If certs is non-nil,
+// clients presenting a verified certificate are identified by it rather than
+// by the credentials in their hello.
+func (s *Server) SetTLS(cfg *tls.Config, certs CertValidator) {
+	s.tlsConfig = cfg
+	s.certs = certs
+}
+
 // Start starts the server and listens for connections
 func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.host, s.port)
@@ -47,9 +83,12 @@ func (s *Server) Start() error {
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", addr, err)
 	}
-	s.listener = listener
 
-	log.Printf("tin server listening on %s", addr)
+	if s.tlsConfig != nil {
+		log.Printf("tin server listening on %s (TLS)", addr)
+	} else {
+		log.Printf("tin server listening on %s", addr)
+	}
 	if s.rootPath != "" {
 		log.Printf("serving repositories under: %s", s.rootPath)
 		if s.autoCreate {
@@ -59,9 +98,22 @@ func (s *Server) Start() error {
 		log.Printf("serving repository: %s", s.repoPath)
 	}
 
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on the given listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	s.listener = listener
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
 			log.Printf("failed to accept connection: %v", err)
 			continue
 		}
@@ -84,6 +136,16 @@ func (s *Server) handleConnection(conn net.Conn) {
 	remoteAddr := conn.RemoteAddr().String()
 	log.Printf("new connection from %s", remoteAddr)
 
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			log.Printf("[%s] TLS handshake failed: %v", remoteAddr, err)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+
 	pc := NewProtocolConn(conn)
 
 	// Read hello message
@@ -104,8 +166,19 @@ func (s *Server) handleConnection(conn net.Conn) {
 		return
 	}
 
-	if hello.Version != ProtocolVersion {
-		pc.SendError(ErrCodeProtocolVersion, fmt.Sprintf("unsupported protocol version: %d", hello.Version))
+	sess, err := negotiateSession(hello.Version, hello.Capabilities, s.version, s.capabilities)
+	if err != nil {
+		pc.SendError(ErrCodeProtocolVersion, err.Error())
+		return
+	}
+
+	userID, ok := CertUser(s.certs, tlsState)
+	scope := PermAdmin
+	if !ok {
+		userID, scope, ok = authenticateHello(s.auth, hello.Auth)
+	}
+	if !ok {
+		pc.SendError(ErrCodeUnauthorized, "authentication failed")
 		return
 	}
 
@@ -116,13 +189,31 @@ func (s *Server) handleConnection(conn net.Conn) {
 		return
 	}
 
-	log.Printf("[%s] repo: %s, operation: %s", remoteAddr, repoPath, hello.Operation)
+	log.Printf("[%s] repo: %s, operation: %s, protocol: v%d, user: %s", remoteAddr, repoPath, hello.Operation, sess.version, userID)
+
+	// Check access
+	aclName := repoKey(hello.RepoPath)
+	if s.rootPath == "" {
+		aclName = filepath.Base(s.repoPath)
+	}
+	sess.repo = aclName
+	sess.user = userID
+	sess.perm = min(s.acl.Permission(userID, aclName), scope)
+	sess.protected = s.acl.ProtectedBranchPatterns(aclName)
+	if errMsg := checkPermission(sess, hello.Operation); errMsg != nil {
+		pc.SendError(errMsg.Code, errMsg.Message)
+		return
+	}
 
 	// Open or create repository
 	repo, err := storage.OpenBare(repoPath)
 	if err != nil {
 		// Try to auto-create on push if enabled
 		if s.autoCreate && hello.Operation == "push" {
+			if sess.perm < PermAdmin {
+				pc.SendError(ErrCodeForbidden, "creating repositories requires admin permission")
+				return
+			}
 			log.Printf("[%s] creating new repository: %s", remoteAddr, repoPath)
 			repo, err = storage.InitBare(repoPath)
 			if err != nil {
@@ -137,11 +228,11 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 	switch hello.Operation {
 	case "push":
-		s.handlePush(pc, repo, remoteAddr)
+		s.handlePush(pc, repo, remoteAddr, sess)
 	case "pull":
-		s.handlePull(pc, repo, remoteAddr)
+		s.handlePull(pc, repo, remoteAddr, sess)
 	case "config":
-		s.handleConfig(pc, repo, remoteAddr)
+		s.handleConfig(pc, repo, remoteAddr, sess)
 	default:
 		pc.SendError(ErrCodeInvalidRequest, "unknown operation: "+hello.Operation)
 	}
@@ -184,9 +275,9 @@ func (s *Server) resolveRepoPath(clientPath string) (string, error) {
 	return fullPath, nil
 }
 
-func (s *Server) handlePush(pc *ProtocolConn, repo *storage.Repository, remoteAddr string) {
+func (s *Server) handlePush(pc *ProtocolConn, repo *storage.Repository, remoteAddr string, sess *session) {
 	// Send refs advertisement
-	refs, err := buildRefsMessage(repo)
+	refs, err := buildRefsMessage(repo, sess)
 	if err != nil {
 		pc.SendError(ErrCodeInternal, "failed to build refs: "+err.Error())
 		return
@@ -197,40 +288,52 @@ func (s *Server) handlePush(pc *ProtocolConn, repo *storage.Repository, remoteAd
 		return
 	}
 
-	// Receive pack
-	msg, err := pc.Receive()
+	// Answer have negotiation, then receive pack
+	msg, err := receiveAfterHaves(pc, repo)
 	if err != nil {
 		log.Printf("[%s] failed to receive pack: %v", remoteAddr, err)
 		return
 	}
 
-	if msg.Type != MsgPack {
-		pc.SendError(ErrCodeInvalidRequest, "expected pack message")
-		return
-	}
-
-	var pack PackMessage
-	if err := msg.DecodePayload(&pack); err != nil {
-		pc.SendError(ErrCodeInvalidRequest, "invalid pack payload")
+	// Pushed objects stay in quarantine until the push is accepted
+	incoming, err := repo.Quarantine("")
+	if err != nil {
+		pc.SendError(ErrCodeInternal, "failed to quarantine pack: "+err.Error())
 		return
 	}
+	defer incoming.DiscardQuarantine()
 
-	// Save received objects
-	for _, thread := range pack.Threads {
-		t := thread // avoid closure issue
-		if err := repo.SaveThread(&t); err != nil {
-			log.Printf("[%s] failed to save thread %s: %v", remoteAddr, thread.ID, err)
+	logPrefix := "[" + remoteAddr + "]"
+	var stats packStats
+	switch msg.Type {
+	case MsgPack:
+		var pack PackMessage
+		if err := msg.DecodePayload(&pack); err != nil {
+			pc.SendError(ErrCodeInvalidRequest, "invalid pack payload")
+			return
 		}
-	}
-
-	for _, commit := range pack.Commits {
-		c := commit // avoid closure issue
-		if err := repo.SaveCommit(&c); err != nil {
-			log.Printf("[%s] failed to save commit %s: %v", remoteAddr, commit.ID, err)
+		stats, err = savePack(incoming, &pack, logPrefix)
+		if err != nil {
+			sendError(pc, err)
+			return
+		}
+	case MsgPackStart:
+		var complete bool
+		stats, complete, err = receiveStreamedPack(pc, msg, incoming, logPrefix)
+		if err != nil {
+			sendError(pc, err)
+			return
+		}
+		if !complete {
+			log.Printf("[%s] connection closed before end of pack", remoteAddr)
+			return
 		}
+	default:
+		pc.SendError(ErrCodeInvalidRequest, "expected pack message")
+		return
 	}
 
-	log.Printf("[%s] received %d threads, %d commits", remoteAddr, len(pack.Threads), len(pack.Commits))
+	log.Printf("[%s] received %d threads, %d commits", remoteAddr, stats.Threads, stats.Commits)
 
 	// Receive ref updates
 	msg, err = pc.Receive()
@@ -251,32 +354,21 @@ func (s *Server) handlePush(pc *ProtocolConn, repo *storage.Repository, remoteAd
 	}
 
 	// Apply ref updates
-	for branch, commitID := range updateRefs.Updates {
-		// Check fast-forward if not force
-		if !updateRefs.Force {
-			currentCommitID, _ := repo.ReadBranch(branch)
-			if currentCommitID != "" {
-				// Check if this is a fast-forward
-				if !isAncestor(repo, currentCommitID, commitID) {
-					pc.SendError(ErrCodeNotFastForward, fmt.Sprintf("non-fast-forward update rejected for %s (use --force)", branch))
-					return
-				}
-			}
-		}
-
-		if err := repo.WriteBranch(branch, commitID); err != nil {
-			pc.SendError(ErrCodeInternal, "failed to update ref: "+err.Error())
-			return
-		}
-		log.Printf("[%s] updated %s -> %s", remoteAddr, branch, commitID[:12])
+	applied, errMsg := applyRefUpdates(incoming, &updateRefs, sess)
+	for _, branch := range applied {
+		log.Printf("[%s] updated %s -> %s", remoteAddr, branch, shortID(updateRefs.Updates[branch]))
+	}
+	if errMsg != nil {
+		pc.SendError(errMsg.Code, errMsg.Message)
+		return
 	}
 
 	pc.SendOK("push successful")
 }
 
-func (s *Server) handlePull(pc *ProtocolConn, repo *storage.Repository, remoteAddr string) {
+func (s *Server) handlePull(pc *ProtocolConn, repo *storage.Repository, remoteAddr string, sess *session) {
 	// Send refs advertisement
-	refs, err := buildRefsMessage(repo)
+	refs, err := buildRefsMessage(repo, sess)
 	if err != nil {
 		pc.SendError(ErrCodeInternal, "failed to build refs: "+err.Error())
 		return
@@ -287,8 +379,8 @@ func (s *Server) handlePull(pc *ProtocolConn, repo *storage.Repository, remoteAd
 		return
 	}
 
-	// Receive want message
-	msg, err := pc.Receive()
+	// Answer have negotiation, then receive want message
+	msg, err := receiveAfterHaves(pc, repo)
 	if err != nil {
 		log.Printf("[%s] failed to receive want: %v", remoteAddr, err)
 		return
@@ -305,47 +397,18 @@ func (s *Server) handlePull(pc *ProtocolConn, repo *storage.Repository, remoteAd
 		return
 	}
 
-	// Build pack with requested objects
-	pack := PackMessage{
-		Commits: make([]model.TinCommit, 0),
-		Threads: make([]model.Thread, 0),
-	}
-
-	// Handle legacy thread ID requests (load latest version)
-	for _, threadID := range want.ThreadIDs {
-		thread, err := repo.LoadThread(threadID)
-		if err != nil {
-			log.Printf("[%s] thread not found: %s", remoteAddr, threadID)
-			continue
-		}
-		pack.Threads = append(pack.Threads, *thread)
-	}
-
-	// Handle specific version requests
-	for _, versionRef := range want.ThreadVersions {
-		thread, err := repo.LoadThreadVersion(versionRef.ThreadID, versionRef.ContentHash)
-		if err != nil {
-			log.Printf("[%s] thread version not found: %s@%s", remoteAddr, versionRef.ThreadID, versionRef.ContentHash[:8])
-			continue
-		}
-		pack.Threads = append(pack.Threads, *thread)
-	}
-
-	for _, commitID := range want.CommitIDs {
-		commit, err := repo.LoadCommit(commitID)
-		if err != nil {
-			log.Printf("[%s] commit not found: %s", remoteAddr, commitID)
-			continue
+	// Send requested objects
+	stats, err := sendWantedObjects(pc, repo, &want, sess, "["+remoteAddr+"]")
+	if err != nil {
+		var errMsg *ErrorMessage
+		if errors.As(err, &errMsg) {
+			pc.SendError(errMsg.Code, errMsg.Message)
 		}
-		pack.Commits = append(pack.Commits, *commit)
-	}
-
-	if err := pc.Send(MsgPack, pack); err != nil {
 		log.Printf("[%s] failed to send pack: %v", remoteAddr, err)
 		return
 	}
 
-	log.Printf("[%s] sent %d threads, %d commits", remoteAddr, len(pack.Threads), len(pack.Commits))
+	log.Printf("[%s] sent %d threads, %d commits", remoteAddr, stats.Threads, stats.Commits)
 
 	// Wait for OK
 	msg, err = pc.Receive()
@@ -359,7 +422,7 @@ func (s *Server) handlePull(pc *ProtocolConn, repo *storage.Repository, remoteAd
 	}
 }
 
-func buildRefsMessage(repo *storage.Repository) (*RefsMessage, error) {
+func buildRefsMessage(repo *storage.Repository, sess *session) (*RefsMessage, error) {
 	refs := &RefsMessage{
 		Branches:       make(map[string]string),
 		CommitIDs:      make([]string, 0),
@@ -367,6 +430,12 @@ func buildRefsMessage(repo *storage.Repository) (*RefsMessage, error) {
 		ThreadVersions: make(map[string][]string),
 	}
 
+	// v1 clients don't know about negotiation; leave the fields unset for them
+	if sess.version >= 2 {
+		refs.Version = sess.version
+		refs.Capabilities = sess.caps.List()
+	}
+
 	// Get HEAD
 	head, err := repo.ReadHead()
 	if err == nil {
@@ -384,6 +453,11 @@ func buildRefsMessage(repo *storage.Repository) (*RefsMessage, error) {
 		}
 	}
 
+	// With have-want negotiation the client asks about objects instead
+	if sess.caps.Has(CapHaveWant) {
+		return refs, nil
+	}
+
 	// Get all commit IDs
 	commits, err := repo.ListCommits()
 	if err == nil {
@@ -409,29 +483,147 @@ func buildRefsMessage(repo *storage.Repository) (*RefsMessage, error) {
 	return refs, nil
 }
 
-// isAncestor checks if ancestorID is an ancestor of commitID
-func isAncestor(repo *storage.Repository, ancestorID, commitID string) bool {
-	if ancestorID == commitID {
-		return true
+// receiveAfterHaves answers any have messages from the client and returns the
+// first message that is not a have
+func receiveAfterHaves(pc *ProtocolConn, repo *storage.Repository) (*Message, error) {
+	for {
+		msg, err := pc.Receive()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != MsgHave {
+			return msg, nil
+		}
+		if err := answerHave(pc, repo, msg); err != nil {
+			sendError(pc, err)
+			return nil, err
+		}
 	}
+}
 
-	// Walk back from commitID looking for ancestorID
-	current := commitID
-	for current != "" {
-		commit, err := repo.LoadCommit(current)
-		if err != nil {
-			return false
+// applyRefUpdates applies the branch updates from a push and returns the branches
+// that were written. Protected branches refuse non-fast-forward updates even
+// when forced. With the multi-ref capability all updates are checked before
+// any is written, so a rejected update leaves every branch untouched. Branches
+// are processed in sorted order so results are deterministic. The repository's
+// pre-receive and update hooks can reject updates; post-receive and webhooks
+// run once the accepted updates are written. If repo is a quarantine view,
+// the pushed objects are moved into the repository once pre-receive accepts
+// the push.
+func applyRefUpdates(repo *storage.Repository, updateRefs *UpdateRefsMessage, sess *session) ([]string, *ErrorMessage) {
+	branches := make([]string, 0, len(updateRefs.Updates))
+	for branch := range updateRefs.Updates {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+
+	// Never point a branch at a commit the server doesn't have
+	updates := make([]RefUpdate, 0, len(branches))
+	for _, branch := range branches {
+		target := updateRefs.Updates[branch]
+		if !repo.HasCommit(target) {
+			return nil, &ErrorMessage{
+				Code:    ErrCodeMissingObject,
+				Message: fmt.Sprintf("cannot update %s: commit %s not found", branch, shortID(target)),
+			}
 		}
-		if commit.ParentCommitID == ancestorID {
-			return true
+		current, _ := repo.ReadBranch(branch)
+		update := RefUpdate{Branch: branch, Old: current, New: target}
+		update.Force = current != "" && !isAncestor(repo, current, target)
+		updates = append(updates, update)
+	}
+
+	checkUpdate := func(update RefUpdate) *ErrorMessage {
+		if !update.Force {
+			return nil
+		}
+		if sess.isProtected(update.Branch) {
+			return &ErrorMessage{
+				Code:    ErrCodeProtectedBranch,
+				Message: fmt.Sprintf("branch %s is protected: non-fast-forward updates are not allowed", update.Branch),
+			}
 		}
-		current = commit.ParentCommitID
+		if updateRefs.Force {
+			return nil
+		}
+		return &ErrorMessage{
+			Code:    ErrCodeNotFastForward,
+			Message: fmt.Sprintf("non-fast-forward update rejected for %s (use --force)", update.Branch),
+		}
+	}
+
+	atomic := sess.caps.Has(CapMultiRef)
+	if atomic {
+		for _, update := range updates {
+			if errMsg := checkUpdate(update); errMsg != nil {
+				return nil, errMsg
+			}
+		}
+	}
+
+	// Hooks and webhooks describe the commits each update adds, so note
+	// them before any branch moves
+	hooks := newPushHooks(repo, sess.user)
+	var webhooks []storage.WebhookConfig
+	if config, err := repo.ReadConfig(); err == nil {
+		webhooks = config.Webhooks
+	}
+	if len(webhooks) > 0 || hooks.hasHooks() {
+		if err := hooks.prepare(updates); err != nil {
+			return nil, &ErrorMessage{Code: ErrCodeInternal, Message: "failed to read history: " + err.Error()}
+		}
+	}
+
+	if errMsg := hooks.preReceive(updates); errMsg != nil {
+		return nil, errMsg
+	}
+	if err := repo.AcceptQuarantine(); err != nil {
+		return nil, &ErrorMessage{Code: ErrCodeInternal, Message: "failed to store pack: " + err.Error()}
 	}
 
-	return false
+	var applied []string
+	var done []RefUpdate
+	defer func() {
+		hooks.postReceive(done)
+		notifyWebhooks(webhooks, hooks, sess.repo, done)
+	}()
+	for _, update := range updates {
+		if !atomic {
+			if errMsg := checkUpdate(update); errMsg != nil {
+				return applied, errMsg
+			}
+		}
+		if errMsg := hooks.update(update, updates); errMsg != nil {
+			return applied, errMsg
+		}
+		if err := repo.WriteBranch(update.Branch, update.New); err != nil {
+			return applied, &ErrorMessage{Code: ErrCodeInternal, Message: "failed to update ref: " + err.Error()}
+		}
+		applied = append(applied, update.Branch)
+		done = append(done, update)
+	}
+
+	return applied, nil
+}
+
+// shortID abbreviates an object ID for logging
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
 }
 
-func (s *Server) handleConfig(pc *ProtocolConn, repo *storage.Repository, remoteAddr string) {
+// isAncestor checks if ancestorID is an ancestor of commitID, following both
+// parents of merge commits
+func isAncestor(repo *storage.Repository, ancestorID, commitID string) bool {
+	if ancestorID == commitID {
+		return true
+	}
+	return repo.ReachableCommits(commitID)[ancestorID] != nil
+}
+
+func (s *Server) handleConfig(pc *ProtocolConn, repo *storage.Repository, remoteAddr string, sess *session) {
 	// Read config message (get or set)
 	msg, err := pc.Receive()
 	if err != nil {
@@ -456,6 +648,11 @@ func (s *Server) handleConfig(pc *ProtocolConn, repo *storage.Repository, remote
 		log.Printf("[%s] sent config", remoteAddr)
 
 	case MsgSetConfig:
+		if sess.perm < PermAdmin {
+			pc.SendError(ErrCodeForbidden, "changing config requires admin permission")
+			return
+		}
+
 		var setConfig SetConfigMessage
 		if err := msg.DecodePayload(&setConfig); err != nil {
 			pc.SendError(ErrCodeInvalidRequest, "invalid set-config payload")
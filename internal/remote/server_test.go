@@ -0,0 +1,645 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// newTestRepo creates an empty bare repository to act as a client-side repo
+func newTestRepo(t *testing.T) *storage.Repository {
+	t.Helper()
+	repo, err := storage.InitBare(filepath.Join(t.TempDir(), "local.tin"))
+	if err != nil {
+		t.Fatalf("InitBare failed: %v", err)
+	}
+	return repo
+}
+
+// addTestCommit creates a thread and a commit referencing it on the given branch
+func addTestCommit(t *testing.T, repo *storage.Repository, branch, content string) *model.TinCommit {
+	t.Helper()
+
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, content, "", nil))
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "done: "+content, "", nil))
+	if err := repo.SaveThread(thread); err != nil {
+		t.Fatalf("SaveThread failed: %v", err)
+	}
+
+	parent, _ := repo.ReadBranch(branch)
+	refs := []model.ThreadRef{{
+		ThreadID:     thread.ID,
+		MessageCount: len(thread.Messages),
+		ContentHash:  thread.ComputeContentHash(),
+	}}
+	commit := model.NewTinCommit(content, refs, "", parent)
+	if err := repo.SaveCommit(commit); err != nil {
+		t.Fatalf("SaveCommit failed: %v", err)
+	}
+	if err := repo.WriteBranch(branch, commit.ID); err != nil {
+		t.Fatalf("WriteBranch failed: %v", err)
+	}
+	return commit
+}
+
+// startTCPServer serves repositories under a temp root over TCP.
+// It returns the root path and a URL prefix to which a repo path can be appended.
+func startTCPServer(t *testing.T, configure func(*Server)) (string, string) {
+	t.Helper()
+	// Test servers are plaintext; let clients authenticate to them
+	t.Setenv(EnvInsecureAuth, "1")
+	root := t.TempDir()
+	server := NewMultiRepoServer("127.0.0.1", 0, root, true)
+	if configure != nil {
+		configure(server)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Stop() })
+
+	return root, listener.Addr().String()
+}
+
+// startLegacyTCPServer emulates a server that predates protocol negotiation:
+// it refuses any hello whose version is not exactly 1.
+func startLegacyTCPServer(t *testing.T) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	server := NewMultiRepoServer("127.0.0.1", 0, root, true)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				pc := NewProtocolConn(conn)
+				msg, err := pc.Receive()
+				if err != nil {
+					return
+				}
+				var hello HelloMessage
+				msg.DecodePayload(&hello)
+				if hello.Version != 1 {
+					pc.SendError(ErrCodeProtocolVersion, fmt.Sprintf("unsupported protocol version: %d", hello.Version))
+					return
+				}
+
+				repoPath, err := server.resolveRepoPath(hello.RepoPath)
+				if err != nil {
+					pc.SendError(ErrCodeInvalidRequest, err.Error())
+					return
+				}
+				repo, err := storage.OpenBare(repoPath)
+				if err != nil {
+					repo, err = storage.InitBare(repoPath)
+					if err != nil {
+						pc.SendError(ErrCodeInternal, err.Error())
+						return
+					}
+				}
+
+				sess := &session{version: 1, caps: make(CapabilitySet), perm: PermAdmin}
+				switch hello.Operation {
+				case "push":
+					server.handlePush(pc, repo, "legacy", sess)
+				case "pull":
+					server.handlePull(pc, repo, "legacy", sess)
+				case "config":
+					server.handleConfig(pc, repo, "legacy", sess)
+				}
+			}(conn)
+		}
+	}()
+
+	return root, listener.Addr().String()
+}
+
+// startHTTPServer serves repositories under a temp root over HTTP
+func startHTTPServer(t *testing.T, configure func(*HTTPHandler)) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	handler := NewHTTPHandler(root, true, nil)
+	if configure != nil {
+		configure(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return root, server.URL
+}
+
+// testAuthValidator accepts the credentials dialTest connects with, so that
+// servers know the pushing user
+func testAuthValidator() AuthValidator {
+	return NewTokenAuthValidator(map[string]string{"alice": "secret"})
+}
+
+// dialTest connects a client, optionally configured as an older or restricted peer
+func dialTest(t *testing.T, url string, configure func(*Client)) *Client {
+	t.Helper()
+	client, err := Dial(url, &Credentials{Username: "alice", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Dial(%s) failed: %v", url, err)
+	}
+	if configure != nil {
+		configure(client)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func v1Client(c *Client) {
+	c.version = 1
+}
+
+func noCapsClient(c *Client) {
+	c.capabilities = nil
+}
+
+type testPeer struct {
+	name  string
+	start func(t *testing.T) (root, url string)
+}
+
+func testServers() []testPeer {
+	return []testPeer{
+		{"tcp-v2", func(t *testing.T) (string, string) {
+			root, addr := startTCPServer(t, nil)
+			return root, addr + "/proj.tin"
+		}},
+		{"tcp-v2-nocaps", func(t *testing.T) (string, string) {
+			root, addr := startTCPServer(t, func(s *Server) { s.SetCapabilities(nil) })
+			return root, addr + "/proj.tin"
+		}},
+		{"tcp-v1", func(t *testing.T) (string, string) {
+			root, addr := startLegacyTCPServer(t)
+			return root, addr + "/proj.tin"
+		}},
+		{"http-v2", func(t *testing.T) (string, string) {
+			root, url := startHTTPServer(t, nil)
+			return root, url + "/proj.tin"
+		}},
+		{"http-v2-nocaps", func(t *testing.T) (string, string) {
+			root, url := startHTTPServer(t, func(h *HTTPHandler) { h.SetCapabilities(nil) })
+			return root, url + "/proj.tin"
+		}},
+		{"http-v1", func(t *testing.T) (string, string) {
+			// A v1 HTTP server ignores the negotiation headers entirely
+			root, url := startHTTPServer(t, func(h *HTTPHandler) { h.version = 1 })
+			return root, url + "/proj.tin"
+		}},
+	}
+}
+
+type testClient struct {
+	name      string
+	configure func(*Client)
+}
+
+func testClients() []testClient {
+	return []testClient{
+		{"v2", nil},
+		{"v2-nocaps", noCapsClient},
+		{"v1", v1Client},
+	}
+}
+
+// expectedCaps returns the capabilities a client/server pair should agree on
+func expectedCaps(server, client string) []string {
+	if strings.HasSuffix(server, "-v1") || strings.HasSuffix(server, "nocaps") || client != "v2" {
+		return []string{}
+	}
+	return NewCapabilitySet(SupportedCapabilities()).List()
+}
+
+func TestProtocol_PushPullMatrix(t *testing.T) {
+	for _, srv := range testServers() {
+		for _, cli := range testClients() {
+			t.Run(srv.name+"/client-"+cli.name, func(t *testing.T) {
+				root, url := srv.start(t)
+
+				local := newTestRepo(t)
+				addTestCommit(t, local, "main", "first")
+				tip := addTestCommit(t, local, "main", "second")
+
+				pusher := dialTest(t, url, cli.configure)
+				if err := pusher.Push(local, "main", false); err != nil {
+					t.Fatalf("Push failed: %v", err)
+				}
+				if got := pusher.Capabilities(); !reflect.DeepEqual(got, expectedCaps(srv.name, cli.name)) {
+					t.Errorf("negotiated capabilities = %v, want %v", got, expectedCaps(srv.name, cli.name))
+				}
+
+				bare, err := storage.OpenBare(filepath.Join(root, "proj.tin"))
+				if err != nil {
+					t.Fatalf("server repo not created: %v", err)
+				}
+				if got, _ := bare.ReadBranch("main"); got != tip.ID {
+					t.Errorf("server main = %s, want %s", got, tip.ID)
+				}
+
+				clone := newTestRepo(t)
+				puller := dialTest(t, url, cli.configure)
+				refs, err := puller.Pull(clone, "main")
+				if err != nil {
+					t.Fatalf("Pull failed: %v", err)
+				}
+				if refs.Branches["main"] != tip.ID {
+					t.Errorf("pulled refs main = %s, want %s", refs.Branches["main"], tip.ID)
+				}
+				history, _ := clone.GetCommitHistory(tip.ID, 0)
+				if len(history) != 2 {
+					t.Errorf("pulled %d commits, want 2", len(history))
+				}
+				for _, commit := range history {
+					for _, ref := range commit.Threads {
+						if !clone.HasThreadVersion(ref.ThreadID, ref.ContentHash) {
+							t.Errorf("missing thread version %s@%s", ref.ThreadID, ref.ContentHash)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestProtocol_ConfigMatrix(t *testing.T) {
+	for _, srv := range testServers() {
+		for _, cli := range testClients() {
+			t.Run(srv.name+"/client-"+cli.name, func(t *testing.T) {
+				root, url := srv.start(t)
+				if _, err := storage.InitBare(filepath.Join(root, "proj.tin")); err != nil {
+					t.Fatalf("InitBare failed: %v", err)
+				}
+
+				setter := dialTest(t, url, cli.configure)
+				if err := setter.SetConfig(&SetConfigMessage{CodeHostURL: "https://github.com/acme/proj"}); err != nil {
+					t.Fatalf("SetConfig failed: %v", err)
+				}
+
+				getter := dialTest(t, url, cli.configure)
+				config, err := getter.GetConfig()
+				if err != nil {
+					t.Fatalf("GetConfig failed: %v", err)
+				}
+				if config.CodeHostURL != "https://github.com/acme/proj" {
+					t.Errorf("CodeHostURL = %q", config.CodeHostURL)
+				}
+			})
+		}
+	}
+}
+
+func TestProtocol_V2ClientFallsBackForLegacyServer(t *testing.T) {
+	_, addr := startLegacyTCPServer(t)
+
+	local := newTestRepo(t)
+	addTestCommit(t, local, "main", "hello")
+
+	client := dialTest(t, addr+"/proj.tin", nil)
+	if err := client.Push(local, "main", false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if client.Version() != 1 {
+		t.Errorf("client version = %d after fallback, want 1", client.Version())
+	}
+}
+
+func TestProtocol_RejectsTooOldVersion(t *testing.T) {
+	_, addr := startTCPServer(t, nil)
+
+	client := dialTest(t, addr+"/proj.tin", func(c *Client) { c.version = 0 })
+	err := client.Push(newTestRepo(t), "main", false)
+	if err == nil || !strings.Contains(err.Error(), "unsupported protocol version") {
+		t.Fatalf("expected protocol version error, got %v", err)
+	}
+}
+
+func TestProtocol_AcceptsNewerClient(t *testing.T) {
+	sess, err := negotiateSession(ProtocolVersion+5, []string{CapMultiRef, "from-the-future"}, ProtocolVersion, SupportedCapabilities())
+	if err != nil {
+		t.Fatalf("negotiateSession failed: %v", err)
+	}
+	if sess.version != ProtocolVersion {
+		t.Errorf("version = %d, want %d", sess.version, ProtocolVersion)
+	}
+	if !reflect.DeepEqual(sess.caps.List(), []string{CapMultiRef}) {
+		t.Errorf("caps = %v, want [%s]", sess.caps.List(), CapMultiRef)
+	}
+}
+
+func TestProtocol_StreamedPushSplitsHTTPRequests(t *testing.T) {
+	root := t.TempDir()
+	var pushRequests int
+	handler := NewHTTPHandler(root, true, nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/tin-receive-pack") {
+			pushRequests++
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	local := newTestRepo(t)
+	var tip *model.TinCommit
+	for i := 0; i < 10; i++ {
+		tip = addTestCommit(t, local, "main", fmt.Sprintf("commit %d %s", i, strings.Repeat("x", 400)))
+	}
+
+	client := dialTest(t, server.URL+"/proj.tin", func(c *Client) {
+		c.transport.(*HTTPSTransport).MaxRequestBytes = 1024
+	})
+	var events []Progress
+	client.SetProgress(func(p Progress) { events = append(events, p) })
+	if err := client.Push(local, "main", false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	// One refs request plus several pack chunks
+	if pushRequests < 4 {
+		t.Errorf("push used %d requests, expected the pack to be split", pushRequests)
+	}
+	if len(events) != 20 || events[len(events)-1].Objects != 20 || events[0].Total != 20 {
+		t.Errorf("unexpected progress events: %+v", events)
+	}
+
+	bare, _ := storage.OpenBare(filepath.Join(root, "proj.tin"))
+	history, _ := bare.GetCommitHistory(tip.ID, 0)
+	if len(history) != 10 {
+		t.Errorf("server has %d commits, want 10", len(history))
+	}
+}
+
+func TestProtocol_SplitPushQuarantinedUntilAccepted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+	root, url := startHTTPServer(t, nil)
+	bare, err := storage.InitBare(filepath.Join(root, "proj.tin"))
+	if err != nil {
+		t.Fatalf("InitBare failed: %v", err)
+	}
+	installHook(t, bare, HookPreReceive, "exit 1\n")
+
+	local := newTestRepo(t)
+	var commits []*model.TinCommit
+	for i := 0; i < 10; i++ {
+		commits = append(commits, addTestCommit(t, local, "main", fmt.Sprintf("commit %d %s", i, strings.Repeat("x", 400))))
+	}
+	push := func() error {
+		return dialTest(t, url+"/proj.tin", func(c *Client) {
+			c.transport.(*HTTPSTransport).MaxRequestBytes = 1024
+		}).Push(local, "main", false)
+	}
+
+	// Chunks sent before pre-receive rejected the push are discarded too
+	if err := push(); err == nil {
+		t.Fatal("expected pre-receive to reject the push")
+	}
+	for _, c := range commits {
+		if bare.HasCommit(c.ID) {
+			t.Fatalf("commit %s of the rejected push was stored", shortID(c.ID))
+		}
+	}
+
+	os.Remove(filepath.Join(bare.RootPath, HooksDir, HookPreReceive))
+	if err := push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if history, _ := bare.GetCommitHistory(commits[9].ID, 0); len(history) != 10 {
+		t.Errorf("server has %d commits, want 10", len(history))
+	}
+	if entries, _ := os.ReadDir(filepath.Join(bare.TinPath, storage.QuarantineDir)); len(entries) != 0 {
+		t.Errorf("quarantine left behind: %v", entries)
+	}
+}
+
+func TestProtocol_StreamedPullReportsProgress(t *testing.T) {
+	for _, srv := range testServers() {
+		if !strings.HasSuffix(srv.name, "-v2") {
+			continue
+		}
+		t.Run(srv.name, func(t *testing.T) {
+			_, url := srv.start(t)
+
+			local := newTestRepo(t)
+			addTestCommit(t, local, "main", "one")
+			addTestCommit(t, local, "main", "two")
+			if err := dialTest(t, url, nil).Push(local, "main", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+
+			clone := newTestRepo(t)
+			client := dialTest(t, url, nil)
+			var last Progress
+			client.SetProgress(func(p Progress) { last = p })
+			if _, err := client.Pull(clone, "main"); err != nil {
+				t.Fatalf("Pull failed: %v", err)
+			}
+			if last.Phase != "receiving" || last.Objects == 0 || last.Objects != last.Total {
+				t.Errorf("unexpected final progress: %+v", last)
+			}
+		})
+	}
+}
+
+func TestEncodeObject_Compression(t *testing.T) {
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, strings.Repeat("compress me ", 500), "", nil))
+
+	plain, err := encodeObject(ObjectThread, thread, false)
+	if err != nil {
+		t.Fatalf("encodeObject failed: %v", err)
+	}
+	packed, err := encodeObject(ObjectThread, thread, true)
+	if err != nil {
+		t.Fatalf("encodeObject failed: %v", err)
+	}
+	if packed.Encoding != "gzip" || len(packed.Data) >= len(plain.Object) {
+		t.Errorf("expected gzip payload smaller than %d bytes, got %s/%d", len(plain.Object), packed.Encoding, len(packed.Data))
+	}
+
+	for _, obj := range []*ObjectMessage{plain, packed} {
+		var decoded model.Thread
+		if err := decodeObject(obj, &decoded); err != nil {
+			t.Fatalf("decodeObject failed: %v", err)
+		}
+		if decoded.ComputeContentHash() != thread.ComputeContentHash() {
+			t.Errorf("decoded thread differs from original (encoding %q)", obj.Encoding)
+		}
+	}
+
+	if err := decodeObject(&ObjectMessage{Kind: ObjectThread, Encoding: "zstd"}, &model.Thread{}); err == nil {
+		t.Error("expected error for unsupported encoding")
+	}
+}
+
+func TestProtocol_MultiRefPush(t *testing.T) {
+	transports := []struct {
+		name  string
+		start func(t *testing.T, caps []string) (string, string)
+	}{
+		{"tcp", func(t *testing.T, caps []string) (string, string) {
+			root, addr := startTCPServer(t, func(s *Server) { s.SetCapabilities(caps) })
+			return root, addr + "/proj.tin"
+		}},
+		{"http", func(t *testing.T, caps []string) (string, string) {
+			root, url := startHTTPServer(t, func(h *HTTPHandler) { h.SetCapabilities(caps) })
+			return root, url + "/proj.tin"
+		}},
+	}
+
+	for _, tr := range transports {
+		for _, multiRef := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/multi-ref=%v", tr.name, multiRef), func(t *testing.T) {
+				var caps []string
+				if multiRef {
+					caps = []string{CapMultiRef}
+				}
+				root, url := tr.start(t, caps)
+
+				local := newTestRepo(t)
+				addTestCommit(t, local, "main", "base")
+				addTestCommit(t, local, "feature", "feature work")
+
+				client := dialTest(t, url, nil)
+				if err := client.PushBranches(local, []string{"main", "feature"}, false); err != nil {
+					t.Fatalf("PushBranches failed: %v", err)
+				}
+
+				bare, _ := storage.OpenBare(filepath.Join(root, "proj.tin"))
+				for _, branch := range []string{"main", "feature"} {
+					want, _ := local.ReadBranch(branch)
+					if got, _ := bare.ReadBranch(branch); got != want {
+						t.Errorf("server %s = %s, want %s", branch, got, want)
+					}
+				}
+
+				// Rewrite "feature" so it no longer fast-forwards, and advance "main"
+				local.WriteBranch("feature", "")
+				addTestCommit(t, local, "feature", "rewritten")
+				newMain := addTestCommit(t, local, "main", "more work")
+				oldFeature, _ := bare.ReadBranch("feature")
+
+				client = dialTest(t, url, nil)
+				err := client.PushBranches(local, []string{"main", "feature"}, false)
+				if err == nil || !strings.Contains(err.Error(), "non-fast-forward") {
+					t.Fatalf("expected non-fast-forward rejection, got %v", err)
+				}
+
+				gotMain, _ := bare.ReadBranch("main")
+				if multiRef && gotMain == newMain.ID {
+					t.Errorf("multi-ref push updated main despite rejected feature update")
+				}
+				if !multiRef && gotMain != newMain.ID {
+					t.Errorf("per-branch push should have updated main before feature was rejected")
+				}
+				if got, _ := bare.ReadBranch("feature"); got != oldFeature {
+					t.Errorf("feature was updated by rejected push")
+				}
+			})
+		}
+	}
+}
+
+func TestProtocol_HaveWantTransfersOnlyMissing(t *testing.T) {
+	for _, srv := range testServers() {
+		if !strings.HasSuffix(srv.name, "-v2") {
+			continue
+		}
+		t.Run(srv.name, func(t *testing.T) {
+			_, url := srv.start(t)
+
+			local := newTestRepo(t)
+			for i := 0; i < 3; i++ {
+				addTestCommit(t, local, "main", fmt.Sprintf("base %d", i))
+			}
+			if err := dialTest(t, url, nil).Push(local, "main", false); err != nil {
+				t.Fatalf("initial Push failed: %v", err)
+			}
+
+			clone := newTestRepo(t)
+			refs, err := dialTest(t, url, nil).Pull(clone, "main")
+			if err != nil {
+				t.Fatalf("initial Pull failed: %v", err)
+			}
+			if len(refs.CommitIDs) != 0 || len(refs.ThreadIDs) != 0 {
+				t.Errorf("refs advertised %d commits, %d threads; want none with have-want", len(refs.CommitIDs), len(refs.ThreadIDs))
+			}
+
+			// Diverge on a feature branch and merge it back, so the new history
+			// includes a second parent
+			base, _ := local.ReadBranch("main")
+			local.WriteBranch("feature", base)
+			feature := addTestCommit(t, local, "feature", "feature work")
+			main := addTestCommit(t, local, "main", "main work")
+			merge := model.NewMergeCommit("merge", nil, "", main.ID, feature.ID)
+			if err := local.SaveCommit(merge); err != nil {
+				t.Fatalf("SaveCommit failed: %v", err)
+			}
+			local.WriteBranch("main", merge.ID)
+
+			// 3 new commits + 2 new thread versions
+			pusher := dialTest(t, url, nil)
+			var pushed Progress
+			pusher.SetProgress(func(p Progress) { pushed = p })
+			if err := pusher.Push(local, "main", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+			if pushed.Total != 5 {
+				t.Errorf("push sent %d objects, want 5", pushed.Total)
+			}
+
+			puller := dialTest(t, url, nil)
+			var pulled Progress
+			puller.SetProgress(func(p Progress) { pulled = p })
+			if _, err := puller.Pull(clone, "main"); err != nil {
+				t.Fatalf("Pull failed: %v", err)
+			}
+			if pulled.Total != 5 {
+				t.Errorf("pull received %d objects, want 5", pulled.Total)
+			}
+			for _, id := range []string{feature.ID, main.ID, merge.ID} {
+				if !clone.HasCommit(id) {
+					t.Errorf("clone is missing commit %s", shortID(id))
+				}
+			}
+		})
+	}
+}
+
+func TestAnswerHave_RejectsOversizedBatch(t *testing.T) {
+	payload, _ := json.Marshal(HaveMessage{CommitIDs: make([]string, maxHavesPerMessage+1)})
+	var out bytes.Buffer
+	err := answerHave(NewProtocolConnFromHTTP(strings.NewReader(""), &out), newTestRepo(t), &Message{Type: MsgHave, Payload: payload})
+	if err == nil || out.Len() != 0 {
+		t.Errorf("expected oversized have to be rejected without a reply, got err=%v reply=%q", err, out.String())
+	}
+}
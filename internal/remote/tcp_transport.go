@@ -1,37 +1,81 @@
 package remote
 
 import (
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
+	"os"
 )
 
+// EnvInsecureAuth, set to 1, sends credentials over plaintext tin://
+// connections, where anyone on the path can read them
+const EnvInsecureAuth = "TIN_INSECURE_AUTH"
+
 // TCPTransport implements Transport over a raw TCP connection
 type TCPTransport struct {
-	conn net.Conn
-	pc   *ProtocolConn
+	conn     net.Conn
+	pc       *ProtocolConn
+	creds    *Credentials
+	secure   bool // Credentials may be sent
+	withheld bool // Credentials were not sent over a plaintext connection
 }
 
-// NewTCPTransport creates a new TCP transport connected to the given URL
-func NewTCPTransport(url *ParsedURL) (*TCPTransport, error) {
-	conn, err := net.Dial("tcp", url.Address())
+// NewTCPTransport creates a new TCP transport connected to the given URL.
+// If creds is non-nil they are sent in the hello message, but only over
+// tin+tls:// connections unless TIN_INSECURE_AUTH=1. tin+tls:// URLs
+// connect over TLS, configured by ClientTLSConfig.
+func NewTCPTransport(url *ParsedURL, creds *Credentials) (*TCPTransport, error) {
+	var conn net.Conn
+	var err error
+	if url.UseTLS() {
+		cfg, cfgErr := ClientTLSConfig(url.Host)
+		if cfgErr != nil {
+			return nil, cfgErr
+		}
+		conn, err = tls.Dial("tcp", url.Address(), cfg)
+	} else {
+		conn, err = net.Dial("tcp", url.Address())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to %s: %w", url.Address(), err)
 	}
 
 	return &TCPTransport{
-		conn: conn,
-		pc:   NewProtocolConn(conn),
+		conn:   conn,
+		pc:     NewProtocolConn(conn),
+		creds:  creds,
+		secure: url.UseTLS() || os.Getenv(EnvInsecureAuth) == "1",
 	}, nil
 }
 
-// Send sends a message with the given type and payload
+// Send sends a message with the given type and payload.
+// Credentials are attached to the hello message here, at the transport layer.
 func (t *TCPTransport) Send(msgType MessageType, payload any) error {
+	if hello, ok := payload.(HelloMessage); ok && t.creds != nil && t.creds.Password != "" && hello.Auth == nil {
+		if !t.secure {
+			t.withheld = true
+		} else {
+			hello.Auth = &AuthInfo{Type: "basic", Username: t.creds.Username, Token: t.creds.Password}
+			payload = hello
+		}
+	}
 	return t.pc.Send(msgType, payload)
 }
 
-// Receive reads and returns the next message
+// Receive reads and returns the next message. If the server wanted the
+// credentials that were withheld, its error says why they were not sent.
 func (t *TCPTransport) Receive() (*Message, error) {
-	return t.pc.Receive()
+	msg, err := t.pc.Receive()
+	if err != nil || !t.withheld || msg.Type != MsgError {
+		return msg, err
+	}
+	var errMsg ErrorMessage
+	if msg.DecodePayload(&errMsg) == nil && errMsg.Code == ErrCodeUnauthorized {
+		errMsg.Message += fmt.Sprintf(" (credentials are only sent over tin+tls://; set %s=1 to send them over tin://)", EnvInsecureAuth)
+		msg.Payload, _ = json.Marshal(errMsg)
+	}
+	return msg, nil
 }
 
 // Close closes the TCP connection
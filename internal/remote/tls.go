@@ -0,0 +1,137 @@
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Environment variables configuring the client side of TLS connections
+// (tin+tls:// and https:// remotes)
+const (
+	EnvTLSCA   = "TIN_TLS_CA"   // PEM bundle of CAs to trust in addition to the system pool
+	EnvTLSCert = "TIN_TLS_CERT" // client certificate for mutual TLS
+	EnvTLSKey  = "TIN_TLS_KEY"  // private key for TIN_TLS_CERT
+)
+
+// ClientTLSConfig builds the TLS configuration used to dial a server,
+// honoring TIN_TLS_CA, TIN_TLS_CERT and TIN_TLS_KEY
+func ClientTLSConfig(serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile := os.Getenv(EnvTLSCA); caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if err := appendCertsFromFile(pool, caFile); err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	certFile, keyFile := os.Getenv(EnvTLSCert), os.Getenv(EnvTLSKey)
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("%s and %s must be set together", EnvTLSCert, EnvTLSKey)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// ServerTLSOptions configures TLS for tin serve and tin serve-http
+type ServerTLSOptions struct {
+	CertFile string // server certificate (PEM)
+	KeyFile  string // server private key (PEM)
+
+	// ClientCAFile enables client certificate authentication: certificates
+	// signed by these CAs identify the user. Clients without a certificate
+	// fall back to password auth unless RequireClientCert is set.
+	ClientCAFile      string
+	RequireClientCert bool
+}
+
+// Enabled reports whether TLS was requested. Client certificate options
+// request it too, so that Config reports a missing certificate rather than
+// the options being ignored.
+func (o ServerTLSOptions) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.ClientCAFile != "" || o.RequireClientCert
+}
+
+// Config builds the server TLS configuration
+func (o ServerTLSOptions) Config() (*tls.Config, error) {
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, fmt.Errorf("both a TLS certificate and key are required")
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if o.ClientCAFile != "" {
+		pool := x509.NewCertPool()
+		if err := appendCertsFromFile(pool, o.ClientCAFile); err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if o.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if o.RequireClientCert {
+		return nil, fmt.Errorf("requiring client certificates needs a client CA")
+	}
+
+	return cfg, nil
+}
+
+func appendCertsFromFile(pool *x509.CertPool, filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in %s", filename)
+	}
+	return nil
+}
+
+// CertValidator maps a verified client certificate to a user ID, like
+// AuthValidator does for passwords
+type CertValidator interface {
+	ValidateCert(cert *x509.Certificate) (userID string, valid bool)
+}
+
+// CommonNameCertValidator identifies users by the certificate's subject common name
+type CommonNameCertValidator struct{}
+
+func (v *CommonNameCertValidator) ValidateCert(cert *x509.Certificate) (string, bool) {
+	if cert.Subject.CommonName == "" {
+		return "", false
+	}
+	return cert.Subject.CommonName, true
+}
+
+// CertUser returns the user identified by a verified client certificate.
+// ok is false if the connection carries no verified certificate.
+func CertUser(validator CertValidator, state *tls.ConnectionState) (userID string, ok bool) {
+	if validator == nil || state == nil || len(state.VerifiedChains) == 0 {
+		return "", false
+	}
+	return validator.ValidateCert(state.VerifiedChains[0][0])
+}
@@ -0,0 +1,231 @@
+package remote
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPKI is a throwaway CA with a server certificate for 127.0.0.1
+// and a client certificate for "alice", written as PEM files
+type testPKI struct {
+	caFile, serverCert, serverKey, clientCert, clientKey string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tin test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage, ips []net.IP) (string, string) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  ips,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatalf("CreateCertificate failed: %v", err)
+		}
+		keyDER, _ := x509.MarshalECPrivateKey(key)
+		certFile := writePEM(t, dir, name+".pem", "CERTIFICATE", der)
+		keyFile := writePEM(t, dir, name+".key", "EC PRIVATE KEY", keyDER)
+		return certFile, keyFile
+	}
+
+	pki := &testPKI{caFile: writePEM(t, dir, "ca.pem", "CERTIFICATE", caDER)}
+	pki.serverCert, pki.serverKey = issue("server", 2, x509.ExtKeyUsageServerAuth, []net.IP{net.ParseIP("127.0.0.1")})
+	pki.clientCert, pki.clientKey = issue("alice", 3, x509.ExtKeyUsageClientAuth, nil)
+	return pki
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func (p *testPKI) serverConfig(t *testing.T, requireClientCert bool) *tls.Config {
+	t.Helper()
+	cfg, err := ServerTLSOptions{
+		CertFile:          p.serverCert,
+		KeyFile:           p.serverKey,
+		ClientCAFile:      p.caFile,
+		RequireClientCert: requireClientCert,
+	}.Config()
+	if err != nil {
+		t.Fatalf("ServerTLSOptions.Config failed: %v", err)
+	}
+	return cfg
+}
+
+func TestParseURL_TLS(t *testing.T) {
+	u, err := ParseURL("tin+tls://example.com/repos/project.tin")
+	if err != nil {
+		t.Fatalf("ParseURL failed: %v", err)
+	}
+	if !u.UseTLS() || u.TransportType() != "tcp" || u.Port != "2323" || u.Path != "/repos/project.tin" {
+		t.Errorf("unexpected parse result: %+v", u)
+	}
+
+	plain, _ := ParseURL("tin://example.com/repos/project.tin")
+	if plain.UseTLS() {
+		t.Error("tin:// should not use TLS")
+	}
+}
+
+func TestProtocol_TLS(t *testing.T) {
+	pki := newTestPKI(t)
+	t.Setenv(EnvTLSCA, pki.caFile)
+
+	acl := &ACL{Rules: []ACLRule{{Users: []string{"alice"}, Repos: []string{"**"}, Permission: PermAdmin}}}
+
+	servers := []struct {
+		name  string
+		start func(t *testing.T, requireClientCert bool) string
+	}{
+		{"tcp", func(t *testing.T, requireClientCert bool) string {
+			_, addr := startTCPServer(t, func(s *Server) {
+				s.SetTLS(pki.serverConfig(t, requireClientCert), &CommonNameCertValidator{})
+				s.SetAuthValidator(NewTokenAuthValidator(map[string]string{"bob": "b"}))
+				s.SetACL(acl)
+			})
+			return "tin+tls://" + addr + "/proj.tin"
+		}},
+		{"http", func(t *testing.T, requireClientCert bool) string {
+			handler := NewHTTPHandler(t.TempDir(), true, NewTokenAuthValidator(map[string]string{"bob": "b"}))
+			handler.SetCertValidator(&CommonNameCertValidator{})
+			handler.SetACL(acl)
+			server := httptest.NewUnstartedServer(handler)
+			server.TLS = pki.serverConfig(t, requireClientCert)
+			server.StartTLS()
+			t.Cleanup(server.Close)
+			return server.URL + "/proj.tin"
+		}},
+	}
+
+	for _, srv := range servers {
+		t.Run(srv.name+"/client-cert", func(t *testing.T) {
+			t.Setenv(EnvTLSCert, pki.clientCert)
+			t.Setenv(EnvTLSKey, pki.clientKey)
+			url := srv.start(t, true)
+
+			// The certificate identifies alice; no password is needed
+			local := newTestRepo(t)
+			tip := addTestCommit(t, local, "main", "over tls")
+			client, err := Dial(url, nil)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer client.Close()
+			if err := client.Push(local, "main", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+
+			clone := newTestRepo(t)
+			refs, err := dialTest(t, url, nil).Pull(clone, "main")
+			if err != nil {
+				t.Fatalf("Pull failed: %v", err)
+			}
+			if refs.Branches["main"] != tip.ID {
+				t.Errorf("pulled main = %s, want %s", refs.Branches["main"], tip.ID)
+			}
+		})
+
+		t.Run(srv.name+"/client-cert-required", func(t *testing.T) {
+			url := srv.start(t, true)
+			client, err := Dial(url, &Credentials{Username: "bob", Password: "b"})
+			if err == nil {
+				defer client.Close()
+				err = client.Push(newTestRepo(t), "main", false)
+			}
+			if err == nil {
+				t.Fatal("expected connection without client certificate to fail")
+			}
+		})
+
+		t.Run(srv.name+"/password-fallback", func(t *testing.T) {
+			url := srv.start(t, false)
+			// Over TLS, credentials are sent without opting in
+			t.Setenv(EnvInsecureAuth, "")
+			local := newTestRepo(t)
+			addTestCommit(t, local, "main", "bob's work")
+
+			// bob authenticates with a password but has no ACL grant
+			client, err := Dial(url, &Credentials{Username: "bob", Password: "b"})
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer client.Close()
+			err = client.Push(local, "main", false)
+			if err == nil || !strings.Contains(err.Error(), "permission") {
+				t.Errorf("expected bob to be refused by the ACL, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProtocol_PlaintextWithholdsCredentials(t *testing.T) {
+	_, addr := startTCPServer(t, func(s *Server) { s.SetAuthValidator(testAuthValidator()) })
+	t.Setenv(EnvInsecureAuth, "")
+
+	local := newTestRepo(t)
+	addTestCommit(t, local, "main", "first")
+	err := dialTest(t, "tin://"+addr+"/proj.tin", nil).Push(local, "main", false)
+	if err == nil || !strings.Contains(err.Error(), "tin+tls://") {
+		t.Fatalf("expected credentials to be withheld over tin://, got %v", err)
+	}
+
+	t.Setenv(EnvInsecureAuth, "1")
+	if err := dialTest(t, "tin://"+addr+"/proj.tin", nil).Push(local, "main", false); err != nil {
+		t.Errorf("Push with %s=1 failed: %v", EnvInsecureAuth, err)
+	}
+}
+
+func TestProtocol_TLSRejectsUntrustedServer(t *testing.T) {
+	pki := newTestPKI(t)
+	_, addr := startTCPServer(t, func(s *Server) {
+		s.SetTLS(pki.serverConfig(t, false), nil)
+	})
+
+	// Without TIN_TLS_CA the test CA is not trusted
+	t.Setenv(EnvTLSCA, "")
+	if _, err := Dial("tin+tls://"+addr+"/proj.tin", nil); err == nil {
+		t.Fatal("expected certificate verification to fail")
+	}
+}
@@ -0,0 +1,372 @@
+package remote
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// TokenPrefix starts every API token issued by a TokenStore
+const TokenPrefix = "th_"
+
+// lastUsedInterval limits how often a token's last-used time is written back
+const lastUsedInterval = time.Minute
+
+// TokenRecord is a stored API token. Only a salted hash of the secret is
+// kept; the full token is shown once, when it is created.
+type TokenRecord struct {
+	ID         string     `json:"id"`
+	User       string     `json:"user"`
+	Name       string     `json:"name,omitempty"`
+	Scope      Permission `json:"scope"` // highest permission the token can exercise
+	Salt       string     `json:"salt"`
+	Hash       string     `json:"hash"` // hex SHA-256 of salt + secret
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the token can currently be used
+func (r *TokenRecord) Active(now time.Time) bool {
+	if r.RevokedAt != nil {
+		return false
+	}
+	return r.ExpiresAt == nil || now.Before(*r.ExpiresAt)
+}
+
+// TokenStore manages API tokens in a JSON file. The file is re-read when it
+// changes on disk, so tokens created or revoked with `tin server token` take
+// effect on a running server without a restart.
+type TokenStore struct {
+	path string
+
+	mu      sync.Mutex
+	tokens  []*TokenRecord
+	modTime time.Time
+}
+
+// DefaultTokenStorePath returns ~/.config/tin/server-tokens.json
+func DefaultTokenStorePath() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, _ := os.UserHomeDir()
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "tin", "server-tokens.json")
+}
+
+// OpenTokenStore opens the token store at path. A missing file is an empty store.
+func OpenTokenStore(path string) (*TokenStore, error) {
+	s := &TokenStore{path: path}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the file backing the store
+func (s *TokenStore) Path() string {
+	return s.path
+}
+
+// reload re-reads the file if it changed since it was last read. Callers hold s.mu.
+func (s *TokenStore) reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.tokens = nil
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !s.modTime.IsZero() && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var tokens []*TokenRecord
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("failed to parse token store %s: %w", s.path, err)
+	}
+	s.tokens = tokens
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// save writes the store atomically. Callers hold s.mu.
+func (s *TokenStore) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".tokens-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// update re-reads the store under a lock file, applies fn and saves the
+// result, so that writers in different processes (a server recording token
+// use, `tin server token revoke`) never overwrite each other's changes.
+// Nothing is saved if fn fails. Callers hold s.mu.
+func (s *TokenStore) update(fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := storage.LockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.modTime = time.Time{} // re-read even if a write landed within the mtime resolution
+	if err := s.reload(); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Create issues a new token and returns the full token string, which is not
+// stored and cannot be recovered later. A zero ttl means the token never expires.
+func (s *TokenStore) Create(user, name string, scope Permission, ttl time.Duration) (string, *TokenRecord, error) {
+	if user == "" {
+		return "", nil, fmt.Errorf("token user required")
+	}
+	if scope == PermNone {
+		return "", nil, fmt.Errorf("token scope required")
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", nil, err
+	}
+	salt, err := randomHex(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now().UTC()
+	record := &TokenRecord{
+		User:      user,
+		Name:      name,
+		Scope:     scope,
+		Salt:      salt,
+		Hash:      hashTokenSecret(salt, secret),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		record.ExpiresAt = &expires
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = s.update(func() error {
+		// IDs are short; Revoke and Authenticate need them to be unique
+		for record.ID == "" || s.find(record.ID) != nil {
+			if record.ID, err = newTokenID(); err != nil {
+				return err
+			}
+		}
+		s.tokens = append(s.tokens, record)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return TokenPrefix + record.ID + "_" + secret, record, nil
+}
+
+// newTokenID generates the public ID of a token
+var newTokenID = func() (string, error) {
+	return randomHex(4)
+}
+
+// find returns the record with the given ID, or nil. Callers hold s.mu.
+func (s *TokenStore) find(id string) *TokenRecord {
+	for _, t := range s.tokens {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// match returns the record of an active token with the given ID and
+// secret, or nil. Callers hold s.mu.
+func (s *TokenStore) match(id, secret string, now time.Time) *TokenRecord {
+	t := s.find(id)
+	if t == nil {
+		return nil
+	}
+	hash := hashTokenSecret(t.Salt, secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(t.Hash)) != 1 || !t.Active(now) {
+		return nil
+	}
+	return t
+}
+
+// List returns all tokens, including expired and revoked ones, oldest first
+func (s *TokenStore) List() ([]TokenRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	records := make([]TokenRecord, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		records = append(records, *t)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+// Revoke marks a token as revoked. Revoked tokens stay listed for auditing.
+func (s *TokenStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func() error {
+		for _, t := range s.tokens {
+			if t.ID == id {
+				if t.RevokedAt == nil {
+					now := time.Now().UTC()
+					t.RevokedAt = &now
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("token not found: %s", id)
+	})
+}
+
+// TokenID returns the ID of a token string, which identifies its record
+func TokenID(token string) (string, bool) {
+	rest, ok := strings.CutPrefix(token, TokenPrefix)
+	if !ok {
+		return "", false
+	}
+	id, _, found := strings.Cut(rest, "_")
+	return id, found
+}
+
+// Active reports whether the token with the given ID exists and can
+// currently be used, re-reading the store so revocations are seen
+func (s *TokenStore) Active(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return false
+	}
+	for _, t := range s.tokens {
+		if t.ID == id {
+			return t.Active(time.Now())
+		}
+	}
+	return false
+}
+
+// Authenticate checks a token string and returns its user and scope.
+// Successful use updates the token's last-used time (at most once a minute).
+func (s *TokenStore) Authenticate(token string) (user string, scope Permission, ok bool) {
+	id, secret, found := strings.Cut(strings.TrimPrefix(token, TokenPrefix), "_")
+	if !strings.HasPrefix(token, TokenPrefix) || !found {
+		return "", PermNone, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return "", PermNone, false
+	}
+
+	now := time.Now().UTC()
+	t := s.match(id, secret, now)
+	if t == nil {
+		return "", PermNone, false
+	}
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= lastUsedInterval {
+		// Only the last-used time is written, onto a fresh read of the file,
+		// so a revocation made meanwhile is kept and honoured. Otherwise best
+		// effort; a failed write must not block the request.
+		var fresh *TokenRecord
+		err := s.update(func() error {
+			if fresh = s.match(id, secret, now); fresh == nil {
+				return errTokenInactive
+			}
+			fresh.LastUsedAt = &now
+			return nil
+		})
+		if errors.Is(err, errTokenInactive) {
+			return "", PermNone, false
+		}
+		if fresh != nil {
+			t = fresh
+		}
+	}
+	return t.User, t.Scope, true
+}
+
+// errTokenInactive aborts recording the use of a token revoked meanwhile
+var errTokenInactive = errors.New("token is no longer active")
+
+func hashTokenSecret(salt, secret string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
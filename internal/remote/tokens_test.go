@@ -0,0 +1,218 @@
+package remote
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenStore_Lifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := OpenTokenStore(path)
+	if err != nil {
+		t.Fatalf("OpenTokenStore failed: %v", err)
+	}
+
+	token, record, err := store.Create("alice", "laptop", PermWrite, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(token, TokenPrefix+record.ID+"_") {
+		t.Errorf("token %q does not carry its ID %s", token, record.ID)
+	}
+
+	// Only the hash is stored
+	data, _ := os.ReadFile(path)
+	secret := token[strings.LastIndex(token, "_")+1:]
+	if strings.Contains(string(data), secret) {
+		t.Error("token secret stored in plaintext")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("token store mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	user, scope, ok := store.Authenticate(token)
+	if !ok || user != "alice" || scope != PermWrite {
+		t.Fatalf("Authenticate = %q, %v, %v; want alice, write, true", user, scope, ok)
+	}
+	if _, _, ok := store.Authenticate(token + "x"); ok {
+		t.Error("tampered token accepted")
+	}
+	if _, _, ok := store.Authenticate("th_00000000_" + secret); ok {
+		t.Error("token with unknown ID accepted")
+	}
+
+	records, _ := store.List()
+	if len(records) != 1 || records[0].LastUsedAt == nil {
+		t.Fatalf("expected last-used time to be recorded, got %+v", records)
+	}
+
+	// A second store (e.g. tin server token revoke) revokes it for the first
+	admin, _ := OpenTokenStore(path)
+	if err := admin.Revoke(record.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, _, ok := store.Authenticate(token); ok {
+		t.Error("revoked token accepted")
+	}
+	if err := admin.Revoke("missing"); err == nil {
+		t.Error("expected revoking an unknown token to fail")
+	}
+}
+
+func TestTokenStore_Expiry(t *testing.T) {
+	store, _ := OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	token, _, err := store.Create("bob", "", PermRead, time.Hour)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, _, ok := store.Authenticate(token); !ok {
+		t.Fatal("unexpired token refused")
+	}
+
+	past := time.Now().Add(-time.Minute)
+	store.tokens[0].ExpiresAt = &past
+	if _, _, ok := store.Authenticate(token); ok {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestTokenStore_UseKeepsConcurrentRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	server, _ := OpenTokenStore(path)
+	revoked, revokedRecord, _ := server.Create("alice", "old", PermRead, 0)
+	used, _, _ := server.Create("alice", "new", PermRead, 0)
+	info, _ := os.Stat(path)
+
+	// The CLI revokes a token, and the server's cached copy can't tell
+	// because the file's modification time didn't visibly change
+	cli, _ := OpenTokenStore(path)
+	if err := cli.Revoke(revokedRecord.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+
+	// Recording the other token's use must not write back the stale copy
+	if _, _, ok := server.Authenticate(used); !ok {
+		t.Fatal("active token refused")
+	}
+	if _, _, ok := cli.Authenticate(revoked); ok {
+		t.Error("recording token use un-revoked another token")
+	}
+	records, _ := cli.List()
+	for _, r := range records {
+		if r.Name == "new" && r.LastUsedAt == nil {
+			t.Error("last-used time not recorded")
+		}
+	}
+}
+
+func TestTokenStore_UseSeesConcurrentRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	server, _ := OpenTokenStore(path)
+	token, record, _ := server.Create("alice", "laptop", PermRead, 0)
+	info, _ := os.Stat(path)
+
+	// The server's cached copy still shows the token as active
+	cli, _ := OpenTokenStore(path)
+	if err := cli.Revoke(record.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+
+	if _, _, ok := server.Authenticate(token); ok {
+		t.Error("token revoked before its use was recorded was accepted")
+	}
+}
+
+func TestTokenStore_CreateAvoidsIDCollision(t *testing.T) {
+	ids := []string{"0000aaaa", "0000aaaa", "0000bbbb"}
+	defer func(orig func() (string, error)) { newTokenID = orig }(newTokenID)
+	newTokenID = func() (string, error) {
+		id := ids[0]
+		ids = ids[1:]
+		return id, nil
+	}
+
+	store, _ := OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	first, _, err := store.Create("alice", "laptop", PermRead, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	second, record, err := store.Create("bob", "ci", PermWrite, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if record.ID != "0000bbbb" {
+		t.Errorf("second token ID = %s, want a fresh one", record.ID)
+	}
+	if user, _, ok := store.Authenticate(first); !ok || user != "alice" {
+		t.Errorf("first token authenticated as %q, %v", user, ok)
+	}
+	if user, _, ok := store.Authenticate(second); !ok || user != "bob" {
+		t.Errorf("second token authenticated as %q, %v", user, ok)
+	}
+}
+
+func TestProtocol_TokenScope(t *testing.T) {
+	store, _ := OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	readToken, _, _ := store.Create("alice", "ci", PermRead, 0)
+	adminToken, _, _ := store.Create("alice", "laptop", PermAdmin, 0)
+
+	auth := NewTokenAuthValidator(map[string]string{"bob": "b"})
+	auth.SetTokenStore(store)
+
+	servers := []struct {
+		name  string
+		start func(t *testing.T) (string, string)
+	}{
+		{"tcp", func(t *testing.T) (string, string) {
+			return startTCPServer(t, func(s *Server) { s.SetAuthValidator(auth) })
+		}},
+		{"http", func(t *testing.T) (string, string) {
+			return startHTTPServer(t, func(h *HTTPHandler) { h.authValidator = auth })
+		}},
+	}
+
+	for _, srv := range servers {
+		t.Run(srv.name, func(t *testing.T) {
+			_, base := srv.start(t)
+			with := func(password string) *Client {
+				// Stored bare tokens are sent with a placeholder username
+				client, err := Dial(base+"/proj.tin", parseAuthString(password))
+				if err != nil {
+					t.Fatalf("Dial failed: %v", err)
+				}
+				t.Cleanup(func() { client.Close() })
+				return client
+			}
+
+			local := newTestRepo(t)
+			tip := addTestCommit(t, local, "main", "first")
+
+			if err := with(readToken).Push(local, "main", false); err == nil || !strings.Contains(err.Error(), "permission") {
+				t.Fatalf("expected read-scoped token to be refused push, got %v", err)
+			}
+			if err := with(adminToken).Push(local, "main", false); err != nil {
+				t.Fatalf("Push with admin token failed: %v", err)
+			}
+			refs, err := with(readToken).Pull(newTestRepo(t), "main")
+			if err != nil {
+				t.Fatalf("Pull with read token failed: %v", err)
+			}
+			if refs.Branches["main"] != tip.ID {
+				t.Errorf("pulled main = %s, want %s", refs.Branches["main"], tip.ID)
+			}
+
+			// Password pairs keep working alongside tokens
+			if _, err := with("bob:b").Pull(newTestRepo(t), "main"); err != nil {
+				t.Errorf("Pull with password failed: %v", err)
+			}
+			if _, err := with("th_bogus_token").Pull(newTestRepo(t), "main"); err == nil {
+				t.Error("expected unknown token to be refused")
+			}
+		})
+	}
+}
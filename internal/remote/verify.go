@@ -0,0 +1,119 @@
+package remote
+
+import (
+	"fmt"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// packVerifier checks pushed objects before they are saved, so a buggy client
+// cannot store objects whose IDs don't match their content or commits whose
+// history is incomplete. References are satisfied by objects already in the
+// repository or accepted earlier in the same pack.
+type packVerifier struct {
+	repo     *storage.Repository
+	commits  map[string]bool
+	threads  map[string]bool
+	versions map[ThreadVersionRef]bool
+}
+
+func newPackVerifier(repo *storage.Repository) *packVerifier {
+	return &packVerifier{
+		repo:     repo,
+		commits:  make(map[string]bool),
+		threads:  make(map[string]bool),
+		versions: make(map[ThreadVersionRef]bool),
+	}
+}
+
+// verifyThread checks a thread's ID and its message hash chain
+func (v *packVerifier) verifyThread(thread *model.Thread) error {
+	if !storage.ValidObjectID(thread.ID) {
+		return invalidObject("thread has invalid ID %q", thread.ID)
+	}
+
+	for i := range thread.Messages {
+		msg := &thread.Messages[i]
+		if msg.Role != model.RoleHuman && msg.Role != model.RoleAssistant {
+			return invalidObject("thread %s: message %d has unknown role %q", thread.ID, i, msg.Role)
+		}
+		if msg.ID != msg.ComputeHash() {
+			return invalidObject("thread %s: message %d ID does not match its content", thread.ID, i)
+		}
+		if i > 0 && msg.ParentMessageID != thread.Messages[i-1].ID {
+			return invalidObject("thread %s: message %d does not follow message %d", thread.ID, i, i-1)
+		}
+	}
+	return nil
+}
+
+// acceptThread records a verified thread so later commits may reference it
+func (v *packVerifier) acceptThread(thread *model.Thread) {
+	v.threads[thread.ID] = true
+	v.versions[ThreadVersionRef{ThreadID: thread.ID, ContentHash: thread.ComputeContentHash()}] = true
+}
+
+// verifyCommit checks a commit's ID and that its parents and thread versions exist
+func (v *packVerifier) verifyCommit(commit *model.TinCommit) error {
+	if !storage.ValidObjectID(commit.ID) || commit.ID != commit.ComputeHash() {
+		return invalidObject("commit %s: ID does not match its content", shortID(commit.ID))
+	}
+
+	for _, parent := range []string{commit.ParentCommitID, commit.SecondParentID} {
+		if parent != "" && !v.commits[parent] && !v.repo.HasCommit(parent) {
+			return missingObject("commit %s: parent %s not found", shortID(commit.ID), shortID(parent))
+		}
+	}
+
+	for _, ref := range commit.Threads {
+		if ref.ContentHash == "" {
+			// Legacy reference to the latest version of a thread
+			if !v.threads[ref.ThreadID] {
+				if _, err := v.repo.LoadThread(ref.ThreadID); err != nil {
+					return missingObject("commit %s: thread %s not found", shortID(commit.ID), ref.ThreadID)
+				}
+			}
+			continue
+		}
+		version := ThreadVersionRef{ThreadID: ref.ThreadID, ContentHash: ref.ContentHash}
+		if !v.versions[version] && !v.repo.HasThreadVersion(ref.ThreadID, ref.ContentHash) {
+			return missingObject("commit %s: thread %s@%s not found", shortID(commit.ID), ref.ThreadID, shortID(ref.ContentHash))
+		}
+	}
+	return nil
+}
+
+// acceptCommit records a verified commit so later commits may use it as a parent
+func (v *packVerifier) acceptCommit(commit *model.TinCommit) {
+	v.commits[commit.ID] = true
+}
+
+// verifyPack checks a legacy single-message pack. Older clients list commits
+// newest first, so parents may appear anywhere in the pack.
+func (v *packVerifier) verifyPack(pack *PackMessage) error {
+	for i := range pack.Threads {
+		if err := v.verifyThread(&pack.Threads[i]); err != nil {
+			return err
+		}
+		v.acceptThread(&pack.Threads[i])
+	}
+
+	for i := range pack.Commits {
+		v.acceptCommit(&pack.Commits[i])
+	}
+	for i := range pack.Commits {
+		if err := v.verifyCommit(&pack.Commits[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func invalidObject(format string, args ...any) *ErrorMessage {
+	return &ErrorMessage{Code: ErrCodeInvalidObject, Message: fmt.Sprintf(format, args...)}
+}
+
+func missingObject(format string, args ...any) *ErrorMessage {
+	return &ErrorMessage{Code: ErrCodeMissingObject, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,161 @@
+package remote
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// testThread builds a two-message thread with a valid hash chain
+func testThread(content string) *model.Thread {
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, content, "", nil))
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "done: "+content, "", nil))
+	return thread
+}
+
+func threadRef(thread *model.Thread) model.ThreadRef {
+	return model.ThreadRef{ThreadID: thread.ID, MessageCount: len(thread.Messages), ContentHash: thread.ComputeContentHash()}
+}
+
+func TestPackVerifier_VerifyPack(t *testing.T) {
+	thread := testThread("hello")
+	first := model.NewTinCommit("first", []model.ThreadRef{threadRef(thread)}, "", "")
+	second := model.NewTinCommit("second", nil, "", first.ID)
+
+	tests := []struct {
+		name     string
+		pack     func() *PackMessage
+		wantCode string
+	}{
+		{
+			name: "valid pack, newest first",
+			pack: func() *PackMessage {
+				return &PackMessage{Threads: []model.Thread{*thread}, Commits: []model.TinCommit{*second, *first}}
+			},
+		},
+		{
+			name: "commit ID does not match content",
+			pack: func() *PackMessage {
+				tampered := *first
+				tampered.Message = "rewritten"
+				return &PackMessage{Threads: []model.Thread{*thread}, Commits: []model.TinCommit{tampered}}
+			},
+			wantCode: ErrCodeInvalidObject,
+		},
+		{
+			name: "missing parent",
+			pack: func() *PackMessage {
+				return &PackMessage{Commits: []model.TinCommit{*second}}
+			},
+			wantCode: ErrCodeMissingObject,
+		},
+		{
+			name: "thread version not in pack or repo",
+			pack: func() *PackMessage {
+				return &PackMessage{Commits: []model.TinCommit{*first}}
+			},
+			wantCode: ErrCodeMissingObject,
+		},
+		{
+			name: "message ID does not match content",
+			pack: func() *PackMessage {
+				bad := testThread("hello")
+				bad.Messages[1].Content = "edited"
+				return &PackMessage{Threads: []model.Thread{*bad}}
+			},
+			wantCode: ErrCodeInvalidObject,
+		},
+		{
+			name: "broken message chain",
+			pack: func() *PackMessage {
+				bad := testThread("hello")
+				orphan := model.NewMessage(model.RoleHuman, "orphan", "", nil)
+				bad.Messages = append(bad.Messages, *orphan)
+				return &PackMessage{Threads: []model.Thread{*bad}}
+			},
+			wantCode: ErrCodeInvalidObject,
+		},
+		{
+			name: "unknown role",
+			pack: func() *PackMessage {
+				bad := model.NewThread("claude-code", "", "", "")
+				bad.AddMessage(model.NewMessage("system", "hi", "", nil))
+				return &PackMessage{Threads: []model.Thread{*bad}}
+			},
+			wantCode: ErrCodeInvalidObject,
+		},
+		{
+			name: "unsafe thread ID",
+			pack: func() *PackMessage {
+				bad := testThread("hello")
+				bad.ID = "../../escape"
+				return &PackMessage{Threads: []model.Thread{*bad}}
+			},
+			wantCode: ErrCodeInvalidObject,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newPackVerifier(newTestRepo(t)).verifyPack(tt.pack())
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("verifyPack failed: %v", err)
+				}
+				return
+			}
+			var errMsg *ErrorMessage
+			if !errors.As(err, &errMsg) || errMsg.Code != tt.wantCode {
+				t.Fatalf("verifyPack error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPackVerifier_ParentInRepository(t *testing.T) {
+	repo := newTestRepo(t)
+	base := addTestCommit(t, repo, "main", "base")
+
+	child := model.NewTinCommit("child", nil, "", base.ID)
+	if err := newPackVerifier(repo).verifyCommit(child); err != nil {
+		t.Errorf("verifyCommit failed for parent already in repo: %v", err)
+	}
+}
+
+func TestProtocol_RejectsCorruptPush(t *testing.T) {
+	for _, srv := range testServers() {
+		t.Run(srv.name, func(t *testing.T) {
+			root, url := srv.start(t)
+
+			local := newTestRepo(t)
+			commit := addTestCommit(t, local, "main", "original")
+			commit.Message = "rewritten after hashing"
+			if err := local.SaveCommit(commit); err != nil {
+				t.Fatalf("SaveCommit failed: %v", err)
+			}
+
+			err := dialTest(t, url, nil).Push(local, "main", false)
+			if err == nil || !strings.Contains(err.Error(), "does not match") {
+				t.Fatalf("expected push to be rejected, got %v", err)
+			}
+
+			if bare, err := storage.OpenBare(filepath.Join(root, "proj.tin")); err == nil {
+				if got, _ := bare.ReadBranch("main"); got != "" {
+					t.Errorf("server main = %s after rejected push, want unset", got)
+				}
+				if bare.HasCommit(commit.ID) {
+					t.Error("server saved the corrupt commit")
+				}
+				ref := commit.Threads[0]
+				if bare.HasThreadVersion(ref.ThreadID, ref.ContentHash) {
+					t.Error("server kept the rejected push's thread")
+				}
+			}
+		})
+	}
+}
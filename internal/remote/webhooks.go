@@ -0,0 +1,242 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// WebhookDeliveriesFile is the delivery log of a bare repository, one JSON
+// WebhookDelivery per line
+const WebhookDeliveriesFile = "webhook-deliveries.jsonl"
+
+// Headers sent with every webhook delivery
+const (
+	HeaderWebhookEvent     = "X-Tin-Event"
+	HeaderWebhookDelivery  = "X-Tin-Delivery"      // unique per event and URL; repeated across retries
+	HeaderWebhookSignature = "X-Tin-Signature-256" // "sha256=" + hex HMAC of the body, if a secret is set
+)
+
+// EventPush is the only webhook event type so far
+const EventPush = "push"
+
+// webhookMaxAttempts is how many times a delivery is tried before giving up
+const webhookMaxAttempts = 5
+
+var (
+	// webhookRetryDelay is the wait before the first retry; it doubles after each attempt
+	webhookRetryDelay = time.Second
+	webhookClient     = &http.Client{Timeout: 10 * time.Second}
+
+	// webhookLogMu serializes writes to delivery logs
+	webhookLogMu sync.Mutex
+)
+
+// PushEvent is the JSON body of a push webhook
+type PushEvent struct {
+	Event     string          `json:"event"`
+	Repo      string          `json:"repo"`
+	User      string          `json:"user,omitempty"`
+	Refs      []RefUpdate     `json:"refs"`
+	Commits   []string        `json:"commits"` // commits the refs gained (old..new), parents first
+	Threads   []ThreadSummary `json:"threads"` // thread versions referenced by those commits
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// WebhookDelivery records one attempt to deliver a webhook
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Time       time.Time `json:"time"`
+}
+
+// SignWebhookPayload returns the signature header value for a webhook body.
+// Receivers recompute it with the shared secret and compare with hmac.Equal.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateWebhookSecret returns a random secret for signing webhook deliveries
+func GenerateWebhookSecret() (string, error) {
+	return randomHex(20)
+}
+
+// notifyWebhooks sends a push event to every webhook of the repository whose
+// branch patterns match an applied update. Deliveries run in the background
+// so slow receivers never hold up the push.
+func notifyWebhooks(webhooks []storage.WebhookConfig, hooks *pushHooks, repoName string, applied []RefUpdate) {
+	for _, hook := range webhooks {
+		refs := filterRefUpdates(applied, hook.Branches)
+		if len(refs) == 0 {
+			continue
+		}
+
+		pack, err := hooks.summarize(refs)
+		if err != nil {
+			log.Printf("webhook %s: failed to summarize push: %v", hook.URL, err)
+			continue
+		}
+		event := PushEvent{
+			Event:     EventPush,
+			Repo:      repoName,
+			User:      hooks.user,
+			Refs:      refs,
+			Commits:   make([]string, 0, len(pack.Commits)),
+			Threads:   pack.Threads,
+			Timestamp: time.Now().UTC(),
+		}
+		for _, c := range pack.Commits {
+			event.Commits = append(event.Commits, c.ID)
+		}
+
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("webhook %s: failed to encode event: %v", hook.URL, err)
+			continue
+		}
+		id, err := randomHex(8)
+		if err != nil {
+			log.Printf("webhook %s: %v", hook.URL, err)
+			continue
+		}
+		go deliverWebhook(hooks.repo, hook, id, EventPush, body)
+	}
+}
+
+// filterRefUpdates returns the updates whose branch matches one of the
+// patterns; all updates if there are no patterns
+func filterRefUpdates(updates []RefUpdate, patterns []string) []RefUpdate {
+	if len(patterns) == 0 {
+		return updates
+	}
+	var matched []RefUpdate
+	for _, u := range updates {
+		for _, pattern := range patterns {
+			if matchGlob(pattern, u.Branch) {
+				matched = append(matched, u)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// deliverWebhook POSTs the body, retrying with exponential backoff on network
+// errors, 429 and 5xx responses. Every attempt is recorded in the repository's
+// delivery log.
+func deliverWebhook(repo *storage.Repository, hook storage.WebhookConfig, id, event string, body []byte) {
+	delay := webhookRetryDelay
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		record := WebhookDelivery{ID: id, URL: hook.URL, Event: event, Attempt: attempt, Time: time.Now().UTC()}
+		retry := postWebhook(hook, id, event, body, &record)
+		record.DurationMS = time.Since(record.Time).Milliseconds()
+		if err := appendWebhookDelivery(repo, &record); err != nil {
+			log.Printf("webhook %s: failed to log delivery: %v", hook.URL, err)
+		}
+
+		if record.Success || !retry {
+			return
+		}
+		if attempt < webhookMaxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	log.Printf("webhook %s: giving up on delivery %s after %d attempts", hook.URL, id, webhookMaxAttempts)
+}
+
+// postWebhook makes one delivery attempt, filling in the record. It returns
+// whether a failed attempt is worth retrying.
+func postWebhook(hook storage.WebhookConfig, id, event string, body []byte, record *WebhookDelivery) (retry bool) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		record.Error = err.Error()
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tin-webhook")
+	req.Header.Set(HeaderWebhookEvent, event)
+	req.Header.Set(HeaderWebhookDelivery, id)
+	if hook.Secret != "" {
+		req.Header.Set(HeaderWebhookSignature, SignWebhookPayload(hook.Secret, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		record.Error = err.Error()
+		return true
+	}
+	resp.Body.Close()
+
+	record.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		record.Success = true
+		return false
+	}
+	record.Error = resp.Status
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func appendWebhookDelivery(repo *storage.Repository, record *WebhookDelivery) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	webhookLogMu.Lock()
+	defer webhookLogMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(repo.RootPath, WebhookDeliveriesFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// ReadWebhookDeliveries returns the most recent delivery attempts of a
+// repository, oldest first. limit <= 0 returns them all.
+func ReadWebhookDeliveries(repo *storage.Repository, limit int) ([]WebhookDelivery, error) {
+	f, err := os.Open(filepath.Join(repo.RootPath, WebhookDeliveriesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var deliveries []WebhookDelivery
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var d WebhookDelivery
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			return nil, fmt.Errorf("corrupt delivery log: %w", err)
+		}
+		deliveries = append(deliveries, d)
+		if limit > 0 && len(deliveries) > limit {
+			deliveries = deliveries[1:]
+		}
+	}
+	return deliveries, scanner.Err()
+}
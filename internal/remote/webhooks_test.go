@@ -0,0 +1,182 @@
+package remote
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// fastWebhookRetries shortens the retry backoff for the duration of a test
+func fastWebhookRetries(t *testing.T) {
+	old := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = old })
+}
+
+// waitForDeliveries polls the delivery log until it has n attempts
+func waitForDeliveries(t *testing.T, repo *storage.Repository, n int) []WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := ReadWebhookDeliveries(repo, 0)
+		if err != nil {
+			t.Fatalf("ReadWebhookDeliveries failed: %v", err)
+		}
+		if len(deliveries) >= n || time.Now().After(deadline) {
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func addWebhook(t *testing.T, repo *storage.Repository, hook storage.WebhookConfig) {
+	t.Helper()
+	config, err := repo.ReadConfig()
+	if err != nil {
+		t.Fatalf("ReadConfig failed: %v", err)
+	}
+	config.Webhooks = append(config.Webhooks, hook)
+	if err := repo.WriteConfig(config); err != nil {
+		t.Fatalf("WriteConfig failed: %v", err)
+	}
+}
+
+func TestProtocol_Webhooks(t *testing.T) {
+	fastWebhookRetries(t)
+
+	servers := []struct {
+		name  string
+		start func(t *testing.T) (string, string)
+	}{
+		{"tcp", func(t *testing.T) (string, string) {
+			root, addr := startTCPServer(t, func(s *Server) { s.SetAuthValidator(testAuthValidator()) })
+			return root, "tin://" + addr
+		}},
+		{"http", func(t *testing.T) (string, string) {
+			return startHTTPServer(t, func(h *HTTPHandler) { h.authValidator = testAuthValidator() })
+		}},
+	}
+
+	for _, srv := range servers {
+		t.Run(srv.name, func(t *testing.T) {
+			// The receiver fails the first delivery to exercise retries
+			events := make(chan PushEvent, 4)
+			var requests atomic.Int32
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					http.Error(w, "busy", http.StatusServiceUnavailable)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				if !hmac.Equal([]byte(r.Header.Get(HeaderWebhookSignature)), []byte(SignWebhookPayload("s3cret", body))) {
+					t.Errorf("bad signature %q", r.Header.Get(HeaderWebhookSignature))
+				}
+				if r.Header.Get(HeaderWebhookEvent) != EventPush {
+					t.Errorf("event header = %q, want push", r.Header.Get(HeaderWebhookEvent))
+				}
+				var event PushEvent
+				if err := json.Unmarshal(body, &event); err != nil {
+					t.Errorf("invalid event: %v", err)
+				}
+				events <- event
+			}))
+			t.Cleanup(receiver.Close)
+
+			root, base := srv.start(t)
+			bare, err := storage.InitBare(filepath.Join(root, "proj.tin"))
+			if err != nil {
+				t.Fatalf("InitBare failed: %v", err)
+			}
+			addWebhook(t, bare, storage.WebhookConfig{URL: receiver.URL, Secret: "s3cret", Branches: []string{"main"}})
+			url := base + "/proj.tin"
+
+			// Branches outside the filter don't notify
+			local := newTestRepo(t)
+			addTestCommit(t, local, "feature", "side work")
+			if err := dialTest(t, url, nil).Push(local, "feature", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+
+			tip := addTestCommit(t, local, "main", "add a login page")
+			if err := dialTest(t, url, nil).Push(local, "main", false); err != nil {
+				t.Fatalf("Push failed: %v", err)
+			}
+
+			var event PushEvent
+			select {
+			case event = <-events:
+			case <-time.After(5 * time.Second):
+				t.Fatal("webhook not delivered")
+			}
+			if event.Repo != "proj.tin" || event.User != "alice" {
+				t.Errorf("event repo/user = %q/%q, want proj.tin/alice", event.Repo, event.User)
+			}
+			if len(event.Refs) != 1 || event.Refs[0].Branch != "main" || event.Refs[0].New != tip.ID {
+				t.Errorf("unexpected refs: %+v", event.Refs)
+			}
+			if len(event.Commits) != 1 || event.Commits[0] != tip.ID {
+				t.Errorf("commits = %v, want [%s]", event.Commits, tip.ID)
+			}
+			if len(event.Threads) != 1 || event.Threads[0].Agent != "claude-code" ||
+				event.Threads[0].MessageCount != 2 || event.Threads[0].FirstPrompt != "add a login page" {
+				t.Errorf("unexpected threads: %+v", event.Threads)
+			}
+
+			deliveries := waitForDeliveries(t, bare, 2)
+			if len(deliveries) != 2 {
+				t.Fatalf("expected 2 logged attempts, got %+v", deliveries)
+			}
+			if deliveries[0].Success || deliveries[0].StatusCode != http.StatusServiceUnavailable ||
+				!deliveries[1].Success || deliveries[1].Attempt != 2 || deliveries[1].ID != deliveries[0].ID {
+				t.Errorf("unexpected delivery log: %+v", deliveries)
+			}
+		})
+	}
+}
+
+func TestDeliverWebhook_Retries(t *testing.T) {
+	fastWebhookRetries(t)
+
+	tests := []struct {
+		name     string
+		status   int
+		attempts int
+	}{
+		{"client error is permanent", http.StatusBadRequest, 1},
+		{"server error is retried", http.StatusInternalServerError, webhookMaxAttempts},
+		{"rate limit is retried", http.StatusTooManyRequests, webhookMaxAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer receiver.Close()
+
+			repo := newTestRepo(t)
+			deliverWebhook(repo, storage.WebhookConfig{URL: receiver.URL}, "d1", EventPush, []byte("{}"))
+
+			deliveries, _ := ReadWebhookDeliveries(repo, 0)
+			if len(deliveries) != tt.attempts {
+				t.Fatalf("got %d attempts, want %d", len(deliveries), tt.attempts)
+			}
+			for _, d := range deliveries {
+				if d.Success || d.StatusCode != tt.status {
+					t.Errorf("unexpected delivery: %+v", d)
+				}
+			}
+			if last, _ := ReadWebhookDeliveries(repo, 1); len(last) != 1 || last[0].Attempt != tt.attempts {
+				t.Errorf("ReadWebhookDeliveries(1) = %+v", last)
+			}
+		})
+	}
+}
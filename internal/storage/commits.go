@@ -12,7 +12,7 @@ import (
 
 // SaveCommit saves a commit to the repository
 func (r *Repository) SaveCommit(commit *model.TinCommit) error {
-	path := filepath.Join(r.TinPath, CommitsDir, commit.ID+".json")
+	path := r.objectPath(CommitsDir, commit.ID+".json")
 	data, err := json.MarshalIndent(commit, "", "  ")
 	if err != nil {
 		return err
@@ -22,7 +22,7 @@ func (r *Repository) SaveCommit(commit *model.TinCommit) error {
 
 // LoadCommit loads a commit by ID
 func (r *Repository) LoadCommit(id string) (*model.TinCommit, error) {
-	path := filepath.Join(r.TinPath, CommitsDir, id+".json")
+	path := r.findObject(CommitsDir, id+".json")
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -38,6 +38,13 @@ func (r *Repository) LoadCommit(id string) (*model.TinCommit, error) {
 	return &commit, nil
 }
 
+// HasCommit checks if a commit exists without loading it
+func (r *Repository) HasCommit(id string) bool {
+	path := r.findObject(CommitsDir, id+".json")
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 // ListCommits returns all commits in the repository
 func (r *Repository) ListCommits() ([]*model.TinCommit, error) {
 	commitsPath := filepath.Join(r.TinPath, CommitsDir)
@@ -171,3 +178,43 @@ func (r *Repository) GetCommitHistory(startID string, limit int) ([]*model.TinCo
 
 	return history, nil
 }
+
+// ReachableCommits returns the given commits and all their ancestors,
+// following both parents of merge commits, keyed by ID
+func (r *Repository) ReachableCommits(ids ...string) map[string]*model.TinCommit {
+	reachable := make(map[string]*model.TinCommit)
+	pending := append([]string{}, ids...)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == "" || reachable[id] != nil {
+			continue
+		}
+		commit, err := r.LoadCommit(id)
+		if err != nil {
+			continue
+		}
+		reachable[id] = commit
+		pending = append(pending, commit.ParentCommitID, commit.SecondParentID)
+	}
+	return reachable
+}
+
+// CommitsBetween returns the commits reachable from headID but not from
+// baseID (like git log base..head), newest first
+func (r *Repository) CommitsBetween(baseID, headID string) []*model.TinCommit {
+	base := r.ReachableCommits(baseID)
+	var commits []*model.TinCommit
+	for id, commit := range r.ReachableCommits(headID) {
+		if base[id] == nil {
+			commits = append(commits, commit)
+		}
+	}
+	sort.Slice(commits, func(i, j int) bool {
+		if !commits[i].Timestamp.Equal(commits[j].Timestamp) {
+			return commits[i].Timestamp.After(commits[j].Timestamp)
+		}
+		return commits[i].ID < commits[j].ID
+	})
+	return commits
+}
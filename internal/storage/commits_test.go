@@ -304,3 +304,41 @@ func TestRepository_ReadBranch_NonExistent(t *testing.T) {
 		t.Errorf("expected empty string for nonexistent branch, got %s", commitID)
 	}
 }
+
+func TestRepository_CommitsBetween(t *testing.T) {
+	repo, err := Init(t.TempDir())
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	save := func(c *model.TinCommit) *model.TinCommit {
+		if err := repo.SaveCommit(c); err != nil {
+			t.Fatalf("SaveCommit failed: %v", err)
+		}
+		return c
+	}
+
+	// root <- a <- b (main)
+	//      \- f1 <- f2 <- merge(f2, b) (feature)
+	root := save(model.NewTinCommit("root", nil, "", ""))
+	a := save(model.NewTinCommit("a", nil, "", root.ID))
+	b := save(model.NewTinCommit("b", nil, "", a.ID))
+	f1 := save(model.NewTinCommit("f1", nil, "", root.ID))
+	f2 := save(model.NewTinCommit("f2", nil, "", f1.ID))
+	merge := save(model.NewMergeCommit("merge", nil, "", f2.ID, b.ID))
+
+	if got := len(repo.ReachableCommits(merge.ID)); got != 6 {
+		t.Errorf("ReachableCommits(merge) = %d commits, want 6", got)
+	}
+
+	between := repo.CommitsBetween(b.ID, merge.ID)
+	var ids []string
+	for _, c := range between {
+		ids = append(ids, c.Message)
+	}
+	if len(ids) != 3 || ids[0] != "merge" || ids[1] != "f2" || ids[2] != "f1" {
+		t.Errorf("CommitsBetween(main, feature) = %v, want [merge f2 f1]", ids)
+	}
+	if got := repo.CommitsBetween(merge.ID, b.ID); len(got) != 0 {
+		t.Errorf("CommitsBetween(feature, main) = %d commits, want 0", len(got))
+	}
+}
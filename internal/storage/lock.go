@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockTimeout is how long LockFile waits for another holder to release a lock
+var lockTimeout = 10 * time.Second
+
+// staleLockAge is the age after which a lock file is assumed to be left
+// behind by a process that died holding it
+const staleLockAge = 30 * time.Second
+
+// LockFile takes an exclusive lock on path by creating path+".lock",
+// waiting while another process or goroutine holds it. The lock guards
+// read-modify-write cycles on files shared between processes, such as a
+// running server and the CLI. The returned function releases it.
+func LockFile(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	unlock, err := LockFile(path)
+	if err != nil {
+		t.Fatalf("LockFile failed: %v", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		second, err := LockFile(path)
+		if err != nil {
+			t.Errorf("second LockFile failed: %v", err)
+		}
+		acquired <- second
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock taken while still held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case second := <-acquired:
+		second()
+	case <-time.After(time.Second):
+		t.Fatal("lock not taken after release")
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Error("lock file left behind after release")
+	}
+}
+
+func TestLockFile_Stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path+".lock", nil, 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	os.Chtimes(path+".lock", old, old)
+
+	unlock, err := LockFile(path)
+	if err != nil {
+		t.Fatalf("LockFile should take over a stale lock: %v", err)
+	}
+	unlock()
+}
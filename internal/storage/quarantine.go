@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// QuarantineDir holds the objects of pushes that have not been accepted yet
+const QuarantineDir = "quarantine"
+
+// staleQuarantineAge is the age after which a quarantine is assumed to be
+// left behind by an abandoned push
+const staleQuarantineAge = time.Hour
+
+// Quarantine returns a view of the repository whose new commits and threads
+// are written to a quarantine directory instead of the repository itself.
+// Reads through the view see both, so pushed objects can be verified and
+// shown to hooks before they are accepted. Branches and config are shared
+// with the repository. An empty name creates a fresh quarantine; a name
+// reopens (or creates) the quarantine of a push spread over several requests.
+func (r *Repository) Quarantine(name string) (*Repository, error) {
+	parent := filepath.Join(r.TinPath, QuarantineDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	removeStaleQuarantines(parent)
+
+	var dir string
+	if name == "" {
+		var err error
+		if dir, err = os.MkdirTemp(parent, "push-"); err != nil {
+			return nil, err
+		}
+	} else {
+		dir = filepath.Join(parent, name)
+		// Keep a push that is still sending chunks from looking abandoned
+		now := time.Now()
+		os.Chtimes(dir, now, now)
+	}
+	for _, sub := range []string{ThreadsDir, ThreadVersionsDir, CommitsDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	view := *r
+	view.quarantine = dir
+	return &view, nil
+}
+
+// QuarantinePath returns the quarantine directory of a view returned by
+// Quarantine, or "" once its objects are accepted or discarded
+func (r *Repository) QuarantinePath() string {
+	return r.quarantine
+}
+
+// AcceptQuarantine moves the quarantined objects into the repository. Threads
+// move before commits, so no commit is ever visible without its threads.
+func (r *Repository) AcceptQuarantine() error {
+	if r.quarantine == "" {
+		return nil
+	}
+	for _, dir := range []string{ThreadVersionsDir, ThreadsDir, CommitsDir} {
+		src := filepath.Join(r.quarantine, dir)
+		err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(r.quarantine, path)
+			if err != nil {
+				return err
+			}
+			dest := filepath.Join(r.TinPath, rel)
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			return os.Rename(path, dest)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return r.DiscardQuarantine()
+}
+
+// DiscardQuarantine removes the quarantined objects
+func (r *Repository) DiscardQuarantine() error {
+	if r.quarantine == "" {
+		return nil
+	}
+	dir := r.quarantine
+	r.quarantine = ""
+	return os.RemoveAll(dir)
+}
+
+// removeStaleQuarantines removes quarantines of pushes that never finished
+func removeStaleQuarantines(parent string) {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && time.Since(info.ModTime()) > staleQuarantineAge {
+			os.RemoveAll(filepath.Join(parent, entry.Name()))
+		}
+	}
+}
+
+// objectPath returns where an object is written: in the quarantine, if any
+func (r *Repository) objectPath(elem ...string) string {
+	if r.quarantine != "" {
+		return filepath.Join(append([]string{r.quarantine}, elem...)...)
+	}
+	return filepath.Join(append([]string{r.TinPath}, elem...)...)
+}
+
+// findObject returns the path of an object, preferring a quarantined copy
+func (r *Repository) findObject(elem ...string) string {
+	if r.quarantine != "" {
+		path := filepath.Join(append([]string{r.quarantine}, elem...)...)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(append([]string{r.TinPath}, elem...)...)
+}
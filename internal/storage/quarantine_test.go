@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+func TestRepository_Quarantine(t *testing.T) {
+	repo, err := InitBare(filepath.Join(t.TempDir(), "proj.tin"))
+	if err != nil {
+		t.Fatalf("InitBare failed: %v", err)
+	}
+	base := model.NewTinCommit("base", nil, "", "")
+	repo.SaveCommit(base)
+
+	incoming, err := repo.Quarantine("")
+	if err != nil {
+		t.Fatalf("Quarantine failed: %v", err)
+	}
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "hello", "", nil))
+	if err := incoming.SaveThread(thread); err != nil {
+		t.Fatalf("SaveThread failed: %v", err)
+	}
+	commit := model.NewTinCommit("incoming", nil, "", base.ID)
+	if err := incoming.SaveCommit(commit); err != nil {
+		t.Fatalf("SaveCommit failed: %v", err)
+	}
+
+	// The view sees both; the repository only its own objects
+	if !incoming.HasCommit(base.ID) || !incoming.HasCommit(commit.ID) {
+		t.Error("quarantine view should see repository and quarantined commits")
+	}
+	if repo.HasCommit(commit.ID) || repo.HasThreadVersion(thread.ID, thread.ComputeContentHash()) {
+		t.Error("quarantined objects visible in the repository before acceptance")
+	}
+
+	if err := incoming.AcceptQuarantine(); err != nil {
+		t.Fatalf("AcceptQuarantine failed: %v", err)
+	}
+	if !repo.HasCommit(commit.ID) || !repo.HasThreadVersion(thread.ID, thread.ComputeContentHash()) {
+		t.Error("accepted objects missing from the repository")
+	}
+	if _, err := repo.LoadThread(thread.ID); err != nil {
+		t.Errorf("LoadThread after accepting failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(repo.TinPath, QuarantineDir)); len(entries) != 0 {
+		t.Errorf("quarantine left behind: %v", entries)
+	}
+}
+
+func TestRepository_DiscardQuarantine(t *testing.T) {
+	repo, _ := InitBare(filepath.Join(t.TempDir(), "proj.tin"))
+
+	// A named quarantine collects objects across several views
+	first, _ := repo.Quarantine("chunked")
+	commit := model.NewTinCommit("incoming", nil, "", "")
+	first.SaveCommit(commit)
+	second, err := repo.Quarantine("chunked")
+	if err != nil {
+		t.Fatalf("Quarantine failed: %v", err)
+	}
+	if !second.HasCommit(commit.ID) {
+		t.Error("reopened quarantine lost its objects")
+	}
+
+	if err := second.DiscardQuarantine(); err != nil {
+		t.Fatalf("DiscardQuarantine failed: %v", err)
+	}
+	if repo.HasCommit(commit.ID) || second.HasCommit(commit.ID) {
+		t.Error("discarded object still visible")
+	}
+	if _, err := os.Stat(first.QuarantinePath()); !os.IsNotExist(err) {
+		t.Error("quarantine directory not removed")
+	}
+}
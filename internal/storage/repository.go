@@ -42,6 +42,13 @@ type CredentialEntry struct {
 	Token string `json:"token"`
 }
 
+// WebhookConfig is a URL the server notifies after pushes to a bare repository
+type WebhookConfig struct {
+	URL      string   `json:"url"`
+	Secret   string   `json:"secret,omitempty"`   // HMAC-SHA256 key for signing deliveries
+	Branches []string `json:"branches,omitempty"` // branch patterns to notify for (all branches if empty)
+}
+
 // Config holds tin configuration
 type Config struct {
 	Version       int               `json:"version"`
@@ -50,6 +57,10 @@ type Config struct {
 	ThreadHostURL string            `json:"thread_host_url,omitempty"` // Base URL for tin web viewer (e.g., https://tin.example.com)
 	AuthToken     string            `json:"auth_token,omitempty"`      // Deprecated: use Credentials instead
 	Credentials   []CredentialEntry `json:"credentials,omitempty"`     // Per-host authentication tokens
+	Webhooks      []WebhookConfig   `json:"webhooks,omitempty"`        // Push notifications (bare repositories)
+	// CaptureThinking records agents' thinking blocks in threads, where the
+	// agent's transcript has them (Claude Code)
+	CaptureThinking bool `json:"capture_thinking,omitempty"`
 }
 
 // Index represents the staging area
@@ -62,6 +73,25 @@ type Repository struct {
 	RootPath string
 	TinPath  string
 	IsBare   bool
+
+	quarantine string // set on views returned by Quarantine
+}
+
+// ValidObjectID reports whether id is safe to use as a commit, thread or
+// thread version ID, which name files in the repository
+func ValidObjectID(id string) bool {
+	if id == "" || len(id) > 255 || id[0] == '.' {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // Init initializes a new tin repository in the given path
@@ -431,6 +461,139 @@ func (r *Repository) GitGetChangedFiles() ([]string, error) {
 	return files, nil
 }
 
+// GitDiff returns the changes made on head since it diverged from base
+// (git diff base...head)
+func (r *Repository) GitDiff(base, head string) (string, error) {
+	if strings.HasPrefix(base, "-") || strings.HasPrefix(head, "-") {
+		return "", fmt.Errorf("invalid git revision")
+	}
+	cmd := exec.Command("git", "diff", "--no-color", "--no-ext-diff", base+"..."+head, "--")
+	cmd.Dir = r.RootPath
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff failed: %w", err)
+	}
+	return string(output), nil
+}
+
+// SnapshotsRef keeps working tree snapshots reachable, so git gc does not
+// prune them
+const SnapshotsRef = "refs/tin/snapshots"
+
+// GitSnapshot records the working tree, including untracked files that are
+// not ignored, as a git tree object and returns its hash. The index, HEAD
+// and working tree are left alone: the tree is built in a copy of the index.
+// Each new tree is committed onto SnapshotsRef so it is kept.
+func (r *Repository) GitSnapshot() (string, error) {
+	gitDir, err := r.gitOutput("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository")
+	}
+	indexPath := filepath.Join(gitDir, "index")
+	tmp, err := os.CreateTemp("", "tin-index-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	// Starting from the real index lets git reuse its cached file stats;
+	// without one, git must create the file itself
+	data, err := os.ReadFile(indexPath)
+	switch {
+	case os.IsNotExist(err):
+		tmp.Close()
+		if err := os.Remove(tmp.Name()); err != nil {
+			return "", err
+		}
+	case err != nil:
+		tmp.Close()
+		return "", fmt.Errorf("failed to read git index: %w", err)
+	default:
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			return "", fmt.Errorf("failed to copy git index: %w", err)
+		}
+		if err := tmp.Close(); err != nil {
+			return "", fmt.Errorf("failed to copy git index: %w", err)
+		}
+	}
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+tmp.Name())
+	add := exec.Command("git", "add", "-A", "--", ".", ":(exclude).tin")
+	add.Dir = r.RootPath
+	add.Env = env
+	if output, err := add.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git add failed: %s", strings.TrimSpace(string(output)))
+	}
+	writeTree := exec.Command("git", "write-tree")
+	writeTree.Dir = r.RootPath
+	writeTree.Env = env
+	output, err := writeTree.Output()
+	if err != nil {
+		return "", fmt.Errorf("git write-tree failed: %w", err)
+	}
+	tree := strings.TrimSpace(string(output))
+
+	// Hooks of concurrent sessions may race to move the ref; retry on a
+	// lost compare-and-swap
+	for range 3 {
+		prev, _ := r.gitOutput("rev-parse", "-q", "--verify", SnapshotsRef)
+		if prev != "" {
+			if prevTree, _ := r.GitTree(prev); prevTree == tree {
+				return tree, nil
+			}
+		}
+		args := []string{"commit-tree", tree, "-m", "tin snapshot"}
+		if prev != "" {
+			args = append(args, "-p", prev)
+		}
+		commit := exec.Command("git", args...)
+		commit.Dir = r.RootPath
+		commit.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=tin", "GIT_AUTHOR_EMAIL=tin@localhost",
+			"GIT_COMMITTER_NAME=tin", "GIT_COMMITTER_EMAIL=tin@localhost")
+		output, err := commit.Output()
+		if err != nil {
+			return "", fmt.Errorf("git commit-tree failed: %w", err)
+		}
+		if _, err := r.gitOutput("update-ref", SnapshotsRef, strings.TrimSpace(string(output)), prev); err == nil {
+			return tree, nil
+		}
+	}
+	return "", fmt.Errorf("failed to update %s", SnapshotsRef)
+}
+
+// GitTree returns the hash of the tree of a git commit
+func (r *Repository) GitTree(rev string) (string, error) {
+	if strings.HasPrefix(rev, "-") {
+		return "", fmt.Errorf("invalid git revision")
+	}
+	return r.gitOutput("rev-parse", "--verify", "-q", rev+"^{tree}")
+}
+
+// GitDiffSnapshots returns the changes between two snapshot trees, with
+// any extra git diff options (e.g. --stat)
+func (r *Repository) GitDiffSnapshots(before, after string, options ...string) (string, error) {
+	if strings.HasPrefix(before, "-") || strings.HasPrefix(after, "-") {
+		return "", fmt.Errorf("invalid git tree")
+	}
+	args := append([]string{"diff", "--no-color", "--no-ext-diff"}, options...)
+	cmd := exec.Command("git", append(args, before, after, "--")...)
+	cmd.Dir = r.RootPath
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff failed: %w", err)
+	}
+	return string(output), nil
+}
+
+// gitOutput runs a git command in the working tree and returns its trimmed output
+func (r *Repository) gitOutput(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.RootPath
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
 // GitPush runs git push with the given remote and branch
 func (r *Repository) GitPush(remote, branch string, force bool) error {
 	args := []string{"push", remote, branch}
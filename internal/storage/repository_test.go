@@ -3,6 +3,7 @@ package storage
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/sestinj/tin/internal/model"
@@ -314,3 +315,90 @@ func TestInit_Worktree_ExistingTin(t *testing.T) {
 		t.Error("expected no .tin in worktree, but it exists")
 	}
 }
+
+func TestRepository_GitSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	repo, err := Init(tmpDir)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	path := filepath.Join(tmpDir, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := repo.GitSnapshot()
+	if err != nil {
+		t.Fatalf("GitSnapshot failed: %v", err)
+	}
+
+	// An unchanged working tree has the same snapshot
+	if again, _ := repo.GitSnapshot(); again != before {
+		t.Errorf("snapshot of unchanged tree = %s, want %s", again, before)
+	}
+
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	after, err := repo.GitSnapshot()
+	if err != nil {
+		t.Fatalf("GitSnapshot failed: %v", err)
+	}
+	if after == before {
+		t.Fatal("snapshot did not change with the working tree")
+	}
+
+	diff, err := repo.GitDiffSnapshots(before, after)
+	if err != nil {
+		t.Fatalf("GitDiffSnapshots failed: %v", err)
+	}
+	if !strings.Contains(diff, "+func main() {}") {
+		t.Errorf("diff missing the change:\n%s", diff)
+	}
+	if strings.Contains(diff, ".tin/") {
+		t.Errorf("diff includes tin's own files:\n%s", diff)
+	}
+
+	// Snapshots leave the git index alone and are kept reachable
+	if status, _ := repo.gitOutput("diff", "--cached", "--name-only"); status != "" {
+		t.Errorf("index changed: %s", status)
+	}
+	if tree, _ := repo.GitTree(SnapshotsRef); tree != after {
+		t.Errorf("%s tree = %s, want %s", SnapshotsRef, tree, after)
+	}
+
+	// With a real index to start from, the snapshot is the same
+	if _, err := repo.gitOutput("add", "main.go"); err != nil {
+		t.Fatalf("git add failed: %v", err)
+	}
+	if again, err := repo.GitSnapshot(); err != nil || again != after {
+		t.Errorf("snapshot with an index = %s, %v; want %s", again, err, after)
+	}
+	if staged, _ := repo.gitOutput("diff", "--cached", "--name-only"); staged != "main.go" {
+		t.Errorf("staged files = %q, want main.go", staged)
+	}
+}
+
+func TestValidObjectID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"3f2a9c", true},
+		{"thread_01.v2-a", true},
+		{"", false},
+		{".hidden", false},
+		{"..", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a b", false},
+		{"a:b", false},
+		{strings.Repeat("a", 256), false},
+	}
+	for _, tt := range tests {
+		if got := ValidObjectID(tt.id); got != tt.want {
+			t.Errorf("ValidObjectID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
@@ -20,7 +21,7 @@ func (r *Repository) SaveThread(thread *model.Thread) error {
 	}
 
 	// Save to "latest" location (existing behavior)
-	path := filepath.Join(r.TinPath, ThreadsDir, thread.ID+".json")
+	path := r.objectPath(ThreadsDir, thread.ID+".json")
 	data, err := json.MarshalIndent(thread, "", "  ")
 	if err != nil {
 		return err
@@ -30,7 +31,7 @@ func (r *Repository) SaveThread(thread *model.Thread) error {
 
 // LoadThread loads a thread by ID
 func (r *Repository) LoadThread(id string) (*model.Thread, error) {
-	path := filepath.Join(r.TinPath, ThreadsDir, id+".json")
+	path := r.findObject(ThreadsDir, id+".json")
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -232,18 +233,18 @@ func (r *Repository) PruneEmptyThreads() {
 func (r *Repository) SaveThreadVersion(thread *model.Thread) (string, error) {
 	contentHash := thread.ComputeContentHash()
 
+	// Check if this version already exists
+	if r.HasThreadVersion(thread.ID, contentHash) {
+		// Version already exists, no need to save again
+		return contentHash, nil
+	}
+
 	// Create thread-specific version directory
-	versionDir := filepath.Join(r.TinPath, ThreadVersionsDir, thread.ID)
+	versionDir := r.objectPath(ThreadVersionsDir, thread.ID)
 	if err := os.MkdirAll(versionDir, 0755); err != nil {
 		return "", err
 	}
-
-	// Check if this version already exists
 	versionPath := filepath.Join(versionDir, contentHash+".json")
-	if _, err := os.Stat(versionPath); err == nil {
-		// Version already exists, no need to save again
-		return contentHash, nil
-	}
 
 	// Save the version
 	data, err := json.MarshalIndent(thread, "", "  ")
@@ -259,7 +260,7 @@ func (r *Repository) SaveThreadVersion(thread *model.Thread) (string, error) {
 
 // LoadThreadVersion loads a specific version of a thread
 func (r *Repository) LoadThreadVersion(threadID, contentHash string) (*model.Thread, error) {
-	versionPath := filepath.Join(r.TinPath, ThreadVersionsDir, threadID, contentHash+".json")
+	versionPath := r.findObject(ThreadVersionsDir, threadID, contentHash+".json")
 	data, err := os.ReadFile(versionPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -300,7 +301,7 @@ func (r *Repository) ListThreadVersions(threadID string) ([]string, error) {
 
 // HasThreadVersion checks if a specific version of a thread exists
 func (r *Repository) HasThreadVersion(threadID, contentHash string) bool {
-	versionPath := filepath.Join(r.TinPath, ThreadVersionsDir, threadID, contentHash+".json")
+	versionPath := r.findObject(ThreadVersionsDir, threadID, contentHash+".json")
 	_, err := os.Stat(versionPath)
 	return err == nil
 }
@@ -324,6 +325,37 @@ func (r *Repository) FindThreadsBySessionID(sessionID string) ([]*model.Thread,
 	return matches, nil
 }
 
+// SaveAgentThread saves a thread imported from an agent, deduplicated by
+// the agent's session ID: a thread already in the repository keeps its tin
+// thread ID, and is only saved again if its content changed. The thread is
+// staged if stage is set. It reports whether the thread already existed,
+// and whether anything was saved.
+func (r *Repository) SaveAgentThread(thread *model.Thread, stage bool) (existed, changed bool, err error) {
+	if thread.AgentSessionID != "" {
+		existingThreads, _ := r.FindThreadsBySessionID(thread.AgentSessionID)
+		if len(existingThreads) > 0 {
+			existing := existingThreads[0]
+			if thread.ComputeContentHash() == existing.ComputeContentHash() {
+				return true, false, nil
+			}
+			// Thread has changed - update it, preserving the tin thread ID
+			thread.ID = existing.ID
+			existed = true
+		}
+	}
+
+	if err := r.SaveThread(thread); err != nil {
+		return existed, false, fmt.Errorf("failed to save thread: %w", err)
+	}
+
+	if stage {
+		if err := r.StageThread(thread.ID, len(thread.Messages), thread.ComputeContentHash()); err != nil {
+			return existed, true, fmt.Errorf("failed to stage thread: %w", err)
+		}
+	}
+	return existed, true, nil
+}
+
 // FindChildThreads returns threads that have the given thread as their parent,
 // sorted by start time (newest first)
 func (r *Repository) FindChildThreads(parentThreadID string) ([]*model.Thread, error) {
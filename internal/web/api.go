@@ -0,0 +1,444 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// The JSON API is read-only and versioned under /api/v1/:
+//
+//	GET /api/v1/repos
+//	GET /api/v1/repos/{repo}/branches
+//	GET /api/v1/repos/{repo}/commits?branch=&cursor=&limit=
+//	GET /api/v1/repos/{repo}/commits/{id}
+//	GET /api/v1/repos/{repo}/threads/{id}?version=
+//	GET /api/v1/repos/{repo}/threads/{id}/versions
+//	GET /api/v1/search?q=&repo=&limit=
+//
+// {repo} is the repository path relative to the server root and may contain
+// slashes. Errors are returned as {"error": "..."} with a matching status.
+
+const (
+	defaultAPILimit = 50
+	maxAPILimit     = 500
+)
+
+// APIRepo describes a repository in the repo list
+type APIRepo struct {
+	Path          string    `json:"path"`
+	Name          string    `json:"name"`
+	CurrentBranch string    `json:"current_branch,omitempty"`
+	LastActivity  time.Time `json:"last_activity"`
+}
+
+// APIBranch describes a branch and the commit it points to
+type APIBranch struct {
+	Name     string `json:"name"`
+	CommitID string `json:"commit_id"`
+	IsHead   bool   `json:"is_head"`
+}
+
+// APICommit is a commit with the agents that contributed its threads
+type APICommit struct {
+	*model.TinCommit
+	Agents []string `json:"agents"`
+}
+
+// APICommitPage is one page of commit history. NextCursor, if set, is passed
+// as ?cursor= to fetch the following page.
+type APICommitPage struct {
+	Commits    []APICommit `json:"commits"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// APIThreadRef is a commit's reference to a thread version, with enough of
+// the thread to display it without another request
+type APIThreadRef struct {
+	model.ThreadRef
+	Agent       string `json:"agent,omitempty"`
+	FirstPrompt string `json:"first_prompt,omitempty"`
+}
+
+// APICommitDetail is a commit with its thread references
+type APICommitDetail struct {
+	*model.TinCommit
+	Agents     []string       `json:"agents"`
+	ThreadRefs []APIThreadRef `json:"thread_refs"`
+}
+
+// APIThread is a thread at a specific version. When paginated, Messages holds
+// one page and NextCursor, if set, is passed as ?cursor= for the next.
+type APIThread struct {
+	*model.Thread
+	ContentHash       string `json:"content_hash"`
+	LatestContentHash string `json:"latest_content_hash"`
+	IsLatest          bool   `json:"is_latest"`
+	NextCursor        string `json:"next_cursor,omitempty"`
+}
+
+// APIThreadVersion is a committed version of a thread
+type APIThreadVersion struct {
+	ContentHash  string   `json:"content_hash"`
+	MessageCount int      `json:"message_count"`
+	Commits      []string `json:"commits"` // IDs of the commits referencing this version
+	IsLatest     bool     `json:"is_latest"`
+}
+
+// APISearchResults wraps search results
+type APISearchResults struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
+
+// handleAPI routes /api/v1/ requests
+func (s *WebServer) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/"), "/")
+	switch {
+	case path == "repos":
+		s.apiRepos(w, r)
+	case path == "search":
+		s.apiSearch(w, r)
+	case strings.HasPrefix(path, "repos/"):
+		s.apiRepo(w, r, strings.TrimPrefix(path, "repos/"))
+	default:
+		writeAPIError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+// apiRepo routes requests for a single repository
+func (s *WebServer) apiRepo(w http.ResponseWriter, r *http.Request, path string) {
+	// Parse: {repo}/branches, {repo}/commits[/{id}], {repo}/threads/{id}[/versions]
+	var repoPath, resource, id, sub string
+	if idx := strings.LastIndex(path, "/threads/"); idx != -1 {
+		repoPath, resource = path[:idx], "threads"
+		id, sub, _ = strings.Cut(path[idx+len("/threads/"):], "/")
+	} else if idx := strings.LastIndex(path, "/commits/"); idx != -1 {
+		repoPath, resource = path[:idx], "commits"
+		id = path[idx+len("/commits/"):]
+	} else if strings.HasSuffix(path, "/commits") {
+		repoPath, resource = strings.TrimSuffix(path, "/commits"), "commits"
+	} else if strings.HasSuffix(path, "/branches") {
+		repoPath, resource = strings.TrimSuffix(path, "/branches"), "branches"
+	} else {
+		writeAPIError(w, http.StatusNotFound, "unknown endpoint")
+		return
+	}
+
+	if id != "" && !storage.ValidObjectID(id) {
+		writeAPIError(w, http.StatusBadRequest, "invalid ID")
+		return
+	}
+
+	repo, err := s.openReadableRepo(r, repoPath)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "repository not found")
+		return
+	}
+
+	index := s.index.get(repo)
+	switch {
+	case resource == "branches":
+		apiBranches(w, repo)
+	case resource == "commits" && id == "":
+		apiCommits(w, r, repo)
+	case resource == "commits":
+		apiCommit(w, r, repo, index, id)
+	case resource == "threads" && sub == "":
+		apiThread(w, r, repo, index, id)
+	case resource == "threads" && sub == "versions":
+		apiThreadVersions(w, r, repo, index, id)
+	default:
+		writeAPIError(w, http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func (s *WebServer) apiRepos(w http.ResponseWriter, r *http.Request) {
+	repos, err := DiscoverRepos(s.rootPath)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := make([]APIRepo, 0, len(repos))
+	for _, info := range s.readableRepos(r, repos) {
+		result = append(result, APIRepo{
+			Path:          filepath.ToSlash(info.Path),
+			Name:          info.Name,
+			CurrentBranch: info.CurrentBranch,
+			LastActivity:  info.LastActivity,
+		})
+	}
+	writeJSON(w, result)
+}
+
+func apiBranches(w http.ResponseWriter, repo *storage.Repository) {
+	head, _ := repo.ReadHead()
+	names, err := repo.ListBranches()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	branches := make([]APIBranch, 0, len(names))
+	for _, name := range names {
+		commitID, _ := repo.ReadBranch(name)
+		branches = append(branches, APIBranch{Name: name, CommitID: commitID, IsHead: name == head})
+	}
+	writeJSON(w, branches)
+}
+
+// apiCommits lists first-parent history from a branch (default HEAD), or
+// from ?cursor= when continuing a previous page
+func apiCommits(w http.ResponseWriter, r *http.Request, repo *storage.Repository) {
+	query := r.URL.Query()
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	start := query.Get("cursor")
+	if start != "" {
+		if !storage.ValidObjectID(start) || !repo.HasCommit(start) {
+			writeAPIError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	} else {
+		branch := query.Get("branch")
+		if branch == "" {
+			branch, _ = repo.ReadHead()
+		}
+		if !repo.BranchExists(branch) {
+			writeAPIError(w, http.StatusNotFound, "branch not found")
+			return
+		}
+		start, _ = repo.ReadBranch(branch)
+	}
+
+	page := APICommitPage{Commits: []APICommit{}}
+	history, _ := repo.GetCommitHistory(start, limit+1)
+	if len(history) > limit {
+		page.NextCursor = history[limit].ID
+		history = history[:limit]
+	}
+	for _, commit := range history {
+		page.Commits = append(page.Commits, APICommit{TinCommit: commit, Agents: getCommitAgents(repo, commit)})
+	}
+	writeJSON(w, page)
+}
+
+func apiCommit(w http.ResponseWriter, r *http.Request, repo *storage.Repository, index *repoIndex, commitID string) {
+	commit, err := repo.LoadCommit(commitID)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "commit not found")
+		return
+	}
+	if checkETag(w, r, "api-commit", commitID, index.stamp()) {
+		return
+	}
+
+	detail := APICommitDetail{
+		TinCommit:  commit,
+		Agents:     getCommitAgents(repo, commit),
+		ThreadRefs: make([]APIThreadRef, 0, len(commit.Threads)),
+	}
+	for _, ref := range commit.Threads {
+		apiRef := APIThreadRef{ThreadRef: ref}
+		if thread := loadThreadRef(repo, ref); thread != nil {
+			apiRef.Agent = thread.Agent
+			if first := thread.FirstHumanMessage(); first != nil {
+				apiRef.FirstPrompt = truncate(first.Content, 200)
+			}
+		}
+		detail.ThreadRefs = append(detail.ThreadRefs, apiRef)
+	}
+	writeJSON(w, detail)
+}
+
+// apiThread returns the latest version of a thread, or the version given by
+// ?version=. With ?limit= (and ?cursor= for later pages) only a page of its
+// messages is returned.
+func apiThread(w http.ResponseWriter, r *http.Request, repo *storage.Repository, index *repoIndex, threadID string) {
+	latest, err := repo.LoadThread(threadID)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "thread not found")
+		return
+	}
+	latestHash := latest.ComputeContentHash()
+
+	thread := latest
+	if version := r.URL.Query().Get("version"); version != "" && version != latestHash {
+		if !storage.ValidObjectID(version) {
+			writeAPIError(w, http.StatusBadRequest, "invalid version")
+			return
+		}
+		thread, err = repo.LoadThreadVersion(threadID, version)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "thread version not found")
+			return
+		}
+	}
+
+	contentHash := thread.ComputeContentHash()
+	query := r.URL.Query()
+	if checkETag(w, r, "api-thread", threadID, contentHash, latestHash, query.Get("cursor"), query.Get("limit")) {
+		return
+	}
+
+	result := APIThread{
+		Thread:            thread,
+		ContentHash:       contentHash,
+		LatestContentHash: latestHash,
+		IsLatest:          contentHash == latestHash,
+	}
+	if query.Has("limit") || query.Has("cursor") {
+		limit, err := parseLimit(query.Get("limit"))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		page, next, ok := pageMessages(thread.Messages, query.Get("cursor"), limit)
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		paged := *thread
+		paged.Messages = page
+		result.Thread = &paged
+		result.NextCursor = next
+	}
+	writeJSON(w, result)
+}
+
+func apiThreadVersions(w http.ResponseWriter, r *http.Request, repo *storage.Repository, index *repoIndex, threadID string) {
+	latest, err := repo.LoadThread(threadID)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "thread not found")
+		return
+	}
+	latestHash := latest.ComputeContentHash()
+	if checkETag(w, r, "api-versions", threadID, latestHash, index.stamp()) {
+		return
+	}
+
+	versions := make([]APIThreadVersion, 0)
+	for _, v := range buildThreadVersions(index, repo, threadID, latestHash, "") {
+		commits := make([]string, 0, len(v.Commits))
+		for _, c := range v.Commits {
+			commits = append(commits, c.ID)
+		}
+		versions = append(versions, APIThreadVersion{
+			ContentHash:  v.ContentHash,
+			MessageCount: v.MessageCount,
+			Commits:      commits,
+			IsLatest:     v.IsLatest,
+		})
+	}
+	writeJSON(w, versions)
+}
+
+// apiSearch searches one repository (?repo=) or every repository under the root
+func (s *WebServer) apiSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+	limit, err := parseLimit(query.Get("limit"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := s.search(r, q, query.Get("repo"), limit)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == storage.ErrNotARepository {
+			status = http.StatusNotFound
+		}
+		writeAPIError(w, status, err.Error())
+		return
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+	writeJSON(w, APISearchResults{Query: q, Results: results})
+}
+
+// openRepoPath opens a repository by its path relative to the server root,
+// refusing paths that escape the root
+func (s *WebServer) openRepoPath(repoPath string) (*storage.Repository, error) {
+	absPath := filepath.Join(s.rootPath, filepath.FromSlash(repoPath))
+	rel, err := filepath.Rel(s.rootPath, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, storage.ErrNotARepository
+	}
+	return openRepo(absPath)
+}
+
+// openReadableRepo opens a repository the request's user may read. Repositories
+// they can't read are reported as missing, so their existence isn't revealed.
+func (s *WebServer) openReadableRepo(r *http.Request, repoPath string) (*storage.Repository, error) {
+	if !s.canRead(r, repoPath) {
+		return nil, storage.ErrNotARepository
+	}
+	return s.openRepoPath(repoPath)
+}
+
+// loadThreadRef loads the thread version a commit references, falling back
+// to the latest version
+func loadThreadRef(repo *storage.Repository, ref model.ThreadRef) *model.Thread {
+	if ref.ContentHash != "" {
+		if thread, err := repo.LoadThreadVersion(ref.ThreadID, ref.ContentHash); err == nil {
+			return thread
+		}
+	}
+	thread, err := repo.LoadThread(ref.ThreadID)
+	if err != nil {
+		return nil
+	}
+	return thread
+}
+
+func parseLimit(s string) (int, error) {
+	if s == "" {
+		return defaultAPILimit, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, &apiError{"invalid limit"}
+	}
+	return min(n, maxAPILimit), nil
+}
+
+type apiError struct {
+	Message string `json:"error"`
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Message: message})
+}
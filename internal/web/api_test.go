@@ -0,0 +1,187 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// newAPITestServer serves a root containing one bare repo, team/proj.tin
+func newAPITestServer(t *testing.T) (*httptest.Server, *storage.Repository) {
+	t.Helper()
+	root := t.TempDir()
+	repo, err := storage.InitBare(filepath.Join(root, "team", "proj.tin"))
+	if err != nil {
+		t.Fatalf("InitBare failed: %v", err)
+	}
+	server := httptest.NewServer(NewWebServer("127.0.0.1", 0, root).Handler())
+	t.Cleanup(server.Close)
+	return server, repo
+}
+
+// commitThread saves the thread's current version and commits it on main
+func commitThread(t *testing.T, repo *storage.Repository, thread *model.Thread, message string) *model.TinCommit {
+	t.Helper()
+	if err := repo.SaveThread(thread); err != nil {
+		t.Fatalf("SaveThread failed: %v", err)
+	}
+	hash, err := repo.SaveThreadVersion(thread)
+	if err != nil {
+		t.Fatalf("SaveThreadVersion failed: %v", err)
+	}
+
+	parent, _ := repo.ReadBranch("main")
+	refs := []model.ThreadRef{{ThreadID: thread.ID, MessageCount: len(thread.Messages), ContentHash: hash}}
+	commit := model.NewTinCommit(message, refs, "", parent)
+	if err := repo.SaveCommit(commit); err != nil {
+		t.Fatalf("SaveCommit failed: %v", err)
+	}
+	if err := repo.WriteBranch("main", commit.ID); err != nil {
+		t.Fatalf("WriteBranch failed: %v", err)
+	}
+	return commit
+}
+
+// getJSON fetches path and decodes the response into v, returning the status
+func getJSON(t *testing.T, server *httptest.Server, path string, v any) int {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("GET %s: Content-Type = %q", path, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: invalid JSON: %v", path, err)
+	}
+	return resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	server, repo := newAPITestServer(t)
+
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "add a login page", "", nil))
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "Added the login form", "", nil))
+	first := commitThread(t, repo, thread, "first pass")
+	firstHash := thread.ComputeContentHash()
+
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "now add logout", "", nil))
+	second := commitThread(t, repo, thread, "add logout")
+	third := commitThread(t, repo, thread, "retag")
+
+	var repos []APIRepo
+	if status := getJSON(t, server, "/api/v1/repos", &repos); status != http.StatusOK {
+		t.Fatalf("repos status = %d", status)
+	}
+	if len(repos) != 1 || repos[0].Path != "team/proj.tin" {
+		t.Fatalf("unexpected repos: %+v", repos)
+	}
+
+	var branches []APIBranch
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/branches", &branches)
+	if len(branches) != 1 || branches[0].Name != "main" || branches[0].CommitID != third.ID || !branches[0].IsHead {
+		t.Errorf("unexpected branches: %+v", branches)
+	}
+
+	// Page through history two commits at a time
+	var page APICommitPage
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/commits?limit=2", &page)
+	if len(page.Commits) != 2 || page.Commits[0].ID != third.ID || page.Commits[1].ID != second.ID || page.NextCursor != first.ID {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	if len(page.Commits[0].Agents) != 1 || page.Commits[0].Agents[0] != "claude-code" {
+		t.Errorf("agents = %v", page.Commits[0].Agents)
+	}
+	cursor := page.NextCursor
+	page = APICommitPage{}
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/commits?limit=2&cursor="+cursor, &page)
+	if len(page.Commits) != 1 || page.Commits[0].ID != first.ID || page.NextCursor != "" {
+		t.Errorf("unexpected last page: %+v", page)
+	}
+
+	var detail APICommitDetail
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/commits/"+first.ID, &detail)
+	if detail.Message != "first pass" || len(detail.ThreadRefs) != 1 ||
+		detail.ThreadRefs[0].FirstPrompt != "add a login page" || detail.ThreadRefs[0].MessageCount != 2 {
+		t.Errorf("unexpected commit detail: %+v", detail)
+	}
+
+	var apiThread APIThread
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/threads/"+thread.ID+"?version="+firstHash, &apiThread)
+	if len(apiThread.Messages) != 2 || apiThread.IsLatest || apiThread.ContentHash != firstHash {
+		t.Errorf("unexpected old version: %d messages, latest=%v", len(apiThread.Messages), apiThread.IsLatest)
+	}
+	apiThread = APIThread{}
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/threads/"+thread.ID, &apiThread)
+	if len(apiThread.Messages) != 3 || !apiThread.IsLatest {
+		t.Errorf("unexpected latest version: %d messages, latest=%v", len(apiThread.Messages), apiThread.IsLatest)
+	}
+
+	var versions []APIThreadVersion
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/threads/"+thread.ID+"/versions", &versions)
+	if len(versions) != 2 || versions[0].ContentHash != firstHash || versions[0].IsLatest ||
+		len(versions[1].Commits) != 2 || !versions[1].IsLatest {
+		t.Errorf("unexpected versions: %+v", versions)
+	}
+
+	var search APISearchResults
+	getJSON(t, server, "/api/v1/search?q=LOGOUT", &search)
+	if len(search.Results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", search.Results)
+	}
+	if r := search.Results[0]; r.Kind != SearchKindCommit || r.CommitID != second.ID || r.Repo != "team/proj.tin" {
+		t.Errorf("unexpected commit result: %+v", r)
+	}
+	if r := search.Results[1]; r.Kind != SearchKindMessage || r.ThreadID != thread.ID || r.Snippet != "now add logout" {
+		t.Errorf("unexpected message result: %+v", r)
+	}
+}
+
+func TestAPI_Errors(t *testing.T) {
+	server, repo := newAPITestServer(t)
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "hello", "", nil))
+	commitThread(t, repo, thread, "hello")
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/unknown", http.StatusNotFound},
+		{"/api/v1/repos/missing.tin/branches", http.StatusNotFound},
+		{"/api/v1/repos/team/proj.tin/commits/deadbeef", http.StatusNotFound},
+		{"/api/v1/repos/team/proj.tin/commits?branch=nope", http.StatusNotFound},
+		{"/api/v1/repos/team/proj.tin/commits?limit=-1", http.StatusBadRequest},
+		{"/api/v1/repos/team/proj.tin/commits?cursor=deadbeef", http.StatusBadRequest},
+		{"/api/v1/repos/team/proj.tin/threads/" + thread.ID + "?version=deadbeef", http.StatusNotFound},
+		{"/api/v1/repos/team/proj.tin/threads/.hidden", http.StatusBadRequest},
+		{"/api/v1/search", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		var body apiError
+		if status := getJSON(t, server, tt.path, &body); status != tt.status || body.Message == "" {
+			t.Errorf("GET %s = %d %q, want %d with an error", tt.path, status, body.Message, tt.status)
+		}
+	}
+
+	if _, err := NewWebServer("127.0.0.1", 0, t.TempDir()).openRepoPath("../team/proj.tin"); err == nil {
+		t.Error("expected paths outside the root to be rejected")
+	}
+
+	resp, err := http.Post(server.URL+"/api/v1/repos", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", resp.StatusCode)
+	}
+}
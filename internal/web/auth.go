@@ -0,0 +1,258 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sestinj/tin/internal/remote"
+)
+
+// sessionCookie is the cookie holding a browser's session ID after login
+const sessionCookie = "tin_session"
+
+// sessionTTL is how long a browser session lasts after login
+var sessionTTL = 12 * time.Hour
+
+// webUser is the authenticated user of a request. Scope limits what their
+// credentials may do, as for the push/pull servers.
+type webUser struct {
+	ID    string
+	Scope remote.Permission
+}
+
+type userContextKey struct{}
+
+// requestUser returns the user authenticated for the request
+func requestUser(r *http.Request) webUser {
+	if user, ok := r.Context().Value(userContextKey{}).(webUser); ok {
+		return user
+	}
+	return webUser{}
+}
+
+// sessionStore keeps browser sessions in memory; they do not survive a restart
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]webSession
+}
+
+type webSession struct {
+	user    webUser
+	tokenID string // API token the session was started with, if any
+	expires time.Time
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]webSession)}
+}
+
+// create starts a session for the user and returns its ID. A session
+// started with an API token lasts only as long as the token stays active.
+func (s *sessionStore) create(user webUser, tokenID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for sid, sess := range s.sessions {
+		if now.After(sess.expires) {
+			delete(s.sessions, sid)
+		}
+	}
+	s.sessions[id] = webSession{user: user, tokenID: tokenID, expires: now.Add(sessionTTL)}
+	return id, nil
+}
+
+// lookup returns an unexpired session
+func (s *sessionStore) lookup(id string) (webSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return webSession{}, false
+	}
+	if time.Now().After(sess.expires) {
+		delete(s.sessions, id)
+		return webSession{}, false
+	}
+	return sess, true
+}
+
+func (s *sessionStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// authRequired reports whether requests must carry credentials
+func (s *WebServer) authRequired() bool {
+	return s.auth != nil
+}
+
+// authenticate identifies the user of a request by, in order, a verified
+// client certificate, a session cookie or Basic Auth credentials (a password
+// or API token). Without an auth validator everyone is let in anonymously.
+func (s *WebServer) authenticate(r *http.Request) (webUser, bool) {
+	if userID, ok := remote.CertUser(s.certs, r.TLS); ok {
+		return webUser{ID: userID, Scope: remote.PermAdmin}, true
+	}
+	if !s.authRequired() {
+		return webUser{Scope: remote.PermAdmin}, true
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if sess, ok := s.sessions.lookup(cookie.Value); ok {
+			if sess.tokenID == "" || s.tokenActive(sess.tokenID) {
+				return sess.user, true
+			}
+			// The token was revoked or expired; so is the session
+			s.sessions.remove(cookie.Value)
+		}
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		if userID, scope, valid := remote.ValidateCredentials(s.auth, username, password); valid {
+			return webUser{ID: userID, Scope: scope}, true
+		}
+	}
+	return webUser{}, false
+}
+
+// tokenActive reports whether an API token a session was started with can
+// still be used
+func (s *WebServer) tokenActive(id string) bool {
+	checker, ok := s.auth.(remote.TokenChecker)
+	return ok && checker.TokenActive(id)
+}
+
+// requireAuth wraps the viewer so that every page and API call is
+// authenticated. Push/pull requests are passed to the protocol handler,
+// which does its own authentication.
+func (s *WebServer) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.protocol != nil && remote.IsProtocolRequest(r) {
+			s.protocol.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/assets/") || r.URL.Path == "/login" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, ok := s.authenticate(r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				w.Header().Set("WWW-Authenticate", `Basic realm="tin"`)
+				writeAPIError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// canRead reports whether the request's user may read the repository, given
+// its path relative to the root
+func (s *WebServer) canRead(r *http.Request, repoPath string) bool {
+	user := requestUser(r)
+	return min(s.acl.Permission(user.ID, repoPath), user.Scope) >= remote.PermRead
+}
+
+// readableRepos filters repos down to those the request's user may read
+func (s *WebServer) readableRepos(r *http.Request, repos []RepoInfo) []RepoInfo {
+	var readable []RepoInfo
+	for _, repo := range repos {
+		if s.canRead(r, repo.Path) {
+			readable = append(readable, repo)
+		}
+	}
+	return readable
+}
+
+// LoginPageData contains data for the login page
+type LoginPageData struct {
+	Title    string
+	Next     string
+	Username string
+	Error    string
+}
+
+// handleLogin shows the login form and starts a session on valid credentials
+func (s *WebServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	next := safeRedirect(r.FormValue("next"))
+	if !s.authRequired() {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	data := LoginPageData{Title: "Sign in", Next: next}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodPost {
+		data.Username = r.PostFormValue("username")
+		password := r.PostFormValue("password")
+		userID, scope, valid := remote.ValidateCredentials(s.auth, data.Username, password)
+		if valid {
+			// Sessions started with a token end when it is revoked or expires
+			tokenID, isToken := remote.TokenID(password)
+			if !isToken || !s.tokenActive(tokenID) {
+				tokenID = ""
+			}
+			id, err := s.sessions.create(webUser{ID: userID, Scope: scope}, tokenID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    id,
+				Path:     "/",
+				MaxAge:   int(sessionTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		data.Error = "Invalid username, password or token"
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	if err := renderTemplate(w, "login.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleLogout ends the browser session. It only accepts POST, which other
+// sites cannot send with the SameSite session cookie.
+func (s *WebServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		s.sessions.remove(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// safeRedirect returns next if it is a local path, so login can't be used
+// to redirect to another site
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
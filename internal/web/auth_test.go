@@ -0,0 +1,296 @@
+package web
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/remote"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// newAuthTestServer serves team/proj.tin and secret/ops.tin to alice (password
+// "pw"), who may only read team/**, and to holders of tokens from the store
+func newAuthTestServer(t *testing.T, protocol http.Handler) (*httptest.Server, *remote.TokenStore) {
+	t.Helper()
+	root := t.TempDir()
+	for _, name := range []string{"team/proj.tin", "secret/ops.tin"} {
+		if _, err := storage.InitBare(filepath.Join(root, name)); err != nil {
+			t.Fatalf("InitBare failed: %v", err)
+		}
+	}
+
+	tokens, err := remote.OpenTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatalf("OpenTokenStore failed: %v", err)
+	}
+	validator := remote.NewTokenAuthValidator(map[string]string{"alice": "pw"})
+	validator.SetTokenStore(tokens)
+
+	viewer := NewWebServer("127.0.0.1", 0, root)
+	viewer.SetAuthValidator(validator)
+	viewer.SetACL(&remote.ACL{Rules: []remote.ACLRule{
+		{Users: []string{"alice"}, Repos: []string{"team/**"}, Permission: remote.PermWrite},
+		{Users: []string{"bob"}, Repos: []string{"**"}, Permission: remote.PermAdmin},
+	}})
+	viewer.SetProtocolHandler(protocol)
+
+	server := httptest.NewServer(viewer.Handler())
+	t.Cleanup(server.Close)
+	return server, tokens
+}
+
+// noRedirects makes a client return redirects instead of following them
+func noRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+func get(t *testing.T, client *http.Client, url string, user, password string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if user != "" || password != "" {
+		req.SetBasicAuth(user, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestWebAuth_BasicAndTokens(t *testing.T) {
+	server, tokens := newAuthTestServer(t, nil)
+	client := &http.Client{CheckRedirect: noRedirects}
+
+	readToken, _, err := tokens.Create("bob", "ci", remote.PermRead, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		user     string
+		password string
+		status   int
+	}{
+		{"api requires auth", "/api/v1/repos", "", "", http.StatusUnauthorized},
+		{"bad password", "/api/v1/repos", "alice", "wrong", http.StatusUnauthorized},
+		{"password", "/api/v1/repos/team/proj.tin/branches", "alice", "pw", http.StatusOK},
+		{"acl hides repo", "/api/v1/repos/secret/ops.tin/branches", "alice", "pw", http.StatusNotFound},
+		{"token", "/api/v1/repos/secret/ops.tin/branches", "", readToken, http.StatusOK},
+		{"pages redirect to login", "/repo/team/proj.tin", "", "", http.StatusSeeOther},
+		{"page with password", "/repo/team/proj.tin", "alice", "pw", http.StatusOK},
+		{"page hidden by acl", "/repo/secret/ops.tin", "alice", "pw", http.StatusNotFound},
+		{"assets are public", "/assets/amp-mark-color.svg", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := get(t, client, server.URL+tt.path, tt.user, tt.password); resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+
+	var repos []APIRepo
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/repos", nil)
+	req.SetBasicAuth("alice", "pw")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&repos); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(repos) != 1 || repos[0].Path != "team/proj.tin" {
+		t.Errorf("alice should only see team/proj.tin, got %+v", repos)
+	}
+}
+
+func TestWebAuth_LoginSession(t *testing.T) {
+	server, _ := newAuthTestServer(t, nil)
+	client := &http.Client{CheckRedirect: noRedirects}
+
+	resp := get(t, client, server.URL+"/repo/team/proj.tin", "", "")
+	if loc := resp.Header.Get("Location"); loc != "/login?next=%2Frepo%2Fteam%2Fproj.tin" {
+		t.Fatalf("redirect = %q", loc)
+	}
+
+	resp, err := client.PostForm(server.URL+"/login", url.Values{"username": {"alice"}, "password": {"wrong"}})
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || len(resp.Cookies()) != 0 {
+		t.Fatalf("bad login: status %d, cookies %v", resp.StatusCode, resp.Cookies())
+	}
+
+	resp, err = client.PostForm(server.URL+"/login", url.Values{
+		"username": {"alice"}, "password": {"pw"}, "next": {"/repo/team/proj.tin"},
+	})
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/repo/team/proj.tin" {
+		t.Fatalf("login: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	var session *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookie {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly {
+		t.Fatalf("expected an HttpOnly session cookie, got %v", resp.Cookies())
+	}
+
+	withCookie := func(method, path string) int {
+		return requestWithCookie(t, client, method, server.URL+path, session)
+	}
+	if status := withCookie(http.MethodGet, "/repo/team/proj.tin"); status != http.StatusOK {
+		t.Errorf("page with session = %d", status)
+	}
+	if status := withCookie(http.MethodGet, "/api/v1/repos/secret/ops.tin/branches"); status != http.StatusNotFound {
+		t.Errorf("acl with session = %d", status)
+	}
+
+	// Logging out takes a POST, so that links on other pages can't
+	if status := withCookie(http.MethodGet, "/logout"); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET /logout = %d, want 405", status)
+	}
+	if status := withCookie(http.MethodGet, "/api/v1/repos"); status != http.StatusOK {
+		t.Errorf("after GET /logout = %d, want 200", status)
+	}
+	withCookie(http.MethodPost, "/logout")
+	if status := withCookie(http.MethodGet, "/api/v1/repos"); status != http.StatusUnauthorized {
+		t.Errorf("after logout = %d, want 401", status)
+	}
+}
+
+// requestWithCookie sends a request with a session cookie and returns its status
+func requestWithCookie(t *testing.T, client *http.Client, method, url string, cookie *http.Cookie) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	req.AddCookie(cookie)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebAuth_TokenSessionEndsOnRevoke(t *testing.T) {
+	server, tokens := newAuthTestServer(t, nil)
+	client := &http.Client{CheckRedirect: noRedirects}
+
+	token, record, err := tokens.Create("bob", "browser", remote.PermRead, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	resp, err := client.PostForm(server.URL+"/login", url.Values{"username": {"bob"}, "password": {token}})
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	var session *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookie {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatalf("token login: status %d, no session cookie", resp.StatusCode)
+	}
+
+	if status := requestWithCookie(t, client, http.MethodGet, server.URL+"/api/v1/repos", session); status != http.StatusOK {
+		t.Fatalf("page with token session = %d", status)
+	}
+	if err := tokens.Revoke(record.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if status := requestWithCookie(t, client, http.MethodGet, server.URL+"/api/v1/repos", session); status != http.StatusUnauthorized {
+		t.Errorf("after revoking the token = %d, want 401", status)
+	}
+}
+
+func TestWebAuth_SharedListener(t *testing.T) {
+	var protocolPaths []string
+	protocol := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocolPaths = append(protocolPaths, r.URL.Path)
+	})
+	server, _ := newAuthTestServer(t, protocol)
+
+	// Protocol requests bypass the viewer's login; the protocol handler
+	// authenticates them itself
+	resp, err := http.Post(server.URL+"/team/proj.tin/tin-upload-pack", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(protocolPaths) != 1 || protocolPaths[0] != "/team/proj.tin/tin-upload-pack" {
+		t.Errorf("protocol request not passed through: %d %v", resp.StatusCode, protocolPaths)
+	}
+
+	if resp := get(t, http.DefaultClient, server.URL+"/api/v1/repos", "alice", "pw"); resp.StatusCode != http.StatusOK {
+		t.Errorf("viewer status = %d", resp.StatusCode)
+	}
+	if len(protocolPaths) != 1 {
+		t.Errorf("viewer request reached the protocol handler")
+	}
+}
+
+func TestSafeRedirect(t *testing.T) {
+	tests := map[string]string{
+		"":                  "/",
+		"/repo/x?branch=y":  "/repo/x?branch=y",
+		"//evil.example":    "/",
+		"/\\evil.example":   "/",
+		"https://evil.test": "/",
+	}
+	for next, want := range tests {
+		if got := safeRedirect(next); got != want {
+			t.Errorf("safeRedirect(%q) = %q, want %q", next, got, want)
+		}
+	}
+}
+
+func TestWebServer_ServeTLS(t *testing.T) {
+	// Borrow httptest's certificate, which its client trusts
+	certServer := httptest.NewUnstartedServer(http.NotFoundHandler())
+	certServer.StartTLS()
+	t.Cleanup(certServer.Close)
+
+	viewer := NewWebServer("127.0.0.1", 0, t.TempDir())
+	viewer.SetAuthValidator(remote.NewTokenAuthValidator(map[string]string{"alice": "pw"}))
+	viewer.SetTLS(&tls.Config{Certificates: certServer.TLS.Certificates}, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go viewer.Serve(listener)
+
+	resp := get(t, certServer.Client(), "https://"+listener.Addr().String()+"/login", "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /login over TLS = %d, want 200", resp.StatusCode)
+	}
+
+	// The login form is never served in the clear
+	if resp, err := http.Get("http://" + listener.Addr().String() + "/login"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("expected plaintext request to be refused")
+		}
+	}
+}
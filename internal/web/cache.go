@@ -0,0 +1,202 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Page sizes for cursor-based pagination
+const (
+	commitsPerPage  = 50
+	messagesPerPage = 200
+)
+
+// repoIndex is derived data about a repository that is expensive to compute
+// on every page view. It is rebuilt when the directory it was built from
+// changes; commits and thread versions are immutable, so a new file is the
+// only change that matters.
+type repoIndex struct {
+	commitsStamp string
+	// versions maps thread ID -> content hash -> commits referencing that
+	// version, newest first
+	versions map[string]map[string][]*model.TinCommit
+	// messageCounts maps thread ID -> content hash -> message count, as recorded in commits
+	messageCounts map[string]map[string]int
+
+	threadsStamp string
+	// children maps a thread ID to the threads continuing from it, newest
+	// first, and subagents to the subagent threads it launched. Only the
+	// first message of each child is kept.
+	children  map[string][]*model.Thread
+	subagents map[string][]*model.Thread
+}
+
+// indexCache holds a repoIndex per repository
+type indexCache struct {
+	mu      sync.Mutex
+	indexes map[string]*repoIndex
+}
+
+func newIndexCache() *indexCache {
+	return &indexCache{indexes: make(map[string]*repoIndex)}
+}
+
+// get returns an up-to-date index for the repository
+func (c *indexCache) get(repo *storage.Repository) *repoIndex {
+	commitsStamp := dirStamp(filepath.Join(repo.TinPath, storage.CommitsDir))
+	threadsStamp := dirStamp(filepath.Join(repo.TinPath, storage.ThreadsDir))
+
+	c.mu.Lock()
+	cached := c.indexes[repo.TinPath]
+	c.mu.Unlock()
+	if cached != nil && cached.commitsStamp == commitsStamp && cached.threadsStamp == threadsStamp {
+		return cached
+	}
+
+	// Indexes are replaced, never modified, so readers of the old one are unaffected
+	index := &repoIndex{commitsStamp: commitsStamp, threadsStamp: threadsStamp}
+	if cached != nil && cached.commitsStamp == commitsStamp {
+		index.versions, index.messageCounts = cached.versions, cached.messageCounts
+	} else {
+		index.buildVersions(repo)
+	}
+	if cached != nil && cached.threadsStamp == threadsStamp {
+		index.children, index.subagents = cached.children, cached.subagents
+	} else {
+		index.buildChildren(repo)
+	}
+
+	c.mu.Lock()
+	c.indexes[repo.TinPath] = index
+	c.mu.Unlock()
+	return index
+}
+
+func (idx *repoIndex) buildVersions(repo *storage.Repository) {
+	idx.versions = make(map[string]map[string][]*model.TinCommit)
+	idx.messageCounts = make(map[string]map[string]int)
+	commits, _ := repo.ListCommits()
+	for _, commit := range commits {
+		for _, ref := range commit.Threads {
+			if ref.ContentHash == "" {
+				continue
+			}
+			if idx.versions[ref.ThreadID] == nil {
+				idx.versions[ref.ThreadID] = make(map[string][]*model.TinCommit)
+				idx.messageCounts[ref.ThreadID] = make(map[string]int)
+			}
+			idx.versions[ref.ThreadID][ref.ContentHash] = append(idx.versions[ref.ThreadID][ref.ContentHash], commit)
+			if ref.MessageCount > 0 {
+				idx.messageCounts[ref.ThreadID][ref.ContentHash] = ref.MessageCount
+			}
+		}
+	}
+}
+
+func (idx *repoIndex) buildChildren(repo *storage.Repository) {
+	idx.children = make(map[string][]*model.Thread)
+	idx.subagents = make(map[string][]*model.Thread)
+	threads, _ := repo.ListThreads()
+	for _, t := range threads {
+		if t.ParentThreadID == "" {
+			continue
+		}
+		child := *t
+		child.Messages = t.Messages[:min(len(t.Messages), 1)]
+		if t.IsSubagent() {
+			idx.subagents[t.ParentThreadID] = append(idx.subagents[t.ParentThreadID], &child)
+		} else {
+			idx.children[t.ParentThreadID] = append(idx.children[t.ParentThreadID], &child)
+		}
+	}
+}
+
+// stamp identifies the state of the repository the index was built from
+func (idx *repoIndex) stamp() string {
+	return idx.commitsStamp + "/" + idx.threadsStamp
+}
+
+// dirStamp summarizes a directory's modification time and entry count; it
+// changes whenever a file is added or removed
+func dirStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	entries, _ := os.ReadDir(path)
+	return fmt.Sprintf("%d.%d", info.ModTime().UnixNano(), len(entries))
+}
+
+// etagSalt changes the ETags of every page when the server restarts, so
+// pages rendered by an older version are never reused
+var etagSalt = fmt.Sprint(time.Now().UnixNano())
+
+// checkETag sets an ETag computed from the inputs a response depends on.
+// If the client already has that version, it writes 304 Not Modified and
+// returns true; the caller should then write nothing else.
+func checkETag(w http.ResponseWriter, r *http.Request, parts ...string) bool {
+	h := sha256.New()
+	h.Write([]byte(etagSalt))
+	for _, part := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(part))
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+
+	w.Header().Set("ETag", etag)
+	// Pages depend on who is signed in, so only the browser may cache them,
+	// and it must revalidate each time
+	w.Header().Set("Cache-Control", "private, no-cache")
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if strings.TrimSpace(candidate) == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// pageMessages returns up to limit messages following the message with ID
+// cursor (from the start if cursor is empty), and the cursor for the next
+// page. ok is false if the cursor is not a message of the list.
+func pageMessages(messages []model.Message, cursor string, limit int) (page []model.Message, next string, ok bool) {
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i := range messages {
+			if messages[i].ID == cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start == -1 {
+			return nil, "", false
+		}
+	}
+
+	end := min(start+limit, len(messages))
+	if end < len(messages) {
+		next = messages[end-1].ID
+	}
+	return messages[start:end], next, true
+}
+
+// messageCursor returns the cursor of the page showing the message at index
+// i, or "" if it is on the first page
+func messageCursor(messages []model.Message, i int) string {
+	start := i / messagesPerPage * messagesPerPage
+	if start == 0 {
+		return ""
+	}
+	return messages[start-1].ID
+}
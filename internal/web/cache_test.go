@@ -0,0 +1,214 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+func TestIndexCache_Invalidation(t *testing.T) {
+	_, repo := newAPITestServer(t)
+	cache := newIndexCache()
+
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "first", "", nil))
+	first := commitThread(t, repo, thread, "first")
+	firstHash := thread.ComputeContentHash()
+
+	index := cache.get(repo)
+	if got := index.versions[thread.ID][firstHash]; len(got) != 1 || got[0].ID != first.ID {
+		t.Fatalf("versions = %+v, want [%s]", got, first.ID)
+	}
+	if cache.get(repo) != index {
+		t.Error("index rebuilt without changes")
+	}
+
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "second", "", nil))
+	commitThread(t, repo, thread, "second")
+	updated := cache.get(repo)
+	if updated == index || updated.stamp() == index.stamp() {
+		t.Fatal("index not rebuilt after commit")
+	}
+	if got := updated.messageCounts[thread.ID][thread.ComputeContentHash()]; got != 2 {
+		t.Errorf("message count = %d, want 2", got)
+	}
+	if len(index.versions[thread.ID]) != 1 {
+		t.Error("old index was modified")
+	}
+
+	child := model.NewThread("claude-code", "", "", "")
+	child.ParentThreadID = thread.ID
+	child.AddMessage(model.NewMessage(model.RoleHuman, "continue", "", nil))
+	child.AddMessage(model.NewMessage(model.RoleAssistant, "ok", "", nil))
+	if err := repo.SaveThread(child); err != nil {
+		t.Fatalf("SaveThread failed: %v", err)
+	}
+	children := cache.get(repo).children[thread.ID]
+	if len(children) != 1 || children[0].ID != child.ID || len(children[0].Messages) != 1 {
+		t.Errorf("children = %+v", children)
+	}
+}
+
+func TestPageMessages(t *testing.T) {
+	var messages []model.Message
+	for i := range 5 {
+		messages = append(messages, model.Message{ID: fmt.Sprint("m", i)})
+	}
+
+	tests := []struct {
+		cursor   string
+		limit    int
+		wantIDs  string
+		wantNext string
+		wantOK   bool
+	}{
+		{"", 2, "m0 m1", "m1", true},
+		{"m1", 2, "m2 m3", "m3", true},
+		{"m3", 2, "m4", "", true},
+		{"m4", 2, "", "", true},
+		{"", 10, "m0 m1 m2 m3 m4", "", true},
+		{"missing", 2, "", "", false},
+	}
+	for _, tt := range tests {
+		page, next, ok := pageMessages(messages, tt.cursor, tt.limit)
+		var ids []string
+		for _, m := range page {
+			ids = append(ids, m.ID)
+		}
+		if got := strings.Join(ids, " "); got != tt.wantIDs || next != tt.wantNext || ok != tt.wantOK {
+			t.Errorf("pageMessages(%q, %d) = %q, %q, %v; want %q, %q, %v",
+				tt.cursor, tt.limit, got, next, ok, tt.wantIDs, tt.wantNext, tt.wantOK)
+		}
+	}
+
+	if got := messageCursor(messages, 4); got != "" {
+		t.Errorf("messageCursor on first page = %q, want empty", got)
+	}
+}
+
+func TestWebPagination(t *testing.T) {
+	server, repo := newAPITestServer(t)
+
+	thread := model.NewThread("claude-code", "", "", "")
+	for i := range messagesPerPage + 5 {
+		thread.AddMessage(model.NewMessage(model.RoleHuman, fmt.Sprint("message ", i), "", nil))
+	}
+	var commits []*model.TinCommit
+	for i := range commitsPerPage + 2 {
+		commits = append(commits, commitThread(t, repo, thread, fmt.Sprint("commit ", i)))
+	}
+
+	fetch := func(path string) string {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+		}
+		return string(body)
+	}
+
+	// Commits are listed newest first; the next page starts at the oldest two
+	link := func(c *model.TinCommit) string { return `href="/repo/team/proj.tin/commit/` + c.ID + `"` }
+	body := fetch("/repo/team/proj.tin")
+	if !strings.Contains(body, "cursor="+commits[1].ID) || !strings.Contains(body, link(commits[2])) || strings.Contains(body, link(commits[1])) {
+		t.Errorf("first commit page missing older link or shows too many commits")
+	}
+	body = fetch("/repo/team/proj.tin?branch=main&cursor=" + commits[1].ID)
+	if !strings.Contains(body, link(commits[0])) || strings.Contains(body, link(commits[2])) || strings.Contains(body, "Older commits") {
+		t.Errorf("second commit page wrong")
+	}
+
+	threadPath := "/repo/team/proj.tin/thread/" + thread.ID
+	body = fetch(threadPath)
+	last := thread.Messages[messagesPerPage-1].ID
+	if !strings.Contains(body, "cursor="+last) || strings.Contains(body, `id="msg-`+thread.Messages[messagesPerPage].ID) {
+		t.Errorf("first message page missing next link or shows too many messages")
+	}
+	body = fetch(threadPath + "?cursor=" + last)
+	if !strings.Contains(body, `id="msg-`+thread.Messages[messagesPerPage].ID) || strings.Contains(body, `id="msg-`+last) {
+		t.Errorf("second message page wrong")
+	}
+
+	results := searchRepo(repo, "team/proj.tin", fmt.Sprint("message ", messagesPerPage+1), 1)
+	want := threadPath + "?cursor=" + last + "#msg-" + thread.Messages[messagesPerPage+1].ID
+	if len(results) != 1 || results[0].URL != want {
+		t.Errorf("search URL = %+v, want %s", results, want)
+	}
+
+	resp, err := http.Get(server.URL + threadPath + "?cursor=missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad cursor status = %d, want 400", resp.StatusCode)
+	}
+
+	var page APIThread
+	getJSON(t, server, "/api/v1/repos/team/proj.tin/threads/"+thread.ID+"?limit=3&cursor="+thread.Messages[1].ID, &page)
+	if len(page.Messages) != 3 || page.Messages[0].ID != thread.Messages[2].ID || page.NextCursor != thread.Messages[4].ID {
+		t.Errorf("API page = %d messages, next %q", len(page.Messages), page.NextCursor)
+	}
+}
+
+func TestWebETags(t *testing.T) {
+	server, repo := newAPITestServer(t)
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "hello", "", nil))
+	commit := commitThread(t, repo, thread, "first")
+
+	get := func(path, etag string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.RequestURI = ""
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	paths := []string{
+		"/repo/team/proj.tin",
+		"/repo/team/proj.tin/commit/" + commit.ID,
+		"/repo/team/proj.tin/thread/" + thread.ID,
+		"/api/v1/repos/team/proj.tin/commits/" + commit.ID,
+		"/api/v1/repos/team/proj.tin/threads/" + thread.ID,
+		"/api/v1/repos/team/proj.tin/threads/" + thread.ID + "/versions",
+	}
+	etags := make(map[string]string)
+	for _, path := range paths {
+		resp := get(path, "")
+		etag := resp.Header.Get("ETag")
+		if resp.StatusCode != http.StatusOK || etag == "" {
+			t.Fatalf("GET %s: status %d, ETag %q", path, resp.StatusCode, etag)
+		}
+		if resp := get(path, etag); resp.StatusCode != http.StatusNotModified {
+			t.Errorf("GET %s with ETag: status %d, want 304", path, resp.StatusCode)
+		}
+		etags[path] = etag
+	}
+
+	// A new commit changes the repository and thread pages
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "hi", "", nil))
+	commitThread(t, repo, thread, "second")
+	for _, path := range []string{paths[0], paths[2], paths[4], paths[5]} {
+		if resp := get(path, etags[path]); resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s after commit: status %d, want 200", path, resp.StatusCode)
+		}
+	}
+}
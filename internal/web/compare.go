@@ -0,0 +1,272 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sestinj/tin/internal/git"
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// maxCompareDiffBytes bounds the git diff shown on the compare page
+const maxCompareDiffBytes = 1 << 20
+
+// CompareThread is a thread version referenced on the head side of a comparison
+type CompareThread struct {
+	Thread   *model.Thread
+	Ref      model.ThreadRef
+	CommitID string // Newest commit referencing this version
+}
+
+// DiffFile is one file of a git diff
+type DiffFile struct {
+	Path      string
+	Lines     []DiffLine
+	Additions int
+	Deletions int
+}
+
+// ComparePageData contains data for the branch comparison page
+type ComparePageData struct {
+	Title         string
+	RepoPath      string
+	RepoName      string
+	Branches      []string
+	Base          string // Branch or commit ID as given
+	Head          string
+	BaseCommit    *model.TinCommit
+	HeadCommit    *model.TinCommit
+	Commits       []CommitWithAgents // On head but not on base, newest first
+	Threads       []CompareThread
+	Files         []DiffFile
+	DiffTruncated bool
+	DiffNote      string // Why the git diff is not shown, if it is not
+	CompareURL    string // Comparison on the code host, if known
+	CodeHostURL   *git.CodeHostURL
+	Error         string
+}
+
+// handleCompare shows what head adds to base: /repo/{repo}/compare/{base}...{head}.
+// Without a range it shows a form to pick the branches.
+func (s *WebServer) handleCompare(w http.ResponseWriter, r *http.Request, repoPath, spec string) {
+	repo, err := s.openReadableRepo(r, repoPath)
+	if err != nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if spec == "" && query.Get("base") != "" && query.Get("head") != "" {
+		target := "/repo/" + repoPath + "/compare/" + url.PathEscape(query.Get("base")) + "..." + url.PathEscape(query.Get("head"))
+		http.Redirect(w, r, target, http.StatusSeeOther)
+		return
+	}
+
+	data := ComparePageData{
+		Title:    "Compare",
+		RepoPath: repoPath,
+		RepoName: displayRepoName(repoPath),
+	}
+	data.Branches, _ = repo.ListBranches()
+	if remoteURL := repo.GetCodeHostURL(); remoteURL != "" {
+		data.CodeHostURL = git.ParseGitRemoteURL(remoteURL)
+	}
+
+	status := http.StatusOK
+	if spec != "" {
+		status = s.loadComparison(w, r, repo, spec, &data)
+		if status == http.StatusNotModified {
+			return
+		}
+	} else if head, _ := repo.ReadHead(); head != "" {
+		data.Base = head
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := renderTemplate(w, "compare.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// loadComparison fills in the comparison of the range spec and returns the
+// status to respond with, or 304 if the ETag matched and nothing remains to
+// be written
+func (s *WebServer) loadComparison(w http.ResponseWriter, r *http.Request, repo *storage.Repository, spec string, data *ComparePageData) int {
+	base, head, ok := strings.Cut(spec, "...")
+	if !ok || base == "" || head == "" {
+		data.Error = "Compare expects a range like main...feature"
+		return http.StatusBadRequest
+	}
+	data.Base, data.Head = base, head
+	data.Title = base + "..." + head
+
+	baseID, headID := resolveRevision(repo, base), resolveRevision(repo, head)
+	if baseID == "" || headID == "" {
+		data.Error = "Unknown branch or commit"
+		return http.StatusNotFound
+	}
+	if checkETag(w, r, "compare", data.RepoPath, baseID, headID) {
+		return http.StatusNotModified
+	}
+	data.BaseCommit, _ = repo.LoadCommit(baseID)
+	data.HeadCommit, _ = repo.LoadCommit(headID)
+
+	commits := repo.CommitsBetween(baseID, headID)
+	for _, c := range commits {
+		data.Commits = append(data.Commits, CommitWithAgents{TinCommit: c, Agents: getCommitAgents(repo, c)})
+	}
+	data.Threads = compareThreads(repo, baseID, commits)
+	loadCompareDiff(repo, data)
+	return http.StatusOK
+}
+
+// resolveRevision returns the commit a branch name or commit ID refers to,
+// or "" if it is neither
+func resolveRevision(repo *storage.Repository, rev string) string {
+	if validBranchName(rev) && repo.BranchExists(rev) {
+		id, _ := repo.ReadBranch(rev)
+		return id
+	}
+	if storage.ValidObjectID(rev) && repo.HasCommit(rev) {
+		return rev
+	}
+	return ""
+}
+
+// validBranchName reports whether name is safe to use as a branch path
+func validBranchName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "-") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// compareThreads returns the thread versions referenced by the given commits
+// (newest first) that no commit on base references, latest version first
+func compareThreads(repo *storage.Repository, baseID string, commits []*model.TinCommit) []CompareThread {
+	onBase := make(map[model.ThreadRef]bool)
+	for _, c := range repo.ReachableCommits(baseID) {
+		for _, ref := range c.Threads {
+			onBase[ref] = true
+		}
+	}
+
+	var threads []CompareThread
+	seen := make(map[string]bool)
+	for _, c := range commits {
+		for _, ref := range c.Threads {
+			if seen[ref.ThreadID] || onBase[ref] {
+				continue
+			}
+			seen[ref.ThreadID] = true
+			if thread := loadThreadRef(repo, ref); thread != nil {
+				threads = append(threads, CompareThread{Thread: thread, Ref: ref, CommitID: c.ID})
+			}
+		}
+	}
+	return threads
+}
+
+// loadCompareDiff adds the git diff between the commits' code, when the
+// repository has a git working tree
+func loadCompareDiff(repo *storage.Repository, data *ComparePageData) {
+	if data.BaseCommit == nil || data.HeadCommit == nil {
+		return
+	}
+	baseHash, headHash := data.BaseCommit.GitCommitHash, data.HeadCommit.GitCommitHash
+	if data.CodeHostURL != nil && baseHash != "" && headHash != "" {
+		data.CompareURL = data.CodeHostURL.CompareURL(baseHash, headHash)
+	}
+
+	switch {
+	case baseHash == "" || headHash == "":
+		data.DiffNote = "These commits do not record git commits."
+	case repo.IsBare:
+		data.DiffNote = "This is a bare repository without the git history to diff."
+	default:
+		diff, err := repo.GitDiff(baseHash, headHash)
+		if err != nil {
+			data.DiffNote = "The git commits are not available in this repository."
+			return
+		}
+		if len(diff) > maxCompareDiffBytes {
+			diff = diff[:strings.LastIndexByte(diff[:maxCompareDiffBytes], '\n')+1]
+			data.DiffTruncated = true
+		}
+		data.Files = parseGitDiff(diff)
+	}
+}
+
+// loadToolDiffs returns the git diffs of the working tree changes of the
+// tool calls in messages that recorded them, by tool call ID
+func loadToolDiffs(repo *storage.Repository, messages []model.Message) map[string][]DiffFile {
+	diffs := make(map[string][]DiffFile)
+	if repo.IsBare {
+		return diffs // No git objects to diff
+	}
+	for _, msg := range messages {
+		for _, tc := range msg.ToolCalls {
+			if tc.Snapshot == nil {
+				continue
+			}
+			diff, err := repo.GitDiffSnapshots(tc.Snapshot.Before, tc.Snapshot.After)
+			if err != nil {
+				continue
+			}
+			if len(diff) > maxCompareDiffBytes {
+				diff = diff[:strings.LastIndexByte(diff[:maxCompareDiffBytes], '\n')+1]
+			}
+			diffs[tc.ID] = parseGitDiff(diff)
+		}
+	}
+	return diffs
+}
+
+// parseGitDiff splits the output of git diff into files
+func parseGitDiff(diff string) []DiffFile {
+	var files []DiffFile
+	var file *DiffFile
+	inHunk := false
+	for _, line := range splitLines(diff) {
+		if header, ok := strings.CutPrefix(line, "diff --git "); ok {
+			path := header
+			if i := strings.LastIndex(header, " b/"); i != -1 {
+				path = header[i+3:]
+			}
+			files = append(files, DiffFile{Path: path})
+			file = &files[len(files)-1]
+			inHunk = false
+			continue
+		}
+		if file == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			file.Lines = append(file.Lines, DiffLine{Kind: "hunk", Text: line})
+		case !inHunk:
+			// File headers: modes, renames, index, ---/+++ and binary notes
+			if strings.HasPrefix(line, "Binary files") {
+				file.Lines = append(file.Lines, DiffLine{Kind: "hunk", Text: line})
+			}
+		case strings.HasPrefix(line, "+"):
+			file.Additions++
+			file.Lines = append(file.Lines, DiffLine{Kind: "add", Text: line})
+		case strings.HasPrefix(line, "-"):
+			file.Deletions++
+			file.Lines = append(file.Lines, DiffLine{Kind: "del", Text: line})
+		default:
+			file.Lines = append(file.Lines, DiffLine{Kind: "context", Text: line})
+		}
+	}
+	return files
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+func TestParseGitDiff(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var x = 1
++var x = 2
+ func main() {}
+diff --git a/logo.png b/logo.png
+new file mode 100644
+index 0000000..3333333
+Binary files /dev/null and b/logo.png differ
+`
+	files := parseGitDiff(diff)
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	if f := files[0]; f.Path != "main.go" || f.Additions != 1 || f.Deletions != 1 || len(f.Lines) != 5 {
+		t.Errorf("main.go = %+v", f)
+	}
+	if f := files[1]; f.Path != "logo.png" || len(f.Lines) != 1 || !strings.HasPrefix(f.Lines[0].Text, "Binary") {
+		t.Errorf("logo.png = %+v", f)
+	}
+}
+
+func TestComparePage(t *testing.T) {
+	server, repo := newAPITestServer(t)
+
+	shared := model.NewThread("claude-code", "", "", "")
+	shared.AddMessage(model.NewMessage(model.RoleHuman, "set up the project", "", nil))
+	base := commitThread(t, repo, shared, "scaffold")
+
+	featureThread := model.NewThread("claude-code", "", "", "")
+	featureThread.AddMessage(model.NewMessage(model.RoleHuman, "add dark mode", "", nil))
+	if err := repo.SaveThread(featureThread); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.SaveThreadVersion(featureThread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := []model.ThreadRef{
+		{ThreadID: shared.ID, MessageCount: 1, ContentHash: shared.ComputeContentHash()},
+		{ThreadID: featureThread.ID, MessageCount: 1, ContentHash: hash},
+	}
+	feature := model.NewTinCommit("dark mode", refs, "", base.ID)
+	if err := repo.SaveCommit(feature); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.WriteBranch("feature/dark", feature.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := fetch("/repo/team/proj.tin/compare/main...feature/dark")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if !strings.Contains(body, "/commit/"+feature.ID) || strings.Contains(body, "/commit/"+base.ID) {
+		t.Error("compare should list only the feature commit")
+	}
+	if !strings.Contains(body, "/thread/"+featureThread.ID) || strings.Contains(body, "/thread/"+shared.ID) {
+		t.Error("compare should list only the thread new on the feature branch")
+	}
+	if !strings.Contains(body, "do not record git commits") {
+		t.Error("compare should explain the missing git diff")
+	}
+
+	if status, body := fetch("/repo/team/proj.tin/compare/feature/dark..." + base.ID); status != http.StatusOK || !strings.Contains(body, "has no commits") {
+		t.Errorf("reverse compare: status %d", status)
+	}
+	if status, _ := fetch("/repo/team/proj.tin/compare/main...missing"); status != http.StatusNotFound {
+		t.Errorf("unknown branch status = %d, want 404", status)
+	}
+	for _, name := range []string{"../config", "feature/../../config", "/etc/passwd", "-x", "a//b"} {
+		if validBranchName(name) {
+			t.Errorf("validBranchName(%q) = true", name)
+		}
+	}
+	if status, _ := fetch("/repo/team/proj.tin/compare/main"); status != http.StatusBadRequest {
+		t.Errorf("missing range status = %d, want 400", status)
+	}
+
+	client := &http.Client{CheckRedirect: noRedirects}
+	resp, err := client.Get(server.URL + "/repo/team/proj.tin/compare?base=main&head=feature/dark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if loc := resp.Header.Get("Location"); loc != "/repo/team/proj.tin/compare/main...feature%2Fdark" {
+		t.Errorf("form redirect = %q", loc)
+	}
+}
@@ -0,0 +1,254 @@
+package web
+
+import (
+	"container/heap"
+	"net/http"
+	"slices"
+
+	"github.com/sestinj/tin/internal/git"
+	"github.com/sestinj/tin/internal/model"
+)
+
+// graphCommitLimit bounds the commits shown on the graph page
+const graphCommitLimit = 200
+
+// Graph row geometry, in pixels
+const (
+	graphLaneWidth = 14
+	graphRowHeight = 28
+)
+
+// graphColors are the lane colors, reused when there are more lanes
+var graphColors = []string{"#4a90d9", "#e8793a", "#3aa55d", "#d94a4a", "#8e5fd9", "#8c6d46", "#d95fb2", "#2aa5b5"}
+
+// GraphRow is a commit in the graph with the lines drawn around its node
+type GraphRow struct {
+	Commit   CommitWithAgents
+	Branches []string // Branches pointing at the commit
+	NodeX    int
+	Color    string
+	Lines    []GraphLine
+}
+
+// GraphLine is a line segment within a graph row
+type GraphLine struct {
+	X1, Y1, X2, Y2 int
+	Color          string
+}
+
+// GraphPageData contains data for the commit graph page
+type GraphPageData struct {
+	Title       string
+	RepoPath    string
+	RepoName    string
+	Rows        []GraphRow
+	Width       int // Width of the graph column
+	RowHeight   int
+	NodeY       int  // Vertical center of the rows
+	Limited     bool // True if older commits are not shown
+	CodeHostURL *git.CodeHostURL
+}
+
+// handleGraph shows the commits of all branches as a DAG, newest first
+func (s *WebServer) handleGraph(w http.ResponseWriter, r *http.Request, repoPath string) {
+	repo, err := s.openReadableRepo(r, repoPath)
+	if err != nil {
+		http.Error(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	branchNames, _ := repo.ListBranches()
+	tips := make(map[string][]string)
+	var tipIDs []string
+	for _, name := range branchNames {
+		if id, _ := repo.ReadBranch(name); id != "" {
+			tips[id] = append(tips[id], name)
+			tipIDs = append(tipIDs, id)
+		}
+	}
+	if checkETag(w, r, append([]string{"graph", repoPath, s.index.get(repo).stamp()}, tipIDs...)...) {
+		return
+	}
+
+	commits := topoSortCommits(repo.ReachableCommits(tipIDs...))
+	data := GraphPageData{
+		Title:     repoPath,
+		RepoPath:  repoPath,
+		RepoName:  displayRepoName(repoPath),
+		RowHeight: graphRowHeight,
+		NodeY:     graphRowHeight / 2,
+	}
+	if len(commits) > graphCommitLimit {
+		commits = commits[:graphCommitLimit]
+		data.Limited = true
+	}
+	var lanes int
+	data.Rows, lanes = layoutGraph(commits)
+	data.Width = max(lanes, 1) * graphLaneWidth
+	for i := range data.Rows {
+		row := &data.Rows[i]
+		row.Commit.Agents = getCommitAgents(repo, row.Commit.TinCommit)
+		row.Branches = tips[row.Commit.ID]
+	}
+	if remoteURL := repo.GetCodeHostURL(); remoteURL != "" {
+		data.CodeHostURL = git.ParseGitRemoteURL(remoteURL)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := renderTemplate(w, "graph.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// commitHeap orders commits newest first
+type commitHeap []*model.TinCommit
+
+func (h commitHeap) Len() int { return len(h) }
+func (h commitHeap) Less(i, j int) bool {
+	if !h[i].Timestamp.Equal(h[j].Timestamp) {
+		return h[i].Timestamp.After(h[j].Timestamp)
+	}
+	return h[i].ID < h[j].ID
+}
+func (h commitHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *commitHeap) Push(x any)   { *h = append(*h, x.(*model.TinCommit)) }
+func (h *commitHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// topoSortCommits orders commits newest first, but always after all of
+// their children, so lines in the graph only run downwards
+func topoSortCommits(commits map[string]*model.TinCommit) []*model.TinCommit {
+	children := make(map[string]int)
+	for _, c := range commits {
+		for _, parent := range commitParents(c, commits) {
+			children[parent]++
+		}
+	}
+
+	ready := &commitHeap{}
+	for id, c := range commits {
+		if children[id] == 0 {
+			*ready = append(*ready, c)
+		}
+	}
+	heap.Init(ready)
+
+	sorted := make([]*model.TinCommit, 0, len(commits))
+	for ready.Len() > 0 {
+		c := heap.Pop(ready).(*model.TinCommit)
+		sorted = append(sorted, c)
+		for _, parent := range commitParents(c, commits) {
+			if children[parent]--; children[parent] == 0 {
+				heap.Push(ready, commits[parent])
+			}
+		}
+	}
+	return sorted
+}
+
+// commitParents returns the parents of a commit that are in the set
+func commitParents(c *model.TinCommit, commits map[string]*model.TinCommit) []string {
+	var parents []string
+	for _, id := range []string{c.ParentCommitID, c.SecondParentID} {
+		if id != "" && commits[id] != nil && !slices.Contains(parents, id) {
+			parents = append(parents, id)
+		}
+	}
+	return parents
+}
+
+// layoutGraph assigns each commit a lane, like git log --graph: a lane holds
+// the commit expected next on it, a commit continues its first parent's lane,
+// and merge parents get a lane of their own. It returns the rows and the
+// number of lanes used.
+func layoutGraph(commits []*model.TinCommit) ([]GraphRow, int) {
+	inGraph := make(map[string]*model.TinCommit, len(commits))
+	for _, c := range commits {
+		inGraph[c.ID] = c
+	}
+	laneX := func(i int) int { return i*graphLaneWidth + graphLaneWidth/2 }
+	color := func(i int) string { return graphColors[i%len(graphColors)] }
+	mid := graphRowHeight / 2
+
+	var lanes []string
+	maxLanes := 0
+	rows := make([]GraphRow, 0, len(commits))
+	for _, c := range commits {
+		before := slices.Clone(lanes)
+		col := slices.Index(lanes, c.ID)
+		if col == -1 {
+			col = freeLane(&lanes, -1)
+		}
+
+		row := GraphRow{Commit: CommitWithAgents{TinCommit: c}, NodeX: laneX(col), Color: color(col)}
+		for i, id := range before {
+			switch {
+			case id == "":
+			case id == c.ID:
+				row.Lines = append(row.Lines, GraphLine{laneX(i), 0, laneX(col), mid, color(i)})
+			default:
+				row.Lines = append(row.Lines, GraphLine{laneX(i), 0, laneX(i), mid, color(i)})
+			}
+		}
+
+		// Lanes that were waiting for this commit end here; its first parent
+		// continues in its lane and other parents join or open a lane
+		for i := range lanes {
+			if lanes[i] == c.ID {
+				lanes[i] = ""
+			}
+		}
+		parents := commitParents(c, inGraph)
+		if c.ParentCommitID != "" && inGraph[c.ParentCommitID] == nil {
+			// The first parent is beyond the limit; keep the lane running
+			parents = append([]string{c.ParentCommitID}, parents...)
+		}
+		targets := make(map[int]bool)
+		for i, parent := range parents {
+			lane := slices.Index(lanes, parent)
+			if i == 0 {
+				lanes[col] = parent
+				lane = col
+			} else if lane == -1 {
+				lane = freeLane(&lanes, col)
+				lanes[lane] = parent
+			}
+			targets[lane] = true
+		}
+
+		for i, id := range lanes {
+			if id == "" {
+				continue
+			}
+			if targets[i] {
+				row.Lines = append(row.Lines, GraphLine{laneX(col), mid, laneX(i), graphRowHeight, color(i)})
+			}
+			if i < len(before) && before[i] == id && id != c.ID {
+				row.Lines = append(row.Lines, GraphLine{laneX(i), mid, laneX(i), graphRowHeight, color(i)})
+			}
+		}
+
+		maxLanes = max(maxLanes, len(lanes))
+		for len(lanes) > 0 && lanes[len(lanes)-1] == "" {
+			lanes = lanes[:len(lanes)-1]
+		}
+		rows = append(rows, row)
+	}
+	return rows, maxLanes
+}
+
+// freeLane returns the first empty lane other than skip, adding one if
+// every lane is in use
+func freeLane(lanes *[]string, skip int) int {
+	for i, id := range *lanes {
+		if id == "" && i != skip {
+			return i
+		}
+	}
+	*lanes = append(*lanes, "")
+	return len(*lanes) - 1
+}
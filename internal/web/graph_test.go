@@ -0,0 +1,103 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+func TestLayoutGraph(t *testing.T) {
+	at := func(minutes int) time.Time { return time.Date(2026, 1, 1, 0, minutes, 0, 0, time.UTC) }
+	commit := func(id string, minutes int, parents ...string) *model.TinCommit {
+		c := &model.TinCommit{ID: id, Timestamp: at(minutes)}
+		if len(parents) > 0 {
+			c.ParentCommitID = parents[0]
+		}
+		if len(parents) > 1 {
+			c.SecondParentID = parents[1]
+		}
+		return c
+	}
+
+	// root <- a <- merge(a, f) on main, root <- f on feature, and a newer
+	// feature commit g on top of f
+	commits := map[string]*model.TinCommit{}
+	for _, c := range []*model.TinCommit{
+		commit("root", 0),
+		commit("a", 1, "root"),
+		commit("f", 2, "root"),
+		commit("merge", 3, "a", "f"),
+		commit("g", 4, "f"),
+	} {
+		commits[c.ID] = c
+	}
+
+	sorted := topoSortCommits(commits)
+	var order []string
+	for _, c := range sorted {
+		order = append(order, c.ID)
+	}
+	if got := strings.Join(order, " "); got != "g merge f a root" {
+		t.Fatalf("order = %q, want %q", got, "g merge f a root")
+	}
+
+	rows, lanes := layoutGraph(sorted)
+	if lanes != 2 {
+		t.Errorf("lanes = %d, want 2", lanes)
+	}
+	wantX := map[string]int{"g": 0, "merge": 1, "f": 0, "a": 1, "root": 0}
+	for _, row := range rows {
+		if want := wantX[row.Commit.ID]*graphLaneWidth + graphLaneWidth/2; row.NodeX != want {
+			t.Errorf("%s at x=%d, want %d", row.Commit.ID, row.NodeX, want)
+		}
+	}
+	// The merge commit has an edge to each parent's lane
+	var fromMerge int
+	for _, line := range rows[1].Lines {
+		if line.Y1 == graphRowHeight/2 && line.X1 == rows[1].NodeX {
+			fromMerge++
+		}
+	}
+	if fromMerge != 2 {
+		t.Errorf("merge commit has %d edges to parents, want 2: %+v", fromMerge, rows[1].Lines)
+	}
+	// The root has no lines below it
+	for _, line := range rows[len(rows)-1].Lines {
+		if line.Y2 > graphRowHeight/2 {
+			t.Errorf("line below root: %+v", line)
+		}
+	}
+}
+
+func TestGraphPage(t *testing.T) {
+	server, repo := newAPITestServer(t)
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "start", "", nil))
+	base := commitThread(t, repo, thread, "on main")
+	feature := model.NewTinCommit("on feature", nil, "", base.ID)
+	if err := repo.SaveCommit(feature); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.WriteBranch("feature/x", feature.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(server.URL + "/repo/team/proj.tin/graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	for _, want := range []string{"<svg", `class="branch-label">feature/x</a>`, `class="branch-label">main</a>`, shortID(base.ID), shortID(feature.ID)} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("graph page missing %s", want)
+		}
+	}
+}
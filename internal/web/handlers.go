@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/sestinj/tin/internal/git"
@@ -18,6 +19,7 @@ type IndexPageData struct {
 	Title    string
 	RootPath string
 	Repos    []RepoInfo
+	User     string // Signed-in user, if any
 }
 
 // BranchInfo contains branch metadata for display
@@ -42,6 +44,8 @@ type RepoPageData struct {
 	SelectedBranch string
 	Commits        []CommitWithAgents
 	CodeHostURL    *git.CodeHostURL
+	Cursor         string // Commit the page starts at (empty = branch tip)
+	NextCursor     string // Commit the next (older) page starts at, if any
 }
 
 // ThreadWithContext wraps a thread with its continuation info
@@ -81,12 +85,17 @@ type ThreadPageData struct {
 	RepoPath       string
 	RepoName       string
 	Thread         *model.Thread
-	ParentThread   *model.Thread   // Thread this continues from (if any)
+	ParentThread   *model.Thread   // Thread this continues from, or that launched it (if any)
 	ChildThreads   []*model.Thread // Threads that continue from this one
+	Subagents      map[string][]*model.Thread // Subagent threads, by the tool call that launched them
+	ToolDiffs      map[string][]DiffFile      // Working tree changes, by the tool call that made them
 	CodeHostURL    *git.CodeHostURL
 	CurrentVersion string            // Content hash of currently displayed version (empty = latest)
 	LatestCount    int               // Message count in latest version
 	Versions       []ThreadVersionInfo // All versions of this thread
+	Messages       []model.Message   // Messages on this page
+	Cursor         string            // Message the page follows (empty = first page)
+	NextCursor     string            // Last message on this page, if there are more
 }
 
 // handleIndex handles the landing page showing all repositories
@@ -105,7 +114,8 @@ func (s *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 	data := IndexPageData{
 		Title:    "Repositories",
 		RootPath: s.rootPath,
-		Repos:    repos,
+		Repos:    s.readableRepos(r, repos),
+		User:     requestUser(r).ID,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -116,10 +126,26 @@ func (s *WebServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 
 // handleRepo routes repository requests to the appropriate handler
 func (s *WebServer) handleRepo(w http.ResponseWriter, r *http.Request) {
-	// Parse: /repo/{repo-path} or /repo/{repo-path}/commit/{id} or /repo/{repo-path}/thread/{id}
+	// Parse: /repo/{repo-path} or /repo/{repo-path}/commit/{id} or /repo/{repo-path}/thread/{id},
+	// /repo/{repo-path}/graph or /repo/{repo-path}/compare/{base}...{head}
 	path := strings.TrimPrefix(r.URL.Path, "/repo/")
 	path = strings.TrimSuffix(path, "/")
 
+	// Check for /compare/{base}...{head} and /compare, before the other
+	// segments since branch names may contain them
+	if idx := strings.Index(path, "/compare/"); idx != -1 {
+		s.handleCompare(w, r, path[:idx], path[idx+9:])
+		return
+	}
+	if repoPath, ok := strings.CutSuffix(path, "/compare"); ok {
+		s.handleCompare(w, r, repoPath, "")
+		return
+	}
+	if repoPath, ok := strings.CutSuffix(path, "/graph"); ok {
+		s.handleGraph(w, r, repoPath)
+		return
+	}
+
 	// Check for /commit/ segment
 	if idx := strings.Index(path, "/commit/"); idx != -1 {
 		repoPath := path[:idx]
@@ -142,9 +168,7 @@ func (s *WebServer) handleRepo(w http.ResponseWriter, r *http.Request) {
 
 // handleRepoPage displays a repository's branches and commits
 func (s *WebServer) handleRepoPage(w http.ResponseWriter, r *http.Request, repoPath string) {
-	absPath := filepath.Join(s.rootPath, repoPath)
-
-	repo, err := openRepo(absPath)
+	repo, err := s.openReadableRepo(r, repoPath)
 	if err != nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
@@ -168,11 +192,30 @@ func (s *WebServer) handleRepoPage(w http.ResponseWriter, r *http.Request, repoP
 		}
 	}
 
-	// Get commits for selected branch and compute agents for each
+	// Get a page of commits for selected branch, starting at the branch tip
+	// or the cursor, and compute agents for each
 	var commits []CommitWithAgents
 	branchCommitID, _ := repo.ReadBranch(selectedBranch)
-	if branchCommitID != "" {
-		rawCommits, _ := repo.GetCommitHistory(branchCommitID, 50)
+	cursor := r.URL.Query().Get("cursor")
+	start := branchCommitID
+	if cursor != "" {
+		if !storage.ValidObjectID(cursor) || !repo.HasCommit(cursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		start = cursor
+	}
+	if checkETag(w, r, "repo", repoPath, selectedBranch, branchCommitID, start, s.index.get(repo).stamp()) {
+		return
+	}
+
+	var nextCursor string
+	if start != "" {
+		rawCommits, _ := repo.GetCommitHistory(start, commitsPerPage+1)
+		if len(rawCommits) > commitsPerPage {
+			nextCursor = rawCommits[commitsPerPage].ID
+			rawCommits = rawCommits[:commitsPerPage]
+		}
 		for _, commit := range rawCommits {
 			agents := getCommitAgents(repo, commit)
 			commits = append(commits, CommitWithAgents{
@@ -196,6 +239,8 @@ func (s *WebServer) handleRepoPage(w http.ResponseWriter, r *http.Request, repoP
 		SelectedBranch: selectedBranch,
 		Commits:        commits,
 		CodeHostURL:    codeHostURL,
+		Cursor:         cursor,
+		NextCursor:     nextCursor,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -206,20 +251,29 @@ func (s *WebServer) handleRepoPage(w http.ResponseWriter, r *http.Request, repoP
 
 // handleCommit displays a single commit with its full conversation
 func (s *WebServer) handleCommit(w http.ResponseWriter, r *http.Request, repoPath, commitID string) {
-	absPath := filepath.Join(s.rootPath, repoPath)
-
-	repo, err := openRepo(absPath)
+	repo, err := s.openReadableRepo(r, repoPath)
 	if err != nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 
+	if !storage.ValidObjectID(commitID) {
+		http.Error(w, "Commit not found", http.StatusNotFound)
+		return
+	}
 	commit, err := repo.LoadCommit(commitID)
 	if err != nil {
 		http.Error(w, "Commit not found", http.StatusNotFound)
 		return
 	}
 
+	// Commits are immutable; the page also shows the latest thread versions
+	// and continuations, which only change when the index does
+	index := s.index.get(repo)
+	if checkETag(w, r, "commit", repoPath, commitID, index.stamp()) {
+		return
+	}
+
 	// Load all threads referenced in commit with their continuation context
 	var threads []ThreadWithContext
 	for _, ref := range commit.Threads {
@@ -258,7 +312,7 @@ func (s *WebServer) handleCommit(w http.ResponseWriter, r *http.Request, repoPat
 			}
 
 			// Find any threads that continue from this one
-			twc.ChildThreads, _ = repo.FindChildThreads(thread.ID)
+			twc.ChildThreads = index.children[thread.ID]
 
 			threads = append(threads, twc)
 		}
@@ -298,15 +352,17 @@ func (s *WebServer) handleCommit(w http.ResponseWriter, r *http.Request, repoPat
 
 // handleThread displays a single thread with its full conversation
 func (s *WebServer) handleThread(w http.ResponseWriter, r *http.Request, repoPath, threadID string) {
-	absPath := filepath.Join(s.rootPath, repoPath)
-
-	repo, err := openRepo(absPath)
+	repo, err := s.openReadableRepo(r, repoPath)
 	if err != nil {
 		http.Error(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 
 	// Load the latest version first
+	if !storage.ValidObjectID(threadID) {
+		http.Error(w, "Thread not found", http.StatusNotFound)
+		return
+	}
 	latestThread, err := repo.LoadThread(threadID)
 	if err != nil {
 		http.Error(w, "Thread not found", http.StatusNotFound)
@@ -323,46 +379,23 @@ func (s *WebServer) handleThread(w http.ResponseWriter, r *http.Request, repoPat
 		}
 	}
 
-	// Build version info: find all versions and which commits reference them
-	var versions []ThreadVersionInfo
-	versionHashes, _ := repo.ListThreadVersions(threadID)
-	commits, _ := repo.ListCommits()
-
-	// Build a map of content_hash -> commits that reference it
-	hashToCommits := make(map[string][]*model.TinCommit)
-	for _, commit := range commits {
-		for _, ref := range commit.Threads {
-			if ref.ThreadID == threadID && ref.ContentHash != "" {
-				hashToCommits[ref.ContentHash] = append(hashToCommits[ref.ContentHash], commit)
-			}
-		}
+	// Versions are immutable, so the page only changes with the latest
+	// version, the displayed page and the index
+	latestHash := latestThread.ComputeContentHash()
+	index := s.index.get(repo)
+	cursor := r.URL.Query().Get("cursor")
+	if checkETag(w, r, "thread", repoPath, threadID, latestHash, thread.ComputeContentHash(), cursor, index.stamp()) {
+		return
 	}
 
-	// Create version info for each version that is referenced by at least one commit
-	for _, hash := range versionHashes {
-		if commitList, ok := hashToCommits[hash]; ok && len(commitList) > 0 {
-			vThread, vErr := repo.LoadThreadVersion(threadID, hash)
-			if vErr != nil {
-				continue
-			}
-			versions = append(versions, ThreadVersionInfo{
-				ContentHash:  hash,
-				MessageCount: len(vThread.Messages),
-				Commits:      commitList,
-				IsCurrent:    hash == requestedVersion || (requestedVersion == "" && hash == latestThread.ComputeContentHash()),
-				IsLatest:     hash == latestThread.ComputeContentHash(),
-			})
-		}
+	messages, nextCursor, ok := pageMessages(thread.Messages, cursor, messagesPerPage)
+	if !ok {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
 
-	// Sort versions by message count (ascending)
-	for i := 0; i < len(versions); i++ {
-		for j := i + 1; j < len(versions); j++ {
-			if versions[i].MessageCount > versions[j].MessageCount {
-				versions[i], versions[j] = versions[j], versions[i]
-			}
-		}
-	}
+	// Build version info: find all versions and which commits reference them
+	versions := buildThreadVersions(index, repo, threadID, latestHash, requestedVersion)
 
 	// Load parent thread if this is a continuation
 	var parentThread *model.Thread
@@ -370,8 +403,12 @@ func (s *WebServer) handleThread(w http.ResponseWriter, r *http.Request, repoPat
 		parentThread, _ = repo.LoadThread(thread.ParentThreadID)
 	}
 
-	// Find any threads that continue from this one
-	childThreads, _ := repo.FindChildThreads(thread.ID)
+	// Find any threads that continue from this one, and its subagents
+	childThreads := index.children[thread.ID]
+	subagents := make(map[string][]*model.Thread)
+	for _, child := range index.subagents[thread.ID] {
+		subagents[child.ParentToolCallID] = append(subagents[child.ParentToolCallID], child)
+	}
 
 	// Try to detect code host URL from config or git remote
 	var codeHostURL *git.CodeHostURL
@@ -386,10 +423,15 @@ func (s *WebServer) handleThread(w http.ResponseWriter, r *http.Request, repoPat
 		Thread:         thread,
 		ParentThread:   parentThread,
 		ChildThreads:   childThreads,
+		Subagents:      subagents,
+		ToolDiffs:      loadToolDiffs(repo, messages),
 		CodeHostURL:    codeHostURL,
 		CurrentVersion: requestedVersion,
 		LatestCount:    latestCount,
 		Versions:       versions,
+		Messages:       messages,
+		Cursor:         cursor,
+		NextCursor:     nextCursor,
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -398,6 +440,50 @@ func (s *WebServer) handleThread(w http.ResponseWriter, r *http.Request, repoPat
 	}
 }
 
+// buildThreadVersions lists the versions of a thread that are referenced by at
+// least one commit, ordered by message count. currentHash marks the displayed
+// version; if empty, the latest version is current.
+func buildThreadVersions(index *repoIndex, repo *storage.Repository, threadID, latestHash, currentHash string) []ThreadVersionInfo {
+	var versions []ThreadVersionInfo
+
+	// The index maps each content hash to the commits that reference it
+	hashToCommits := index.versions[threadID]
+	hashes := make([]string, 0, len(hashToCommits))
+	for hash := range hashToCommits {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	// Create version info for each referenced version that exists
+	for _, hash := range hashes {
+		if !repo.HasThreadVersion(threadID, hash) {
+			continue
+		}
+		// Commits record the message count; only very old ones need the version loaded
+		count, ok := index.messageCounts[threadID][hash]
+		if !ok {
+			vThread, vErr := repo.LoadThreadVersion(threadID, hash)
+			if vErr != nil {
+				continue
+			}
+			count = len(vThread.Messages)
+		}
+		versions = append(versions, ThreadVersionInfo{
+			ContentHash:  hash,
+			MessageCount: count,
+			Commits:      hashToCommits[hash],
+			IsCurrent:    hash == currentHash || (currentHash == "" && hash == latestHash),
+			IsLatest:     hash == latestHash,
+		})
+	}
+
+	// Sort versions by message count (ascending)
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].MessageCount < versions[j].MessageCount
+	})
+	return versions
+}
+
 // openRepo tries to open a repository at the exact path given
 func openRepo(path string) (*storage.Repository, error) {
 	// First check if this is a bare repository (has HEAD, refs/, threads/ directly)
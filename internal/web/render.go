@@ -0,0 +1,586 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"html/template"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+// Tool call kinds, each rendered differently on thread pages
+const (
+	ToolKindEdit  = "edit"
+	ToolKindWrite = "write"
+	ToolKindRead  = "read"
+	ToolKindBash  = "bash"
+	ToolKindFetch = "fetch"
+	ToolKindOther = "other"
+)
+
+// collapseResultLines is the length from which tool results start collapsed
+const collapseResultLines = 15
+
+// diffContext is how many unchanged lines are kept around each change
+const diffContext = 3
+
+// maxDiffCells bounds the line-diff table; larger edits are shown as a full
+// removal followed by a full addition
+const maxDiffCells = 1 << 20
+
+// toolKinds maps normalized tool names (lowercase, without '_' and '-') of
+// the agents tin captures to a kind
+var toolKinds = map[string]string{
+	"edit":           ToolKindEdit,
+	"multiedit":      ToolKindEdit,
+	"editfile":       ToolKindEdit,
+	"strreplace":     ToolKindEdit,
+	"searchreplace":  ToolKindEdit,
+	"applypatch":     ToolKindEdit,
+	"write":          ToolKindWrite,
+	"writefile":      ToolKindWrite,
+	"createfile":     ToolKindWrite,
+	"read":           ToolKindRead,
+	"readfile":       ToolKindRead,
+	"view":           ToolKindRead,
+	"bash":           ToolKindBash,
+	"shell":          ToolKindBash,
+	"runterminalcmd": ToolKindBash,
+	"runcommand":     ToolKindBash,
+	"webfetch":       ToolKindFetch,
+	"fetch":          ToolKindFetch,
+	"readwebpage":    ToolKindFetch,
+}
+
+// ToolCallView is a tool call prepared for display
+type ToolCallView struct {
+	Kind        string
+	Name        string
+	Target      string        // File path, command or URL the call acts on
+	TargetURL   string        // Set if Target is a safe link
+	Description string        // Command description or fetch prompt
+	Diff        []DiffLine    // Edits
+	Code        template.HTML // Highlighted file content of writes and reads
+	Arguments   string        // Indented arguments of other tools
+	Files       []DiffFile    // Working tree change the call made, if snapshotted
+	Result      string
+	ResultLines int
+	Collapsed   bool // True if the result is long enough to start hidden
+}
+
+// DiffLine is a line of a unified diff, including its +, - or space prefix
+type DiffLine struct {
+	Kind string // "add", "del", "context" or "hunk"
+	Text string
+}
+
+// toolCallView interprets a tool call's arguments according to its kind.
+// The git diff of the working tree change the call made, if known, is shown
+// in place of the change its arguments describe.
+func toolCallView(tc model.ToolCall, files ...[]DiffFile) ToolCallView {
+	view := ToolCallView{Kind: toolKind(tc.Name), Name: tc.Name, Result: tc.Result}
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal(tc.Arguments, &args); err != nil {
+		view.Kind = ToolKindOther
+	}
+
+	switch view.Kind {
+	case ToolKindEdit:
+		view.Target = stringArg(args, "file_path", "path", "target_file")
+		view.Diff = editDiff(args)
+		if patch := stringArg(args, "patch"); patch != "" {
+			view.Target, view.Diff = patchDiff(patch)
+		}
+	case ToolKindWrite:
+		view.Target = stringArg(args, "file_path", "path", "target_file")
+		view.Code = highlight(stringArg(args, "content", "file_text", "contents"), languageForPath(view.Target))
+	case ToolKindRead:
+		view.Target = stringArg(args, "file_path", "path", "target_file")
+		if view.Result != "" {
+			view.Code = highlight(view.Result, languageForPath(view.Target))
+			view.Result = ""
+		}
+	case ToolKindBash:
+		view.Target = stringArg(args, "command", "cmd")
+		view.Description = stringArg(args, "description", "explanation")
+	case ToolKindFetch:
+		view.Target = stringArg(args, "url")
+		view.Description = stringArg(args, "prompt", "objective")
+		if strings.HasPrefix(view.Target, "https://") || strings.HasPrefix(view.Target, "http://") {
+			view.TargetURL = view.Target
+		}
+	}
+	if view.Kind == ToolKindOther || (view.Target == "" && view.Code == "" && view.Diff == nil) {
+		view.Kind = ToolKindOther
+		var indented bytes.Buffer
+		if json.Indent(&indented, tc.Arguments, "", "  ") == nil {
+			view.Arguments = indented.String()
+		} else {
+			view.Arguments = string(tc.Arguments)
+		}
+	}
+	if len(files) > 0 && len(files[0]) > 0 {
+		view.Files = files[0]
+		if view.Kind == ToolKindEdit || view.Kind == ToolKindWrite {
+			view.Diff, view.Code = nil, ""
+		}
+	}
+
+	if view.Result != "" {
+		view.ResultLines = strings.Count(strings.TrimRight(view.Result, "\n"), "\n") + 1
+		view.Collapsed = view.ResultLines > collapseResultLines
+	}
+	return view
+}
+
+// toolKind returns the kind of a tool from its name
+func toolKind(name string) string {
+	normalized := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+	if kind, ok := toolKinds[normalized]; ok {
+		return kind
+	}
+	return ToolKindOther
+}
+
+// stringArg returns the first of the given arguments that is a non-empty string
+func stringArg(args map[string]json.RawMessage, keys ...string) string {
+	for _, key := range keys {
+		var value string
+		if json.Unmarshal(args[key], &value) == nil && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// editDiff returns the diff of an edit, or of each edit of a multi-edit
+func editDiff(args map[string]json.RawMessage) []DiffLine {
+	var edits []map[string]json.RawMessage
+	if err := json.Unmarshal(args["edits"], &edits); err != nil || len(edits) == 0 {
+		edits = []map[string]json.RawMessage{args}
+	}
+
+	var diff []DiffLine
+	for i, edit := range edits {
+		oldText := stringArg(edit, "old_string", "old_str", "old_text")
+		newText := stringArg(edit, "new_string", "new_str", "new_text")
+		if oldText == "" && newText == "" {
+			continue
+		}
+		if i > 0 {
+			diff = append(diff, DiffLine{Kind: "hunk", Text: "@@"})
+		}
+		diff = append(diff, lineDiff(oldText, newText)...)
+	}
+	return diff
+}
+
+// patchDiff returns the diff of a Codex patch ("*** Begin Patch" format),
+// and the file it changes, or the first of the files
+func patchDiff(patch string) (string, []DiffLine) {
+	target := ""
+	var diff []DiffLine
+	for _, line := range splitLines(patch) {
+		switch {
+		case line == "*** Begin Patch" || line == "*** End Patch" || line == "*** End of File":
+		case strings.HasPrefix(line, "*** "):
+			// File headers: Add, Update or Delete File, and Move to
+			if _, path, ok := strings.Cut(line, " File: "); ok && target == "" {
+				target = path
+			}
+			diff = append(diff, DiffLine{Kind: "hunk", Text: line[4:]})
+		case strings.HasPrefix(line, "@@"):
+			diff = append(diff, DiffLine{Kind: "hunk", Text: line})
+		case strings.HasPrefix(line, "+"):
+			diff = append(diff, DiffLine{Kind: "add", Text: line})
+		case strings.HasPrefix(line, "-"):
+			diff = append(diff, DiffLine{Kind: "del", Text: line})
+		default:
+			diff = append(diff, DiffLine{Kind: "context", Text: line})
+		}
+	}
+	return target, diff
+}
+
+// lineDiff returns a unified diff of two texts, with unchanged runs longer
+// than the context elided
+func lineDiff(oldText, newText string) []DiffLine {
+	a, b := splitLines(oldText), splitLines(newText)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []DiffLine
+	for _, line := range a[:prefix] {
+		lines = append(lines, DiffLine{Kind: "context", Text: " " + line})
+	}
+	lines = append(lines, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		lines = append(lines, DiffLine{Kind: "context", Text: " " + line})
+	}
+	return elideContext(lines)
+}
+
+// diffMiddle diffs two line lists using their longest common subsequence
+func diffMiddle(a, b []string) []DiffLine {
+	var lines []DiffLine
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			lines = append(lines, DiffLine{Kind: "del", Text: "-" + line})
+		}
+		for _, line := range b {
+			lines = append(lines, DiffLine{Kind: "add", Text: "+" + line})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, DiffLine{Kind: "context", Text: " " + a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, DiffLine{Kind: "add", Text: "+" + b[j]})
+			j++
+		default:
+			lines = append(lines, DiffLine{Kind: "del", Text: "-" + a[i]})
+			i++
+		}
+	}
+	return lines
+}
+
+// elideContext replaces unchanged lines further than diffContext from any
+// change with a hunk marker
+func elideContext(lines []DiffLine) []DiffLine {
+	near := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.Kind == "context" {
+			continue
+		}
+		for k := max(i-diffContext, 0); k <= min(i+diffContext, len(lines)-1); k++ {
+			near[k] = true
+		}
+	}
+
+	var result []DiffLine
+	for i, line := range lines {
+		if near[i] {
+			result = append(result, line)
+		} else if len(result) == 0 || result[len(result)-1].Kind != "hunk" {
+			result = append(result, DiffLine{Kind: "hunk", Text: "@@"})
+		}
+	}
+	return result
+}
+
+// splitLines splits text into lines, without a trailing empty line
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// language describes enough of a programming language to highlight it
+type language struct {
+	keywords     []string
+	lineComments []string
+	blockComment [2]string
+	quotes       string // String delimiters; a backtick may span lines
+}
+
+var (
+	cLike = language{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+	}
+	languages = map[string]language{
+		"go": withKeywords(language{lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`"},
+			"break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false"),
+		"javascript": withKeywords(language{lineComments: []string{"//"}, blockComment: [2]string{"/*", "*/"}, quotes: "\"'`"},
+			"async await break case catch class const continue default delete do else export extends finally for from function if import in instanceof interface let new null of return static super switch this throw true false try type typeof undefined var void while yield"),
+		"python": withKeywords(language{lineComments: []string{"#"}, quotes: `"'`},
+			"and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return True try while with yield"),
+		"shell": withKeywords(language{lineComments: []string{"#"}, quotes: `"'`},
+			"case do done elif else esac export fi for function if in local return then until while"),
+		"rust": withKeywords(cLike,
+			"as async await break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+		"java": withKeywords(cLike,
+			"abstract boolean break case catch class continue default do double else enum extends final finally float for if implements import instanceof int interface long new null package private protected public return static super switch this throw throws true false try void while"),
+		"c": withKeywords(cLike,
+			"auto break case char class const continue default delete do double else enum extern float for if include define inline int long namespace new nullptr private public return short signed sizeof static struct switch template this typedef union unsigned using virtual void while"),
+		"ruby": withKeywords(language{lineComments: []string{"#"}, quotes: `"'`},
+			"begin class def do else elsif end ensure false if module nil require rescue return self then true unless until when while yield"),
+		"json": withKeywords(language{quotes: `"`}, "true false null"),
+	}
+	languageAliases = map[string]string{
+		"go": "go", "golang": "go",
+		"js": "javascript", "jsx": "javascript", "mjs": "javascript", "cjs": "javascript", "javascript": "javascript",
+		"ts": "javascript", "tsx": "javascript", "typescript": "javascript",
+		"py": "python", "python": "python",
+		"sh": "shell", "bash": "shell", "zsh": "shell", "shell": "shell", "console": "shell",
+		"rs": "rust", "rust": "rust",
+		"java": "java", "kt": "java", "kotlin": "java", "scala": "java", "cs": "java", "csharp": "java", "swift": "java",
+		"c": "c", "h": "c", "cc": "c", "cpp": "c", "hpp": "c", "cxx": "c", "c++": "c",
+		"rb": "ruby", "ruby": "ruby",
+		"json": "json",
+	}
+)
+
+func withKeywords(lang language, keywords string) language {
+	lang.keywords = strings.Fields(keywords)
+	return lang
+}
+
+// languageForPath returns the language name for a file path, or "" if unknown
+func languageForPath(filePath string) string {
+	return languageAliases[strings.ToLower(strings.TrimPrefix(path.Ext(filePath), "."))]
+}
+
+// highlight returns code as HTML with keywords, strings, comments and
+// numbers wrapped in spans. Unknown languages are only escaped.
+func highlight(code, languageName string) template.HTML {
+	lang, ok := languages[languageAliases[strings.ToLower(languageName)]]
+	if !ok {
+		return template.HTML(html.EscapeString(code))
+	}
+	keywords := make(map[string]bool, len(lang.keywords))
+	for _, kw := range lang.keywords {
+		keywords[kw] = true
+	}
+
+	var out strings.Builder
+	span := func(class, text string) {
+		out.WriteString(`<span class="hl-` + class + `">` + html.EscapeString(text) + `</span>`)
+	}
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		if open := lang.blockComment[0]; open != "" && strings.HasPrefix(rest, open) {
+			end := strings.Index(rest[len(open):], lang.blockComment[1])
+			if end == -1 {
+				end = len(rest)
+			} else {
+				end += len(open) + len(lang.blockComment[1])
+			}
+			span("com", rest[:end])
+			i += end
+			continue
+		}
+		if lineComment(rest, lang.lineComments) {
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				end = len(rest)
+			}
+			span("com", rest[:end])
+			i += end
+			continue
+		}
+
+		c := rest[0]
+		switch {
+		case strings.IndexByte(lang.quotes, c) != -1:
+			end := 1
+			for end < len(rest) && rest[end] != c && (rest[end] != '\n' || c == '`') {
+				if rest[end] == '\\' && c != '`' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(rest))
+			span("str", rest[:end])
+			i += end
+		case isDigit(c) && (i == 0 || !isIdentByte(code[i-1])):
+			end := 1
+			for end < len(rest) && (isIdentByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			span("num", rest[:end])
+			i += end
+		case isIdentByte(c):
+			end := 1
+			for end < len(rest) && isIdentByte(rest[end]) {
+				end++
+			}
+			if word := rest[:end]; keywords[word] {
+				span("kw", word)
+			} else {
+				out.WriteString(html.EscapeString(word))
+			}
+			i += end
+		default:
+			out.WriteString(html.EscapeString(rest[:1]))
+			i++
+		}
+	}
+	return template.HTML(out.String())
+}
+
+func lineComment(text string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	unorderedPattern = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedPattern   = regexp.MustCompile(`^\s*\d+[.)]\s+(.*)$`)
+	rulePattern      = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	boldPattern      = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern    = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_\s][^_]*)_\b`)
+	linkPattern      = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	safeLinkPattern  = regexp.MustCompile(`^(https?://|mailto:|/|#)`)
+	codeSpanPattern  = regexp.MustCompile("`[^`]+`")
+)
+
+// renderMarkdown renders the Markdown agents write: headings, paragraphs,
+// lists, block quotes, rules, fenced code blocks and inline code, emphasis
+// and links. All text is escaped; raw HTML is shown as text.
+func renderMarkdown(text string) template.HTML {
+	var out strings.Builder
+	var paragraph []string
+	var list string // "ul" or "ol" while inside a list
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(kind string) {
+		if list != kind {
+			closeList()
+			out.WriteString("<" + kind + ">\n")
+			list = kind
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if fence, ok := strings.CutPrefix(trimmed, "```"); ok {
+			flushParagraph()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			lang := strings.Fields(fence + " ")
+			name := ""
+			if len(lang) > 0 {
+				name = lang[0]
+			}
+			out.WriteString(`<pre class="code"><code>` + string(highlight(strings.Join(code, "\n"), name)) + "</code></pre>\n")
+			continue
+		}
+
+		switch m := headingPattern.FindStringSubmatch(trimmed); {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case m != nil:
+			flushParagraph()
+			closeList()
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+		case rulePattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr>\n")
+		case unorderedPattern.MatchString(line):
+			flushParagraph()
+			openList("ul")
+			out.WriteString("<li>" + renderInline(unorderedPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+		case orderedPattern.MatchString(line):
+			flushParagraph()
+			openList("ol")
+			out.WriteString("<li>" + renderInline(orderedPattern.FindStringSubmatch(line)[1]) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			out.WriteString("<blockquote>" + renderInline(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, renderInline(trimmed))
+		}
+	}
+	flushParagraph()
+	closeList()
+	return template.HTML(out.String())
+}
+
+// renderInline escapes a line of Markdown and renders its code spans,
+// emphasis and links
+func renderInline(text string) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range codeSpanPattern.FindAllStringIndex(text, -1) {
+		out.WriteString(renderEmphasis(text[last:loc[0]]))
+		out.WriteString("<code>" + html.EscapeString(text[loc[0]+1:loc[1]-1]) + "</code>")
+		last = loc[1]
+	}
+	out.WriteString(renderEmphasis(text[last:]))
+	return out.String()
+}
+
+// renderEmphasis escapes text and renders its emphasis and links
+func renderEmphasis(text string) string {
+	escaped := html.EscapeString(text)
+	escaped = linkPattern.ReplaceAllStringFunc(escaped, func(match string) string {
+		m := linkPattern.FindStringSubmatch(match)
+		if !safeLinkPattern.MatchString(html.UnescapeString(m[2])) {
+			return match
+		}
+		return `<a href="` + m[2] + `" rel="nofollow noopener">` + m[1] + "</a>"
+	})
+	escaped = boldPattern.ReplaceAllString(escaped, "<strong>$1$2</strong>")
+	return italicPattern.ReplaceAllString(escaped, "<em>$1$2</em>")
+}
@@ -0,0 +1,209 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+func TestLineDiff(t *testing.T) {
+	got := lineDiff("a\nb\nc\n", "a\nB\nc\nd\n")
+	want := []string{" a", "-b", "+B", " c", "+d"}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %v", got, want)
+	}
+	for i, line := range got {
+		if line.Text != want[i] {
+			t.Errorf("line %d = %q, want %q", i, line.Text, want[i])
+		}
+	}
+
+	// Unchanged lines far from the change are elided
+	var old []string
+	for i := range 20 {
+		old = append(old, strings.Repeat("x", i+1))
+	}
+	changed := append([]string{}, old...)
+	changed[10] = "changed"
+	got = lineDiff(strings.Join(old, "\n"), strings.Join(changed, "\n"))
+	if got[0].Kind != "hunk" || got[len(got)-1].Kind != "hunk" || len(got) != 2+2*diffContext+2 {
+		t.Errorf("context not elided: %+v", got)
+	}
+}
+
+func TestToolCallView(t *testing.T) {
+	tests := []struct {
+		name   string
+		tc     model.ToolCall
+		kind   string
+		target string
+	}{
+		{"claude edit", model.ToolCall{Name: "Edit", Arguments: json.RawMessage(`{"file_path":"main.go","old_string":"a","new_string":"b"}`)}, ToolKindEdit, "main.go"},
+		{"amp edit", model.ToolCall{Name: "edit_file", Arguments: json.RawMessage(`{"path":"main.go","old_str":"a","new_str":"b"}`)}, ToolKindEdit, "main.go"},
+		{"bash", model.ToolCall{Name: "Bash", Arguments: json.RawMessage(`{"command":"go test ./...","description":"Run tests"}`)}, ToolKindBash, "go test ./..."},
+		{"read", model.ToolCall{Name: "Read", Arguments: json.RawMessage(`{"file_path":"main.go"}`), Result: "package main"}, ToolKindRead, "main.go"},
+		{"fetch", model.ToolCall{Name: "WebFetch", Arguments: json.RawMessage(`{"url":"https://example.com","prompt":"summarize"}`)}, ToolKindFetch, "https://example.com"},
+		{"unknown", model.ToolCall{Name: "TodoWrite", Arguments: json.RawMessage(`{"todos":[]}`)}, ToolKindOther, ""},
+		{"missing arguments", model.ToolCall{Name: "Bash", Arguments: json.RawMessage(`{}`)}, ToolKindOther, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view := toolCallView(tt.tc)
+			if view.Kind != tt.kind || view.Target != tt.target {
+				t.Errorf("kind %q target %q, want %q %q", view.Kind, view.Target, tt.kind, tt.target)
+			}
+		})
+	}
+
+	multi := toolCallView(model.ToolCall{Name: "MultiEdit", Arguments: json.RawMessage(
+		`{"file_path":"a.txt","edits":[{"old_string":"one","new_string":"1"},{"old_string":"two","new_string":"2"}]}`)})
+	if len(multi.Diff) != 5 || multi.Diff[2].Kind != "hunk" {
+		t.Errorf("multi-edit diff = %+v", multi.Diff)
+	}
+
+	patch := toolCallView(model.ToolCall{Name: "apply_patch", Arguments: json.RawMessage(
+		`{"patch":"*** Begin Patch\n*** Update File: a.txt\n@@\n-one\n+1\n two\n*** End Patch\n"}`)})
+	if patch.Kind != ToolKindEdit || patch.Target != "a.txt" || len(patch.Diff) != 5 || patch.Diff[2].Kind != "del" || patch.Diff[3].Kind != "add" {
+		t.Errorf("patch view = %+v", patch)
+	}
+
+	read := toolCallView(model.ToolCall{Name: "Read", Arguments: json.RawMessage(`{"file_path":"main.go"}`), Result: "func main() {}"})
+	if !strings.Contains(string(read.Code), `<span class="hl-kw">func</span>`) || read.Result != "" {
+		t.Errorf("read not highlighted: %q", read.Code)
+	}
+
+	long := toolCallView(model.ToolCall{Name: "Bash", Arguments: json.RawMessage(`{"command":"ls"}`), Result: strings.Repeat("line\n", collapseResultLines+1)})
+	if !long.Collapsed || long.ResultLines != collapseResultLines+1 {
+		t.Errorf("long result: collapsed %v, %d lines", long.Collapsed, long.ResultLines)
+	}
+}
+
+func TestToolCallView_SnapshotDiff(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo, err := storage.Init(tmpDir)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	path := filepath.Join(tmpDir, "a.txt")
+	os.WriteFile(path, []byte("one\ntwo\n"), 0644)
+	before, err := repo.GitSnapshot()
+	if err != nil {
+		t.Fatalf("GitSnapshot failed: %v", err)
+	}
+	os.WriteFile(path, []byte("one\n2\n"), 0644)
+	after, _ := repo.GitSnapshot()
+
+	edit := model.ToolCall{ID: "edit_1", Name: "Edit", Arguments: json.RawMessage(`{"file_path":"a.txt","old_string":"two","new_string":"2"}`),
+		Snapshot: &model.Snapshot{Before: before, After: after}}
+	msg := model.NewMessage(model.RoleAssistant, "", "", []model.ToolCall{edit})
+	diffs := loadToolDiffs(repo, []model.Message{*msg})
+	files := diffs["edit_1"]
+	if len(files) != 1 || files[0].Path != "a.txt" || files[0].Additions != 1 || files[0].Deletions != 1 {
+		t.Fatalf("tool diffs = %+v", diffs)
+	}
+
+	// The recorded change replaces the one the arguments describe
+	view := toolCallView(edit, files)
+	if len(view.Files) != 1 || view.Diff != nil || view.Target != "a.txt" {
+		t.Errorf("view = %+v", view)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := string(highlight("x := \"<a>\" // done\nreturn 42", "go"))
+	for _, want := range []string{
+		`<span class="hl-str">&#34;&lt;a&gt;&#34;</span>`,
+		`<span class="hl-com">// done</span>`,
+		`<span class="hl-kw">return</span>`,
+		`<span class="hl-num">42</span>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("highlight missing %s in %s", want, got)
+		}
+	}
+	if got := highlight("<b>", "unknown"); got != "&lt;b&gt;" {
+		t.Errorf("unknown language = %q", got)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	got := string(renderMarkdown("# Plan\n\nUse **bold**, *em* and `<code>`.\n\n- one\n- [two](https://example.com)\n\n```go\nfunc f() {}\n```\n\n<script>alert(1)</script> [x](javascript:alert(1))"))
+	for _, want := range []string{
+		"<h1>Plan</h1>",
+		"<strong>bold</strong>",
+		"<em>em</em>",
+		"<code>&lt;code&gt;</code>",
+		"<ul>\n<li>one</li>\n<li><a href=\"https://example.com\" rel=\"nofollow noopener\">two</a></li>\n</ul>",
+		`<pre class="code"><code><span class="hl-kw">func</span> f() {}</code></pre>`,
+		"&lt;script&gt;",
+		"[x](javascript:alert(1))",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("markdown missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestThreadPage_ToolCalls(t *testing.T) {
+	server, repo := newAPITestServer(t)
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "rename the flag", "", nil))
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "Renamed **verbose**", "", []model.ToolCall{
+		{ID: "1", Name: "Edit", Arguments: json.RawMessage(`{"file_path":"main.go","old_string":"verbose","new_string":"debug"}`)},
+	}))
+	commitThread(t, repo, thread, "rename")
+
+	resp, err := http.Get(server.URL + "/repo/team/proj.tin/thread/" + thread.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{`<span class="diff-del">-verbose</span>`, `<span class="diff-add">&#43;debug</span>`, "<strong>verbose</strong>"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("thread page missing %s", want)
+		}
+	}
+}
+
+func TestThreadPage_Subagents(t *testing.T) {
+	server, repo := newAPITestServer(t)
+	thread := model.NewThread("claude-code", "sess", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "review the code", "", nil))
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "", "", []model.ToolCall{
+		{ID: "task_1", Name: "Task", Arguments: json.RawMessage(`{"prompt":"Check the API"}`)},
+	}))
+	child := model.NewThread("claude-code", "", thread.ID, thread.Messages[1].ID)
+	child.ParentToolCallID = "task_1"
+	child.AddMessage(model.NewMessage(model.RoleHuman, "Check the API", "", nil))
+	commitThread(t, repo, thread, "review")
+	commitThread(t, repo, child, "subagent")
+
+	get := func(id string) string {
+		resp, err := http.Get(server.URL + "/repo/team/proj.tin/thread/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	parentPage := get(thread.ID)
+	if !strings.Contains(parentPage, `href="/repo/team/proj.tin/thread/`+child.ID+`" class="continuation-link">`) {
+		t.Error("parent thread page does not link the subagent")
+	}
+	if strings.Contains(parentPage, "Continued in") {
+		t.Error("subagent listed as a continuation")
+	}
+	if childPage := get(child.ID); !strings.Contains(childPage, "Subagent of:") || !strings.Contains(childPage, "#msg-"+thread.Messages[1].ID) {
+		t.Error("subagent thread page does not link its launching message")
+	}
+}
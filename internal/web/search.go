@@ -0,0 +1,251 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sestinj/tin/internal/model"
+	"github.com/sestinj/tin/internal/storage"
+)
+
+// Search result kinds
+const (
+	SearchKindCommit   = "commit"
+	SearchKindMessage  = "message"
+	SearchKindToolCall = "tool_call"
+	SearchKindFile     = "file"
+)
+
+// snippetContext is how many bytes of context are kept on each side of a match
+const snippetContext = 60
+
+// maxSearchPageResults bounds the results shown on the search page
+const maxSearchPageResults = 100
+
+// fileArgumentKeys are the tool call arguments that name files the tool
+// reads or writes, across the agents tin captures
+var fileArgumentKeys = map[string]bool{
+	"file_path":     true,
+	"filePath":      true,
+	"path":          true,
+	"notebook_path": true,
+	"target_file":   true,
+}
+
+// SearchResult is a single match in a repository
+type SearchResult struct {
+	Repo      string `json:"repo"`
+	Kind      string `json:"kind"`
+	CommitID  string `json:"commit_id,omitempty"`
+	ThreadID  string `json:"thread_id,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	ToolName  string `json:"tool_name,omitempty"`
+	FilePath  string `json:"file_path,omitempty"`
+	Snippet   string `json:"snippet"`
+	URL       string `json:"url"` // web viewer page of the match, anchored to the message
+}
+
+// SearchPageData contains data for the search page
+type SearchPageData struct {
+	Title    string
+	Query    string
+	RepoPath string // Repository searched; empty for all
+	RepoName string
+	Results  []SearchResult
+	Limited  bool // True if there were more results than shown
+	Error    string
+}
+
+// handleSearch shows the search form and results
+func (s *WebServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := SearchPageData{
+		Title:    "Search",
+		Query:    strings.TrimSpace(query.Get("q")),
+		RepoPath: strings.Trim(query.Get("repo"), "/"),
+	}
+	if data.RepoPath != "" {
+		data.RepoName = displayRepoName(data.RepoPath)
+	}
+
+	status := http.StatusOK
+	if data.Query != "" {
+		results, err := s.search(r, data.Query, data.RepoPath, maxSearchPageResults+1)
+		if err == storage.ErrNotARepository {
+			status = http.StatusNotFound
+			data.Error = "Repository not found"
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(results) > maxSearchPageResults {
+			results = results[:maxSearchPageResults]
+			data.Limited = true
+		}
+		data.Results = results
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := renderTemplate(w, "search.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// search returns up to limit matches of query in the given repository, or
+// in every repository under the root that the request's user can read
+func (s *WebServer) search(r *http.Request, query, repoPath string, limit int) ([]SearchResult, error) {
+	var repoPaths []string
+	if repoPath = strings.Trim(repoPath, "/"); repoPath != "" {
+		repoPaths = []string{repoPath}
+	} else {
+		repos, err := DiscoverRepos(s.rootPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range s.readableRepos(r, repos) {
+			repoPaths = append(repoPaths, filepath.ToSlash(info.Path))
+		}
+	}
+
+	var results []SearchResult
+	for _, path := range repoPaths {
+		repo, err := s.openReadableRepo(r, path)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, searchRepo(repo, path, query, limit-len(results))...)
+		if len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// searchRepo returns up to limit case-insensitive matches of query in the
+// repository's commit messages and the latest version of its threads: message
+// content, tool calls and the files tool calls touched
+func searchRepo(repo *storage.Repository, repoPath, query string, limit int) []SearchResult {
+	var results []SearchResult
+	if limit <= 0 {
+		return results
+	}
+	needle := strings.ToLower(query)
+	add := func(result SearchResult, cursor string) bool {
+		result.Repo = repoPath
+		if result.ThreadID != "" {
+			result.URL = "/repo/" + repoPath + "/thread/" + result.ThreadID
+			if cursor != "" {
+				result.URL += "?cursor=" + url.QueryEscape(cursor)
+			}
+			result.URL += "#msg-" + result.MessageID
+		} else {
+			result.URL = "/repo/" + repoPath + "/commit/" + result.CommitID
+		}
+		results = append(results, result)
+		return len(results) >= limit
+	}
+
+	commits, _ := repo.ListCommits()
+	for _, commit := range commits {
+		if snippet, ok := matchSnippet(commit.Message, needle); ok {
+			if add(SearchResult{Kind: SearchKindCommit, CommitID: commit.ID, Snippet: snippet}, "") {
+				return results
+			}
+		}
+	}
+
+	threads, _ := repo.ListThreads()
+	for _, thread := range threads {
+		for i, msg := range thread.Messages {
+			// Link to the page of the thread the message is on
+			cursor := messageCursor(thread.Messages, i)
+			if snippet, ok := matchSnippet(msg.Content, needle); ok {
+				if add(SearchResult{Kind: SearchKindMessage, ThreadID: thread.ID, MessageID: msg.ID, Snippet: snippet}, cursor) {
+					return results
+				}
+			}
+			for _, tc := range msg.ToolCalls {
+				if result, ok := matchToolCall(tc, needle); ok {
+					result.ThreadID, result.MessageID = thread.ID, msg.ID
+					if add(result, cursor) {
+						return results
+					}
+				}
+			}
+		}
+	}
+	return results
+}
+
+// matchToolCall matches a tool call by the files it touched, or else by its
+// name, arguments and result
+func matchToolCall(tc model.ToolCall, needle string) (SearchResult, bool) {
+	for _, path := range toolCallFilePaths(tc) {
+		if strings.Contains(strings.ToLower(path), needle) {
+			return SearchResult{Kind: SearchKindFile, ToolName: tc.Name, FilePath: path, Snippet: tc.Name + " " + path}, true
+		}
+	}
+	for _, text := range []string{tc.Name, string(tc.Arguments), tc.Result} {
+		if snippet, ok := matchSnippet(text, needle); ok {
+			return SearchResult{Kind: SearchKindToolCall, ToolName: tc.Name, Snippet: snippet}, true
+		}
+	}
+	return SearchResult{}, false
+}
+
+// toolCallFilePaths returns the file paths named in a tool call's arguments
+func toolCallFilePaths(tc model.ToolCall) []string {
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal(tc.Arguments, &args); err != nil {
+		return nil
+	}
+	var paths []string
+	for key, raw := range args {
+		if !fileArgumentKeys[key] {
+			continue
+		}
+		var path string
+		if err := json.Unmarshal(raw, &path); err == nil && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// matchSnippet reports whether text contains the lowercase needle and returns
+// the match with some surrounding context
+func matchSnippet(text, needle string) (string, bool) {
+	idx := strings.Index(strings.ToLower(text), needle)
+	if idx == -1 {
+		return "", false
+	}
+	// Lowercasing can change byte lengths; fall back to the start of the text
+	if idx+len(needle) > len(text) {
+		idx = 0
+	}
+
+	start := max(idx-snippetContext, 0)
+	end := min(idx+len(needle)+snippetContext, len(text))
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+
+	snippet := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(text) {
+		snippet += "..."
+	}
+	return snippet, true
+}
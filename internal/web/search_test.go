@@ -0,0 +1,100 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sestinj/tin/internal/model"
+)
+
+func TestSearchRepo_ToolCallsAndFiles(t *testing.T) {
+	_, repo := newAPITestServer(t)
+
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "fix the session timeout", "", nil))
+	thread.AddMessage(model.NewMessage(model.RoleAssistant, "Updating the config", "", []model.ToolCall{
+		{ID: "1", Name: "Edit", Arguments: json.RawMessage(`{"file_path":"internal/auth/Session.go","old_string":"a","new_string":"b"}`)},
+		{ID: "2", Name: "Bash", Arguments: json.RawMessage(`{"command":"go test ./internal/auth"}`), Result: "FAIL: TestSessionExpiry"},
+	}))
+	commitThread(t, repo, thread, "Shorten idle sessions")
+	msgID := thread.Messages[1].ID
+
+	tests := []struct {
+		query string
+		want  []SearchResult
+	}{
+		{"session.go", []SearchResult{
+			{Kind: SearchKindFile, ThreadID: thread.ID, MessageID: msgID, ToolName: "Edit", FilePath: "internal/auth/Session.go"},
+		}},
+		{"TestSessionExpiry", []SearchResult{
+			{Kind: SearchKindToolCall, ThreadID: thread.ID, MessageID: msgID, ToolName: "Bash"},
+		}},
+		{"session", []SearchResult{
+			{Kind: SearchKindCommit},
+			{Kind: SearchKindMessage, ThreadID: thread.ID, MessageID: thread.Messages[0].ID},
+			{Kind: SearchKindFile, ThreadID: thread.ID, MessageID: msgID, ToolName: "Edit", FilePath: "internal/auth/Session.go"},
+			{Kind: SearchKindToolCall, ThreadID: thread.ID, MessageID: msgID, ToolName: "Bash"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := searchRepo(repo, "team/proj.tin", tt.query, 10)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d results, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				r := got[i]
+				if r.Kind != want.Kind || r.ThreadID != want.ThreadID || r.MessageID != want.MessageID ||
+					r.ToolName != want.ToolName || r.FilePath != want.FilePath {
+					t.Errorf("result %d = %+v, want %+v", i, r, want)
+				}
+			}
+		})
+	}
+
+	if got := searchRepo(repo, "team/proj.tin", "session", 2); len(got) != 2 {
+		t.Errorf("limit not applied: %d results", len(got))
+	}
+	if got := searchRepo(repo, "team/proj.tin", "session.go", 1); got[0].URL != "/repo/team/proj.tin/thread/"+thread.ID+"#msg-"+msgID {
+		t.Errorf("URL = %q", got[0].URL)
+	}
+}
+
+func TestSearchPage(t *testing.T) {
+	server, repo := newAPITestServer(t)
+	thread := model.NewThread("claude-code", "", "", "")
+	thread.AddMessage(model.NewMessage(model.RoleHuman, "why did we pick postgres?", "", nil))
+	commitThread(t, repo, thread, "Database choice")
+
+	fetch := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := fetch("/search?q=Postgres")
+	if status != http.StatusOK || !strings.Contains(body, `href="/repo/team/proj.tin/thread/`+thread.ID+`#msg-`+thread.Messages[0].ID+`"`) {
+		t.Errorf("search page missing deep link (status %d):\n%s", status, body)
+	}
+
+	status, body = fetch("/search?q=nothing-matches&repo=team/proj.tin")
+	if status != http.StatusOK || !strings.Contains(body, "No results") {
+		t.Errorf("expected empty results page, got %d", status)
+	}
+
+	if status, _ := fetch("/search?q=x&repo=missing.tin"); status != http.StatusNotFound {
+		t.Errorf("missing repo status = %d, want 404", status)
+	}
+
+	_, body = fetch("/repo/team/proj.tin/thread/" + thread.ID)
+	if !strings.Contains(body, `id="msg-`+thread.Messages[0].ID+`"`) {
+		t.Error("thread page has no message anchors")
+	}
+}
@@ -1,10 +1,14 @@
 package web
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"path/filepath"
+
+	"github.com/sestinj/tin/internal/remote"
 )
 
 // WebServer serves the HTML web viewer for tin repositories
@@ -12,6 +16,13 @@ type WebServer struct {
 	host     string
 	port     int
 	rootPath string
+	auth     remote.AuthValidator // nil means no login is required
+	certs    remote.CertValidator // maps verified client certificates to users
+	acl      *remote.ACL          // limits which repositories users may read
+	protocol http.Handler         // push/pull handler sharing the listener, if any
+	tls      *tls.Config          // serve HTTPS if set
+	sessions *sessionStore
+	index    *indexCache
 }
 
 // NewWebServer creates a new web server instance
@@ -21,20 +32,78 @@ func NewWebServer(host string, port int, rootPath string) *WebServer {
 		host:     host,
 		port:     port,
 		rootPath: absPath,
+		sessions: newSessionStore(),
+		index:    newIndexCache(),
 	}
 }
 
-// Start starts the HTTP server
-func (s *WebServer) Start() error {
+// SetAuthValidator requires users to sign in, or to send Basic Auth
+// credentials, before viewing anything. API tokens are accepted as passwords.
+func (s *WebServer) SetAuthValidator(auth remote.AuthValidator) {
+	s.auth = auth
+}
+
+// SetCertValidator identifies users presenting a verified TLS client
+// certificate by that certificate
+func (s *WebServer) SetCertValidator(certs remote.CertValidator) {
+	s.certs = certs
+}
+
+// SetTLS makes Start serve HTTPS. If certs is non-nil, verified client
+// certificates identify users, as with SetCertValidator.
+func (s *WebServer) SetTLS(cfg *tls.Config, certs remote.CertValidator) {
+	s.tls = cfg
+	s.certs = certs
+}
+
+// SetACL hides repositories the user has no read permission on
+func (s *WebServer) SetACL(acl *remote.ACL) {
+	s.acl = acl
+}
+
+// SetProtocolHandler serves push/pull requests on the same listener as the
+// web viewer
+func (s *WebServer) SetProtocolHandler(protocol http.Handler) {
+	s.protocol = protocol
+}
+
+// Handler returns the HTTP handler serving the web viewer and its JSON API
+func (s *WebServer) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.Handle("/assets/", http.StripPrefix("/assets/", serveAssets()))
 	mux.HandleFunc("/", s.handleIndex)
 	mux.HandleFunc("/repo/", s.handleRepo)
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/api/v1/", s.handleAPI)
+	mux.HandleFunc("/login", s.handleLogin)
+	mux.HandleFunc("/logout", s.handleLogout)
+
+	return s.requireAuth(mux)
+}
 
+// Start starts the HTTP server
+func (s *WebServer) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.host, s.port)
-	log.Printf("Tin web server listening on http://%s", addr)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.tls != nil {
+		log.Printf("Tin web server listening on https://%s", addr)
+	} else {
+		log.Printf("Tin web server listening on http://%s", addr)
+	}
 	log.Printf("Serving repositories under: %s", s.rootPath)
 
-	return http.ListenAndServe(addr, mux)
+	return s.Serve(listener)
+}
+
+// Serve serves the web viewer on an existing listener, over TLS if SetTLS
+// was called
+func (s *WebServer) Serve(listener net.Listener) error {
+	if s.tls != nil {
+		listener = tls.NewListener(listener, s.tls)
+	}
+	return http.Serve(listener, s.Handler())
 }
@@ -30,6 +30,8 @@ func init() {
 		"isMergeCommit":   isMergeCommit,
 		"agentIconPath":   agentIconPath,
 		"agentIconClass":  agentIconClass,
+		"toolCallView":    toolCallView,
+		"markdown":        renderMarkdown,
 	}
 
 	templates = template.Must(template.New("").